@@ -1,6 +1,7 @@
 package alertmanager
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -9,7 +10,13 @@ import (
 	"github.piwriw.go-tools/pkg/alertmanager/dingtalk"
 	"github.piwriw.go-tools/pkg/alertmanager/email"
 	"github.piwriw.go-tools/pkg/alertmanager/lark"
+	"github.piwriw.go-tools/pkg/alertmanager/oncall"
 	"github.piwriw.go-tools/pkg/alertmanager/script"
+	"github.piwriw.go-tools/pkg/alertmanager/slack"
+	"github.piwriw.go-tools/pkg/alertmanager/teams"
+	"github.piwriw.go-tools/pkg/alertmanager/telegram"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+	"github.piwriw.go-tools/pkg/alertmanager/webhook"
 	"github.piwriw.go-tools/pkg/alertmanager/wechat"
 	"github.piwriw.go-tools/pkg/httputil"
 )
@@ -18,9 +25,27 @@ type Option func(*AlertStrategyManager)
 
 type AlertStrategyManager struct {
 	strategies map[string]common.AlertMethod
+	contexts   map[string]common.ContextFactory
 	LimitFunc  common.LimitOption
 	beforeHook common.HookFunc
 	afterHook  common.HookFunc
+	templates  *tmpl.Templates
+	onCall     *oncall.OnCall
+}
+
+// defaultTemplates 内置告警方式默认使用的模板名称
+var defaultTemplates = []string{
+	email.DefaultTemplate,
+	email.DefaultSubjectTemplate,
+	wechat.DefaultTemplate,
+	wechat.DefaultAppTemplate,
+	dingtalk.DefaultTemplate,
+	script.DefaultTemplate,
+	lark.DefaultTemplate,
+	webhook.DefaultTemplate,
+	slack.DefaultTemplate,
+	teams.DefaultTemplate,
+	telegram.DefaultTemplate,
 }
 
 // WithGlobalHook 设置全局 Hook
@@ -38,13 +63,114 @@ func WithGlobalLimit(limitFunc common.LimitOption) Option {
 	}
 }
 
+// WithTemplates 设置内置告警方式使用的消息模板
+// 各告警方式使用 DefaultTemplate 名称的模板，接收者可以通过上下文中的 template 字段覆盖
+func WithTemplates(templates *tmpl.Templates) Option {
+	return func(manager *AlertStrategyManager) {
+		manager.templates = templates
+	}
+}
+
+// WithOnCall 发送时将 users 中的 oncall:<值班表> 替换为值班表当前的值班人员
+func WithOnCall(onCall *oncall.OnCall) Option {
+	return func(manager *AlertStrategyManager) {
+		manager.onCall = onCall
+	}
+}
+
 // registerStrategies 统一注册所有告警策略
 func (manager *AlertStrategyManager) registerStrategies(client *http.Client) {
-	manager.strategies[common.MethodEmail] = &email.EmailAlert{}
-	manager.strategies[common.MethodWechat] = &wechat.WechatAlert{Client: client}
-	manager.strategies[common.MethodDingtalk] = &dingtalk.DingtalkAlert{Client: client}
-	manager.strategies[common.MethodScript] = &script.ScriptAlert{Client: client}
-	manager.strategies[common.MethodLark] = &lark.LarkAlert{Client: client}
+	manager.strategies[common.MethodEmail] = &email.EmailAlert{Templates: manager.templates}
+	manager.strategies[common.MethodWechat] = &wechat.WechatAlert{Client: client, Templates: manager.templates}
+	manager.strategies[common.MethodWechatApp] = &wechat.WechatAppAlert{Client: client, Templates: manager.templates}
+	manager.strategies[common.MethodDingtalk] = &dingtalk.DingtalkAlert{Client: client, Templates: manager.templates}
+	// 默认的脚本策略没有白名单，拒绝执行所有脚本，需要通过 RegisterStrategy 注册配置了 AllowedScripts 的 ScriptAlert
+	manager.strategies[common.MethodScript] = &script.ScriptAlert{Client: client, Templates: manager.templates}
+	manager.strategies[common.MethodLark] = &lark.LarkAlert{Client: client, Templates: manager.templates}
+	manager.strategies[common.MethodWebhook] = &webhook.WebhookAlert{Client: client, Templates: manager.templates}
+	manager.strategies[common.MethodSlack] = &slack.SlackAlert{Client: client, Templates: manager.templates}
+	manager.strategies[common.MethodTeams] = &teams.TeamsAlert{Client: client, Templates: manager.templates}
+	manager.strategies[common.MethodTelegram] = &telegram.TelegramAlert{Client: client, Templates: manager.templates}
+
+	manager.contexts[common.MethodEmail] = jsonContext(func(msg common.CustomMsg) *email.EmailAlertContext {
+		return &email.EmailAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodWechat] = jsonContext(func(msg common.CustomMsg) *wechat.WechatAlertContext {
+		return &wechat.WechatAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodWechatApp] = jsonContext(func(msg common.CustomMsg) *wechat.WechatAppAlertContext {
+		return &wechat.WechatAppAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodDingtalk] = jsonContext(func(msg common.CustomMsg) *dingtalk.DingtalkAlertContext {
+		return &dingtalk.DingtalkAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodScript] = jsonContext(func(msg common.CustomMsg) *script.ScriptAlertContext {
+		return &script.ScriptAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodLark] = jsonContext(func(msg common.CustomMsg) *lark.LarkAlertContext {
+		return &lark.LarkAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodWebhook] = jsonContext(func(msg common.CustomMsg) *webhook.WebhookAlertContext {
+		return &webhook.WebhookAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodSlack] = jsonContext(func(msg common.CustomMsg) *slack.SlackAlertContext {
+		return &slack.SlackAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodTeams] = jsonContext(func(msg common.CustomMsg) *teams.TeamsAlertContext {
+		return &teams.TeamsAlertContext{Message: msg}
+	})
+	manager.contexts[common.MethodTelegram] = jsonContext(func(msg common.CustomMsg) *telegram.TelegramAlertContext {
+		return &telegram.TelegramAlertContext{Message: msg}
+	})
+}
+
+// jsonContext 创建告警上下文后，将接收者配置按 json tag 解析到上下文中
+func jsonContext[C common.AlertContext](newContext func(msg common.CustomMsg) C) common.ContextFactory {
+	return func(msg common.CustomMsg, config json.RawMessage) (common.AlertContext, error) {
+		c := newContext(msg)
+		if len(config) > 0 {
+			if err := json.Unmarshal(config, c); err != nil {
+				return nil, fmt.Errorf("[alert]:parse %s config failed: %w", c.GetMethod(), err)
+			}
+		}
+		return c, nil
+	}
+}
+
+// RegisterContextFactory 注册告警方式的上下文工厂，WebhookServer 通过它根据接收者配置创建告警上下文
+func (manager *AlertStrategyManager) RegisterContextFactory(methodName string, factory common.ContextFactory) {
+	manager.contexts[methodName] = factory
+}
+
+// NewAlertContext 使用注册的上下文工厂创建告警上下文
+func (manager *AlertStrategyManager) NewAlertContext(method string, msg common.CustomMsg, config json.RawMessage) (common.AlertContext, error) {
+	factory, exists := manager.contexts[method]
+	if !exists {
+		return nil, fmt.Errorf("[alert]:context factory of method %s not found", method)
+	}
+	return factory(msg, config)
+}
+
+// ValidateTemplates 校验已加载的默认模板和 names 指定的模板都可以正常渲染
+func (manager *AlertStrategyManager) ValidateTemplates(names ...string) error {
+	if manager.templates == nil {
+		if len(names) > 0 {
+			return fmt.Errorf("[alert]:templates %v are configured but no templates are loaded", names)
+		}
+		return nil
+	}
+	for _, name := range defaultTemplates {
+		if manager.templates.Has(name) {
+			names = append(names, name)
+		}
+	}
+	return manager.templates.Validate(names...)
+}
+
+// HasMethod 判断告警方式是否已经注册
+func (manager *AlertStrategyManager) HasMethod(method string) bool {
+	_, exists := manager.strategies[method]
+	return exists
 }
 
 // RegisterStrategy 统一注册所有告警策略
@@ -71,14 +197,15 @@ func (manager *AlertStrategyManager) EnableLimit() bool {
 func NewAlertStrategyManager(options ...Option) *AlertStrategyManager {
 	manager := &AlertStrategyManager{
 		strategies: make(map[string]common.AlertMethod),
+		contexts:   make(map[string]common.ContextFactory),
 	}
 
-	client := http.NewHTTPClient()
-	// 注册所有告警策略
-	manager.registerStrategies(client)
 	for _, option := range options {
 		option(manager)
 	}
+	client := http.NewHTTPClient()
+	// 注册所有告警策略
+	manager.registerStrategies(client)
 	return manager
 }
 
@@ -102,6 +229,13 @@ func (manager *AlertStrategyManager) Execute(method string, c common.AlertContex
 	if !exists {
 		return errors.New(fmt.Sprintf("method %s not found", method))
 	}
+	if manager.onCall != nil {
+		resolved, err := manager.onCall.ResolveUsers(users)
+		if err != nil {
+			return err
+		}
+		users = resolved
+	}
 	// 执行前钩子
 	if err := manager.before(c); err != nil {
 		return err
@@ -7,8 +7,11 @@ import (
 
 	"github.com/prometheus/alertmanager/notify/webhook"
 	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.piwriw.go-tools/pkg/alertmanager/common"
 	"github.piwriw.go-tools/pkg/alertmanager/lark"
+	"github.piwriw.go-tools/pkg/alertmanager/oncall"
 )
 
 func TestName(t *testing.T) {
@@ -71,3 +74,33 @@ func TestName(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// TestAlertStrategyManagerOnCall 测试发送时将 oncall:<值班表> 替换为当前的值班人员
+func TestAlertStrategyManagerOnCall(t *testing.T) {
+	cfg, err := oncall.Parse([]byte(`
+schedules:
+  - name: primary
+    layers:
+      - users: [zhangsan, lisi]
+        handoff: daily
+        start: 2024-01-01T09:00:00Z
+`))
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	oc, err := oncall.New(cfg, nil, oncall.WithNow(func() time.Time { return now }))
+	require.NoError(t, err)
+
+	a := &recordAlert{}
+	manager := NewAlertStrategyManager(WithOnCall(oc))
+	manager.RegisterStrategy("a", a)
+	c := &lark.LarkAlertContext{}
+	require.NoError(t, manager.Execute("a", c, []string{"oncall:primary", "ops"}))
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, manager.Execute("a", c, []string{"oncall:primary"}))
+	assert.ErrorContains(t, manager.Execute("a", c, []string{"oncall:none"}), "schedule none not found")
+
+	calls := a.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, []string{"lisi", "ops"}, calls[0].users)
+	assert.Equal(t, []string{"zhangsan"}, calls[1].users)
+}
@@ -1,6 +1,30 @@
 package common
 
+import "encoding/json"
+
 // AlertContext 告警上下文接口，不同策略有不同的上下文
 type AlertContext interface {
 	GetMethod() string
 }
+
+// ContextFactory 根据告警消息和接收者的配置创建告警上下文
+// config 为接收者配置中该告警方式的 JSON 配置，例如 {"title":"...","webhook":"..."}
+type ContextFactory func(msg CustomMsg, config json.RawMessage) (AlertContext, error)
+
+// TemplateContext 支持按接收者覆盖消息模板的告警上下文
+type TemplateContext interface {
+	AlertContext
+	// TemplateNames 返回接收者配置的模板名称，用于启动时校验模板
+	TemplateNames() []string
+}
+
+// NonEmpty 过滤空的模板名称
+func NonEmpty(names ...string) []string {
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != "" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
@@ -1,7 +1,60 @@
 package common
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
 const (
 	AlertStatusFiring   = "活跃"
 	AlertStatusResolved = "恢复"
 )
 const AlertFormat = "[%sAlert告警信息] \n类型：%s \n实例名称：%s \nIP：%s \n告警名称：%s \n告警级别：%s \n告警详情：%s \n开始时间：%s"
+
+// StatusText 返回告警状态的中文描述
+func StatusText(status string) string {
+	if status == "resolved" {
+		return AlertStatusResolved
+	}
+	return AlertStatusFiring
+}
+
+// AlertSummary 返回告警的描述，依次使用 summary、description 注解，都没有时返回告警名称
+func AlertSummary(alert template.Alert) string {
+	for _, name := range []string{"summary", "description"} {
+		if v := alert.Annotations[name]; v != "" {
+			return v
+		}
+	}
+	return alert.Labels["alertname"]
+}
+
+// AlertCategory 返回告警 category 标签按 "." 分割后的第二段，例如 host.cpu 返回 cpu
+// 标签不包含 "." 时原样返回，没有该标签时返回空字符串
+func AlertCategory(alert template.Alert) string {
+	category := alert.Labels["category"]
+	if parts := strings.Split(category, "."); len(parts) > 1 {
+		return parts[1]
+	}
+	return category
+}
+
+// AlertMarkdown 生成告警消息的 Markdown 文本，用于 Markdown 和卡片类型的消息
+func AlertMarkdown(title string, data *template.Data) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### [%s] %s %d 条告警\n", title, StatusText(data.Status), len(data.Alerts))
+	for _, alert := range data.Alerts {
+		fmt.Fprintf(&b, "\n**%s** %s\n\n", alert.Labels["alertname"], AlertSummary(alert))
+		fmt.Fprintf(&b, "- 状态：%s\n", StatusText(alert.Status))
+		if severity := alert.Labels["severity"]; severity != "" {
+			fmt.Fprintf(&b, "- 级别：%s\n", severity)
+		}
+		if instance := alert.Labels["instance"]; instance != "" {
+			fmt.Fprintf(&b, "- 实例：%s\n", instance)
+		}
+		fmt.Fprintf(&b, "- 开始时间：%s\n", alert.StartsAt.Format("2006-01-02 15:04:05"))
+	}
+	return b.String()
+}
@@ -1,8 +1,69 @@
 package common
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/alertmanager/template"
+)
 
 var ErrorBeforeHook = errors.New("[alert]:before hook is failed")
 var ErrorAfterHook = errors.New("[alert]:after hook is failed")
 var ErrorSameMethod = errors.New("[alert]:same alert method name")
 var ErrorNilLimitFunc = errors.New("[alert]:limitFunc is nil")
+
+// ErrorLimited 告警被限流，使用 errors.Is 判断
+var ErrorLimited = errors.New("[alert]:alert is limited")
+
+// LimitedError 被限流没有发送的告警，告警方式被限流时返回，调用方可以通过 LimitedAlerts 取出告警上报
+type LimitedError struct {
+	Alerts template.Alerts
+}
+
+// NewLimitedError 创建限流错误，alerts 为被限流的告警
+func NewLimitedError(alerts template.Alerts) *LimitedError {
+	return &LimitedError{Alerts: alerts}
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("%s: %d alerts dropped", ErrorLimited, len(e.Alerts))
+}
+
+func (e *LimitedError) Unwrap() error {
+	return ErrorLimited
+}
+
+// LimitedAlerts 返回 err 中所有被限流的告警，包括 errors.Join 合并的错误
+func LimitedAlerts(err error) template.Alerts {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *LimitedError:
+		return e.Alerts
+	case interface{ Unwrap() []error }:
+		var res template.Alerts
+		for _, err := range e.Unwrap() {
+			res = append(res, LimitedAlerts(err)...)
+		}
+		return res
+	case interface{ Unwrap() error }:
+		return LimitedAlerts(e.Unwrap())
+	}
+	return nil
+}
+
+// IsLimited 判断 err 是否只包含限流错误，包括 errors.Join 合并的错误
+// 合并的错误中还有其他失败时返回 false，调用方仍需按失败处理
+func IsLimited(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		for _, err := range errs {
+			if !IsLimited(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	var limitedErr *LimitedError
+	return errors.As(err, &limitedErr)
+}
@@ -1,7 +1,44 @@
 package common
 
-import "github.com/prometheus/alertmanager/notify/webhook"
+import (
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+)
 
 type CustomMsg struct {
 	webhook.Message
 }
+
+// WithAlerts 构造只包含部分告警的消息，重新计算状态和公共标签，alerts 不能为空
+func (m CustomMsg) WithAlerts(alerts []template.Alert) CustomMsg {
+	data := *m.Data
+	data.Alerts = alerts
+	data.Status = "resolved"
+	for _, alert := range alerts {
+		if alert.Status == "firing" {
+			data.Status = "firing"
+			break
+		}
+	}
+	data.CommonLabels = CommonKV(alerts, func(a template.Alert) template.KV { return a.Labels })
+	data.CommonAnnotations = CommonKV(alerts, func(a template.Alert) template.KV { return a.Annotations })
+	m.Data = &data
+	return m
+}
+
+// CommonKV 返回所有告警都相同的键值，用于计算 CommonLabels 和 CommonAnnotations，alerts 不能为空
+func CommonKV(alerts []template.Alert, kv func(template.Alert) template.KV) template.KV {
+	res := template.KV{}
+	for name, value := range kv(alerts[0]) {
+		res[name] = value
+	}
+	for _, alert := range alerts[1:] {
+		values := kv(alert)
+		for name, value := range res {
+			if values[name] != value {
+				delete(res, name)
+			}
+		}
+	}
+	return res
+}
@@ -1,9 +1,27 @@
 package common
 
 const (
-	MethodScript   = "script"
-	MethodEmail    = "email"
-	MethodWechat   = "wechat"
-	MethodDingtalk = "dingtalk"
-	MethodLark     = "lark"
+	MethodScript    = "script"
+	MethodEmail     = "email"
+	MethodWechat    = "wechat"
+	MethodDingtalk  = "dingtalk"
+	MethodLark      = "lark"
+	MethodWebhook   = "webhook"
+	MethodSlack     = "slack"
+	MethodTeams     = "teams"
+	MethodTelegram  = "telegram"
+	MethodWechatApp = "wechat_app"
+)
+
+// 告警消息类型，支持的类型由告警方式决定
+const (
+	MsgTypeText     = "text"
+	MsgTypeMarkdown = "markdown"
+	MsgTypeCard     = "card"
+)
+
+// 接收告警的用户 users 的类型，用于 @ 用户
+const (
+	MentionByMobile = "mobile"
+	MentionByUserID = "user_id"
 )
@@ -0,0 +1,118 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// WebhookConfig Webhook 接收服务的路由配置，描述 Alertmanager 的 receiver 发送给哪些告警方式和用户
+//
+//	default_receiver: ops
+//	receivers:
+//	  - name: ops
+//	    targets:
+//	      - method: lark
+//	        users: ["zhangsan"]
+//	        config:
+//	          title: 生产环境
+//	          webhook: https://open.feishu.cn/open-apis/bot/v2/hook/xxx
+type WebhookConfig struct {
+	// DefaultReceiver 未匹配到 receiver 时使用的接收者，为空时返回 404
+	DefaultReceiver string     `json:"default_receiver,omitempty"`
+	Receivers       []Receiver `json:"receivers"`
+}
+
+// Receiver 与 Alertmanager 配置中 receiver 名称对应的接收者
+type Receiver struct {
+	Name    string           `json:"name"`
+	Targets []ReceiverTarget `json:"targets"`
+}
+
+// ReceiverTarget 接收者的一个告警方式
+type ReceiverTarget struct {
+	// Method 告警方式，对应 AlertStrategyManager 中注册的名称
+	Method string   `json:"method"`
+	Users  []string `json:"users,omitempty"`
+	// Config 告警方式的配置，按告警上下文的 json tag 解析
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// LoadWebhookConfig 从 YAML 或 JSON 文件加载路由配置
+func LoadWebhookConfig(path string) (*WebhookConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWebhookConfig(data)
+}
+
+// ParseWebhookConfig 解析 YAML 或 JSON 格式的路由配置
+func ParseWebhookConfig(data []byte) (*WebhookConfig, error) {
+	cfg := &WebhookConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("[alert]:parse webhook config failed: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 校验 receiver 名称唯一、每个 receiver 至少有一个告警方式
+func (c *WebhookConfig) Validate() error {
+	names := make(map[string]struct{}, len(c.Receivers))
+	for _, receiver := range c.Receivers {
+		if receiver.Name == "" {
+			return errors.New("[alert]:receiver name is empty")
+		}
+		if _, ok := names[receiver.Name]; ok {
+			return fmt.Errorf("[alert]:receiver %s is duplicated", receiver.Name)
+		}
+		names[receiver.Name] = struct{}{}
+		if len(receiver.Targets) == 0 {
+			return fmt.Errorf("[alert]:receiver %s has no targets", receiver.Name)
+		}
+		for _, target := range receiver.Targets {
+			if target.Method == "" {
+				return fmt.Errorf("[alert]:receiver %s has target without method", receiver.Name)
+			}
+		}
+	}
+	if c.DefaultReceiver != "" {
+		if _, ok := names[c.DefaultReceiver]; !ok {
+			return fmt.Errorf("[alert]:default receiver %s not found", c.DefaultReceiver)
+		}
+	}
+	return nil
+}
+
+// Receiver 返回名称对应的接收者，未找到时使用默认接收者
+func (c *WebhookConfig) Receiver(name string) (*Receiver, bool) {
+	for i := range c.Receivers {
+		if c.Receivers[i].Name == name {
+			return &c.Receivers[i], true
+		}
+	}
+	if c.DefaultReceiver != "" && c.DefaultReceiver != name {
+		return c.Receiver(c.DefaultReceiver)
+	}
+	return nil, false
+}
+
+// targets 返回接收者中属于 methods 的告警方式
+func (r *Receiver) targets(methods ...string) []ReceiverTarget {
+	var res []ReceiverTarget
+	for _, target := range r.Targets {
+		for _, method := range methods {
+			if target.Method == method {
+				res = append(res, target)
+				break
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,281 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var baseTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testRecords() []Record {
+	return []Record{
+		{Method: "lark", Receiver: "ops", Fingerprint: "a", Status: StatusFailed, Attempt: 1, Error: "timeout", CreatedAt: baseTime},
+		{Method: "lark", Receiver: "ops", Fingerprint: "a", Status: StatusSuccess, Attempt: 2, Latency: time.Second, CreatedAt: baseTime.Add(time.Minute)},
+		{Method: "email", Receiver: "ops", Fingerprint: "b", Status: StatusDeadLetter, Attempt: 5, CreatedAt: baseTime.Add(2 * time.Minute)},
+		{Method: "lark", Receiver: "dev", Fingerprint: "c", Status: StatusSuccess, Attempt: 1, CreatedAt: baseTime.Add(3 * time.Minute)},
+	}
+}
+
+// testDeliveryLog 测试 DeliveryLog 实现的查询
+func testDeliveryLog(t *testing.T, log DeliveryLog) {
+	ctx := context.Background()
+	require.NoError(t, log.Save(ctx, testRecords()...))
+	require.NoError(t, log.Save(ctx))
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []int
+	}{
+		{name: "全部按时间倒序", query: Query{}, want: []int{3, 2, 1, 0}},
+		{name: "按告警方式", query: Query{Method: "lark"}, want: []int{3, 1, 0}},
+		{name: "按 receiver", query: Query{Receiver: "dev"}, want: []int{3}},
+		{name: "按 fingerprint", query: Query{Fingerprint: "a"}, want: []int{1, 0}},
+		{name: "按状态", query: Query{Status: StatusDeadLetter}, want: []int{2}},
+		{name: "按时间范围", query: Query{Since: baseTime.Add(time.Minute), Until: baseTime.Add(3 * time.Minute)}, want: []int{2, 1}},
+		{name: "限制条数", query: Query{Limit: 2}, want: []int{3, 2}},
+		{name: "没有匹配", query: Query{Method: "wechat"}, want: nil},
+	}
+	records := testRecords()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := log.Query(ctx, tt.query)
+			require.NoError(t, err)
+			require.Len(t, got, len(tt.want))
+			for i, idx := range tt.want {
+				want := records[idx]
+				assert.NotZero(t, got[i].ID)
+				assert.Equal(t, want.Method, got[i].Method)
+				assert.Equal(t, want.Fingerprint, got[i].Fingerprint)
+				assert.Equal(t, want.Status, got[i].Status)
+				assert.Equal(t, want.Attempt, got[i].Attempt)
+				assert.Equal(t, want.Latency, got[i].Latency)
+				assert.Equal(t, want.Error, got[i].Error)
+				assert.True(t, want.CreatedAt.Equal(got[i].CreatedAt))
+			}
+		})
+	}
+}
+
+// TestMemoryLog 测试内存发送记录
+func TestMemoryLog(t *testing.T) {
+	testDeliveryLog(t, NewMemoryLog(0))
+
+	log := NewMemoryLog(2)
+	require.NoError(t, log.Save(context.Background(), testRecords()...))
+	got, err := log.Query(context.Background(), Query{})
+	require.NoError(t, err)
+	require.Len(t, got, 2, "超过容量时丢弃最早的记录")
+	assert.Equal(t, "c", got[0].Fingerprint)
+	assert.Equal(t, "b", got[1].Fingerprint)
+}
+
+// TestGormLog 测试 GORM 发送记录
+func TestGormLog(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	log, err := NewGormLog(db)
+	require.NoError(t, err)
+	testDeliveryLog(t, log)
+
+	_, err = NewGormLog(nil)
+	require.Error(t, err)
+}
+
+// TestRetryPolicyBackoff 测试指数退避
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{}
+	policy.withDefaults()
+	assert.Equal(t, 10*time.Second, policy.backoff(1))
+	assert.Equal(t, 20*time.Second, policy.backoff(2))
+	assert.Equal(t, 160*time.Second, policy.backoff(5))
+	assert.Equal(t, 5*time.Minute, policy.backoff(6))
+	assert.Equal(t, 5*time.Minute, policy.backoff(100))
+}
+
+// flakySend 前 failures 次发送失败
+type flakySend struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (f *flakySend) send() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("send failed")
+	}
+	return nil
+}
+
+func testTask(send func() error) Task {
+	return Task{
+		Method:   "lark",
+		Receiver: "ops",
+		Message: common.CustomMsg{Message: webhook.Message{Data: &template.Data{
+			Alerts: template.Alerts{
+				{Status: "firing", Fingerprint: "a"},
+				{Status: "resolved", Fingerprint: "b"},
+			},
+		}, GroupKey: "ops:{}"}},
+		Send: send,
+	}
+}
+
+func newTestTracker(t *testing.T, opts ...Option) (*Tracker, *MemoryLog, *time.Time) {
+	t.Helper()
+	log := NewMemoryLog(0)
+	tracker, err := NewTracker(log, opts...)
+	require.NoError(t, err)
+	now := baseTime
+	tracker.now = func() time.Time { return now }
+	// 测试中手动调用 retryDue，不启动后台 loop
+	tracker.running = true
+	return tracker, log, &now
+}
+
+// TestTrackerSuccess 测试发送成功时每条告警记录一条
+func TestTrackerSuccess(t *testing.T) {
+	tracker, log, _ := newTestTracker(t)
+	require.NoError(t, tracker.Deliver(testTask(func() error { return nil })))
+
+	records, err := log.Query(context.Background(), Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "b", records[0].Fingerprint)
+	assert.Equal(t, "resolved", records[0].AlertStatus)
+	assert.Equal(t, "a", records[1].Fingerprint)
+	for _, r := range records {
+		assert.Equal(t, "lark", r.Method)
+		assert.Equal(t, "ops", r.Receiver)
+		assert.Equal(t, "ops:{}", r.GroupKey)
+		assert.Equal(t, StatusSuccess, r.Status)
+		assert.Equal(t, 1, r.Attempt)
+		assert.Empty(t, r.Error)
+	}
+	assert.Zero(t, tracker.Pending())
+
+	require.Error(t, tracker.Deliver(Task{}))
+	_, err = NewTracker(nil)
+	require.Error(t, err)
+}
+
+// TestTrackerRetry 测试失败后按退避时间重试
+func TestTrackerRetry(t *testing.T) {
+	tracker, log, now := newTestTracker(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second}))
+	f := &flakySend{failures: 2}
+	require.NoError(t, tracker.Deliver(testTask(f.send)), "加入重试队列时不返回错误")
+	assert.Equal(t, 1, tracker.Pending())
+
+	tracker.retryDue(now.Add(500 * time.Millisecond))
+	assert.Equal(t, 1, f.calls, "未到重试时间")
+
+	*now = now.Add(time.Second)
+	tracker.retryDue(*now)
+	assert.Equal(t, 2, f.calls)
+	assert.Equal(t, 1, tracker.Pending())
+
+	tracker.retryDue(now.Add(time.Second))
+	assert.Equal(t, 2, f.calls, "第二次失败后等待 2s")
+	tracker.retryDue(now.Add(2 * time.Second))
+	assert.Equal(t, 3, f.calls)
+	assert.Zero(t, tracker.Pending())
+
+	records, err := log.Query(context.Background(), Query{Fingerprint: "a"})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []Status{StatusSuccess, StatusFailed, StatusFailed},
+		[]Status{records[0].Status, records[1].Status, records[2].Status})
+	assert.Equal(t, 3, records[0].Attempt)
+	assert.Equal(t, "send failed", records[1].Error)
+}
+
+// TestTrackerDeadLetter 测试达到最大尝试次数后进入死信
+func TestTrackerDeadLetter(t *testing.T) {
+	var deadTask Task
+	var deadAttempts int
+	tracker, log, now := newTestTracker(t,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second}),
+		WithDeadLetter(func(task Task, attempts int, err error) {
+			deadTask = task
+			deadAttempts = attempts
+		}),
+	)
+	f := &flakySend{failures: 10}
+	require.NoError(t, tracker.Deliver(testTask(f.send)))
+	tracker.retryDue(now.Add(time.Second))
+	assert.Zero(t, tracker.Pending())
+	assert.Equal(t, 2, deadAttempts)
+	assert.Equal(t, "lark", deadTask.Method)
+
+	records, err := log.Query(context.Background(), Query{Status: StatusDeadLetter})
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	// 不重试时直接返回死信错误
+	tracker, _, _ = newTestTracker(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	err = tracker.Deliver(testTask(f.send))
+	require.ErrorIs(t, err, ErrDeadLetter)
+	assert.Contains(t, err.Error(), "send failed")
+}
+
+// TestTrackerStartStop 测试后台重试
+func TestTrackerStartStop(t *testing.T) {
+	tracker, err := NewTracker(NewMemoryLog(0),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond}),
+		WithTickInterval(5*time.Millisecond),
+	)
+	require.NoError(t, err)
+	tracker.Start()
+
+	f := &flakySend{failures: 1}
+	require.NoError(t, tracker.Deliver(testTask(f.send)))
+	require.Eventually(t, func() bool { return tracker.Pending() == 0 }, time.Second, 5*time.Millisecond)
+
+	tracker.Stop()
+
+	tracker, err = NewTracker(NewMemoryLog(0), WithRetryPolicy(RetryPolicy{BaseDelay: time.Hour}))
+	require.NoError(t, err)
+	tracker.Start()
+	require.NoError(t, tracker.Deliver(testTask((&flakySend{failures: 10}).send)))
+	assert.Equal(t, 1, tracker.Pending())
+	tracker.Stop()
+	assert.Zero(t, tracker.Pending(), "停止时丢弃未完成的重试")
+}
+
+// TestTrackerNotRunning 测试重试队列没有运行时返回发送失败的错误，不加入重试队列
+func TestTrackerNotRunning(t *testing.T) {
+	log := NewMemoryLog(0)
+	tracker, err := NewTracker(log)
+	require.NoError(t, err)
+
+	f := &flakySend{failures: 10}
+	err = tracker.Deliver(testTask(f.send))
+	require.ErrorIs(t, err, ErrNotRunning, "未调用 Start")
+	assert.Contains(t, err.Error(), "send failed")
+	assert.Zero(t, tracker.Pending())
+
+	records, err := log.Query(context.Background(), Query{Status: StatusFailed})
+	require.NoError(t, err)
+	assert.Len(t, records, 2, "仍然记录发送失败")
+
+	tracker.Start()
+	require.NoError(t, tracker.Deliver(testTask(f.send)))
+	tracker.Stop()
+	require.ErrorIs(t, tracker.Deliver(testTask(f.send)), ErrNotRunning, "已经 Stop")
+	assert.Zero(t, tracker.Pending())
+}
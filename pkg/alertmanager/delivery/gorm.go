@@ -0,0 +1,69 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// GormLog 使用 GORM 保存发送记录，支持 MySQL、PostgreSQL、SQLite 等数据库
+type GormLog struct {
+	db *gorm.DB
+}
+
+var _ DeliveryLog = (*GormLog)(nil)
+
+// NewGormLog 创建 GORM 发送记录，会自动迁移 alert_delivery_records 表
+func NewGormLog(db *gorm.DB) (*GormLog, error) {
+	if db == nil {
+		return nil, errors.New("[alert]:gorm db is nil")
+	}
+	if err := db.AutoMigrate(&Record{}); err != nil {
+		return nil, fmt.Errorf("[alert]:migrate delivery records failed: %w", err)
+	}
+	return &GormLog{db: db}, nil
+}
+
+// Save 批量写入发送记录
+func (g *GormLog) Save(ctx context.Context, records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := g.db.WithContext(ctx).Create(&records).Error; err != nil {
+		return fmt.Errorf("[alert]:save delivery records failed: %w", err)
+	}
+	return nil
+}
+
+// Query 按条件查询发送记录，最新的记录在前
+func (g *GormLog) Query(ctx context.Context, q Query) ([]Record, error) {
+	tx := g.db.WithContext(ctx).Model(&Record{})
+	if q.Method != "" {
+		tx = tx.Where("method = ?", q.Method)
+	}
+	if q.Receiver != "" {
+		tx = tx.Where("receiver = ?", q.Receiver)
+	}
+	if q.Fingerprint != "" {
+		tx = tx.Where("fingerprint = ?", q.Fingerprint)
+	}
+	if q.Status != "" {
+		tx = tx.Where("status = ?", q.Status)
+	}
+	if !q.Since.IsZero() {
+		tx = tx.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		tx = tx.Where("created_at < ?", q.Until)
+	}
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+	var res []Record
+	if err := tx.Order("created_at DESC").Order("id DESC").Find(&res).Error; err != nil {
+		return nil, fmt.Errorf("[alert]:query delivery records failed: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,79 @@
+package delivery
+
+import (
+	"context"
+	"time"
+)
+
+// Status 发送状态
+type Status string
+
+const (
+	// StatusSuccess 发送成功
+	StatusSuccess Status = "success"
+	// StatusFailed 发送失败，已加入重试队列
+	StatusFailed Status = "failed"
+	// StatusDeadLetter 达到最大尝试次数仍然失败，不再重试
+	StatusDeadLetter Status = "dead_letter"
+	// StatusLimited 告警被限流没有发送，不再重试
+	StatusLimited Status = "limited"
+)
+
+// Record 一次发送尝试中一条告警的发送记录
+// 一次发送包含多条告警时，每条告警记录一条，便于按 fingerprint 查询某条告警是否发送成功
+type Record struct {
+	ID          uint64        `json:"id" gorm:"primaryKey;autoIncrement"`
+	Method      string        `json:"method" gorm:"size:64;index"`
+	Receiver    string        `json:"receiver" gorm:"size:128;index"`
+	GroupKey    string        `json:"group_key" gorm:"size:512"`
+	Fingerprint string        `json:"fingerprint" gorm:"size:64;index"`
+	AlertStatus string        `json:"alert_status" gorm:"size:16"`
+	Status      Status        `json:"status" gorm:"size:16;index"`
+	Attempt     int           `json:"attempt"`
+	Latency     time.Duration `json:"latency"`
+	Error       string        `json:"error,omitempty" gorm:"type:text"`
+	CreatedAt   time.Time     `json:"created_at" gorm:"index"`
+}
+
+// TableName GORM 表名
+func (Record) TableName() string {
+	return "alert_delivery_records"
+}
+
+// Query 发送记录的查询条件，空值表示不过滤
+type Query struct {
+	Method      string
+	Receiver    string
+	Fingerprint string
+	Status      Status
+	// Since 和 Until 按记录时间过滤，包含 Since，不包含 Until
+	Since time.Time
+	Until time.Time
+	// Limit 返回的最大条数，小于等于 0 时不限制
+	Limit int
+}
+
+// match 判断记录是否满足查询条件
+func (q Query) match(r Record) bool {
+	switch {
+	case q.Method != "" && r.Method != q.Method:
+		return false
+	case q.Receiver != "" && r.Receiver != q.Receiver:
+		return false
+	case q.Fingerprint != "" && r.Fingerprint != q.Fingerprint:
+		return false
+	case q.Status != "" && r.Status != q.Status:
+		return false
+	case !q.Since.IsZero() && r.CreatedAt.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !r.CreatedAt.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// DeliveryLog 发送记录的存储，查询结果按时间倒序返回
+type DeliveryLog interface {
+	Save(ctx context.Context, records ...Record) error
+	Query(ctx context.Context, q Query) ([]Record, error)
+}
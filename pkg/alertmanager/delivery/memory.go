@@ -0,0 +1,61 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultMemoryCapacity 内存发送记录默认保留的条数
+const defaultMemoryCapacity = 10000
+
+// MemoryLog 内存中的发送记录，超过容量时丢弃最早的记录
+type MemoryLog struct {
+	mu       sync.RWMutex
+	records  []Record
+	capacity int
+	nextID   uint64
+}
+
+var _ DeliveryLog = (*MemoryLog)(nil)
+
+// NewMemoryLog 创建内存发送记录，capacity 小于等于 0 时默认保留 10000 条
+func NewMemoryLog(capacity int) *MemoryLog {
+	if capacity <= 0 {
+		capacity = defaultMemoryCapacity
+	}
+	return &MemoryLog{capacity: capacity}
+}
+
+// Save 保存发送记录，未设置 ID 时自动分配
+func (m *MemoryLog) Save(_ context.Context, records ...Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range records {
+		m.nextID++
+		if r.ID == 0 {
+			r.ID = m.nextID
+		}
+		m.records = append(m.records, r)
+	}
+	if over := len(m.records) - m.capacity; over > 0 {
+		m.records = append(m.records[:0:0], m.records[over:]...)
+	}
+	return nil
+}
+
+// Query 按条件查询发送记录，最新的记录在前
+func (m *MemoryLog) Query(_ context.Context, q Query) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var res []Record
+	for i := len(m.records) - 1; i >= 0; i-- {
+		if !q.match(m.records[i]) {
+			continue
+		}
+		res = append(res, m.records[i])
+		if q.Limit > 0 && len(res) >= q.Limit {
+			break
+		}
+	}
+	return res, nil
+}
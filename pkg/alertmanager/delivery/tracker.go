@@ -0,0 +1,331 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+const (
+	defaultMaxAttempts  = 5
+	defaultBaseDelay    = 10 * time.Second
+	defaultMaxDelay     = 5 * time.Minute
+	defaultTickInterval = time.Second
+)
+
+var (
+	// ErrDeadLetter 达到最大尝试次数仍然失败
+	ErrDeadLetter = errors.New("[alert]:delivery moved to dead letter")
+	// ErrNotRunning 重试队列没有运行，发送失败的任务无法加入重试队列
+	ErrNotRunning = errors.New("[alert]:delivery tracker is not running")
+)
+
+// RetryPolicy 失败重试策略，第 n 次失败后等待 BaseDelay * 2^(n-1)，最长 MaxDelay
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数（包含第一次发送），默认 5，设置为 1 时不重试
+	MaxAttempts int
+	// BaseDelay 退避的基础等待时间，默认 10s
+	BaseDelay time.Duration
+	// MaxDelay 单次退避的最大等待时间，默认 5m
+	MaxDelay time.Duration
+}
+
+func (p *RetryPolicy) withDefaults() {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultMaxDelay
+	}
+}
+
+// backoff 计算第 attempt 次失败后的等待时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := p.BaseDelay << shift; d > 0 && d < delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// Task 一次发送任务：将一条 Webhook 消息发送到一个告警方式
+type Task struct {
+	Method   string
+	Receiver string
+	Message  common.CustomMsg
+	// Send 执行发送，重试时会再次调用
+	Send func() error
+}
+
+// DeadLetterFunc 任务进入死信时的回调，err 为最后一次失败的错误
+type DeadLetterFunc func(task Task, attempts int, err error)
+
+// Option Tracker 配置选项
+type Option func(*Tracker)
+
+// WithRetryPolicy 设置失败重试策略
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(t *Tracker) {
+		t.policy = policy
+	}
+}
+
+// WithDeadLetter 设置任务进入死信时的回调，例如通知管理员或写入持久化队列
+func WithDeadLetter(fn DeadLetterFunc) Option {
+	return func(t *Tracker) {
+		t.deadLetter = fn
+	}
+}
+
+// WithTickInterval 设置检查重试队列的间隔，默认 1s
+func WithTickInterval(interval time.Duration) Option {
+	return func(t *Tracker) {
+		if interval > 0 {
+			t.tickInterval = interval
+		}
+	}
+}
+
+// retryItem 重试队列中的任务
+type retryItem struct {
+	task    Task
+	attempt int
+	nextAt  time.Time
+}
+
+// Tracker 记录每次发送的结果，失败的任务按指数退避重试，达到最大尝试次数后进入死信
+// 重试队列保存在内存中，Stop 或进程退出后未完成的重试会丢失（Stop 时记录日志），
+// 只有调用 Start 后失败的任务才会加入重试队列
+type Tracker struct {
+	log          DeliveryLog
+	policy       RetryPolicy
+	deadLetter   DeadLetterFunc
+	tickInterval time.Duration
+	now          func() time.Time
+
+	mu    sync.Mutex
+	queue []*retryItem
+	// running 重试队列是否在运行，Start 后为 true，Stop 后为 false
+	running bool
+
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewTracker 创建发送跟踪器
+func NewTracker(log DeliveryLog, opts ...Option) (*Tracker, error) {
+	if log == nil {
+		return nil, errors.New("[alert]:delivery log is nil")
+	}
+	t := &Tracker{
+		log:          log,
+		tickInterval: defaultTickInterval,
+		now:          time.Now,
+		stopCh:       make(chan struct{}),
+		doneCh:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.policy.withDefaults()
+	return t, nil
+}
+
+// Log 返回发送记录的存储，用于查询发送历史
+func (t *Tracker) Log() DeliveryLog {
+	return t.log
+}
+
+// Start 启动重试队列
+func (t *Tracker) Start() {
+	t.startOnce.Do(func() {
+		t.mu.Lock()
+		t.running = true
+		t.mu.Unlock()
+		go t.loop()
+	})
+}
+
+// Stop 停止重试队列，必须在 Start 之后调用
+func (t *Tracker) Stop() {
+	t.stopOnce.Do(func() {
+		t.mu.Lock()
+		t.running = false
+		t.mu.Unlock()
+		close(t.stopCh)
+		<-t.doneCh
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for _, item := range t.queue {
+			slog.Warn("Tracker, drop pending retry",
+				slog.String("method", item.task.Method),
+				slog.String("receiver", item.task.Receiver),
+				slog.Int("attempt", item.attempt),
+			)
+		}
+		t.queue = nil
+	})
+}
+
+func (t *Tracker) loop() {
+	defer close(t.doneCh)
+	ticker := time.NewTicker(t.tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			t.retryDue(t.now())
+		}
+	}
+}
+
+// Pending 返回等待重试的任务数
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.queue)
+}
+
+// Deliver 执行第一次发送并记录结果
+// 发送失败且还可以重试时加入重试队列并返回 nil；重试队列没有运行（未调用 Start 或已经 Stop）时
+// 不加入队列，返回 ErrNotRunning 和失败原因，由调用方（例如 Alertmanager）负责重试；
+// 不再重试时返回 ErrDeadLetter 和失败原因；
+// 告警方式被限流时记录为 limited，不重试，返回包含 *common.LimitedError 的错误
+func (t *Tracker) Deliver(task Task) error {
+	if task.Send == nil {
+		return errors.New("[alert]:task send func is nil")
+	}
+	return t.attempt(task, 1)
+}
+
+// attempt 执行第 n 次发送
+func (t *Tracker) attempt(task Task, n int) error {
+	start := time.Now()
+	err := task.Send()
+	latency := time.Since(start)
+
+	status := StatusSuccess
+	switch {
+	case err == nil:
+	case common.IsLimited(err):
+		status = StatusLimited
+	case n < t.policy.MaxAttempts:
+		status = StatusFailed
+	default:
+		status = StatusDeadLetter
+	}
+	t.record(task, n, status, latency, err)
+
+	switch status {
+	case StatusFailed:
+		delay := t.policy.backoff(n)
+		t.mu.Lock()
+		if !t.running {
+			t.mu.Unlock()
+			return fmt.Errorf("%w, retry is not scheduled: %w", ErrNotRunning, err)
+		}
+		t.queue = append(t.queue, &retryItem{task: task, attempt: n + 1, nextAt: t.now().Add(delay)})
+		t.mu.Unlock()
+		slog.Warn("Tracker, delivery failed, will retry",
+			slog.String("method", task.Method),
+			slog.String("receiver", task.Receiver),
+			slog.Int("attempt", n),
+			slog.Duration("delay", delay),
+			slog.Any("err", err),
+		)
+		return nil
+	case StatusDeadLetter:
+		slog.Error("Tracker, delivery moved to dead letter",
+			slog.String("method", task.Method),
+			slog.String("receiver", task.Receiver),
+			slog.Int("attempts", n),
+			slog.Any("err", err),
+		)
+		if t.deadLetter != nil {
+			t.deadLetter(task, n, err)
+		}
+		return fmt.Errorf("%w after %d attempts: %w", ErrDeadLetter, n, err)
+	case StatusLimited:
+		return err
+	}
+	return nil
+}
+
+// RecordLimited 记录发送前被限流的告警，task.Message 只包含被限流的告警
+func (t *Tracker) RecordLimited(task Task) {
+	t.record(task, 0, StatusLimited, 0, common.ErrorLimited)
+}
+
+// record 为消息中的每条告警写入一条发送记录
+func (t *Tracker) record(task Task, attempt int, status Status, latency time.Duration, err error) {
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
+	}
+	base := Record{
+		Method:    task.Method,
+		Receiver:  task.Receiver,
+		GroupKey:  task.Message.GroupKey,
+		Status:    status,
+		Attempt:   attempt,
+		Latency:   latency,
+		Error:     errMsg,
+		CreatedAt: t.now(),
+	}
+	var records []Record
+	if task.Message.Data != nil {
+		for _, alert := range task.Message.Alerts {
+			r := base
+			r.Fingerprint = alert.Fingerprint
+			r.AlertStatus = alert.Status
+			records = append(records, r)
+		}
+	}
+	if len(records) == 0 {
+		records = append(records, base)
+	}
+	if err := t.log.Save(context.Background(), records...); err != nil {
+		slog.Error("Tracker, save delivery records failed", slog.String("method", task.Method), slog.Any("err", err))
+	}
+}
+
+// retryDue 并发重试所有到期的任务
+func (t *Tracker) retryDue(now time.Time) {
+	t.mu.Lock()
+	var due []*retryItem
+	pending := t.queue[:0]
+	for _, item := range t.queue {
+		if now.Before(item.nextAt) {
+			pending = append(pending, item)
+			continue
+		}
+		due = append(due, item)
+	}
+	t.queue = pending
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, item := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.attempt(item.task, item.attempt)
+		}()
+	}
+	wg.Wait()
+}
@@ -6,18 +6,28 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/prometheus/alertmanager/template"
 	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
 	"github.piwriw.go-tools/pkg/httputil"
 )
 
+// jsonHeaders 通过请求头设置 Content-Type，避免并发发送时调用 Client.JSON() 修改共享的客户端
+var jsonHeaders = map[string]string{"Content-Type": string(http.JSON)}
+
+// DefaultTemplate 钉钉消息默认使用的模板名称，模板渲染的结果作为文本消息发送
+const DefaultTemplate = "dingtalk.message"
+
 // DingtalkAlert 钉钉告警策略
 type DingtalkAlert struct {
 	Client     *http.Client
 	BeforeHook common.HookFunc
 	AfterHook  common.HookFunc
 	LimitFunc  common.LimitOption
+	// Templates 消息模板，未设置或模板不存在时使用内置的消息格式
+	Templates *tmpl.Templates
 }
 
 var _ = common.AlertMethod(&DingtalkAlert{})
@@ -37,6 +47,11 @@ func (d *DingtalkAlert) WithLimit(limit common.LimitOption) *DingtalkAlert {
 	return d
 }
 
+func (d *DingtalkAlert) WithTemplates(templates *tmpl.Templates) *DingtalkAlert {
+	d.Templates = templates
+	return d
+}
+
 func (d *DingtalkAlert) WithBeforeHook(hook common.HookFunc) *DingtalkAlert {
 	if hook == nil {
 		return d
@@ -73,16 +88,16 @@ func (d *DingtalkAlert) After(c common.AlertContext) error {
 
 func (d *DingtalkAlert) Limit(idx int, alerts template.Alerts) bool {
 	if d.LimitFunc != nil {
-		slog.Warn("Current Alert is Limited",
-			slog.Int("remaining_alert_count", len(alerts[idx:])),
-			slog.Any("remaining_alerts", alerts[idx:]),
-		)
-		if d.LimitFunc.Allow() {
+		if !d.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
 			return true
 		}
 		return false
 	}
-	return true
+	return false
 }
 
 func (d *DingtalkAlert) Execute(c common.AlertContext, users []string) error {
@@ -93,43 +108,49 @@ func (d *DingtalkAlert) Execute(c common.AlertContext, users []string) error {
 	if !ok {
 		return errors.New("invalid context type for DingtalkAlert")
 	}
-	for idx, wa := range dingtalkContext.Message.Alerts {
-		if d.Limit(idx, dingtalkContext.Message.Alerts) {
-			return errors.New("alert is limited")
-		}
-		severity := wa.Labels["severity"]
-		ss := strings.Split(severity, ":")
-		status := ss[0]
-		typ := strings.Split(wa.Labels["category"], ".")[1]
-		if wa.Status == "resolved" {
-			status = "恢复"
-		}
-		message := fmt.Sprintf(common.AlertFormat,
-			dingtalkContext.Title, typ, wa.Labels["name"], wa.Labels["ip"], wa.Labels["alertname"], status, wa.Annotations["description"], wa.StartsAt.Format("2006-01-02 15:04:05"))
-		data := map[string]any{
-			"msgtype": "text",
-			"text": map[string]string{
-				"content": message + "\n",
-			},
-			"at": map[string]any{
-				"atMobiles": users,
-				"isAtAll":   false,
-			},
+	if dingtalkContext.Message.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+	title := fmt.Sprintf("[%s] %s %d 条告警", dingtalkContext.Title,
+		common.StatusText(dingtalkContext.Message.Status), len(dingtalkContext.Message.Alerts))
+	if name := d.Templates.Resolve(dingtalkContext.Template, DefaultTemplate); name != "" {
+		if d.Limit(0, dingtalkContext.Message.Alerts) {
+			return common.NewLimitedError(dingtalkContext.Message.Alerts)
 		}
-		req, _ := json.Marshal(data)
-		body, err := d.Client.JSON().Post(dingtalkContext.Webhook, req)
+		text, err := d.Templates.Render(name, tmpl.NewData(dingtalkContext.Message, dingtalkContext.Title, users))
 		if err != nil {
-			slog.Error("Dingtalk, Send data to Dingtalk failed, ", slog.Any("err", err))
+			slog.Error("DingtalkAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
 			return err
 		}
-		dingTalkRes := &dingTalkRes{}
-		if err = json.Unmarshal(body, &dingTalkRes); err != nil {
-			slog.Error("LarkAlert, Unmarshal response is failed", slog.Any("err", err))
+		if err = d.send(dingtalkContext, title, text, users); err != nil {
+			return err
+		}
+	} else if dingtalkContext.MsgType != "" && dingtalkContext.MsgType != common.MsgTypeText {
+		// Markdown 和卡片消息将所有告警合并为一条消息发送
+		if d.Limit(0, dingtalkContext.Message.Alerts) {
+			return common.NewLimitedError(dingtalkContext.Message.Alerts)
+		}
+		text := common.AlertMarkdown(dingtalkContext.Title, dingtalkContext.Message.Data)
+		if err := d.send(dingtalkContext, title, text, users); err != nil {
 			return err
 		}
-		if dingTalkRes.Errcode != 0 {
-			slog.Error("LarkAlert, Send data to LarkAlert failed, ", slog.Any("err", dingTalkRes))
-			return errors.New(dingTalkRes.Errmsg)
+	} else {
+		for idx, wa := range dingtalkContext.Message.Alerts {
+			if d.Limit(idx, dingtalkContext.Message.Alerts) {
+				return common.NewLimitedError(dingtalkContext.Message.Alerts[idx:])
+			}
+			severity := wa.Labels["severity"]
+			ss := strings.Split(severity, ":")
+			status := ss[0]
+			typ := common.AlertCategory(wa)
+			if wa.Status == "resolved" {
+				status = "恢复"
+			}
+			message := fmt.Sprintf(common.AlertFormat,
+				dingtalkContext.Title, typ, wa.Labels["name"], wa.Labels["ip"], wa.Labels["alertname"], status, wa.Annotations["description"], wa.StartsAt.Format("2006-01-02 15:04:05"))
+			if err := d.send(dingtalkContext, title, message+"\n", users); err != nil {
+				return err
+			}
 		}
 	}
 	if err := d.After(c); err != nil {
@@ -143,21 +164,27 @@ type dingTalkRes struct {
 	Errmsg  string `json:"errmsg"`
 }
 
-func (d *DingtalkAlert) ExecuteTest(c common.AlertContext) error {
-	dingtalkContext, ok := c.(*DingtalkAlertContext)
-	if !ok {
-		return errors.New("invalid context type for DingtalkAlert")
-	}
-	data := map[string]any{
-		"msgtype": "text",
-		"text": map[string]string{
-			"content": fmt.Sprintf("【%s】钉钉告警测试：收到本消息说明钉钉告警配置成功！", dingtalkContext.Title),
-		},
+// send 按上下文配置的消息类型发送消息，并 @ 指定的用户
+func (d *DingtalkAlert) send(dingtalkContext *DingtalkAlertContext, title, content string, users []string) error {
+	data, err := robotMessage(dingtalkContext, title, content, users)
+	if err != nil {
+		return err
 	}
+	return d.post(dingtalkContext, data)
+}
 
-	slog.Debug("Dingtalk is ExecuteTest", slog.String("data", "告警测试邮件，请勿回复，谢谢"), slog.Any("Context", dingtalkContext))
+// post 发送机器人消息，配置了加签密钥时对 Webhook 地址签名
+func (d *DingtalkAlert) post(dingtalkContext *DingtalkAlertContext, data map[string]any) error {
+	webhook := dingtalkContext.Webhook
+	if dingtalkContext.Secret != "" {
+		signed, err := signURL(webhook, dingtalkContext.Secret, time.Now())
+		if err != nil {
+			return err
+		}
+		webhook = signed
+	}
 	req, _ := json.Marshal(data)
-	body, err := d.Client.JSON().Post(dingtalkContext.Webhook, req)
+	body, err := d.Client.PostWithHeaders(webhook, jsonHeaders, req)
 	if err != nil {
 		slog.Error("Dingtalk, Send data to Dingtalk failed, ", slog.Any("err", err))
 		return err
@@ -168,8 +195,24 @@ func (d *DingtalkAlert) ExecuteTest(c common.AlertContext) error {
 		return err
 	}
 	if dingTalkRes.Errcode != 0 {
-		slog.Error("DingtalkAlert, Send data to LarkAlert failed, ", slog.Any("err", dingTalkRes))
+		slog.Error("DingtalkAlert, Send data to DingtalkAlert failed, ", slog.Any("err", dingTalkRes))
 		return errors.New(dingTalkRes.Errmsg)
 	}
 	return nil
 }
+
+func (d *DingtalkAlert) ExecuteTest(c common.AlertContext) error {
+	dingtalkContext, ok := c.(*DingtalkAlertContext)
+	if !ok {
+		return errors.New("invalid context type for DingtalkAlert")
+	}
+	data := map[string]any{
+		"msgtype": "text",
+		"text": map[string]string{
+			"content": fmt.Sprintf("【%s】钉钉告警测试：收到本消息说明钉钉告警配置成功！", dingtalkContext.Title),
+		},
+	}
+
+	slog.Debug("Dingtalk is ExecuteTest", slog.String("data", "告警测试邮件，请勿回复，谢谢"), slog.Any("Context", dingtalkContext))
+	return d.post(dingtalkContext, data)
+}
@@ -9,10 +9,24 @@ type DingtalkAlertContext struct {
 	Message common.CustomMsg
 	Title   string `json:"title"`
 	Webhook string `json:"webhook"` // 钉钉配置
+	// Secret 机器人安全设置中的加签密钥，设置后请求会携带 timestamp 和 sign 参数
+	Secret string `json:"secret,omitempty"`
+	// MsgType 消息类型：text（默认）、markdown、card（ActionCard，不支持 @ 用户）
+	MsgType string `json:"msg_type,omitempty"`
+	// MentionBy users 的类型：mobile（默认，手机号）、user_id（钉钉用户 ID）
+	MentionBy string `json:"mention_by,omitempty"`
+	// AtAll @ 所有人
+	AtAll bool `json:"at_all,omitempty"`
+	// Template 覆盖告警方式默认的消息模板
+	Template string `json:"template,omitempty"`
 }
 
-var _ = common.AlertContext(&DingtalkAlertContext{})
+var _ = common.TemplateContext(&DingtalkAlertContext{})
 
 func (d *DingtalkAlertContext) GetMethod() string {
 	return common.MethodDingtalk
 }
+
+func (d *DingtalkAlertContext) TemplateNames() []string {
+	return common.NonEmpty(d.Template)
+}
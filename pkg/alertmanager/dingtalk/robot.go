@@ -0,0 +1,92 @@
+package dingtalk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// signURL 按钉钉自定义机器人的加签规则，在 Webhook 地址上追加 timestamp 和 sign 参数
+// sign = base64(HmacSHA256(secret, timestamp + "\n" + secret))，timestamp 为毫秒时间戳
+func signURL(webhook, secret string, now time.Time) (string, error) {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return "", fmt.Errorf("[alert]:parse dingtalk webhook failed: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+
+	q := u.Query()
+	q.Set("timestamp", timestamp)
+	q.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// at 生成 @ 用户的配置
+func at(c *DingtalkAlertContext, users []string) map[string]any {
+	res := map[string]any{"isAtAll": c.AtAll}
+	if c.MentionBy == common.MentionByUserID {
+		res["atUserIds"] = users
+	} else {
+		res["atMobiles"] = users
+	}
+	return res
+}
+
+// mentionText Markdown 消息需要在正文中包含 @手机号 或 @用户ID 才会高亮显示
+func mentionText(c *DingtalkAlertContext, users []string) string {
+	mentions := make([]string, 0, len(users)+1)
+	for _, user := range users {
+		mentions = append(mentions, "@"+user)
+	}
+	if c.AtAll {
+		mentions = append(mentions, "@所有人")
+	}
+	return strings.Join(mentions, " ")
+}
+
+// robotMessage 按消息类型生成机器人消息，title 为 Markdown 和 ActionCard 消息在会话列表中显示的标题
+// card 类型的按钮链接到 Alertmanager，消息中没有 ExternalURL 时按 markdown 类型发送
+func robotMessage(c *DingtalkAlertContext, title, content string, users []string) (map[string]any, error) {
+	msgType := c.MsgType
+	if msgType == common.MsgTypeCard && (c.Message.Data == nil || c.Message.ExternalURL == "") {
+		msgType = common.MsgTypeMarkdown
+	}
+	switch msgType {
+	case "", common.MsgTypeText:
+		return map[string]any{
+			"msgtype": "text",
+			"text":    map[string]string{"content": content},
+			"at":      at(c, users),
+		}, nil
+	case common.MsgTypeMarkdown:
+		if mentions := mentionText(c, users); mentions != "" {
+			content += "\n\n" + mentions
+		}
+		return map[string]any{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"title": title, "text": content},
+			"at":       at(c, users),
+		}, nil
+	case common.MsgTypeCard:
+		return map[string]any{
+			"msgtype": "actionCard",
+			"actionCard": map[string]string{
+				"title":       title,
+				"text":        content,
+				"singleTitle": "查看详情",
+				"singleURL":   c.Message.ExternalURL,
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("[alert]:dingtalk msg_type %s is not supported", c.MsgType)
+}
@@ -0,0 +1,101 @@
+package dingtalk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/internal/alerttest"
+)
+
+// TestSignURL 测试加签后的地址可以被钉钉的签名规则校验
+func TestSignURL(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	signed, err := signURL("https://oapi.dingtalk.com/robot/send?access_token=abc", "SECxyz", now)
+	require.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", u.Query().Get("access_token"))
+	assert.Equal(t, "1700000000123", u.Query().Get("timestamp"))
+
+	mac := hmac.New(sha256.New, []byte("SECxyz"))
+	mac.Write([]byte("1700000000123\nSECxyz"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), u.Query().Get("sign"))
+}
+
+// TestDingtalkAlertExecute 测试不同消息类型和 @ 方式
+func TestDingtalkAlertExecute(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    DingtalkAlertContext
+		verify func(t *testing.T, query url.Values, body map[string]any)
+	}{
+		{
+			name: "文本消息按手机号@",
+			ctx:  DingtalkAlertContext{},
+			verify: func(t *testing.T, query url.Values, body map[string]any) {
+				assert.Equal(t, "text", body["msgtype"])
+				at := body["at"].(map[string]any)
+				assert.Equal(t, []any{"13800000000"}, at["atMobiles"])
+				assert.Nil(t, at["atUserIds"])
+				assert.Empty(t, query.Get("sign"))
+			},
+		},
+		{
+			name: "Markdown消息按用户ID@并加签",
+			ctx:  DingtalkAlertContext{MsgType: common.MsgTypeMarkdown, MentionBy: common.MentionByUserID, Secret: "SECxyz", AtAll: true},
+			verify: func(t *testing.T, query url.Values, body map[string]any) {
+				assert.Equal(t, "markdown", body["msgtype"])
+				markdown := body["markdown"].(map[string]any)
+				assert.Equal(t, "[prod] 活跃 1 条告警", markdown["title"])
+				assert.Contains(t, markdown["text"], "**HighCPU**")
+				assert.Contains(t, markdown["text"], "@13800000000 @所有人")
+				at := body["at"].(map[string]any)
+				assert.Equal(t, []any{"13800000000"}, at["atUserIds"])
+				assert.Equal(t, true, at["isAtAll"])
+				assert.NotEmpty(t, query.Get("timestamp"))
+				assert.NotEmpty(t, query.Get("sign"))
+			},
+		},
+		{
+			name: "卡片消息链接到Alertmanager",
+			ctx:  DingtalkAlertContext{MsgType: common.MsgTypeCard},
+			verify: func(t *testing.T, query url.Values, body map[string]any) {
+				assert.Equal(t, "actionCard", body["msgtype"])
+				card := body["actionCard"].(map[string]any)
+				assert.Equal(t, "http://alertmanager:9093", card["singleURL"])
+				assert.Equal(t, "[prod] 活跃 1 条告警", card["title"])
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, `{"errcode":0,"errmsg":"ok"}`))
+			c := tt.ctx
+			c.Message, c.Title, c.Webhook = alerttest.HighCPUMessage("firing"), "prod", ts.URL+"/robot/send?access_token=abc"
+			require.NoError(t, NewDingtalkAlert().Execute(&c, []string{"13800000000"}))
+			require.Len(t, *requests, 1)
+			req := (*requests)[0]
+			assert.Equal(t, "abc", req.Query.Get("access_token"))
+			tt.verify(t, req.Query, alerttest.JSON[map[string]any](t, req))
+		})
+	}
+}
+
+// TestDingtalkAlertError 测试钉钉返回错误码和不支持的消息类型
+func TestDingtalkAlertError(t *testing.T) {
+	ts, _ := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, `{"errcode":310000,"errmsg":"sign not match"}`))
+	c := &DingtalkAlertContext{Message: alerttest.HighCPUMessage("firing"), Title: "prod", Webhook: ts.URL, MsgType: common.MsgTypeMarkdown}
+	assert.EqualError(t, NewDingtalkAlert().Execute(c, nil), "sign not match")
+
+	c.MsgType = "feedCard"
+	assert.ErrorContains(t, NewDingtalkAlert().Execute(c, nil), "not supported")
+}
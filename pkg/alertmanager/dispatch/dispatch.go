@@ -0,0 +1,512 @@
+// Package dispatch 告警发送前的分组、去重和抑制
+//
+// Dispatcher 接收 Alertmanager Webhook 消息，按 receiver 和 GroupBy 标签将告警分组：
+// 新分组等待 GroupWait 后发送，之后每隔 GroupInterval 检查一次；
+// 同一告警（按 fingerprint）在 RepeatInterval 内只发送一次，状态变化（恢复）时立即在下次检查时发送；
+// 命中抑制规则的告警不会发送；超过 AlertTTL 没有再次收到的活跃告警视为已经消失，直接删除。状态保存在内存中，可以定期保存到快照文件，重启后不会重复通知。
+package dispatch
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	prommodel "github.com/prometheus/common/model"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+const (
+	defaultGroupWait      = 30 * time.Second
+	defaultGroupInterval  = 5 * time.Minute
+	defaultRepeatInterval = 4 * time.Hour
+	defaultTickInterval   = time.Second
+	// defaultAlertTTLFactor 默认的 AlertTTL 为 RepeatInterval 的倍数
+	defaultAlertTTLFactor = 3
+
+	statusFiring   = "firing"
+	statusResolved = "resolved"
+
+	// GroupByAll 按告警的所有标签分组，即每个告警单独一组
+	GroupByAll = "..."
+)
+
+// ErrStopped Dispatcher 已经停止
+var ErrStopped = errors.New("[alert]:dispatcher is stopped")
+
+// NotifyFunc 发送一个分组的告警，返回错误时告警不会标记为已发送，在下个 GroupInterval 重试
+type NotifyFunc func(msg common.CustomMsg) error
+
+// NotifyErrorFunc 分组发送失败时的回调，用于告警、记录指标等，msg 为发送失败的消息
+type NotifyErrorFunc func(msg common.CustomMsg, err error)
+
+// GroupConfig 分组配置
+type GroupConfig struct {
+	// GroupBy 分组使用的标签，为空时同一 receiver 的告警为一组，GroupByAll 表示按所有标签分组
+	GroupBy []string
+	// GroupWait 新分组第一次发送前的等待时间，用于收集同一组的告警，默认 30s
+	GroupWait time.Duration
+	// GroupInterval 分组有新告警时两次发送的最小间隔，默认 5m
+	GroupInterval time.Duration
+	// RepeatInterval 仍处于活跃状态的告警重复发送的间隔，默认 4h
+	RepeatInterval time.Duration
+	// AlertTTL 活跃告警超过该时间没有再次收到时从分组中删除，不发送恢复通知，默认为 3 倍 RepeatInterval。
+	// Alertmanager 按自身的 repeat_interval 重复推送活跃告警，AlertTTL 需要大于该间隔，
+	// 用于清理 Alertmanager 重启或恢复通知丢失后永远不会恢复的告警
+	AlertTTL time.Duration
+}
+
+func (c *GroupConfig) withDefaults() {
+	if c.GroupWait <= 0 {
+		c.GroupWait = defaultGroupWait
+	}
+	if c.GroupInterval <= 0 {
+		c.GroupInterval = defaultGroupInterval
+	}
+	if c.RepeatInterval <= 0 {
+		c.RepeatInterval = defaultRepeatInterval
+	}
+	if c.AlertTTL <= 0 {
+		c.AlertTTL = defaultAlertTTLFactor * c.RepeatInterval
+	}
+}
+
+// Option Dispatcher 配置选项
+type Option func(*Dispatcher)
+
+// WithGroupConfig 设置默认的分组配置
+func WithGroupConfig(cfg GroupConfig) Option {
+	return func(d *Dispatcher) {
+		d.group = cfg
+	}
+}
+
+// WithReceiverGroupConfig 为指定 receiver 设置分组配置，覆盖默认配置
+func WithReceiverGroupConfig(receiver string, cfg GroupConfig) Option {
+	return func(d *Dispatcher) {
+		d.receiverGroups[receiver] = cfg
+	}
+}
+
+// WithInhibitRules 设置抑制规则
+func WithInhibitRules(rules ...InhibitRule) Option {
+	return func(d *Dispatcher) {
+		d.inhibitRules = append(d.inhibitRules, rules...)
+	}
+}
+
+// WithNotifyErrorHandler 设置分组发送失败时的回调
+// Dispatch 接收告警后立即返回，发送失败无法通过 Webhook 的响应通知 Alertmanager，需要通过回调感知
+func WithNotifyErrorHandler(fn NotifyErrorFunc) Option {
+	return func(d *Dispatcher) {
+		d.onNotifyError = fn
+	}
+}
+
+// WithSnapshotFile 设置快照文件，创建时从快照恢复状态，状态变化后和停止时写入快照
+func WithSnapshotFile(path string) Option {
+	return func(d *Dispatcher) {
+		d.snapshotPath = path
+	}
+}
+
+// WithTickInterval 设置检查分组是否需要发送的间隔，默认 1s
+func WithTickInterval(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		if interval > 0 {
+			d.tickInterval = interval
+		}
+	}
+}
+
+// alertState 告警及其发送状态
+type alertState struct {
+	Alert template.Alert `json:"alert"`
+	// SentStatus 最后一次发送时的状态，未发送过为空
+	SentStatus string    `json:"sent_status,omitempty"`
+	SentAt     time.Time `json:"sent_at,omitempty"`
+	// LastSeen 最后一次收到该告警的时间
+	LastSeen time.Time `json:"last_seen,omitempty"`
+}
+
+// group 一个分组的告警
+type group struct {
+	Key         string                 `json:"key"`
+	Receiver    string                 `json:"receiver"`
+	Labels      template.KV            `json:"labels"`
+	ExternalURL string                 `json:"external_url"`
+	Alerts      map[string]*alertState `json:"alerts"`
+	NextFlush   time.Time              `json:"next_flush"`
+}
+
+// Dispatcher 告警分组、去重和抑制
+type Dispatcher struct {
+	mu             sync.Mutex
+	notify         NotifyFunc
+	onNotifyError  NotifyErrorFunc
+	group          GroupConfig
+	receiverGroups map[string]GroupConfig
+	inhibitRules   []InhibitRule
+	groups         map[string]*group
+	snapshotPath   string
+	dirty          bool
+	tickInterval   time.Duration
+	now            func() time.Time
+
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stopped   bool
+}
+
+// New 创建 Dispatcher，设置了快照文件时从快照恢复状态
+func New(notify NotifyFunc, opts ...Option) (*Dispatcher, error) {
+	if notify == nil {
+		return nil, errors.New("[alert]:notify func is nil")
+	}
+	d := &Dispatcher{
+		notify: notify,
+		group: GroupConfig{
+			GroupWait:      defaultGroupWait,
+			GroupInterval:  defaultGroupInterval,
+			RepeatInterval: defaultRepeatInterval,
+		},
+		receiverGroups: make(map[string]GroupConfig),
+		groups:         make(map[string]*group),
+		tickInterval:   defaultTickInterval,
+		now:            time.Now,
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.group.withDefaults()
+	for receiver, cfg := range d.receiverGroups {
+		cfg.withDefaults()
+		d.receiverGroups[receiver] = cfg
+	}
+	if d.snapshotPath != "" {
+		if err := d.restore(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Start 启动定时检查
+func (d *Dispatcher) Start() {
+	d.startOnce.Do(func() {
+		go d.loop()
+	})
+}
+
+// Stop 停止定时检查并写入快照，未发送的告警保存在快照中，不会在停止时发送
+// 必须在 Start 之后调用
+func (d *Dispatcher) Stop() error {
+	var err error
+	d.stopOnce.Do(func() {
+		close(d.stopCh)
+		<-d.doneCh
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.stopped = true
+		d.expireLocked(d.now())
+		err = d.saveLocked()
+	})
+	return err
+}
+
+func (d *Dispatcher) loop() {
+	defer close(d.doneCh)
+	ticker := time.NewTicker(d.tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			d.process(d.now())
+		}
+	}
+}
+
+// Dispatch 接收 Webhook 消息中的告警，告警会在所属分组下次发送时通知
+func (d *Dispatcher) Dispatch(msg common.CustomMsg) error {
+	if msg.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return ErrStopped
+	}
+
+	now := d.now()
+	cfg := d.groupConfig(msg.Receiver)
+	for _, alert := range msg.Alerts {
+		if alert.Fingerprint == "" {
+			alert.Fingerprint = fingerprint(alert.Labels)
+		}
+		labels := groupLabels(alert.Labels, cfg.GroupBy)
+		key := groupKey(msg.Receiver, labels)
+
+		g, ok := d.groups[key]
+		if !ok {
+			g = &group{
+				Key:       key,
+				Receiver:  msg.Receiver,
+				Labels:    labels,
+				Alerts:    make(map[string]*alertState),
+				NextFlush: now.Add(cfg.GroupWait),
+			}
+			d.groups[key] = g
+		}
+		g.ExternalURL = msg.ExternalURL
+
+		st, ok := g.Alerts[alert.Fingerprint]
+		if !ok {
+			st = &alertState{}
+			g.Alerts[alert.Fingerprint] = st
+		}
+		st.Alert = alert
+		st.LastSeen = now
+	}
+	d.dirty = true
+	return nil
+}
+
+func (d *Dispatcher) groupConfig(receiver string) GroupConfig {
+	if cfg, ok := d.receiverGroups[receiver]; ok {
+		return cfg
+	}
+	return d.group
+}
+
+// pending 一次需要发送的分组消息
+type pending struct {
+	key    string
+	msg    common.CustomMsg
+	alerts []template.Alert
+}
+
+// process 发送到期分组中需要通知的告警
+func (d *Dispatcher) process(now time.Time) {
+	d.mu.Lock()
+	batches := d.collectLocked(now)
+	d.mu.Unlock()
+
+	for _, p := range batches {
+		if err := d.notify(p.msg); err != nil {
+			slog.Error("Dispatcher, notify group failed",
+				slog.String("group", p.key),
+				slog.Int("alerts", len(p.alerts)),
+				slog.Any("err", err),
+			)
+			if d.onNotifyError != nil {
+				d.onNotifyError(p.msg, err)
+			}
+			continue
+		}
+		d.mu.Lock()
+		d.markSentLocked(p, now)
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.saveLocked(); err != nil {
+		slog.Error("Dispatcher, save snapshot failed", slog.String("path", d.snapshotPath), slog.Any("err", err))
+	}
+}
+
+// collectLocked 找出到期的分组，返回需要发送的告警
+// 未发送过或已恢复的告警、超过 RepeatInterval 的活跃告警需要发送；被抑制的告警不发送；
+// 从未发送过活跃状态的恢复告警直接丢弃。
+func (d *Dispatcher) collectLocked(now time.Time) []pending {
+	d.expireLocked(now)
+	sources := d.firingAlertsLocked()
+
+	var res []pending
+	keys := make([]string, 0, len(d.groups))
+	for key := range d.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		g := d.groups[key]
+		if now.Before(g.NextFlush) {
+			continue
+		}
+		cfg := d.groupConfig(g.Receiver)
+		g.NextFlush = now.Add(cfg.GroupInterval)
+		d.dirty = true
+
+		var alerts []template.Alert
+		for fp, st := range g.Alerts {
+			switch {
+			case st.Alert.Status == statusResolved:
+				if st.SentStatus != statusFiring {
+					delete(g.Alerts, fp)
+					continue
+				}
+				alerts = append(alerts, st.Alert)
+			case inhibited(d.inhibitRules, sources, st.Alert):
+				continue
+			case st.SentStatus != statusFiring || now.Sub(st.SentAt) >= cfg.RepeatInterval:
+				alerts = append(alerts, st.Alert)
+			}
+		}
+		if len(g.Alerts) == 0 {
+			delete(d.groups, key)
+			continue
+		}
+		if len(alerts) == 0 {
+			continue
+		}
+		sort.Slice(alerts, func(i, j int) bool {
+			if !alerts[i].StartsAt.Equal(alerts[j].StartsAt) {
+				return alerts[i].StartsAt.Before(alerts[j].StartsAt)
+			}
+			return alerts[i].Fingerprint < alerts[j].Fingerprint
+		})
+		res = append(res, pending{key: key, msg: g.message(alerts), alerts: alerts})
+	}
+	return res
+}
+
+// expireLocked 删除超过 AlertTTL 没有再次收到的活跃告警，过期的告警不再发送，也不再作为抑制规则的源告警
+func (d *Dispatcher) expireLocked(now time.Time) {
+	for key, g := range d.groups {
+		ttl := d.groupConfig(g.Receiver).AlertTTL
+		for fp, st := range g.Alerts {
+			if st.Alert.Status == statusResolved || now.Sub(st.LastSeen) <= ttl {
+				continue
+			}
+			slog.Warn("Dispatcher, alert expired",
+				slog.String("group", key),
+				slog.String("fingerprint", fp),
+				slog.Time("last_seen", st.LastSeen),
+			)
+			delete(g.Alerts, fp)
+			d.dirty = true
+		}
+		if len(g.Alerts) == 0 {
+			delete(d.groups, key)
+		}
+	}
+}
+
+// firingAlertsLocked 返回所有活跃告警，作为抑制规则的源告警
+func (d *Dispatcher) firingAlertsLocked() []template.Alert {
+	if len(d.inhibitRules) == 0 {
+		return nil
+	}
+	var res []template.Alert
+	for _, g := range d.groups {
+		for _, st := range g.Alerts {
+			if st.Alert.Status != statusResolved {
+				res = append(res, st.Alert)
+			}
+		}
+	}
+	return res
+}
+
+// markSentLocked 标记告警已发送，已发送的恢复告警从分组中删除
+// 发送期间告警状态发生变化时不标记，下次检查时重新发送
+func (d *Dispatcher) markSentLocked(p pending, now time.Time) {
+	g, ok := d.groups[p.key]
+	if !ok {
+		return
+	}
+	for _, alert := range p.alerts {
+		st, ok := g.Alerts[alert.Fingerprint]
+		if !ok || st.Alert.Status != alert.Status {
+			continue
+		}
+		if alert.Status == statusResolved {
+			delete(g.Alerts, alert.Fingerprint)
+			continue
+		}
+		st.SentStatus = statusFiring
+		st.SentAt = now
+	}
+	if len(g.Alerts) == 0 {
+		delete(d.groups, p.key)
+	}
+	d.dirty = true
+}
+
+// message 构造分组的 Webhook 消息
+func (g *group) message(alerts []template.Alert) common.CustomMsg {
+	data := &template.Data{
+		Receiver:          g.Receiver,
+		Status:            statusResolved,
+		Alerts:            alerts,
+		GroupLabels:       g.Labels,
+		CommonLabels:      template.KV{},
+		CommonAnnotations: template.KV{},
+		ExternalURL:       g.ExternalURL,
+	}
+	for _, alert := range alerts {
+		if alert.Status == statusFiring {
+			data.Status = statusFiring
+			break
+		}
+	}
+	if len(alerts) > 0 {
+		data.CommonLabels = common.CommonKV(alerts, func(a template.Alert) template.KV { return a.Labels })
+		data.CommonAnnotations = common.CommonKV(alerts, func(a template.Alert) template.KV { return a.Annotations })
+	}
+	return common.CustomMsg{Message: webhook.Message{
+		Data:     data,
+		Version:  "4",
+		GroupKey: g.Key,
+	}}
+}
+
+// groupLabels 返回告警用于分组的标签
+func groupLabels(labels template.KV, groupBy []string) template.KV {
+	res := template.KV{}
+	for _, name := range groupBy {
+		if name == GroupByAll {
+			for k, v := range labels {
+				res[k] = v
+			}
+			return res
+		}
+		if value, ok := labels[name]; ok {
+			res[name] = value
+		}
+	}
+	return res
+}
+
+// groupKey 由 receiver 和分组标签组成，例如 ops:{alertname="HighCPU"}
+func groupKey(receiver string, labels template.KV) string {
+	pairs := labels.SortedPairs()
+	parts := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		parts = append(parts, fmt.Sprintf("%s=%q", pair.Name, pair.Value))
+	}
+	return receiver + ":{" + strings.Join(parts, ",") + "}"
+}
+
+// fingerprint 告警缺少 fingerprint 时按标签计算
+func fingerprint(labels template.KV) string {
+	set := make(prommodel.LabelSet, len(labels))
+	for name, value := range labels {
+		set[prommodel.LabelName(name)] = prommodel.LabelValue(value)
+	}
+	return set.Fingerprint().String()
+}
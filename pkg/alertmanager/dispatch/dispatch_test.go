@@ -0,0 +1,354 @@
+package dispatch
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// recorder 记录发送的消息
+type recorder struct {
+	mu   sync.Mutex
+	msgs []common.CustomMsg
+	err  error
+}
+
+func (r *recorder) notify(msg common.CustomMsg) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+
+// take 返回并清空已发送的消息，每条消息用告警名称和状态表示
+func (r *recorder) take() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([][]string, 0, len(r.msgs))
+	for _, msg := range r.msgs {
+		var alerts []string
+		for _, alert := range msg.Alerts {
+			alerts = append(alerts, alert.Labels["instance"]+"/"+alert.Labels["severity"]+"/"+alert.Status)
+		}
+		sort.Strings(alerts)
+		res = append(res, alerts)
+	}
+	r.msgs = nil
+	return res
+}
+
+func newAlert(status, instance, severity string) template.Alert {
+	return template.Alert{
+		Status: status,
+		Labels: template.KV{
+			"alertname": "NodeDown",
+			"instance":  instance,
+			"severity":  severity,
+		},
+		Annotations: template.KV{"summary": "node down"},
+		StartsAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func newMsg(receiver string, alerts ...template.Alert) common.CustomMsg {
+	return common.CustomMsg{Message: webhook.Message{Data: &template.Data{
+		Receiver:    receiver,
+		Alerts:      alerts,
+		ExternalURL: "http://alertmanager:9093",
+	}}}
+}
+
+var testGroupConfig = GroupConfig{
+	GroupBy:        []string{"alertname"},
+	GroupWait:      30 * time.Second,
+	GroupInterval:  5 * time.Minute,
+	RepeatInterval: time.Hour,
+}
+
+func newTestDispatcher(t *testing.T, r *recorder, opts ...Option) (*Dispatcher, *time.Time) {
+	t.Helper()
+	d, err := New(r.notify, append([]Option{WithGroupConfig(testGroupConfig)}, opts...)...)
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+// TestDispatcherGrouping 测试按标签分组并在 GroupWait 后合并发送
+func TestDispatcherGrouping(t *testing.T) {
+	r := &recorder{}
+	d, now := newTestDispatcher(t, r)
+
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("firing", "node-1", "critical"))))
+	*now = now.Add(10 * time.Second)
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("firing", "node-2", "critical"))))
+	// 不同 receiver 单独分组
+	require.NoError(t, d.Dispatch(newMsg("dev", newAlert("firing", "node-1", "critical"))))
+
+	d.process(now.Add(10 * time.Second))
+	assert.Empty(t, r.take(), "GroupWait 内不发送")
+
+	d.process(now.Add(20 * time.Second))
+	assert.Equal(t, [][]string{
+		{"node-1/critical/firing", "node-2/critical/firing"},
+	}, r.take())
+
+	d.process(now.Add(30 * time.Second))
+	assert.Equal(t, [][]string{{"node-1/critical/firing"}}, r.take())
+}
+
+// TestDispatcherMessage 测试分组消息的字段
+func TestDispatcherMessage(t *testing.T) {
+	r := &recorder{}
+	d, now := newTestDispatcher(t, r)
+
+	a := newAlert("firing", "node-1", "critical")
+	b := newAlert("firing", "node-2", "critical")
+	require.NoError(t, d.Dispatch(newMsg("ops", a, b)))
+	d.process(now.Add(time.Minute))
+
+	require.Len(t, r.msgs, 1)
+	msg := r.msgs[0]
+	assert.Equal(t, "ops", msg.Receiver)
+	assert.Equal(t, "firing", msg.Status)
+	assert.Equal(t, `ops:{alertname="NodeDown"}`, msg.GroupKey)
+	assert.Equal(t, template.KV{"alertname": "NodeDown"}, msg.GroupLabels)
+	assert.Equal(t, template.KV{"alertname": "NodeDown", "severity": "critical"}, msg.CommonLabels)
+	assert.Equal(t, template.KV{"summary": "node down"}, msg.CommonAnnotations)
+	assert.Equal(t, "http://alertmanager:9093", msg.ExternalURL)
+	assert.NotEmpty(t, msg.Alerts[0].Fingerprint, "缺少 fingerprint 时按标签计算")
+}
+
+// TestDispatcherDedup 测试 RepeatInterval 内不重复发送，恢复后发送恢复通知
+func TestDispatcherDedup(t *testing.T) {
+	r := &recorder{}
+	d, now := newTestDispatcher(t, r)
+	start := *now
+
+	alert := newAlert("firing", "node-1", "critical")
+	require.NoError(t, d.Dispatch(newMsg("ops", alert)))
+	d.process(start.Add(30 * time.Second))
+	assert.Len(t, r.take(), 1)
+
+	// Alertmanager 重复推送同一告警
+	require.NoError(t, d.Dispatch(newMsg("ops", alert)))
+	d.process(start.Add(30*time.Second + 5*time.Minute))
+	assert.Empty(t, r.take(), "RepeatInterval 内不重复发送")
+
+	// 新告警只发送新告警
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("firing", "node-2", "critical"))))
+	d.process(start.Add(30*time.Second + 10*time.Minute))
+	assert.Equal(t, [][]string{{"node-2/critical/firing"}}, r.take())
+
+	// 超过 RepeatInterval 重复发送
+	d.process(start.Add(30*time.Second + 60*time.Minute))
+	assert.Equal(t, [][]string{{"node-1/critical/firing"}}, r.take())
+
+	// 恢复
+	resolved := alert
+	resolved.Status = "resolved"
+	require.NoError(t, d.Dispatch(newMsg("ops", resolved)))
+	d.process(start.Add(30*time.Second + 65*time.Minute))
+	assert.Equal(t, [][]string{{"node-1/critical/resolved"}}, r.take())
+
+	require.NoError(t, d.Dispatch(newMsg("ops", resolved)))
+	d.process(start.Add(30*time.Second + 69*time.Minute))
+	assert.Empty(t, r.take(), "已发送的恢复告警不再发送")
+}
+
+// TestDispatcherResolvedBeforeSent 测试从未发送过的告警恢复时直接丢弃
+func TestDispatcherResolvedBeforeSent(t *testing.T) {
+	r := &recorder{}
+	d, now := newTestDispatcher(t, r)
+
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("firing", "node-1", "critical"))))
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("resolved", "node-1", "critical"))))
+	d.process(now.Add(time.Minute))
+	assert.Empty(t, r.take())
+	assert.Empty(t, d.groups)
+}
+
+// TestDispatcherNotifyFailed 测试发送失败时在下个 GroupInterval 重试
+func TestDispatcherNotifyFailed(t *testing.T) {
+	r := &recorder{err: errors.New("send failed")}
+	d, now := newTestDispatcher(t, r)
+
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("firing", "node-1", "critical"))))
+	d.process(now.Add(time.Minute))
+	assert.Empty(t, r.take())
+
+	r.err = nil
+	d.process(now.Add(2 * time.Minute))
+	assert.Empty(t, r.take(), "GroupInterval 内不重试")
+	d.process(now.Add(6 * time.Minute))
+	assert.Equal(t, [][]string{{"node-1/critical/firing"}}, r.take())
+}
+
+// TestDispatcherNotifyErrorHandler 测试发送失败时调用回调
+func TestDispatcherNotifyErrorHandler(t *testing.T) {
+	r := &recorder{err: errors.New("send failed")}
+	var failed []common.CustomMsg
+	var errs []error
+	d, now := newTestDispatcher(t, r, WithNotifyErrorHandler(func(msg common.CustomMsg, err error) {
+		failed = append(failed, msg)
+		errs = append(errs, err)
+	}))
+
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("firing", "node-1", "critical"))))
+	d.process(now.Add(time.Minute))
+	require.Len(t, failed, 1)
+	assert.Equal(t, "ops", failed[0].Receiver)
+	assert.Len(t, failed[0].Alerts, 1)
+	assert.EqualError(t, errs[0], "send failed")
+}
+
+// TestDispatcherInhibit 测试活跃的 critical 告警抑制同一实例的 warning 告警
+func TestDispatcherInhibit(t *testing.T) {
+	r := &recorder{}
+	d, now := newTestDispatcher(t, r, WithInhibitRules(InhibitRule{
+		SourceMatch: map[string]string{"severity": "critical"},
+		TargetMatch: map[string]string{"severity": "warning"},
+		Equal:       []string{"instance"},
+	}))
+	start := *now
+
+	critical := newAlert("firing", "node-1", "critical")
+	require.NoError(t, d.Dispatch(newMsg("ops",
+		critical,
+		newAlert("firing", "node-1", "warning"),
+		newAlert("firing", "node-2", "warning"),
+	)))
+	d.process(start.Add(time.Minute))
+	assert.Equal(t, [][]string{{"node-1/critical/firing", "node-2/warning/firing"}}, r.take())
+
+	// critical 恢复后 warning 不再被抑制
+	critical.Status = "resolved"
+	require.NoError(t, d.Dispatch(newMsg("ops", critical)))
+	d.process(start.Add(10 * time.Minute))
+	assert.Equal(t, [][]string{{"node-1/critical/resolved", "node-1/warning/firing"}}, r.take())
+}
+
+// TestDispatcherExpire 测试超过 AlertTTL 没有再次收到的活跃告警被删除，不再发送和抑制其他告警
+func TestDispatcherExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dispatch.json")
+	r := &recorder{}
+	d, now := newTestDispatcher(t, r, WithSnapshotFile(path), WithInhibitRules(InhibitRule{
+		SourceMatch: map[string]string{"severity": "critical"},
+		TargetMatch: map[string]string{"severity": "warning"},
+		Equal:       []string{"instance"},
+	}))
+	start := *now
+	require.Equal(t, 3*time.Hour, d.group.AlertTTL, "默认为 3 倍 RepeatInterval")
+
+	require.NoError(t, d.Dispatch(newMsg("ops",
+		newAlert("firing", "node-1", "critical"),
+		newAlert("firing", "node-1", "warning"),
+	)))
+	d.process(start.Add(time.Minute))
+	assert.Equal(t, [][]string{{"node-1/critical/firing"}}, r.take())
+
+	// 只有 warning 告警继续推送，critical 告警的恢复通知丢失
+	*now = start.Add(2 * time.Hour)
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("firing", "node-1", "warning"))))
+	d.process(start.Add(2*time.Hour + time.Minute))
+	assert.Equal(t, [][]string{{"node-1/critical/firing"}}, r.take(), "AlertTTL 内的告警仍然重复发送并抑制其他告警")
+
+	d.process(start.Add(3*time.Hour + time.Minute))
+	assert.Equal(t, [][]string{{"node-1/warning/firing"}}, r.take(), "过期的告警不再发送，也不再抑制其他告警")
+	require.Len(t, d.groups, 1)
+	for _, g := range d.groups {
+		assert.Len(t, g.Alerts, 1)
+	}
+
+	// warning 告警也过期后删除分组，快照中不再保存
+	d.process(start.Add(5*time.Hour + time.Minute))
+	assert.Empty(t, r.take())
+	assert.Empty(t, d.groups)
+	restored, err := New(r.notify, WithSnapshotFile(path))
+	require.NoError(t, err)
+	assert.Empty(t, restored.groups)
+}
+
+// TestDispatcherReceiverGroupConfig 测试按 receiver 覆盖分组配置
+func TestDispatcherReceiverGroupConfig(t *testing.T) {
+	r := &recorder{}
+	d, now := newTestDispatcher(t, r, WithReceiverGroupConfig("dev", GroupConfig{
+		GroupBy:   []string{GroupByAll},
+		GroupWait: time.Second,
+	}))
+
+	require.NoError(t, d.Dispatch(newMsg("dev",
+		newAlert("firing", "node-1", "critical"),
+		newAlert("firing", "node-2", "critical"),
+	)))
+	d.process(now.Add(time.Second))
+	assert.Len(t, r.take(), 2, "按所有标签分组，每个告警单独发送")
+}
+
+// TestDispatcherSnapshot 测试快照恢复后不重复发送
+func TestDispatcherSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dispatch.json")
+	r := &recorder{}
+	d, now := newTestDispatcher(t, r, WithSnapshotFile(path), WithTickInterval(time.Hour))
+	d.Start()
+
+	alert := newAlert("firing", "node-1", "critical")
+	require.NoError(t, d.Dispatch(newMsg("ops", alert)))
+	d.process(now.Add(time.Minute))
+	assert.Len(t, r.take(), 1)
+	require.NoError(t, d.Dispatch(newMsg("ops", newAlert("firing", "node-2", "critical"))))
+	require.NoError(t, d.Stop())
+	require.ErrorIs(t, d.Dispatch(newMsg("ops", alert)), ErrStopped)
+
+	restored, now2 := newTestDispatcher(t, r, WithSnapshotFile(path))
+	*now2 = now.Add(10 * time.Minute)
+	require.NoError(t, restored.Dispatch(newMsg("ops", alert)))
+	restored.process(*now2)
+	assert.Equal(t, [][]string{{"node-2/critical/firing"}}, r.take(), "已发送的告警不重复发送，未发送的告警继续发送")
+
+	_, err := New(r.notify, WithSnapshotFile(filepath.Join(t.TempDir(), "missing.json")))
+	require.NoError(t, err, "快照文件不存在时忽略")
+}
+
+// TestInhibitRule 测试抑制规则匹配
+func TestInhibitRule(t *testing.T) {
+	rule := InhibitRule{
+		SourceMatch: map[string]string{"severity": "critical"},
+		TargetMatch: map[string]string{"severity": "warning"},
+		Equal:       []string{"instance"},
+	}
+	tests := []struct {
+		name   string
+		source template.Alert
+		target template.Alert
+		want   bool
+	}{
+		{name: "同一实例", source: newAlert("firing", "a", "critical"), target: newAlert("firing", "a", "warning"), want: true},
+		{name: "不同实例", source: newAlert("firing", "a", "critical"), target: newAlert("firing", "b", "warning")},
+		{name: "源告警不匹配", source: newAlert("firing", "a", "warning"), target: newAlert("firing", "a", "warning")},
+		{name: "目标告警不匹配", source: newAlert("firing", "a", "critical"), target: newAlert("firing", "a", "critical")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rule.inhibits(tt.source, tt.target))
+		})
+	}
+}
+
+// TestNew 测试参数校验
+func TestNew(t *testing.T) {
+	_, err := New(nil)
+	require.Error(t, err)
+}
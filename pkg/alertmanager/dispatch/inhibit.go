@@ -0,0 +1,57 @@
+package dispatch
+
+import (
+	"github.com/prometheus/alertmanager/template"
+)
+
+// InhibitRule 抑制规则：存在匹配 SourceMatch 的活跃告警时，匹配 TargetMatch 的告警不再发送
+// Equal 中的标签在源告警和目标告警上的值必须相同，例如按 instance 抑制同一台机器上的告警
+//
+//	InhibitRule{
+//		SourceMatch: map[string]string{"severity": "critical"},
+//		TargetMatch: map[string]string{"severity": "warning"},
+//		Equal:       []string{"alertname", "instance"},
+//	}
+type InhibitRule struct {
+	SourceMatch map[string]string `json:"source_match"`
+	TargetMatch map[string]string `json:"target_match"`
+	Equal       []string          `json:"equal,omitempty"`
+}
+
+// matchLabels 判断标签是否满足所有等值匹配
+func matchLabels(labels template.KV, match map[string]string) bool {
+	for name, value := range match {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// inhibits 判断 source 是否抑制 target
+func (r InhibitRule) inhibits(source, target template.Alert) bool {
+	if !matchLabels(source.Labels, r.SourceMatch) || !matchLabels(target.Labels, r.TargetMatch) {
+		return false
+	}
+	for _, name := range r.Equal {
+		if source.Labels[name] != target.Labels[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// inhibited 判断告警是否被任一活跃的源告警抑制，告警不会抑制自己
+func inhibited(rules []InhibitRule, sources []template.Alert, target template.Alert) bool {
+	for _, rule := range rules {
+		for _, source := range sources {
+			if source.Fingerprint == target.Fingerprint {
+				continue
+			}
+			if rule.inhibits(source, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// snapshotVersion 快照格式版本
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version int      `json:"version"`
+	Groups  []*group `json:"groups"`
+}
+
+// restore 从快照文件恢复分组和发送状态，快照文件不存在时忽略
+// 没有记录最后收到时间的告警按恢复时间计算过期时间
+func (d *Dispatcher) restore() error {
+	data, err := os.ReadFile(d.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	snap := snapshot{}
+	if err = json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("[alert]:parse snapshot %s failed: %w", d.snapshotPath, err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("[alert]:unsupported snapshot version %d", snap.Version)
+	}
+	for _, g := range snap.Groups {
+		if g.Alerts == nil {
+			continue
+		}
+		for _, st := range g.Alerts {
+			if st.LastSeen.IsZero() {
+				st.LastSeen = d.now()
+			}
+		}
+		d.groups[g.Key] = g
+	}
+	return nil
+}
+
+// saveLocked 状态有变化时写入快照，先写临时文件再重命名，避免写入中断导致快照损坏
+func (d *Dispatcher) saveLocked() error {
+	if d.snapshotPath == "" || !d.dirty {
+		return nil
+	}
+	snap := snapshot{Version: snapshotVersion, Groups: make([]*group, 0, len(d.groups))}
+	for _, g := range d.groups {
+		snap.Groups = append(snap.Groups, g)
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(d.snapshotPath), filepath.Base(d.snapshotPath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), d.snapshotPath); err != nil {
+		return err
+	}
+	d.dirty = false
+	return nil
+}
@@ -10,14 +10,24 @@ import (
 
 	"github.com/prometheus/alertmanager/template"
 	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
 	"gopkg.in/gomail.v2"
 )
 
+const (
+	// DefaultTemplate 邮件正文默认使用的模板名称，建议使用 html/template 模板文件
+	DefaultTemplate = "email.html"
+	// DefaultSubjectTemplate 邮件标题默认使用的模板名称
+	DefaultSubjectTemplate = "email.subject"
+)
+
 // EmailAlert 邮件告警策略
 type EmailAlert struct {
 	LimitFunc  common.LimitOption
 	BeforeHook common.HookFunc
 	AfterHook  common.HookFunc
+	// Templates 邮件模板，未设置或模板不存在时使用内置的邮件格式
+	Templates *tmpl.Templates
 }
 
 var _ = common.AlertMethod(&EmailAlert{})
@@ -30,6 +40,11 @@ func (e *EmailAlert) WithLimit(limit common.LimitOption) *EmailAlert {
 	return e
 }
 
+func (e *EmailAlert) WithTemplates(templates *tmpl.Templates) *EmailAlert {
+	e.Templates = templates
+	return e
+}
+
 func (e *EmailAlert) WithBeforeHook(hook common.HookFunc) *EmailAlert {
 	if hook == nil {
 		return e
@@ -66,16 +81,16 @@ func (e *EmailAlert) After(c common.AlertContext) error {
 
 func (e *EmailAlert) Limit(idx int, alerts template.Alerts) bool {
 	if e.LimitFunc != nil {
-		slog.Warn("Current Alert is Limited",
-			slog.Int("remaining_alert_count", len(alerts[idx:])),
-			slog.Any("remaining_alerts", alerts[idx:]),
-		)
-		if e.LimitFunc.Allow() {
+		if !e.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
 			return true
 		}
 		return false
 	}
-	return true
+	return false
 }
 
 func (e *EmailAlert) Execute(c common.AlertContext, users []string) error {
@@ -83,29 +98,56 @@ func (e *EmailAlert) Execute(c common.AlertContext, users []string) error {
 	if !ok {
 		return errors.New("invalid context type for EmailAlert")
 	}
+	data := tmpl.NewData(emailContext.Message, emailContext.Title, users)
+	subject := fmt.Sprintf("【%s】告警邮件", emailContext.Title)
+	if name := e.Templates.Resolve(emailContext.SubjectTemplate, DefaultSubjectTemplate); name != "" {
+		res, err := e.Templates.Render(name, data)
+		if err != nil {
+			slog.Error("EmailAlert, Render subject template failed", slog.String("template", name), slog.Any("err", err))
+			return err
+		}
+		subject = strings.TrimSpace(res)
+	}
+	var templateBody string
+	bodyTemplate := e.Templates.Resolve(emailContext.Template, DefaultTemplate)
+	if bodyTemplate != "" {
+		if e.Limit(0, emailContext.Message.Alerts) {
+			return common.NewLimitedError(emailContext.Message.Alerts)
+		}
+		res, err := e.Templates.Render(bodyTemplate, data)
+		if err != nil {
+			slog.Error("EmailAlert, Render template failed", slog.String("template", bodyTemplate), slog.Any("err", err))
+			return err
+		}
+		templateBody = res
+	}
+
 	var errArr error
 	// 执行邮件发送操作
 	for _, user := range users {
-		var message string
-		for idx, wa := range emailContext.Message.Alerts {
-			if e.Limit(idx, emailContext.Message.Alerts) {
-				return errors.New("alert is limited")
-			}
-			severity := wa.Labels["severity"]
-			ss := strings.Split(severity, ":")
-			alertStatus := common.AlertStatusFiring
-			alertLevel := ss[0]
-			if wa.Status == "resolved" {
-				alertStatus = common.AlertStatusResolved
+		htmlEmail := templateBody
+		if bodyTemplate == "" {
+			var message string
+			for idx, wa := range emailContext.Message.Alerts {
+				if e.Limit(idx, emailContext.Message.Alerts) {
+					return common.NewLimitedError(emailContext.Message.Alerts[idx:])
+				}
+				severity := wa.Labels["severity"]
+				ss := strings.Split(severity, ":")
+				alertStatus := common.AlertStatusFiring
+				alertLevel := ss[0]
+				if wa.Status == "resolved" {
+					alertStatus = common.AlertStatusResolved
+				}
+				message += fmt.Sprintf(EmailTableTemplate,
+					wa.Labels["alertname"], wa.Annotations["summary"], wa.Labels["name"], wa.Labels["ip"], wa.StartsAt.Format("2006-01-02 15:04:05"), alertLevel, alertStatus, wa.Annotations["description"], wa.Annotations["suggestion"])
 			}
-			message += fmt.Sprintf(EmailTableTemplate,
-				wa.Labels["alertname"], wa.Annotations["summary"], wa.Labels["name"], wa.Labels["ip"], wa.StartsAt.Format("2006-01-02 15:04:05"), alertLevel, alertStatus, wa.Annotations["description"], wa.Annotations["suggestion"])
+			htmlEmail = EmailTableTemplate + message + "</div>"
 		}
-		htmlEmail := EmailTableTemplate + message + "</div>"
 		m := gomail.NewMessage()
 		m.SetHeader("From", emailContext.SMTPFrom)
 		m.SetHeader("To", user)
-		m.SetHeader("Subject", fmt.Sprintf("【%s】告警邮件", emailContext.Title))
+		m.SetHeader("Subject", subject)
 		m.SetBody("text/html", htmlEmail)
 
 		d, err := checkAndNewDialer(emailContext.SMTPSmarthost, emailContext.SMTPAuthUsername, emailContext.SMTPAuthPassword)
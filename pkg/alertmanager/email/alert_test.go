@@ -0,0 +1,40 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// countLimit 前 n 次允许发送
+type countLimit struct {
+	n int
+}
+
+func (l *countLimit) Allow() bool {
+	l.n--
+	return l.n >= 0
+}
+
+// TestEmailAlertLimit 测试没有限流时不限流，额度用完后限流
+func TestEmailAlertLimit(t *testing.T) {
+	alerts := template.Alerts{{Status: "firing"}, {Status: "firing"}}
+	tests := []struct {
+		name  string
+		limit common.LimitOption
+		want  []bool
+	}{
+		{name: "没有设置限流", want: []bool{false, false}},
+		{name: "额度用完后限流", limit: &countLimit{n: 1}, want: []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := (&EmailAlert{}).WithLimit(tt.limit)
+			for idx, want := range tt.want {
+				assert.Equal(t, want, e.Limit(idx, alerts))
+			}
+		})
+	}
+}
@@ -14,11 +14,19 @@ type EmailAlertContext struct {
 	SMTPAuthPassword string `json:"smtp_auth_password"` // 邮件密码
 	SMTPRequireTLS   bool   `json:"smtp_require_tls"`   // 邮件是否使用tls
 	SendTo           string `json:"send_to"`            // 发送给谁，测试使用字段
+	// Template 覆盖默认的邮件正文模板
+	Template string `json:"template,omitempty"`
+	// SubjectTemplate 覆盖默认的邮件标题模板
+	SubjectTemplate string `json:"subject_template,omitempty"`
 }
 
 // 确保 EmailAlertContext 实现了 AlertContext 接口
-var _ = common.AlertContext(&EmailAlertContext{})
+var _ = common.TemplateContext(&EmailAlertContext{})
 
 func (e *EmailAlertContext) GetMethod() string {
 	return common.MethodEmail
 }
+
+func (e *EmailAlertContext) TemplateNames() []string {
+	return common.NonEmpty(e.Template, e.SubjectTemplate)
+}
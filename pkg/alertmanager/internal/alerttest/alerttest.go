@@ -0,0 +1,108 @@
+// Package alerttest 告警渠道测试共用的告警消息、模拟服务和限流
+package alerttest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// ExternalURL 测试消息的 Alertmanager 地址
+const ExternalURL = "http://alertmanager:9093"
+
+// StartsAt 测试告警的开始时间
+var StartsAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Alert 返回 severity 为 critical 的 HighCPU 告警，labels 和 annotations 合并到告警的标签和注解中
+func Alert(status string, labels, annotations template.KV) template.Alert {
+	alert := template.Alert{
+		Status:      status,
+		Labels:      template.KV{"alertname": "HighCPU", "severity": "critical"},
+		Annotations: template.KV{},
+		StartsAt:    StartsAt,
+	}
+	for name, value := range labels {
+		alert.Labels[name] = value
+	}
+	for name, value := range annotations {
+		alert.Annotations[name] = value
+	}
+	return alert
+}
+
+// Message 返回包含 alerts 的 Webhook 消息，有活跃告警时状态为 firing，否则为 resolved
+func Message(alerts ...template.Alert) common.CustomMsg {
+	data := &template.Data{Status: "resolved", Alerts: alerts, ExternalURL: ExternalURL}
+	for _, alert := range alerts {
+		if alert.Status == "firing" {
+			data.Status = "firing"
+			break
+		}
+	}
+	return common.CustomMsg{Message: webhook.Message{Data: data}}
+}
+
+// HighCPUMessage 返回包含一条 HighCPU 告警的消息，告警分类为 host.cpu，status 为告警的状态
+func HighCPUMessage(status string) common.CustomMsg {
+	return Message(Alert(status, template.KV{"category": "host.cpu"}, template.KV{"summary": "CPU 使用率过高"}))
+}
+
+// Request 模拟服务收到的请求
+type Request struct {
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// ReplyFunc 根据收到的请求写入响应
+type ReplyFunc func(w http.ResponseWriter, req Request)
+
+// Reply 返回固定状态码和响应体的 ReplyFunc
+func Reply(status int, body string) ReplyFunc {
+	return func(w http.ResponseWriter, req Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
+
+// NewServer 启动记录请求的模拟服务，测试结束时关闭，返回收到的请求
+func NewServer(t *testing.T, reply ReplyFunc) (*httptest.Server, *[]Request) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := Request{Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header.Clone(), Body: body}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		reply(w, req)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+// JSON 将请求体按 JSON 解析为 T，解析失败时测试失败
+func JSON[T any](t *testing.T, req Request) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(req.Body, &v); err != nil {
+		t.Fatalf("unmarshal request body %q failed: %v", req.Body, err)
+	}
+	return v
+}
+
+// DenyLimit 拒绝所有告警的限流
+type DenyLimit struct{}
+
+func (DenyLimit) Allow() bool { return false }
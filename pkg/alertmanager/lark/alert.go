@@ -6,18 +6,28 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/prometheus/alertmanager/template"
 	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
 	"github.piwriw.go-tools/pkg/httputil"
 )
 
+// jsonHeaders 通过请求头设置 Content-Type，避免并发发送时调用 Client.JSON() 修改共享的客户端
+var jsonHeaders = map[string]string{"Content-Type": string(http.JSON)}
+
+// DefaultTemplate 飞书消息默认使用的模板名称，模板渲染的结果作为文本消息发送
+const DefaultTemplate = "lark.message"
+
 // LarkAlert  Lark告警策略
 type LarkAlert struct {
 	Client     *http.Client
 	BeforeHook common.HookFunc
 	AfterHook  common.HookFunc
 	LimitFunc  common.LimitOption
+	// Templates 消息模板，未设置或模板不存在时使用内置的消息格式
+	Templates *tmpl.Templates
 }
 
 var _ = common.AlertMethod(&LarkAlert{})
@@ -38,6 +48,11 @@ func (l *LarkAlert) WithLimit(limit common.LimitOption) *LarkAlert {
 	return l
 }
 
+func (l *LarkAlert) WithTemplates(templates *tmpl.Templates) *LarkAlert {
+	l.Templates = templates
+	return l
+}
+
 func (l *LarkAlert) WithBeforeHook(hook common.HookFunc) *LarkAlert {
 	if hook == nil {
 		return l
@@ -97,39 +112,50 @@ func (l *LarkAlert) Execute(c common.AlertContext, users []string) error {
 	// 执行 Lark 发送操作
 	slog.Debug("Lark is ExecuteTest", slog.Any("sendToUser", users), slog.Any("Context", larkContext))
 
-	for idx, wa := range larkContext.Message.Alerts {
-		if l.Limit(idx, larkContext.Message.Alerts) {
-			return errors.New("alert is limited")
-		}
-		severity := wa.Labels["severity"]
-		severities := strings.Split(severity, ":")
-		status := severities[0]
-		typ := strings.Split(wa.Labels["category"], ".")[1]
-		if wa.Status == "resolved" {
-			status = "恢复"
-		}
-		message := fmt.Sprintf(common.AlertFormat,
-			larkContext.Title, typ, wa.Labels["name"], wa.Labels["ip"], wa.Labels["alertname"], status, wa.Annotations["description"], wa.StartsAt.Format("2006-01-02 15:04:05"))
-		data := map[string]any{
-			"msg_type": "text",
-			"content": map[string]any{
-				"text": getLarkContent(users, message),
-			},
+	if larkContext.Message.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+	title := fmt.Sprintf("[%s] %s %d 条告警", larkContext.Title,
+		common.StatusText(larkContext.Message.Status), len(larkContext.Message.Alerts))
+	if name := l.Templates.Resolve(larkContext.Template, DefaultTemplate); name != "" {
+		if l.Limit(0, larkContext.Message.Alerts) {
+			return common.NewLimitedError(larkContext.Message.Alerts)
 		}
-		req, _ := json.Marshal(data)
-		body, err := l.Client.JSON().Post(larkContext.Webhook, req)
+		text, err := l.Templates.Render(name, tmpl.NewData(larkContext.Message, larkContext.Title, users))
 		if err != nil {
-			slog.Error("Lark, Send data to Lark failed, ", slog.Any("err", err))
+			slog.Error("LarkAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
 			return err
 		}
-		larkRes := &larkRes{}
-		if err = json.Unmarshal(body, &larkRes); err != nil {
-			slog.Error("LarkAlert, Unmarshal response is failed", slog.Any("err", err))
+		// 模板自行决定如何 @ 用户，渲染结果原样发送
+		if err = l.send(larkContext, title, text, nil); err != nil {
+			return err
+		}
+	} else if larkContext.MsgType != "" && larkContext.MsgType != common.MsgTypeText {
+		// Markdown 和卡片消息将所有告警合并为一条消息发送
+		if l.Limit(0, larkContext.Message.Alerts) {
+			return common.NewLimitedError(larkContext.Message.Alerts)
+		}
+		text := common.AlertMarkdown(larkContext.Title, larkContext.Message.Data)
+		if err := l.send(larkContext, title, text, users); err != nil {
 			return err
 		}
-		if larkRes.Code != 0 {
-			slog.Error("LarkAlert, Send data to LarkAlert failed, ", slog.Any("err", larkRes))
-			return errors.New(larkRes.Msg)
+	} else {
+		for idx, wa := range larkContext.Message.Alerts {
+			if l.Limit(idx, larkContext.Message.Alerts) {
+				return common.NewLimitedError(larkContext.Message.Alerts[idx:])
+			}
+			severity := wa.Labels["severity"]
+			severities := strings.Split(severity, ":")
+			status := severities[0]
+			typ := common.AlertCategory(wa)
+			if wa.Status == "resolved" {
+				status = "恢复"
+			}
+			message := fmt.Sprintf(common.AlertFormat,
+				larkContext.Title, typ, wa.Labels["name"], wa.Labels["ip"], wa.Labels["alertname"], status, wa.Annotations["description"], wa.StartsAt.Format("2006-01-02 15:04:05"))
+			if err := l.send(larkContext, title, message, users); err != nil {
+				return err
+			}
 		}
 	}
 	if err := l.After(c); err != nil {
@@ -144,23 +170,24 @@ type larkRes struct {
 	Msg  string      `json:"msg"`
 }
 
-func (l *LarkAlert) ExecuteTest(c common.AlertContext) error {
-	larkAlertContext, ok := c.(*LarkAlertContext)
-	if !ok {
-		return errors.New("invalid context type for LarkAlert")
-	}
-	data := map[string]any{
-		"msg_type": "text",
-		"content": map[string]any{
-			"text": fmt.Sprintf("【%s】飞书告警测试：收到本消息说明飞书告警配置成功！", larkAlertContext.Title),
-		},
+// send 按上下文配置的消息类型发送消息，并 @ 指定的用户
+func (l *LarkAlert) send(larkContext *LarkAlertContext, title, content string, users []string) error {
+	data, err := robotMessage(larkContext, title, content, users)
+	if err != nil {
+		return err
 	}
+	return l.post(larkContext, data)
+}
 
-	slog.Debug("LarkAlert is ExecuteTest", slog.String("data", "飞书告警测试，请勿回复，谢谢"), slog.Any("Context", larkAlertContext))
+// post 发送机器人消息，配置了签名密钥时在请求体中携带 timestamp 和 sign
+func (l *LarkAlert) post(larkContext *LarkAlertContext, data map[string]any) error {
+	if larkContext.Secret != "" {
+		data["timestamp"], data["sign"] = sign(larkContext.Secret, time.Now())
+	}
 	req, _ := json.Marshal(data)
-	body, err := l.Client.JSON().Post(larkAlertContext.Webhook, req)
+	body, err := l.Client.PostWithHeaders(larkContext.Webhook, jsonHeaders, req)
 	if err != nil {
-		slog.Error("LarkAlert, Send data to LarkAlert failed, ", slog.Any("err", err))
+		slog.Error("Lark, Send data to Lark failed, ", slog.Any("err", err))
 		return err
 	}
 	larkRes := &larkRes{}
@@ -174,3 +201,19 @@ func (l *LarkAlert) ExecuteTest(c common.AlertContext) error {
 	}
 	return nil
 }
+
+func (l *LarkAlert) ExecuteTest(c common.AlertContext) error {
+	larkAlertContext, ok := c.(*LarkAlertContext)
+	if !ok {
+		return errors.New("invalid context type for LarkAlert")
+	}
+	data := map[string]any{
+		"msg_type": "text",
+		"content": map[string]any{
+			"text": fmt.Sprintf("【%s】飞书告警测试：收到本消息说明飞书告警配置成功！", larkAlertContext.Title),
+		},
+	}
+
+	slog.Debug("LarkAlert is ExecuteTest", slog.String("data", "飞书告警测试，请勿回复，谢谢"), slog.Any("Context", larkAlertContext))
+	return l.post(larkAlertContext, data)
+}
@@ -9,10 +9,22 @@ type LarkAlertContext struct {
 	Message common.CustomMsg
 	Title   string `json:"title"`
 	Webhook string `json:"webhook"`
+	// Secret 机器人安全设置中的签名校验密钥，设置后请求体会携带 timestamp 和 sign
+	Secret string `json:"secret,omitempty"`
+	// MsgType 消息类型：text（默认）、markdown（只包含 Markdown 内容的卡片）、card（带标题和按钮的消息卡片）
+	MsgType string `json:"msg_type,omitempty"`
+	// AtAll @ 所有人
+	AtAll bool `json:"at_all,omitempty"`
+	// Template 覆盖告警方式默认的消息模板
+	Template string `json:"template,omitempty"`
 }
 
-var _ = common.AlertContext(&LarkAlertContext{})
+var _ = common.TemplateContext(&LarkAlertContext{})
 
 func (l *LarkAlertContext) GetMethod() string {
 	return common.MethodLark
 }
+
+func (l *LarkAlertContext) TemplateNames() []string {
+	return common.NonEmpty(l.Template)
+}
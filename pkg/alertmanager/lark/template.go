@@ -1,9 +1,24 @@
 package lark
 
-import "fmt"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
 
 const larkTemplate = `<at user_id="%s">Tom</at>`
 
+// larkCardAtTemplate 卡片 Markdown 中 @ 用户的语法
+const larkCardAtTemplate = `<at id=%s></at>`
+
+// larkAtAll @ 所有人使用的用户 ID
+const larkAtAll = "all"
+
 func getLarkContent(userIDS []string, context string) string {
 	res := ""
 	for _, userID := range userIDS {
@@ -15,3 +30,74 @@ func getLarkContent(userIDS []string, context string) string {
 	}
 	return res + "\n" + context
 }
+
+// getCardContent 在卡片 Markdown 内容末尾 @ 用户
+func getCardContent(userIDS []string, content string) string {
+	res := ""
+	for _, userID := range userIDS {
+		res += fmt.Sprintf(larkCardAtTemplate, userID)
+	}
+	if res == "" {
+		return content
+	}
+	return content + "\n" + res
+}
+
+// sign 按飞书自定义机器人的签名规则计算签名
+// sign = base64(HmacSHA256(key=timestamp + "\n" + secret, data=""))，timestamp 为秒级时间戳
+func sign(secret string, now time.Time) (timestamp, signature string) {
+	timestamp = strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return timestamp, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// robotMessage 按消息类型生成机器人消息，title 为卡片标题
+func robotMessage(c *LarkAlertContext, title, content string, users []string) (map[string]any, error) {
+	if c.AtAll {
+		users = append(users[:len(users):len(users)], larkAtAll)
+	}
+	switch c.MsgType {
+	case "", common.MsgTypeText:
+		return map[string]any{
+			"msg_type": "text",
+			"content":  map[string]any{"text": getLarkContent(users, content)},
+		}, nil
+	case common.MsgTypeMarkdown:
+		return map[string]any{
+			"msg_type": "interactive",
+			"card": map[string]any{
+				"config":   map[string]any{"wide_screen_mode": true},
+				"elements": []any{map[string]any{"tag": "markdown", "content": getCardContent(users, content)}},
+			},
+		}, nil
+	case common.MsgTypeCard:
+		color := "red"
+		if c.Message.Data != nil && c.Message.Status == "resolved" {
+			color = "green"
+		}
+		elements := []any{map[string]any{"tag": "markdown", "content": getCardContent(users, content)}}
+		if c.Message.Data != nil && c.Message.ExternalURL != "" {
+			elements = append(elements, map[string]any{
+				"tag": "action",
+				"actions": []any{map[string]any{
+					"tag":  "button",
+					"text": map[string]any{"tag": "plain_text", "content": "查看详情"},
+					"type": "primary",
+					"url":  c.Message.ExternalURL,
+				}},
+			})
+		}
+		return map[string]any{
+			"msg_type": "interactive",
+			"card": map[string]any{
+				"config": map[string]any{"wide_screen_mode": true},
+				"header": map[string]any{
+					"title":    map[string]any{"tag": "plain_text", "content": title},
+					"template": color,
+				},
+				"elements": elements,
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("[alert]:lark msg_type %s is not supported", c.MsgType)
+}
@@ -0,0 +1,97 @@
+package lark
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/internal/alerttest"
+)
+
+// TestSign 测试签名与飞书的校验规则一致
+func TestSign(t *testing.T) {
+	timestamp, signature := sign("secret", time.Unix(1700000000, 0))
+	assert.Equal(t, "1700000000", timestamp)
+
+	mac := hmac.New(sha256.New, []byte("1700000000\nsecret"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), signature)
+}
+
+// TestLarkAlertExecute 测试不同消息类型和 @ 用户
+func TestLarkAlertExecute(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    LarkAlertContext
+		status string
+		verify func(t *testing.T, req map[string]any)
+	}{
+		{
+			name:   "文本消息@用户",
+			ctx:    LarkAlertContext{},
+			status: "firing",
+			verify: func(t *testing.T, req map[string]any) {
+				assert.Equal(t, "text", req["msg_type"])
+				assert.Contains(t, req["content"].(map[string]any)["text"], `<at user_id="ou_1">Tom</at>`)
+				assert.Nil(t, req["sign"])
+			},
+		},
+		{
+			name:   "Markdown消息@所有人并签名",
+			ctx:    LarkAlertContext{MsgType: common.MsgTypeMarkdown, Secret: "secret", AtAll: true},
+			status: "firing",
+			verify: func(t *testing.T, req map[string]any) {
+				assert.Equal(t, "interactive", req["msg_type"])
+				elements := req["card"].(map[string]any)["elements"].([]any)
+				require.Len(t, elements, 1)
+				content := elements[0].(map[string]any)["content"].(string)
+				assert.Contains(t, content, "**HighCPU**")
+				assert.Contains(t, content, "<at id=ou_1></at><at id=all></at>")
+
+				timestamp, err := strconv.ParseInt(req["timestamp"].(string), 10, 64)
+				require.NoError(t, err)
+				_, signature := sign("secret", time.Unix(timestamp, 0))
+				assert.Equal(t, signature, req["sign"])
+			},
+		},
+		{
+			name:   "恢复的卡片消息",
+			ctx:    LarkAlertContext{MsgType: common.MsgTypeCard},
+			status: "resolved",
+			verify: func(t *testing.T, req map[string]any) {
+				assert.Equal(t, "interactive", req["msg_type"])
+				card := req["card"].(map[string]any)
+				header := card["header"].(map[string]any)
+				assert.Equal(t, "green", header["template"])
+				assert.Equal(t, "[prod] 恢复 1 条告警", header["title"].(map[string]any)["content"])
+				elements := card["elements"].([]any)
+				require.Len(t, elements, 2)
+				button := elements[1].(map[string]any)["actions"].([]any)[0].(map[string]any)
+				assert.Equal(t, "http://alertmanager:9093", button["url"])
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, `{"code":0,"msg":"success"}`))
+			c := tt.ctx
+			c.Message, c.Title, c.Webhook = alerttest.HighCPUMessage(tt.status), "prod", ts.URL
+			require.NoError(t, NewLarkAlert().Execute(&c, []string{"ou_1"}))
+			require.Len(t, *requests, 1)
+			tt.verify(t, alerttest.JSON[map[string]any](t, (*requests)[0]))
+		})
+	}
+}
+
+// TestLarkAlertError 测试飞书返回错误码
+func TestLarkAlertError(t *testing.T) {
+	ts, _ := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, `{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`))
+	c := &LarkAlertContext{Message: alerttest.HighCPUMessage("firing"), Title: "prod", Webhook: ts.URL, Secret: "secret", MsgType: common.MsgTypeCard}
+	assert.ErrorContains(t, NewLarkAlert().Execute(c, nil), "sign match fail")
+}
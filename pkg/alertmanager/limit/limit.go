@@ -0,0 +1,129 @@
+// Package limit 可插拔的告警限流器
+//
+// Limiter 按限流键（key）计数，KeyFunc 决定告警使用哪个键：按接收者、告警方式、告警名称或它们的组合。
+// 内置的限流器：
+//   - TokenBucket：进程内令牌桶，每个键一个桶
+//   - SlidingWindow：进程内滑动窗口日志，window 内最多允许 limit 条
+//   - Redis：基于 Redis 的滑动窗口，通过 Lua 脚本原子地计数，多个 Webhook 副本共享同一额度
+//
+// 限流器可以通过 WebhookServer 的 WithLimiter 按告警过滤，也可以通过 NewLimitOption 适配为
+// common.LimitOption，传给告警方式的 WithLimit。
+package limit
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// Limiter 按键限流的限流器
+type Limiter interface {
+	// Allow 判断 key 是否还可以发送一条告警，允许时占用一次额度
+	Allow(ctx context.Context, key string) (bool, error)
+}
+
+// Target 告警的发送目标
+type Target struct {
+	Receiver string
+	Method   string
+}
+
+// Report 被限流没有发送的告警
+type Report struct {
+	Target
+	GroupKey string
+	Alerts   template.Alerts
+}
+
+// ReportFunc 上报被限流的告警，例如写入审计日志或发送到其他通道
+type ReportFunc func(r Report)
+
+// KeyFunc 计算告警的限流键，返回空字符串时不限流
+type KeyFunc func(target Target, alert template.Alert) string
+
+// Global 所有告警共用一个限流键
+func Global(Target, template.Alert) string {
+	return "global"
+}
+
+// ByReceiver 按接收者限流
+func ByReceiver(target Target, _ template.Alert) string {
+	return "receiver=" + target.Receiver
+}
+
+// ByMethod 按告警方式限流
+func ByMethod(target Target, _ template.Alert) string {
+	return "method=" + target.Method
+}
+
+// ByAlertName 按告警名称限流
+func ByAlertName(_ Target, alert template.Alert) string {
+	return "alertname=" + alert.Labels["alertname"]
+}
+
+// Keys 组合多个 KeyFunc，例如 Keys(ByReceiver, ByAlertName) 按接收者和告警名称限流
+// 任一 KeyFunc 返回空字符串时不限流
+func Keys(funcs ...KeyFunc) KeyFunc {
+	return func(target Target, alert template.Alert) string {
+		keys := make([]string, 0, len(funcs))
+		for _, fn := range funcs {
+			key := fn(target, alert)
+			if key == "" {
+				return ""
+			}
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, ",")
+	}
+}
+
+// Filter 按限流键依次判断消息中的每条告警，返回允许发送的告警和被限流的告警
+// 限流器出错时记录日志并放行，避免限流器不可用时丢失告警
+func Filter(ctx context.Context, limiter Limiter, keyFunc KeyFunc, target Target, alerts []template.Alert) (allowed, limited template.Alerts) {
+	if keyFunc == nil {
+		keyFunc = Global
+	}
+	for _, alert := range alerts {
+		key := keyFunc(target, alert)
+		if key == "" {
+			allowed = append(allowed, alert)
+			continue
+		}
+		ok, err := limiter.Allow(ctx, key)
+		if err != nil {
+			slog.Error("Limiter, allow failed, let alert through", slog.String("key", key), slog.Any("err", err))
+			ok = true
+		}
+		if ok {
+			allowed = append(allowed, alert)
+		} else {
+			limited = append(limited, alert)
+		}
+	}
+	return allowed, limited
+}
+
+// limitOption 使用固定键的 common.LimitOption
+type limitOption struct {
+	limiter Limiter
+	key     string
+}
+
+// NewLimitOption 将限流器适配为 common.LimitOption，所有调用使用同一个 key，
+// 例如 dingtalk.NewDingtalkAlert().WithLimit(limit.NewLimitOption(redisLimiter, "dingtalk"))
+// 限流器出错时记录日志并放行
+func NewLimitOption(limiter Limiter, key string) common.LimitOption {
+	return &limitOption{limiter: limiter, key: key}
+}
+
+func (o *limitOption) Allow() bool {
+	ok, err := o.limiter.Allow(context.Background(), o.key)
+	if err != nil {
+		slog.Error("Limiter, allow failed, let alert through", slog.String("key", o.key), slog.Any("err", err))
+		return true
+	}
+	return ok
+}
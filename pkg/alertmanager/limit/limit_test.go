@@ -0,0 +1,199 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTarget = Target{Receiver: "ops", Method: "dingtalk"}
+
+func testAlert(name string) template.Alert {
+	return template.Alert{Status: "firing", Labels: template.KV{"alertname": name}, Fingerprint: name}
+}
+
+// TestKeyFunc 测试限流键的计算
+func TestKeyFunc(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyFunc KeyFunc
+		want    string
+	}{
+		{name: "全局", keyFunc: Global, want: "global"},
+		{name: "按接收者", keyFunc: ByReceiver, want: "receiver=ops"},
+		{name: "按告警方式", keyFunc: ByMethod, want: "method=dingtalk"},
+		{name: "按告警名称", keyFunc: ByAlertName, want: "alertname=HighCPU"},
+		{name: "组合", keyFunc: Keys(ByReceiver, ByAlertName), want: "receiver=ops,alertname=HighCPU"},
+		{name: "组合中有空键时不限流", keyFunc: Keys(ByReceiver, func(Target, template.Alert) string { return "" }), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.keyFunc(testTarget, testAlert("HighCPU")))
+		})
+	}
+}
+
+// allowN 连续调用 n 次 Allow，返回允许的次数
+func allowN(t *testing.T, limiter Limiter, key string, n int) int {
+	t.Helper()
+	allowed := 0
+	for i := 0; i < n; i++ {
+		ok, err := limiter.Allow(context.Background(), key)
+		require.NoError(t, err)
+		if ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+// TestTokenBucket 测试每个键使用独立的令牌桶
+func TestTokenBucket(t *testing.T) {
+	limiter, err := NewTokenBucket(1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, allowN(t, limiter, "a", 5))
+	assert.Equal(t, 2, allowN(t, limiter, "b", 5), "不同的键互不影响")
+
+	// 空闲超过 capacity/rate 的令牌桶已经补满，清理后不再占用内存
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	now = now.Add(time.Second)
+	allowN(t, limiter, "a", 1)
+	now = now.Add(1500 * time.Millisecond)
+	allowN(t, limiter, "c", 1)
+	assert.Contains(t, limiter.buckets, "a")
+	assert.NotContains(t, limiter.buckets, "b")
+
+	_, err = NewTokenBucket(0, 1)
+	assert.Error(t, err)
+}
+
+// TestSlidingWindow 测试滑动窗口内最多允许 limit 条，旧记录移出窗口后恢复额度
+func TestSlidingWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter, err := NewSlidingWindow(2, time.Minute, WithNow(func() time.Time { return now }))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, allowN(t, limiter, "a", 1))
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, 1, allowN(t, limiter, "a", 3))
+	assert.Equal(t, 2, allowN(t, limiter, "b", 3), "不同的键互不影响")
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, 1, allowN(t, limiter, "a", 3), "第一条移出窗口")
+
+	// 超过一个窗口后清理不再出现的键
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 2, allowN(t, limiter, "c", 2))
+	assert.NotContains(t, limiter.logs, "a")
+	assert.NotContains(t, limiter.logs, "b")
+
+	_, err = NewSlidingWindow(1, 0)
+	assert.Error(t, err)
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+// TestRedis 测试多个副本共享 Redis 中的额度
+func TestRedis(t *testing.T) {
+	mr, client := newTestRedis(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := WithRedisNow(func() time.Time { return now })
+	replica1, err := NewRedis(client, 3, time.Minute, clock)
+	require.NoError(t, err)
+	replica2, err := NewRedis(client, 3, time.Minute, clock)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, allowN(t, replica1, "a", 2))
+	assert.Equal(t, 1, allowN(t, replica2, "a", 2), "同一毫秒内的记录不会互相覆盖")
+	assert.Equal(t, 3, allowN(t, replica2, "b", 5), "不同的键互不影响")
+	assert.True(t, mr.Exists("alert:limit:a"))
+	assert.Equal(t, time.Minute, mr.TTL("alert:limit:a"))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, 3, allowN(t, replica1, "a", 5), "窗口之外的记录被清理")
+
+	other, err := NewRedis(client, 1, time.Minute, clock, WithPrefix("other:"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, allowN(t, other, "a", 2), "不同前缀使用不同的额度")
+
+	mr.SetError("connection refused")
+	_, err = replica1.Allow(context.Background(), "a")
+	assert.ErrorContains(t, err, "redis limit a failed")
+}
+
+// TestRedisConcurrent 测试并发调用时不会超过额度
+func TestRedisConcurrent(t *testing.T) {
+	_, client := newTestRedis(t)
+	limiter, err := NewRedis(client, 10, time.Minute)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := limiter.Allow(context.Background(), "a")
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 10, allowed)
+}
+
+// errLimiter 总是返回错误的限流器
+type errLimiter struct{}
+
+func (errLimiter) Allow(context.Context, string) (bool, error) {
+	return false, errors.New("unavailable")
+}
+
+// TestFilter 测试按告警名称过滤被限流的告警，限流器出错时放行
+func TestFilter(t *testing.T) {
+	limiter, err := NewSlidingWindow(1, time.Minute)
+	require.NoError(t, err)
+	alerts := []template.Alert{testAlert("HighCPU"), testAlert("HighCPU"), testAlert("DiskFull")}
+
+	allowed, limited := Filter(context.Background(), limiter, ByAlertName, testTarget, alerts)
+	assert.Equal(t, template.Alerts{alerts[0], alerts[2]}, allowed)
+	assert.Equal(t, template.Alerts{alerts[1]}, limited)
+
+	allowed, limited = Filter(context.Background(), limiter, nil, testTarget, alerts)
+	assert.Equal(t, template.Alerts{alerts[0]}, allowed, "没有 KeyFunc 时使用全局键")
+	assert.Len(t, limited, 2)
+
+	allowed, limited = Filter(context.Background(), errLimiter{}, ByAlertName, testTarget, alerts)
+	assert.Len(t, allowed, 3)
+	assert.Empty(t, limited)
+}
+
+// TestNewLimitOption 测试适配为告警方式的 LimitOption
+func TestNewLimitOption(t *testing.T) {
+	limiter, err := NewSlidingWindow(1, time.Minute)
+	require.NoError(t, err)
+	option := NewLimitOption(limiter, "dingtalk")
+	assert.True(t, option.Allow())
+	assert.False(t, option.Allow())
+	assert.True(t, NewLimitOption(errLimiter{}, "dingtalk").Allow(), "限流器出错时放行")
+}
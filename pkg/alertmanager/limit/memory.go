@@ -0,0 +1,148 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// Option SlidingWindow 配置选项
+type Option func(*SlidingWindow)
+
+// WithNow 替换当前时间，用于测试
+func WithNow(now func() time.Time) Option {
+	return func(w *SlidingWindow) {
+		if now != nil {
+			w.now = now
+		}
+	}
+}
+
+// TokenBucket 进程内令牌桶限流器，每个键一个 common.TokenBucket
+type TokenBucket struct {
+	mu       sync.Mutex
+	rate     int
+	capacity int
+	// idle 令牌桶从空到补满需要的时间，空闲超过 idle 的令牌桶与新建的相同，可以删除
+	idle      time.Duration
+	buckets   map[string]*tokenBucketEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// tokenBucketEntry 一个键的令牌桶和最后使用的时间
+type tokenBucketEntry struct {
+	bucket   *common.TokenBucket
+	lastUsed time.Time
+}
+
+var _ Limiter = (*TokenBucket)(nil)
+
+// NewTokenBucket 创建令牌桶限流器
+// rate: 每个键每秒生成的令牌数
+// capacity: 每个键的令牌桶容量
+func NewTokenBucket(rate, capacity int) (*TokenBucket, error) {
+	if rate <= 0 || capacity <= 0 {
+		return nil, errors.New("[alert]:token bucket rate and capacity must be positive")
+	}
+	now := time.Now()
+	return &TokenBucket{
+		rate:      rate,
+		capacity:  capacity,
+		idle:      time.Duration(capacity) * time.Second / time.Duration(rate),
+		buckets:   make(map[string]*tokenBucketEntry),
+		lastSweep: now,
+		now:       time.Now,
+	}, nil
+}
+
+func (b *TokenBucket) Allow(_ context.Context, key string) (bool, error) {
+	b.mu.Lock()
+	now := b.now()
+	// 每隔 idle 清理一次已经补满的令牌桶，避免不再出现的键一直占用内存
+	if now.Sub(b.lastSweep) >= b.idle {
+		for k, entry := range b.buckets {
+			if now.Sub(entry.lastUsed) >= b.idle {
+				delete(b.buckets, k)
+			}
+		}
+		b.lastSweep = now
+	}
+	entry, ok := b.buckets[key]
+	if !ok {
+		entry = &tokenBucketEntry{bucket: common.NewTokenBucket(b.rate, b.capacity)}
+		b.buckets[key] = entry
+	}
+	entry.lastUsed = now
+	b.mu.Unlock()
+	return entry.bucket.Allow(), nil
+}
+
+// SlidingWindow 进程内滑动窗口日志限流器，记录每个键在 window 内的发送时间，最多允许 limit 条
+// 与令牌桶相比没有突发，任意长度为 window 的区间内都不会超过 limit 条
+type SlidingWindow struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	logs      map[string][]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+var _ Limiter = (*SlidingWindow)(nil)
+
+// NewSlidingWindow 创建滑动窗口限流器，每个键在 window 内最多允许 limit 条
+func NewSlidingWindow(limit int, window time.Duration, opts ...Option) (*SlidingWindow, error) {
+	if limit <= 0 || window <= 0 {
+		return nil, errors.New("[alert]:sliding window limit and window must be positive")
+	}
+	w := &SlidingWindow{
+		limit:  limit,
+		window: window,
+		logs:   make(map[string][]time.Time),
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.lastSweep = w.now()
+	return w, nil
+}
+
+func (w *SlidingWindow) Allow(_ context.Context, key string) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	// 每个窗口清理一次所有键的过期记录，避免不再出现的键一直占用内存
+	if now.Sub(w.lastSweep) >= w.window {
+		for k := range w.logs {
+			w.prune(k, now)
+		}
+		w.lastSweep = now
+	}
+	if len(w.prune(key, now)) >= w.limit {
+		return false, nil
+	}
+	w.logs[key] = append(w.logs[key], now)
+	return true, nil
+}
+
+// prune 删除键在窗口之外的记录，返回剩余的记录
+func (w *SlidingWindow) prune(key string, now time.Time) []time.Time {
+	log := w.logs[key]
+	start := now.Add(-w.window)
+	i := 0
+	for i < len(log) && !log[i].After(start) {
+		i++
+	}
+	if i == len(log) {
+		delete(w.logs, key)
+		return nil
+	}
+	log = log[i:]
+	w.logs[key] = log
+	return log
+}
@@ -0,0 +1,106 @@
+package limit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultRedisPrefix Redis 限流键的默认前缀
+const defaultRedisPrefix = "alert:limit:"
+
+// slidingWindowScript 滑动窗口计数，在一个脚本中完成清理、计数和记录，多个副本并发调用时保证原子性
+// KEYS[1]: 限流键；ARGV: 当前时间（毫秒）、窗口长度（毫秒）、限制条数、本次记录的唯一成员
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], window)
+return 1
+`)
+
+// RedisOption Redis 配置选项
+type RedisOption func(*Redis)
+
+// WithPrefix 设置 Redis 键的前缀，默认 alert:limit:，不同的限流策略应使用不同的前缀
+func WithPrefix(prefix string) RedisOption {
+	return func(r *Redis) {
+		r.prefix = prefix
+	}
+}
+
+// WithRedisNow 替换当前时间，用于测试
+func WithRedisNow(now func() time.Time) RedisOption {
+	return func(r *Redis) {
+		if now != nil {
+			r.now = now
+		}
+	}
+}
+
+// Redis 基于 Redis 有序集合的滑动窗口限流器，每个键在 window 内最多允许 limit 条
+// 计数由 Lua 脚本原子地完成，多个 Webhook 副本使用同一个 Redis 时共享额度
+// 时间取自调用方，各副本的时钟偏差会影响窗口边界
+type Redis struct {
+	client redis.UniversalClient
+	limit  int
+	window time.Duration
+	prefix string
+	now    func() time.Time
+	// id 和 seq 生成有序集合的成员，保证同一毫秒内多次记录不会互相覆盖
+	id  string
+	seq atomic.Uint64
+}
+
+var _ Limiter = (*Redis)(nil)
+
+// NewRedis 创建 Redis 限流器，client 可以是单机、哨兵或集群客户端
+//
+//	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+//	limiter, _ := limit.NewRedis(client, 10, time.Minute)
+func NewRedis(client redis.UniversalClient, limit int, window time.Duration, opts ...RedisOption) (*Redis, error) {
+	if client == nil {
+		return nil, errors.New("[alert]:redis client is nil")
+	}
+	if limit <= 0 || window < time.Millisecond {
+		return nil, errors.New("[alert]:redis limit must be positive and window at least 1ms")
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("[alert]:generate redis limiter id failed: %w", err)
+	}
+	r := &Redis{
+		client: client,
+		limit:  limit,
+		window: window,
+		prefix: defaultRedisPrefix,
+		now:    time.Now,
+		id:     hex.EncodeToString(id),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+func (r *Redis) Allow(ctx context.Context, key string) (bool, error) {
+	now := r.now().UnixMilli()
+	member := r.id + ":" + strconv.FormatUint(r.seq.Add(1), 10)
+	res, err := slidingWindowScript.Run(ctx, r.client, []string{r.prefix + key},
+		now, r.window.Milliseconds(), r.limit, member).Int()
+	if err != nil {
+		return false, fmt.Errorf("[alert]:redis limit %s failed: %w", key, err)
+	}
+	return res == 1, nil
+}
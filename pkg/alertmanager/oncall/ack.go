@@ -0,0 +1,60 @@
+package oncall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// AckRequest 确认事件的请求
+type AckRequest struct {
+	Key  string `json:"key"`
+	User string `json:"user"`
+}
+
+type ackResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AckHandler 返回确认事件的 http.Handler，接收 POST 的 AckRequest，事件不存在时返回 404
+//
+//	curl -XPOST localhost:8080/oncall/ack -d '{"key":"{}:{alertname=\"HighCPU\"}","user":"zhangsan"}'
+func AckHandler(o *OnCall) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeResult(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		req := AckRequest{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeResult(w, http.StatusBadRequest, fmt.Errorf("decode request failed: %w", err))
+			return
+		}
+		if req.Key == "" || req.User == "" {
+			writeResult(w, http.StatusBadRequest, errors.New("key and user are required"))
+			return
+		}
+		if err := o.Ack(req.Key, req.User); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, ErrIncidentNotFound) {
+				code = http.StatusNotFound
+			}
+			writeResult(w, code, err)
+			return
+		}
+		writeResult(w, http.StatusOK, nil)
+	})
+}
+
+func writeResult(w http.ResponseWriter, code int, err error) {
+	res := ackResult{Status: "success"}
+	if err != nil {
+		res = ackResult{Status: "error", Error: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
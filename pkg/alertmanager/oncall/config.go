@@ -0,0 +1,120 @@
+// Package oncall 值班表和升级策略
+//
+// 值班表（Schedule）按轮值层计算某一时刻的值班人员，AlertStrategyManager 可以在发送时
+// 将 users 中的 oncall:<值班表> 替换为当前的值班人员。
+// 升级策略（EscalationPolicy）按级别依次通知：先通知第一级，超过 EscalateAfter 仍未确认时通知下一级，
+// 确认（Ack）或恢复后停止升级。状态保存在内存中。
+//
+//	schedules:
+//	  - name: primary
+//	    layers:
+//	      - users: [zhangsan, lisi, wangwu]
+//	        handoff: weekly
+//	        start: 2024-01-01T20:00:00+08:00
+//	escalation_policies:
+//	  - name: critical
+//	    levels:
+//	      - schedules: [primary]
+//	        escalate_after: 15m
+//	      - users: [leader]
+package oncall
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultEscalateAfter 升级到下一级前默认的等待时间
+const defaultEscalateAfter = prommodel.Duration(30 * time.Minute)
+
+// Config 值班配置
+type Config struct {
+	Schedules []Schedule         `json:"schedules"`
+	Policies  []EscalationPolicy `json:"escalation_policies,omitempty"`
+}
+
+// EscalationPolicy 升级策略
+type EscalationPolicy struct {
+	Name   string  `json:"name"`
+	Levels []Level `json:"levels"`
+	// Repeat 通知完所有级别后仍未确认时，从第一级重新开始的次数
+	Repeat int `json:"repeat,omitempty"`
+}
+
+// Level 升级策略的一级，通知值班表中当前的值班人员和指定的用户
+type Level struct {
+	Schedules []string `json:"schedules,omitempty"`
+	Users     []string `json:"users,omitempty"`
+	// EscalateAfter 通知后等待确认的时间，超时后通知下一级，默认 30m
+	EscalateAfter prommodel.Duration `json:"escalate_after,omitempty"`
+}
+
+// Load 从 YAML 或 JSON 文件加载值班配置
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse 解析 YAML 或 JSON 格式的值班配置
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("[alert]:parse oncall config failed: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 校验值班表和升级策略，升级策略引用的值班表必须存在
+func (c *Config) Validate() error {
+	schedules := make(map[string]struct{}, len(c.Schedules))
+	for i := range c.Schedules {
+		if err := c.Schedules[i].Validate(); err != nil {
+			return err
+		}
+		if _, ok := schedules[c.Schedules[i].Name]; ok {
+			return fmt.Errorf("[alert]:schedule %s is duplicated", c.Schedules[i].Name)
+		}
+		schedules[c.Schedules[i].Name] = struct{}{}
+	}
+	policies := make(map[string]struct{}, len(c.Policies))
+	for _, policy := range c.Policies {
+		if policy.Name == "" {
+			return errors.New("[alert]:escalation policy name is empty")
+		}
+		if _, ok := policies[policy.Name]; ok {
+			return fmt.Errorf("[alert]:escalation policy %s is duplicated", policy.Name)
+		}
+		policies[policy.Name] = struct{}{}
+		if len(policy.Levels) == 0 {
+			return fmt.Errorf("[alert]:escalation policy %s has no levels", policy.Name)
+		}
+		if policy.Repeat < 0 {
+			return fmt.Errorf("[alert]:escalation policy %s repeat is negative", policy.Name)
+		}
+		for i, level := range policy.Levels {
+			if len(level.Schedules) == 0 && len(level.Users) == 0 {
+				return fmt.Errorf("[alert]:escalation policy %s level %d has no schedules or users", policy.Name, i+1)
+			}
+			if level.EscalateAfter < 0 {
+				return fmt.Errorf("[alert]:escalation policy %s level %d escalate_after is negative", policy.Name, i+1)
+			}
+			for _, name := range level.Schedules {
+				if _, ok := schedules[name]; !ok {
+					return fmt.Errorf("[alert]:escalation policy %s level %d: schedule %s not found", policy.Name, i+1, name)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package oncall
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+const (
+	defaultTickInterval = 10 * time.Second
+
+	// UserPrefix users 中以该前缀开头的用户会替换为值班表当前的值班人员，例如 oncall:primary
+	UserPrefix = "oncall:"
+)
+
+var (
+	// ErrIncidentNotFound 事件不存在或已经恢复
+	ErrIncidentNotFound = errors.New("[alert]:incident not found")
+	// ErrStopped OnCall 已经停止
+	ErrStopped = errors.New("[alert]:oncall is stopped")
+)
+
+// Notification 升级策略一级的通知
+type Notification struct {
+	// Key 事件的唯一标识，通常为 Alertmanager 消息的 GroupKey
+	Key    string
+	Policy string
+	// Level 通知的级别，从 1 开始
+	Level   int
+	Users   []string
+	Message common.CustomMsg
+}
+
+// NotifyFunc 通知一级的值班人员，返回错误时只记录日志，不影响后续升级
+type NotifyFunc func(n Notification) error
+
+// Option OnCall 配置选项
+type Option func(*OnCall)
+
+// WithNow 替换当前时间，用于测试
+func WithNow(now func() time.Time) Option {
+	return func(o *OnCall) {
+		if now != nil {
+			o.now = now
+		}
+	}
+}
+
+// WithTickInterval 设置检查事件是否需要升级的间隔，默认 10s
+func WithTickInterval(interval time.Duration) Option {
+	return func(o *OnCall) {
+		if interval > 0 {
+			o.tickInterval = interval
+		}
+	}
+}
+
+// Incident 升级中的事件
+type Incident struct {
+	Key    string `json:"key"`
+	Policy string `json:"policy"`
+	// Level 最后一次通知的级别，从 1 开始
+	Level int `json:"level"`
+	// Round 从第一级重新开始的次数
+	Round       int       `json:"round"`
+	TriggeredAt time.Time `json:"triggered_at"`
+	NotifiedAt  time.Time `json:"notified_at"`
+	// EscalateAt 下一次升级的时间，确认后或没有下一级时为零值
+	EscalateAt time.Time        `json:"escalate_at,omitempty"`
+	AckedBy    string           `json:"acked_by,omitempty"`
+	AckedAt    time.Time        `json:"acked_at,omitempty"`
+	Message    common.CustomMsg `json:"-"`
+}
+
+// OnCall 值班表和升级策略，按配置计算值班人员并在事件未确认时逐级通知
+//
+//	oc, _ := oncall.New(cfg, func(n oncall.Notification) error {
+//		c, err := manager.NewAlertContext(common.MethodDingtalk, n.Message, dingtalkConfig)
+//		if err != nil {
+//			return err
+//		}
+//		return manager.Execute(common.MethodDingtalk, c, n.Users)
+//	})
+//	oc.Start()
+//	oc.Trigger(msg.GroupKey, "critical", msg)
+type OnCall struct {
+	mu           sync.Mutex
+	schedules    map[string]*Schedule
+	policies     map[string]*EscalationPolicy
+	incidents    map[string]*Incident
+	notify       NotifyFunc
+	tickInterval time.Duration
+	now          func() time.Time
+
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stopped   bool
+}
+
+// New 创建 OnCall，notify 为空时只能用于计算值班人员
+func New(cfg *Config, notify NotifyFunc, opts ...Option) (*OnCall, error) {
+	if cfg == nil {
+		return nil, errors.New("[alert]:oncall config is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	o := &OnCall{
+		schedules:    make(map[string]*Schedule, len(cfg.Schedules)),
+		policies:     make(map[string]*EscalationPolicy, len(cfg.Policies)),
+		incidents:    make(map[string]*Incident),
+		notify:       notify,
+		tickInterval: defaultTickInterval,
+		now:          time.Now,
+		stopCh:       make(chan struct{}),
+		doneCh:       make(chan struct{}),
+	}
+	for i := range cfg.Schedules {
+		schedule := cfg.Schedules[i]
+		schedule.Overrides = append([]Override(nil), schedule.Overrides...)
+		o.schedules[schedule.Name] = &schedule
+	}
+	for i := range cfg.Policies {
+		policy := cfg.Policies[i]
+		o.policies[policy.Name] = &policy
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o, nil
+}
+
+// Start 启动定时升级检查
+func (o *OnCall) Start() {
+	o.startOnce.Do(func() {
+		go o.loop()
+	})
+}
+
+// Stop 停止定时升级检查，必须在 Start 之后调用
+func (o *OnCall) Stop() {
+	o.stopOnce.Do(func() {
+		close(o.stopCh)
+		<-o.doneCh
+
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.stopped = true
+	})
+}
+
+func (o *OnCall) loop() {
+	defer close(o.doneCh)
+	ticker := time.NewTicker(o.tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.stopCh:
+			return
+		case <-ticker.C:
+			o.process(o.now())
+		}
+	}
+}
+
+// OnCallUser 返回值班表当前的值班人员
+func (o *OnCall) OnCallUser(schedule string) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.onCallLocked(schedule, o.now())
+}
+
+func (o *OnCall) onCallLocked(schedule string, at time.Time) (string, error) {
+	s, ok := o.schedules[schedule]
+	if !ok {
+		return "", fmt.Errorf("[alert]:schedule %s not found", schedule)
+	}
+	user, ok := s.OnCall(at)
+	if !ok {
+		return "", fmt.Errorf("[alert]:schedule %s has nobody on call", schedule)
+	}
+	return user, nil
+}
+
+// ResolveUsers 将 users 中的 oncall:<值班表> 替换为当前的值班人员，其他用户保持不变，结果去重
+func (o *OnCall) ResolveUsers(users []string) ([]string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := o.now()
+	res := make([]string, 0, len(users))
+	for _, user := range users {
+		if schedule, ok := strings.CutPrefix(user, UserPrefix); ok {
+			onCall, err := o.onCallLocked(schedule, now)
+			if err != nil {
+				return nil, err
+			}
+			user = onCall
+		}
+		res = appendUnique(res, user)
+	}
+	return res, nil
+}
+
+// AddOverride 为值班表添加临时替班，后添加的替班优先
+func (o *OnCall) AddOverride(schedule string, override Override) error {
+	if err := override.validate(); err != nil {
+		return fmt.Errorf("[alert]:schedule %s: %w", schedule, err)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s, ok := o.schedules[schedule]
+	if !ok {
+		return fmt.Errorf("[alert]:schedule %s not found", schedule)
+	}
+	// 清理已经结束的替班
+	now := o.now()
+	overrides := s.Overrides[:0]
+	for _, existing := range s.Overrides {
+		if existing.End.After(now) {
+			overrides = append(overrides, existing)
+		}
+	}
+	s.Overrides = append(overrides, override)
+	return nil
+}
+
+// Trigger 按升级策略开始通知事件，立即通知第一级
+// 事件已存在时只更新消息，消息状态为 resolved 时结束事件
+func (o *OnCall) Trigger(key, policy string, msg common.CustomMsg) error {
+	if msg.Data != nil && msg.Status == "resolved" {
+		o.Resolve(key)
+		return nil
+	}
+
+	o.mu.Lock()
+	if o.stopped {
+		o.mu.Unlock()
+		return ErrStopped
+	}
+	if _, ok := o.policies[policy]; !ok {
+		o.mu.Unlock()
+		return fmt.Errorf("[alert]:escalation policy %s not found", policy)
+	}
+	if incident, ok := o.incidents[key]; ok {
+		incident.Message = msg
+		o.mu.Unlock()
+		return nil
+	}
+	now := o.now()
+	incident := &Incident{Key: key, Policy: policy, TriggeredAt: now, Message: msg}
+	o.incidents[key] = incident
+	n := o.escalateLocked(incident, now)
+	o.mu.Unlock()
+
+	return o.send(n)
+}
+
+// Ack 确认事件，停止升级
+func (o *OnCall) Ack(key, user string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	incident, ok := o.incidents[key]
+	if !ok {
+		return ErrIncidentNotFound
+	}
+	if incident.AckedBy != "" {
+		return nil
+	}
+	incident.AckedBy = user
+	incident.AckedAt = o.now()
+	incident.EscalateAt = time.Time{}
+	slog.Info("OnCall, incident acknowledged", slog.String("key", key), slog.String("user", user), slog.Int("level", incident.Level))
+	return nil
+}
+
+// Resolve 结束事件，事件不存在时忽略
+func (o *OnCall) Resolve(key string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.incidents, key)
+}
+
+// Incidents 返回所有未恢复的事件，按触发时间排序
+func (o *OnCall) Incidents() []Incident {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	res := make([]Incident, 0, len(o.incidents))
+	for _, incident := range o.incidents {
+		res = append(res, *incident)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].TriggeredAt.Equal(res[j].TriggeredAt) {
+			return res[i].Key < res[j].Key
+		}
+		return res[i].TriggeredAt.Before(res[j].TriggeredAt)
+	})
+	return res
+}
+
+// process 通知所有到达升级时间的事件的下一级
+func (o *OnCall) process(now time.Time) {
+	o.mu.Lock()
+	var notifications []Notification
+	for _, incident := range o.incidents {
+		if incident.EscalateAt.IsZero() || now.Before(incident.EscalateAt) {
+			continue
+		}
+		notifications = append(notifications, o.escalateLocked(incident, now))
+	}
+	o.mu.Unlock()
+
+	for _, n := range notifications {
+		o.send(n)
+	}
+}
+
+// escalateLocked 将事件升级到下一级，返回需要发送的通知
+// 最后一级之后按 Repeat 从第一级重新开始，次数用完后不再升级
+func (o *OnCall) escalateLocked(incident *Incident, now time.Time) Notification {
+	policy := o.policies[incident.Policy]
+	if incident.Level == len(policy.Levels) {
+		incident.Level = 0
+		incident.Round++
+	}
+	incident.Level++
+	incident.NotifiedAt = now
+
+	level := policy.Levels[incident.Level-1]
+	escalateAfter := time.Duration(level.EscalateAfter)
+	if escalateAfter == 0 {
+		escalateAfter = time.Duration(defaultEscalateAfter)
+	}
+	incident.EscalateAt = now.Add(escalateAfter)
+	if incident.Level == len(policy.Levels) && incident.Round >= policy.Repeat {
+		incident.EscalateAt = time.Time{}
+	}
+
+	var users []string
+	for _, schedule := range level.Schedules {
+		user, err := o.onCallLocked(schedule, now)
+		if err != nil {
+			slog.Warn("OnCall, resolve on-call user failed", slog.String("key", incident.Key), slog.Any("err", err))
+			continue
+		}
+		users = appendUnique(users, user)
+	}
+	users = appendUnique(users, level.Users...)
+	return Notification{
+		Key:     incident.Key,
+		Policy:  incident.Policy,
+		Level:   incident.Level,
+		Users:   users,
+		Message: incident.Message,
+	}
+}
+
+// send 发送通知，没有设置 notify 或没有可通知的用户时只记录日志
+func (o *OnCall) send(n Notification) error {
+	if len(n.Users) == 0 {
+		slog.Warn("OnCall, no users to notify", slog.String("key", n.Key), slog.String("policy", n.Policy), slog.Int("level", n.Level))
+		return nil
+	}
+	if o.notify == nil {
+		return nil
+	}
+	slog.Info("OnCall, notify escalation level", slog.String("key", n.Key), slog.String("policy", n.Policy), slog.Int("level", n.Level), slog.Any("users", n.Users))
+	if err := o.notify(n); err != nil {
+		slog.Error("OnCall, notify failed", slog.String("key", n.Key), slog.Int("level", n.Level), slog.Any("err", err))
+		return err
+	}
+	return nil
+}
+
+func appendUnique(values []string, add ...string) []string {
+	for _, value := range add {
+		exists := false
+		for _, v := range values {
+			if v == value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,265 @@
+package oncall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+const testConfig = `
+schedules:
+  - name: primary
+    layers:
+      - name: 全天
+        users: [zhangsan, lisi, wangwu]
+        handoff: weekly
+        start: 2024-01-01T20:00:00+08:00
+      - name: 工作日白班
+        users: [day1, day2]
+        handoff: daily
+        shift_length: 2
+        start: 2024-01-01T00:00:00+08:00
+        restrictions:
+          - weekdays: ['monday:friday']
+            times: [{start_time: '09:00', end_time: '18:00'}]
+            location: Asia/Shanghai
+  - name: secondary
+    layers:
+      - users: [leader]
+        handoff: daily
+        start: 2024-01-01T00:00:00Z
+escalation_policies:
+  - name: critical
+    repeat: 1
+    levels:
+      - schedules: [primary]
+        escalate_after: 15m
+      - schedules: [secondary]
+        users: [manager]
+        escalate_after: 10m
+`
+
+var shanghai, _ = time.LoadLocation("Asia/Shanghai")
+
+func newTestOnCall(t *testing.T, notify NotifyFunc, now *time.Time) *OnCall {
+	t.Helper()
+	cfg, err := Parse([]byte(testConfig))
+	require.NoError(t, err)
+	o, err := New(cfg, notify, WithNow(func() time.Time { return *now }))
+	require.NoError(t, err)
+	return o
+}
+
+// TestScheduleOnCall 测试轮值交接、轮值层优先级和时间限制
+func TestScheduleOnCall(t *testing.T) {
+	now := time.Now()
+	o := newTestOnCall(t, nil, &now)
+	schedule := o.schedules["primary"]
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{name: "开始前没有值班人员", at: time.Date(2024, 1, 1, 19, 0, 0, 0, shanghai), want: ""},
+		{name: "第一周夜间", at: time.Date(2024, 1, 1, 20, 0, 0, 0, shanghai), want: "zhangsan"},
+		{name: "交接前一刻", at: time.Date(2024, 1, 8, 19, 59, 0, 0, shanghai), want: "zhangsan"},
+		{name: "周末按周交接", at: time.Date(2024, 1, 13, 10, 0, 0, 0, shanghai), want: "lisi"},
+		{name: "轮值一圈后重新开始", at: time.Date(2024, 1, 22, 20, 0, 0, 0, shanghai), want: "zhangsan"},
+		{name: "工作时间白班优先", at: time.Date(2024, 1, 2, 9, 0, 0, 0, shanghai), want: "day1"},
+		{name: "白班每两天交接", at: time.Date(2024, 1, 3, 17, 59, 0, 0, shanghai), want: "day2"},
+		{name: "白班下班后", at: time.Date(2024, 1, 3, 18, 0, 0, 0, shanghai), want: "zhangsan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, ok := schedule.OnCall(tt.at)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, user)
+		})
+	}
+}
+
+// TestScheduleDaylightSaving 测试夏令时切换后仍在当地时间交接
+func TestScheduleDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	layer := Layer{Users: []string{"a", "b"}, Handoff: HandoffDaily, Start: time.Date(2024, 3, 9, 9, 0, 0, 0, newYork)}
+	require.NoError(t, layer.validate())
+
+	// 2024-03-10 开始夏令时，这一天只有 23 小时
+	user, _ := layer.onCall(time.Date(2024, 3, 10, 8, 59, 0, 0, newYork))
+	assert.Equal(t, "a", user)
+	user, _ = layer.onCall(time.Date(2024, 3, 10, 9, 0, 0, 0, newYork))
+	assert.Equal(t, "b", user)
+}
+
+// TestOnCallOverride 测试临时替班和解析 oncall: 用户
+func TestOnCallOverride(t *testing.T) {
+	now := time.Date(2024, 1, 1, 20, 0, 0, 0, shanghai)
+	o := newTestOnCall(t, nil, &now)
+
+	users, err := o.ResolveUsers([]string{"oncall:primary", "ops", "zhangsan"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zhangsan", "ops"}, users)
+
+	require.NoError(t, o.AddOverride("primary", Override{User: "lisi", Start: now.Add(-time.Hour), End: now.Add(time.Hour)}))
+	user, err := o.OnCallUser("primary")
+	require.NoError(t, err)
+	assert.Equal(t, "lisi", user)
+
+	now = now.Add(time.Hour)
+	user, err = o.OnCallUser("primary")
+	require.NoError(t, err)
+	assert.Equal(t, "zhangsan", user, "替班结束")
+
+	// 添加替班时清理已经结束的替班
+	require.NoError(t, o.AddOverride("primary", Override{User: "wangwu", Start: now, End: now.Add(time.Hour)}))
+	assert.Len(t, o.schedules["primary"].Overrides, 1)
+
+	assert.ErrorContains(t, o.AddOverride("primary", Override{User: "a", Start: now, End: now}), "ends before start")
+	assert.ErrorContains(t, o.AddOverride("none", Override{User: "a", Start: now, End: now.Add(time.Hour)}), "schedule none not found")
+	_, err = o.ResolveUsers([]string{"oncall:none"})
+	assert.ErrorContains(t, err, "schedule none not found")
+}
+
+// recorder 记录发送的通知
+type recorder struct {
+	mu            sync.Mutex
+	notifications []string
+}
+
+func (r *recorder) notify(n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, strings.Join(n.Users, ","))
+	return nil
+}
+
+// take 返回并清空已发送的通知
+func (r *recorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.notifications
+	r.notifications = nil
+	return res
+}
+
+func testMessage(status string) common.CustomMsg {
+	return common.CustomMsg{Message: webhook.Message{
+		GroupKey: "{}:{alertname=\"HighCPU\"}",
+		Data: &template.Data{
+			Status: status,
+			Alerts: template.Alerts{{Status: status, Labels: template.KV{"alertname": "HighCPU"}}},
+		},
+	}}
+}
+
+// TestOnCallEscalation 测试超时未确认时逐级通知，通知完所有级别后按 repeat 重新开始
+func TestOnCallEscalation(t *testing.T) {
+	now := time.Date(2024, 1, 1, 20, 0, 0, 0, shanghai)
+	r := &recorder{}
+	o := newTestOnCall(t, r.notify, &now)
+
+	require.NoError(t, o.Trigger("k", "critical", testMessage("firing")))
+	assert.Equal(t, []string{"zhangsan"}, r.take())
+	require.NoError(t, o.Trigger("k", "critical", testMessage("firing")))
+	assert.Empty(t, r.take(), "重复触发不会重新通知")
+
+	steps := []struct {
+		after time.Duration
+		want  []string
+	}{
+		{after: 14 * time.Minute},
+		{after: time.Minute, want: []string{"leader,manager"}},
+		{after: 10 * time.Minute, want: []string{"zhangsan"}},
+		{after: 15 * time.Minute, want: []string{"leader,manager"}},
+		// 重复次数用完后不再升级
+		{after: time.Hour},
+	}
+	for _, step := range steps {
+		now = now.Add(step.after)
+		o.process(now)
+		assert.Equal(t, step.want, r.take(), now)
+	}
+	incidents := o.Incidents()
+	require.Len(t, incidents, 1)
+	assert.Equal(t, 2, incidents[0].Level)
+	assert.Equal(t, 1, incidents[0].Round)
+	assert.True(t, incidents[0].EscalateAt.IsZero())
+
+	require.NoError(t, o.Trigger("k", "critical", testMessage("resolved")))
+	assert.Empty(t, o.Incidents(), "恢复后结束事件")
+	assert.ErrorContains(t, o.Trigger("k", "none", testMessage("firing")), "escalation policy none not found")
+}
+
+// TestOnCallAck 测试确认后停止升级
+func TestOnCallAck(t *testing.T) {
+	now := time.Date(2024, 1, 1, 20, 0, 0, 0, shanghai)
+	r := &recorder{}
+	o := newTestOnCall(t, r.notify, &now)
+	ts := httptest.NewServer(AckHandler(o))
+	defer ts.Close()
+
+	require.NoError(t, o.Trigger("k", "critical", testMessage("firing")))
+	assert.Equal(t, []string{"zhangsan"}, r.take())
+
+	now = now.Add(5 * time.Minute)
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "非法 JSON", body: "{", wantCode: http.StatusBadRequest},
+		{name: "缺少用户", body: `{"key":"k"}`, wantCode: http.StatusBadRequest},
+		{name: "事件不存在", body: `{"key":"none","user":"zhangsan"}`, wantCode: http.StatusNotFound},
+		{name: "确认成功", body: `{"key":"k","user":"zhangsan"}`, wantCode: http.StatusOK},
+		{name: "重复确认", body: `{"key":"k","user":"lisi"}`, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL, "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+		})
+	}
+
+	now = now.Add(time.Hour)
+	o.process(now)
+	assert.Empty(t, r.take(), "确认后不再升级")
+	incidents := o.Incidents()
+	require.Len(t, incidents, 1)
+	assert.Equal(t, "zhangsan", incidents[0].AckedBy)
+	assert.Equal(t, time.Date(2024, 1, 1, 20, 5, 0, 0, shanghai), incidents[0].AckedAt)
+}
+
+// TestParse 测试值班配置的校验
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "值班表没有轮值层", config: `schedules: [{name: a}]`, wantErr: "schedule a has no layers"},
+		{name: "轮值层没有用户", config: `schedules: [{name: a, layers: [{handoff: daily, start: 2024-01-01T00:00:00Z}]}]`, wantErr: "layer 0: no users"},
+		{name: "交接周期不支持", config: `schedules: [{name: a, layers: [{users: [a], handoff: monthly, start: 2024-01-01T00:00:00Z}]}]`, wantErr: `handoff "monthly" is not supported`},
+		{name: "值班表重复", config: `schedules: [{name: a, layers: [{users: [a], handoff: daily, start: 2024-01-01T00:00:00Z}]}, {name: a, layers: [{users: [a], handoff: daily, start: 2024-01-01T00:00:00Z}]}]`, wantErr: "schedule a is duplicated"},
+		{name: "升级策略引用的值班表不存在", config: `escalation_policies: [{name: p, levels: [{schedules: [none]}]}]`, wantErr: "level 1: schedule none not found"},
+		{name: "升级策略级别为空", config: `escalation_policies: [{name: p, levels: [{}]}]`, wantErr: "level 1 has no schedules or users"},
+		{name: "等待时间格式错误", config: `escalation_policies: [{name: p, levels: [{users: [a], escalate_after: 1x}]}]`, wantErr: "parse oncall config failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.config))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
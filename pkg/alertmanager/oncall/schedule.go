@@ -0,0 +1,162 @@
+package oncall
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/alertmanager/timeinterval"
+)
+
+const (
+	// HandoffDaily 每天交接
+	HandoffDaily = "daily"
+	// HandoffWeekly 每周交接
+	HandoffWeekly = "weekly"
+)
+
+// Schedule 值班表，由多个轮值层和临时替班组成
+// 同一时刻后面的轮值层优先于前面的轮值层，替班优先于所有轮值层
+type Schedule struct {
+	Name      string     `json:"name"`
+	Layers    []Layer    `json:"layers"`
+	Overrides []Override `json:"overrides,omitempty"`
+}
+
+// Layer 轮值层，Users 按顺序轮流值班
+//
+//	name: 工作日白班
+//	users: [zhangsan, lisi]
+//	handoff: weekly
+//	start: 2024-01-01T09:00:00+08:00
+//	restrictions:
+//	  - weekdays: ['monday:friday']
+//	    times: [{start_time: '09:00', end_time: '18:00'}]
+//	    location: Asia/Shanghai
+type Layer struct {
+	Name  string   `json:"name,omitempty"`
+	Users []string `json:"users"`
+	// Handoff 交接周期：daily 或 weekly
+	Handoff string `json:"handoff"`
+	// ShiftLength 每人连续值班的交接周期数，默认 1
+	ShiftLength int `json:"shift_length,omitempty"`
+	// Start 第一个人开始值班的时间，之后在 Start 所在时区的同一时刻交接
+	Start time.Time `json:"start"`
+	// End 轮值层结束的时间，为空时一直生效
+	End *time.Time `json:"end,omitempty"`
+	// Restrictions 只在这些时间区间内值班，为空时全天值班，格式与 Alertmanager 的 time_intervals 相同
+	Restrictions []timeinterval.TimeInterval `json:"restrictions,omitempty"`
+}
+
+// Override 临时替班，[Start, End) 内由 User 值班
+type Override struct {
+	User  string    `json:"user"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Validate 校验值班表
+func (s *Schedule) Validate() error {
+	if s.Name == "" {
+		return errors.New("[alert]:schedule name is empty")
+	}
+	if len(s.Layers) == 0 {
+		return fmt.Errorf("[alert]:schedule %s has no layers", s.Name)
+	}
+	for i, layer := range s.Layers {
+		if err := layer.validate(); err != nil {
+			return fmt.Errorf("[alert]:schedule %s layer %d: %w", s.Name, i, err)
+		}
+	}
+	for _, override := range s.Overrides {
+		if err := override.validate(); err != nil {
+			return fmt.Errorf("[alert]:schedule %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (l *Layer) validate() error {
+	if len(l.Users) == 0 {
+		return errors.New("no users")
+	}
+	if l.Handoff != HandoffDaily && l.Handoff != HandoffWeekly {
+		return fmt.Errorf("handoff %q is not supported", l.Handoff)
+	}
+	if l.ShiftLength < 0 {
+		return errors.New("shift_length is negative")
+	}
+	if l.Start.IsZero() {
+		return errors.New("start is empty")
+	}
+	if l.End != nil && !l.End.After(l.Start) {
+		return errors.New("end is before start")
+	}
+	return nil
+}
+
+func (o *Override) validate() error {
+	if o.User == "" {
+		return errors.New("override user is empty")
+	}
+	if !o.End.After(o.Start) {
+		return fmt.Errorf("override of %s ends before start", o.User)
+	}
+	return nil
+}
+
+// OnCall 返回 at 时刻的值班人员，没有人值班时返回 false
+func (s *Schedule) OnCall(at time.Time) (string, bool) {
+	for i := len(s.Overrides) - 1; i >= 0; i-- {
+		override := s.Overrides[i]
+		if !at.Before(override.Start) && at.Before(override.End) {
+			return override.User, true
+		}
+	}
+	for i := len(s.Layers) - 1; i >= 0; i-- {
+		if user, ok := s.Layers[i].onCall(at); ok {
+			return user, true
+		}
+	}
+	return "", false
+}
+
+// onCall 返回轮值层在 at 时刻的值班人员
+func (l *Layer) onCall(at time.Time) (string, bool) {
+	if at.Before(l.Start) || (l.End != nil && !at.Before(*l.End)) {
+		return "", false
+	}
+	if len(l.Restrictions) > 0 {
+		allowed := false
+		for _, restriction := range l.Restrictions {
+			if restriction.ContainsTime(at) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", false
+		}
+	}
+	days := 1
+	if l.Handoff == HandoffWeekly {
+		days = 7
+	}
+	if l.ShiftLength > 0 {
+		days *= l.ShiftLength
+	}
+	shift := elapsedDays(l.Start, at) / days
+	return l.Users[shift%len(l.Users)], true
+}
+
+// elapsedDays 返回 start 之后经过的完整天数，按 start 所在时区的日历计算，夏令时切换不影响交接时刻
+func elapsedDays(start, at time.Time) int {
+	at = at.In(start.Location())
+	y1, m1, d1 := start.Date()
+	y2, m2, d2 := at.Date()
+	days := int(time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC).Sub(time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	if start.AddDate(0, 0, days).After(at) {
+		days--
+	}
+	return days
+}
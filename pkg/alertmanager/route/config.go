@@ -0,0 +1,141 @@
+// Package route 按告警标签将告警路由到接收者
+//
+// 路由配置是一棵树：告警从根路由开始，依次尝试子路由，命中第一个匹配的子路由后继续向下匹配，
+// 子路由设置了 continue 时还会继续尝试后面的兄弟路由；没有子路由匹配时由当前路由处理。
+// 路由可以设置静音时间区间（mute_time_intervals）和生效时间区间（active_time_intervals），
+// 命中但处于静音状态的路由不会发送，也不会继续尝试兄弟路由。
+//
+//	route:
+//	  receiver: default
+//	  routes:
+//	    - matchers: ['severity="critical"', 'env!~"dev|test"']
+//	      receiver: oncall
+//	      methods: [dingtalk]
+//	      active_time_intervals: [workhours]
+//	      continue: true
+//	    - matchers: ['team="db"']
+//	      receiver: dba
+//	time_intervals:
+//	  - name: workhours
+//	    time_intervals:
+//	      - weekdays: ['monday:friday']
+//	        times: [{start_time: '09:00', end_time: '18:00'}]
+//	        location: Asia/Shanghai
+package route
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/timeinterval"
+	"sigs.k8s.io/yaml"
+)
+
+// Config 路由配置
+type Config struct {
+	// Route 根路由，匹配所有告警，必须设置 receiver
+	Route *Route `json:"route"`
+	// TimeIntervals 路由引用的时间区间
+	TimeIntervals []TimeInterval `json:"time_intervals,omitempty"`
+}
+
+// TimeInterval 命名的时间区间，满足其中任意一个区间即认为在时间区间内
+// 区间的格式与 Alertmanager 的 time_intervals 相同，通过 location 指定时区，默认 UTC
+type TimeInterval struct {
+	Name          string                      `json:"name"`
+	TimeIntervals []timeinterval.TimeInterval `json:"time_intervals"`
+}
+
+// Route 路由节点
+type Route struct {
+	// Receiver 接收者名称，对应 WebhookConfig 中的 receiver，为空时继承父路由
+	Receiver string `json:"receiver,omitempty"`
+	// Methods 只使用接收者的这些告警方式，为空时继承父路由，都为空时使用接收者的所有告警方式
+	Methods []string `json:"methods,omitempty"`
+	// Matchers 告警标签需要满足的所有条件，支持 =、!=、=~、!~，例如 severity=~"critical|warning"
+	Matchers []string `json:"matchers,omitempty"`
+	// Continue 命中后继续尝试后面的兄弟路由
+	Continue bool `json:"continue,omitempty"`
+	// MuteTimeIntervals 在这些时间区间内静音
+	MuteTimeIntervals []string `json:"mute_time_intervals,omitempty"`
+	// ActiveTimeIntervals 只在这些时间区间内发送，为空时一直发送
+	ActiveTimeIntervals []string `json:"active_time_intervals,omitempty"`
+	Routes              []*Route `json:"routes,omitempty"`
+
+	id       string
+	matchers labels.Matchers
+}
+
+// Load 从 YAML 或 JSON 文件加载路由配置
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse 解析 YAML 或 JSON 格式的路由配置
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("[alert]:parse route config failed: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 校验根路由设置了接收者、匹配条件格式正确、引用的时间区间都存在
+func (c *Config) Validate() error {
+	if c.Route == nil {
+		return errors.New("[alert]:route is empty")
+	}
+	if c.Route.Receiver == "" {
+		return errors.New("[alert]:root route has no receiver")
+	}
+	if len(c.Route.Matchers) > 0 {
+		return errors.New("[alert]:root route must not have matchers")
+	}
+	names := make(map[string]struct{}, len(c.TimeIntervals))
+	for _, interval := range c.TimeIntervals {
+		if interval.Name == "" {
+			return errors.New("[alert]:time interval name is empty")
+		}
+		if _, ok := names[interval.Name]; ok {
+			return fmt.Errorf("[alert]:time interval %s is duplicated", interval.Name)
+		}
+		names[interval.Name] = struct{}{}
+	}
+	return c.Route.compile("root", names)
+}
+
+// compile 解析匹配条件并生成路由 ID，ID 由父路由 ID 和子路由的下标组成，例如 root/0/1
+func (r *Route) compile(id string, intervals map[string]struct{}) error {
+	r.id = id
+	r.matchers = make(labels.Matchers, 0, len(r.Matchers))
+	for _, s := range r.Matchers {
+		m, err := labels.ParseMatcher(s)
+		if err != nil {
+			return fmt.Errorf("[alert]:route %s: invalid matcher %q: %w", id, s, err)
+		}
+		r.matchers = append(r.matchers, m)
+	}
+	for _, name := range append(r.MuteTimeIntervals[:len(r.MuteTimeIntervals):len(r.MuteTimeIntervals)], r.ActiveTimeIntervals...) {
+		if _, ok := intervals[name]; !ok {
+			return fmt.Errorf("[alert]:route %s: time interval %s not found", id, name)
+		}
+	}
+	for i, child := range r.Routes {
+		if child == nil {
+			return fmt.Errorf("[alert]:route %s/%d is empty", id, i)
+		}
+		if err := child.compile(fmt.Sprintf("%s/%d", id, i), intervals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// DryRunRequest 预览路由的请求，Time 为空时使用当前时间
+type DryRunRequest struct {
+	Labels template.KV `json:"labels"`
+	Time   *time.Time  `json:"time,omitempty"`
+}
+
+// DryRunResponse 预览路由的结果
+type DryRunResponse struct {
+	Time   time.Time `json:"time"`
+	Routes []Result  `json:"routes"`
+}
+
+// DryRun 返回告警标签命中的路由，不会发送告警
+func (r *Router) DryRun(req DryRunRequest) DryRunResponse {
+	at := time.Now()
+	if req.Time != nil {
+		at = *req.Time
+	}
+	return DryRunResponse{Time: at, Routes: r.Match(req.Labels, at)}
+}
+
+// DryRunHandler 返回预览路由的 http.Handler，接收 POST 的 DryRunRequest，返回 DryRunResponse
+//
+//	curl -XPOST localhost:8080/routes/test -d '{"labels":{"severity":"critical"},"time":"2024-01-01T10:00:00+08:00"}'
+func DryRunHandler(router *Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		req := DryRunRequest{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("decode request failed: %w", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(router.DryRun(req))
+	})
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"status": "error", "error": err.Error()})
+}
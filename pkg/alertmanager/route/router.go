@@ -0,0 +1,197 @@
+package route
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/timeinterval"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// Result 告警命中的路由
+type Result struct {
+	// ID 路由 ID，例如 root/0/1
+	ID       string   `json:"id"`
+	Receiver string   `json:"receiver"`
+	Methods  []string `json:"methods,omitempty"`
+	Matchers []string `json:"matchers,omitempty"`
+	Continue bool     `json:"continue,omitempty"`
+	// Muted 路由处于静音时间区间，或不在生效时间区间内
+	Muted bool `json:"muted"`
+	// MutedBy 导致静音的时间区间名称，不在生效时间区间内时为所有生效时间区间的名称
+	MutedBy []string `json:"muted_by,omitempty"`
+}
+
+// Message 发送给一个路由的告警
+type Message struct {
+	Result
+	Message common.CustomMsg
+}
+
+// Router 按路由树查找告警的接收者，创建后只读，可以并发使用
+type Router struct {
+	root      *Route
+	intervals map[string][]timeinterval.TimeInterval
+}
+
+// NewRouter 校验配置并创建 Router
+func NewRouter(cfg *Config) (*Router, error) {
+	if cfg == nil {
+		return nil, errors.New("[alert]:route config is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	r := &Router{root: cfg.Route, intervals: make(map[string][]timeinterval.TimeInterval, len(cfg.TimeIntervals))}
+	for _, interval := range cfg.TimeIntervals {
+		r.intervals[interval.Name] = interval.TimeIntervals
+	}
+	return r, nil
+}
+
+// Receivers 返回所有路由使用的接收者及其限定的告警方式，用于校验接收者和告警方式都已配置
+func (r *Router) Receivers() map[string][]string {
+	res := make(map[string][]string)
+	var walk func(route *Route, receiver string, methods []string)
+	walk = func(route *Route, receiver string, methods []string) {
+		if route.Receiver != "" {
+			receiver = route.Receiver
+		}
+		if len(route.Methods) > 0 {
+			methods = route.Methods
+		}
+		if _, ok := res[receiver]; !ok {
+			res[receiver] = nil
+		}
+		res[receiver] = appendUnique(res[receiver], methods...)
+		for _, child := range route.Routes {
+			walk(child, receiver, methods)
+		}
+	}
+	walk(r.root, "", nil)
+	return res
+}
+
+// Match 返回告警在 at 时刻命中的所有路由，包括处于静音状态的路由，可用于预览路由结果
+func (r *Router) Match(labels template.KV, at time.Time) []Result {
+	return r.match(r.root, Result{}, labels, at)
+}
+
+// match 告警匹配 route 时返回命中的路由，parent 为父路由的结果，用于继承接收者和告警方式
+func (r *Router) match(route *Route, parent Result, labels template.KV, at time.Time) []Result {
+	for _, m := range route.matchers {
+		if !m.Matches(labels[m.Name]) {
+			return nil
+		}
+	}
+	current := Result{
+		ID:       route.id,
+		Receiver: parent.Receiver,
+		Methods:  parent.Methods,
+		Matchers: route.Matchers,
+		Continue: route.Continue,
+	}
+	if route.Receiver != "" {
+		current.Receiver = route.Receiver
+	}
+	if len(route.Methods) > 0 {
+		current.Methods = route.Methods
+	}
+
+	var res []Result
+	for _, child := range route.Routes {
+		matched := r.match(child, current, labels, at)
+		if len(matched) == 0 {
+			continue
+		}
+		res = append(res, matched...)
+		if !child.Continue {
+			break
+		}
+	}
+	if len(res) > 0 {
+		return res
+	}
+	current.MutedBy = r.mutedBy(route, at)
+	current.Muted = len(current.MutedBy) > 0
+	return []Result{current}
+}
+
+// mutedBy 返回导致路由在 at 时刻静音的时间区间
+func (r *Router) mutedBy(route *Route, at time.Time) []string {
+	var res []string
+	for _, name := range route.MuteTimeIntervals {
+		if r.contains(name, at) {
+			res = append(res, name)
+		}
+	}
+	if len(route.ActiveTimeIntervals) == 0 {
+		return res
+	}
+	for _, name := range route.ActiveTimeIntervals {
+		if r.contains(name, at) {
+			return res
+		}
+	}
+	return append(res, route.ActiveTimeIntervals...)
+}
+
+func (r *Router) contains(name string, at time.Time) bool {
+	for _, interval := range r.intervals[name] {
+		if interval.ContainsTime(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// Split 按路由拆分消息中的告警，每个命中的路由生成一条消息，消息的 Receiver 为路由的接收者
+// 处于静音状态的路由不会生成消息，返回的消息按路由 ID 排序
+func (r *Router) Split(msg common.CustomMsg, at time.Time) []Message {
+	if msg.Data == nil {
+		return nil
+	}
+	results := make(map[string]Result)
+	alerts := make(map[string][]template.Alert)
+	for _, alert := range msg.Alerts {
+		for _, result := range r.Match(alert.Labels, at) {
+			if result.Muted {
+				continue
+			}
+			results[result.ID] = result
+			alerts[result.ID] = append(alerts[result.ID], alert)
+		}
+	}
+
+	res := make([]Message, 0, len(results))
+	for id, result := range results {
+		res = append(res, Message{Result: result, Message: subMessage(msg, result.Receiver, alerts[id])})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// subMessage 构造只包含部分告警的消息，接收者为路由的接收者
+func subMessage(msg common.CustomMsg, receiver string, alerts []template.Alert) common.CustomMsg {
+	msg = msg.WithAlerts(alerts)
+	msg.Data.Receiver = receiver
+	return msg
+}
+
+func appendUnique(values []string, add ...string) []string {
+	for _, value := range add {
+		exists := false
+		for _, v := range values {
+			if v == value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			values = append(values, value)
+		}
+	}
+	return values
+}
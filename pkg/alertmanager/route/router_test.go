@@ -0,0 +1,230 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+const testConfig = `
+route:
+  receiver: default
+  routes:
+    - matchers: ['severity="critical"', 'env!~"dev|test"']
+      receiver: oncall
+      methods: [dingtalk]
+      continue: true
+      routes:
+        - matchers: ['team="db"']
+          receiver: dba
+          active_time_intervals: [workhours]
+    - matchers: ['team=~"db|cache"']
+      receiver: storage
+      mute_time_intervals: [weekend]
+    - matchers: ['severity!="info"']
+      receiver: ops
+time_intervals:
+  - name: workhours
+    time_intervals:
+      - weekdays: ['monday:friday']
+        times: [{start_time: '09:00', end_time: '18:00'}]
+        location: Asia/Shanghai
+  - name: weekend
+    time_intervals:
+      - weekdays: ['saturday', 'sunday']
+        location: Asia/Shanghai
+`
+
+func newTestRouter(t *testing.T) *Router {
+	t.Helper()
+	cfg, err := Parse([]byte(testConfig))
+	require.NoError(t, err)
+	router, err := NewRouter(cfg)
+	require.NoError(t, err)
+	return router
+}
+
+// routeIDs 返回命中的路由 ID，静音的路由加上 muted 前缀
+func routeIDs(results []Result) []string {
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		id := result.ID + ":" + result.Receiver
+		if result.Muted {
+			id = "muted " + id
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// TestRouterMatch 测试匹配条件、continue 和接收者继承
+func TestRouterMatch(t *testing.T) {
+	// 2024-01-03 是星期三，北京时间 10:00
+	workday := time.Date(2024, 1, 3, 2, 0, 0, 0, time.UTC)
+	router := newTestRouter(t)
+	tests := []struct {
+		name   string
+		labels template.KV
+		want   []string
+	}{
+		{name: "没有匹配的子路由时使用根路由", labels: template.KV{"severity": "info"}, want: []string{"root:default"}},
+		{name: "等值匹配", labels: template.KV{"severity": "warning"}, want: []string{"root/2:ops"}},
+		{name: "continue 后继续匹配兄弟路由", labels: template.KV{"severity": "critical", "team": "cache"}, want: []string{"root/0:oncall", "root/1:storage"}},
+		{name: "正则不匹配时跳过路由", labels: template.KV{"severity": "critical", "env": "dev"}, want: []string{"root/2:ops"}},
+		{name: "命中嵌套路由", labels: template.KV{"severity": "critical", "team": "db"}, want: []string{"root/0/0:dba", "root/1:storage"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, routeIDs(router.Match(tt.labels, workday)))
+		})
+	}
+
+	// 嵌套路由继承父路由限定的告警方式
+	results := router.Match(template.KV{"severity": "critical", "team": "db"}, workday)
+	assert.Equal(t, []string{"dingtalk"}, results[0].Methods)
+	assert.Empty(t, results[1].Methods)
+}
+
+// TestRouterTimeIntervals 测试按时区计算的静音时间区间和生效时间区间
+func TestRouterTimeIntervals(t *testing.T) {
+	router := newTestRouter(t)
+	labels := template.KV{"severity": "critical", "team": "db"}
+	tests := []struct {
+		name string
+		at   time.Time
+		want []string
+	}{
+		{name: "工作时间", at: time.Date(2024, 1, 3, 2, 0, 0, 0, time.UTC), want: []string{"root/0/0:dba", "root/1:storage"}},
+		// UTC 时间仍在工作时间内，北京时间已经 19:00
+		{name: "下班后不在生效时间区间", at: time.Date(2024, 1, 3, 11, 0, 0, 0, time.UTC), want: []string{"muted root/0/0:dba", "root/1:storage"}},
+		// UTC 时间是星期五，北京时间已经是星期六
+		{name: "周末静音", at: time.Date(2024, 1, 5, 17, 0, 0, 0, time.UTC), want: []string{"muted root/0/0:dba", "muted root/1:storage"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, routeIDs(router.Match(labels, tt.at)))
+		})
+	}
+
+	results := router.Match(labels, time.Date(2024, 1, 6, 2, 0, 0, 0, time.UTC))
+	assert.Equal(t, []string{"workhours"}, results[0].MutedBy)
+	assert.Equal(t, []string{"weekend"}, results[1].MutedBy)
+}
+
+// TestRouterSplit 测试按路由拆分消息，静音的路由不发送
+func TestRouterSplit(t *testing.T) {
+	router := newTestRouter(t)
+	newAlert := func(status string, labels template.KV) template.Alert {
+		return template.Alert{Status: status, Labels: labels, Annotations: template.KV{"summary": "test"}}
+	}
+	msg := common.CustomMsg{Message: webhook.Message{
+		Version:  "4",
+		GroupKey: "{}:{}",
+		Data: &template.Data{
+			Receiver:     "alertmanager",
+			Status:       "firing",
+			ExternalURL:  "http://alertmanager:9093",
+			CommonLabels: template.KV{},
+			Alerts: template.Alerts{
+				newAlert("firing", template.KV{"alertname": "A", "severity": "critical", "team": "db"}),
+				newAlert("resolved", template.KV{"alertname": "B", "severity": "warning", "team": "cache"}),
+				newAlert("firing", template.KV{"alertname": "C", "severity": "info"}),
+			},
+		},
+	}}
+
+	// 星期六：dba 不在生效时间区间，storage 静音
+	messages := router.Split(msg, time.Date(2024, 1, 6, 2, 0, 0, 0, time.UTC))
+	require.Len(t, messages, 1)
+	assert.Equal(t, "root", messages[0].ID)
+	assert.Equal(t, "default", messages[0].Message.Receiver)
+	require.Len(t, messages[0].Message.Alerts, 1)
+	assert.Equal(t, "C", messages[0].Message.Alerts[0].Labels["alertname"])
+
+	// 工作时间
+	messages = router.Split(msg, time.Date(2024, 1, 3, 2, 0, 0, 0, time.UTC))
+	require.Len(t, messages, 3)
+	assert.Equal(t, []string{"root", "root/0/0", "root/1"}, []string{messages[0].ID, messages[1].ID, messages[2].ID})
+
+	storage := messages[2].Message
+	assert.Equal(t, "storage", storage.Receiver)
+	assert.Equal(t, "firing", storage.Status)
+	assert.Len(t, storage.Alerts, 2)
+	assert.Equal(t, template.KV{"summary": "test"}, storage.CommonAnnotations)
+	assert.Empty(t, storage.CommonLabels)
+	assert.Equal(t, "http://alertmanager:9093", storage.ExternalURL)
+	assert.Equal(t, "{}:{}", storage.GroupKey)
+	assert.Equal(t, "alertmanager", msg.Receiver, "不应修改原消息")
+}
+
+// TestRouterReceivers 测试返回路由使用的接收者和告警方式
+func TestRouterReceivers(t *testing.T) {
+	assert.Equal(t, map[string][]string{
+		"default": nil,
+		"oncall":  {"dingtalk"},
+		"dba":     {"dingtalk"},
+		"storage": nil,
+		"ops":     nil,
+	}, newTestRouter(t).Receivers())
+}
+
+// TestParse 测试路由配置的校验
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "没有根路由", config: `time_intervals: []`, wantErr: "route is empty"},
+		{name: "根路由没有接收者", config: `route: {routes: [{receiver: a}]}`, wantErr: "root route has no receiver"},
+		{name: "根路由有匹配条件", config: `route: {receiver: a, matchers: ['a="b"']}`, wantErr: "root route must not have matchers"},
+		{name: "匹配条件格式错误", config: `route: {receiver: a, routes: [{matchers: ['a=~"("']}]}`, wantErr: `route root/0: invalid matcher`},
+		{name: "时间区间不存在", config: `route: {receiver: a, routes: [{routes: [{mute_time_intervals: [night]}]}]}`, wantErr: "route root/0/0: time interval night not found"},
+		{name: "时间区间重复", config: `{route: {receiver: a}, time_intervals: [{name: a}, {name: a}]}`, wantErr: "time interval a is duplicated"},
+		{name: "未知字段", config: `route: {receiver: a, group_by: [a]}`, wantErr: "parse route config failed"},
+		{name: "时区不存在", config: `{route: {receiver: a}, time_intervals: [{name: a, time_intervals: [{location: Mars/Olympus}]}]}`, wantErr: "parse route config failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.config))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+// TestDryRunHandler 测试通过 HTTP 预览路由
+func TestDryRunHandler(t *testing.T) {
+	ts := httptest.NewServer(DryRunHandler(newTestRouter(t)))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "application/json",
+		strings.NewReader(`{"labels":{"severity":"critical","team":"db"},"time":"2024-01-03T19:00:00+08:00"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	res := DryRunResponse{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.True(t, res.Time.Equal(time.Date(2024, 1, 3, 11, 0, 0, 0, time.UTC)))
+	assert.Equal(t, []string{"muted root/0/0:dba", "root/1:storage"}, routeIDs(res.Routes))
+	assert.Equal(t, []string{`team="db"`}, res.Routes[0].Matchers)
+
+	resp, err = http.Post(ts.URL, "application/json", strings.NewReader("{"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -1,29 +1,164 @@
 package script
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
-	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/prometheus/alertmanager/template"
 	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
 	"github.piwriw.go-tools/pkg/httputil"
 )
 
+// DefaultTemplate 脚本 --msg 参数默认使用的模板名称，每条告警渲染一次，.Alerts 中只包含当前告警
+const DefaultTemplate = "script.message"
+
+const (
+	// DefaultTimeout 脚本默认的执行超时时间
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxOutputSize 默认保存的标准输出和标准错误的最大长度
+	DefaultMaxOutputSize = 64 << 10
+	// SeverityAll 匹配所有告警级别
+	SeverityAll = "*"
+)
+
+// DefaultSeverities 默认触发脚本的告警级别，与 severity 标签中冒号前的部分比较
+var DefaultSeverities = []string{"严重", "致命"}
+
 // ScriptAlert 脚本告警策略
 type ScriptAlert struct {
 	Client     *http.Client
 	LimitFunc  common.LimitOption
 	BeforeHook common.HookFunc
 	AfterHook  common.HookFunc
+	// Templates 消息模板，未设置或模板不存在时使用内置的消息格式
+	Templates *tmpl.Templates
+	// AllowedScripts 允许执行的脚本路径，支持 filepath.Match 的通配符，例如 /opt/alert/*.sh
+	// 为空且没有设置 AllowAll 时拒绝执行所有脚本
+	AllowedScripts []string
+	// AllowAll 允许执行任意脚本，忽略 AllowedScripts，只应在脚本路径完全可信时使用
+	AllowAll bool
+	// IsolateEnv 脚本只继承 PATH、HOME、LANG、TZ 环境变量，避免泄露服务自身的密钥，默认继承服务的所有环境变量
+	IsolateEnv bool
+	// Timeout 脚本的执行超时时间，默认 DefaultTimeout
+	Timeout time.Duration
+	// MaxOutputSize 标准输出和标准错误各自保存的最大长度，默认 DefaultMaxOutputSize
+	MaxOutputSize int
+	// Severities 触发脚本的告警级别，默认 DefaultSeverities，包含 SeverityAll 时所有告警都触发
+	Severities []string
 }
 
 var _ = common.AlertMethod(&ScriptAlert{})
 
+func NewScriptAlert() *ScriptAlert {
+	return &ScriptAlert{}
+}
+
+func (s *ScriptAlert) WithLimit(limit common.LimitOption) *ScriptAlert {
+	if limit == nil {
+		return s
+	}
+	s.LimitFunc = limit
+	return s
+}
+
+func (s *ScriptAlert) WithTemplates(templates *tmpl.Templates) *ScriptAlert {
+	s.Templates = templates
+	return s
+}
+
+func (s *ScriptAlert) WithBeforeHook(hook common.HookFunc) *ScriptAlert {
+	if hook == nil {
+		return s
+	}
+	s.BeforeHook = hook
+	return s
+}
+
+func (s *ScriptAlert) WithAfterHook(hook common.HookFunc) *ScriptAlert {
+	if hook == nil {
+		return s
+	}
+	s.AfterHook = hook
+	return s
+}
+
+// WithAllowedScripts 设置允许执行的脚本路径
+func (s *ScriptAlert) WithAllowedScripts(patterns ...string) *ScriptAlert {
+	s.AllowedScripts = append(s.AllowedScripts, patterns...)
+	return s
+}
+
+// WithAllowAll 允许执行任意脚本
+func (s *ScriptAlert) WithAllowAll() *ScriptAlert {
+	s.AllowAll = true
+	return s
+}
+
+// WithIsolateEnv 脚本只继承 PATH、HOME、LANG、TZ 环境变量
+func (s *ScriptAlert) WithIsolateEnv() *ScriptAlert {
+	s.IsolateEnv = true
+	return s
+}
+
+// WithTimeout 设置脚本的执行超时时间
+func (s *ScriptAlert) WithTimeout(timeout time.Duration) *ScriptAlert {
+	if timeout > 0 {
+		s.Timeout = timeout
+	}
+	return s
+}
+
+// WithMaxOutputSize 设置保存的输出的最大长度
+func (s *ScriptAlert) WithMaxOutputSize(size int) *ScriptAlert {
+	if size > 0 {
+		s.MaxOutputSize = size
+	}
+	return s
+}
+
+// WithSeverities 设置触发脚本的告警级别
+func (s *ScriptAlert) WithSeverities(severities ...string) *ScriptAlert {
+	s.Severities = severities
+	return s
+}
+
+func (s *ScriptAlert) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (s *ScriptAlert) maxOutputSize() int {
+	if s.MaxOutputSize > 0 {
+		return s.MaxOutputSize
+	}
+	return DefaultMaxOutputSize
+}
+
+// triggered 判断告警级别是否触发脚本，上下文中设置的级别优先
+func (s *ScriptAlert) triggered(scriptContext *ScriptAlertContext, alert template.Alert) bool {
+	severities := scriptContext.Severities
+	if len(severities) == 0 {
+		severities = s.Severities
+	}
+	if len(severities) == 0 {
+		severities = DefaultSeverities
+	}
+	severity := strings.Split(alert.Labels["severity"], ":")[0]
+	for _, value := range severities {
+		if value == SeverityAll || value == severity {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *ScriptAlert) Before(c common.AlertContext) error {
 	if s.BeforeHook != nil {
 		if err := s.BeforeHook(c); err != nil {
@@ -44,64 +179,93 @@ func (s *ScriptAlert) After(c common.AlertContext) error {
 
 func (s *ScriptAlert) Limit(idx int, alerts template.Alerts) bool {
 	if s.LimitFunc != nil {
-		slog.Warn("Current Alert is Limited",
-			slog.Int("remaining_alert_count", len(alerts[idx:])),
-			slog.Any("remaining_alerts", alerts[idx:]),
-		)
-		if s.LimitFunc.Allow() {
+		if !s.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
 			return true
 		}
 		return false
 	}
-	return true
+	return false
 }
 
 func (s *ScriptAlert) Execute(c common.AlertContext, users []string) error {
+	_, err := s.Run(context.Background(), c, users)
+	return err
+}
+
+// Run 为每个用户的每条触发脚本的告警执行一次脚本，返回所有执行结果
+// 脚本执行失败时返回 *ScriptError，多个失败通过 errors.Join 合并
+func (s *ScriptAlert) Run(ctx context.Context, c common.AlertContext, users []string) ([]Result, error) {
 	if s.Before(c) != nil {
-		return common.ErrorBeforeHook
+		return nil, common.ErrorBeforeHook
 	}
 	scriptContext, ok := c.(*ScriptAlertContext)
 	if !ok {
-		return errors.New("invalid context type for ScriptAlert")
+		return nil, errors.New("invalid context type for ScriptAlert")
+	}
+	switch scriptContext.Input {
+	case "", InputArgs, InputEnv, InputStdin:
+	default:
+		return nil, fmt.Errorf("[alert]:script input %s is not supported", scriptContext.Input)
+	}
+	script, err := s.allowed(scriptContext.Script)
+	if err != nil {
+		slog.Error("ScriptAlert, script is not allowed", slog.String("script", scriptContext.Script), slog.Any("err", err))
+		return nil, err
 	}
 	// 执行脚本
+	var results []Result
 	var errArr error
+	name := s.Templates.Resolve(scriptContext.Template, DefaultTemplate)
 	for _, touser := range users {
 		for idx, alert := range scriptContext.Message.Alerts {
 			if s.Limit(idx, scriptContext.Message.Alerts) {
-				return errors.New("alert is limited")
+				return results, errors.Join(errArr, common.NewLimitedError(scriptContext.Message.Alerts[idx:]))
+			}
+			if !s.triggered(scriptContext, alert) {
+				continue
+			}
+			status := "告警"
+			if alert.Status == "resolved" {
+				status = "恢复"
 			}
-			severity := alert.Labels["severity"]
-			ss := strings.Split(severity, ":")
-			if ss[0] == "严重" || ss[0] == "致命" {
-				status := "告警"
-				if alert.Status == "resolved" {
-					status = "恢复"
+			message := fmt.Sprintf("[%s] [%s]%v", scriptContext.Title, status, alert.Annotations["description"])
+			if name != "" {
+				data := tmpl.NewData(scriptContext.Message, scriptContext.Title, []string{touser}).ForAlert(alert)
+				res, err := s.Templates.Render(name, data)
+				if err != nil {
+					slog.Error("ScriptAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
+					errArr = errors.Join(errArr, err)
+					continue
 				}
-				message := fmt.Sprintf("[%s] [%s]%v", scriptContext.Title, status, alert.Annotations["description"])
+				message = res
+			}
+			p := payload{User: touser, Message: message, Title: scriptContext.Title, Alert: &alert, Args: scriptContext.Args}
+			var args []string
+			if scriptContext.Input == "" || scriptContext.Input == InputArgs {
 				// 构建 args 参数数组
-				args := []string{
+				args = []string{
 					"--user", touser,
 					"--msg", message,
 					"--alert", scriptContext.GetAlertString(alert.Fingerprint),
 					"--args", scriptContext.Args.String(),
 				}
-
-				// 使用变参形式传递参数
-				cmd := exec.Command(scriptContext.Script, args...)
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				if err := cmd.Run(); err != nil {
-					slog.Error("Script(), exec cmd is failed", slog.Any("err", err))
-					errArr = errors.Join(errArr, err)
-				}
+			}
+			res := s.run(ctx, scriptContext, script, p, args)
+			results = append(results, res)
+			if res.Error != "" {
+				slog.Error("Script(), exec cmd is failed", slog.String("script", script), slog.Any("result", res))
+				errArr = errors.Join(errArr, &ScriptError{Result: res})
 			}
 		}
 	}
 	if s.After(c) != nil {
-		return common.ErrorAfterHook
+		return results, common.ErrorAfterHook
 	}
-	return nil
+	return results, errArr
 }
 
 func (s *ScriptAlert) ExecuteTest(c common.AlertContext) error {
@@ -109,14 +273,21 @@ func (s *ScriptAlert) ExecuteTest(c common.AlertContext) error {
 	if !ok {
 		return errors.New("invalid context type for ScriptAlert")
 	}
+	script, err := s.allowed(scriptContext.Script)
+	if err != nil {
+		return err
+	}
 	message := fmt.Sprintf("[%s] [%s]%v", scriptContext.Title, "测试", "发送成功")
-	cmd := exec.Command(scriptContext.Script, scriptContext.ScriptReceiver, message)
 	slog.Debug("ScriptAlert INFO", slog.Any("message", message))
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	if err := cmd.Run(); err != nil {
-		slog.Error("Script(), exec cmd is failed", slog.Any("err", err))
-		return err
+	p := payload{User: scriptContext.ScriptReceiver, Message: message, Title: scriptContext.Title, Args: scriptContext.Args}
+	var args []string
+	if scriptContext.Input == "" || scriptContext.Input == InputArgs {
+		args = []string{scriptContext.ScriptReceiver, message}
+	}
+	res := s.run(context.Background(), scriptContext, script, p, args)
+	if res.Error != "" {
+		slog.Error("Script(), exec cmd is failed", slog.Any("result", res))
+		return &ScriptError{Result: res}
 	}
 	return nil
 }
@@ -0,0 +1,205 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// writeScript 在临时目录中创建可执行的 shell 脚本
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755))
+	return path
+}
+
+func testMessage(severities ...string) common.CustomMsg {
+	data := &template.Data{Status: "firing"}
+	for i, severity := range severities {
+		data.Alerts = append(data.Alerts, template.Alert{
+			Status:      "firing",
+			Labels:      template.KV{"alertname": "HighCPU", "severity": severity, "instance": "10.0.0.1:9100"},
+			Annotations: template.KV{"description": "CPU 使用率过高"},
+			Fingerprint: "fp" + string(rune('0'+i)),
+		})
+	}
+	return common.CustomMsg{Message: webhook.Message{Data: data}}
+}
+
+// TestScriptAlertInput 测试通过命令行参数、环境变量和标准输入传递告警
+func TestScriptAlertInput(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SERVICE_SECRET", "secret")
+	tests := []struct {
+		name    string
+		input   string
+		body    string
+		isolate bool
+		verify  func(t *testing.T, stdout string)
+	}{
+		{
+			name:  "命令行参数",
+			input: InputArgs,
+			body:  `for arg in "$@"; do echo "$arg"; done`,
+			verify: func(t *testing.T, stdout string) {
+				lines := strings.Split(strings.TrimSpace(stdout), "\n")
+				require.Len(t, lines, 8)
+				assert.Equal(t, []string{"--user", "zhangsan", "--msg", "[prod] [告警]CPU 使用率过高"}, lines[:4])
+				assert.Contains(t, lines[5], `"fingerprint":"fp0"`)
+				assert.Equal(t, `{"configFile":"/etc/alert.yaml"}`, lines[7])
+			},
+		},
+		{
+			name:    "环境变量",
+			input:   InputEnv,
+			body:    `echo "$ALERT_USER|$ALERT_MESSAGE|$ALERT_STATUS|$ALERT_FINGERPRINT|$ALERT_LABEL_ALERTNAME|$EXTRA|$SERVICE_SECRET|$#"; pwd`,
+			isolate: true,
+			verify: func(t *testing.T, stdout string) {
+				lines := strings.Split(strings.TrimSpace(stdout), "\n")
+				assert.Equal(t, "zhangsan|[prod] [告警]CPU 使用率过高|firing|fp0|HighCPU|extra||0", lines[0], "IsolateEnv 时不继承服务的环境变量")
+				assert.Equal(t, dir, lines[1], "默认在脚本所在目录执行")
+			},
+		},
+		{
+			name:  "默认继承服务的环境变量",
+			input: InputEnv,
+			body:  `echo "$ALERT_USER|$EXTRA|$SERVICE_SECRET"`,
+			verify: func(t *testing.T, stdout string) {
+				assert.Equal(t, "zhangsan|extra|secret", strings.TrimSpace(stdout))
+			},
+		},
+		{
+			name:  "标准输入",
+			input: InputStdin,
+			body:  `cat`,
+			verify: func(t *testing.T, stdout string) {
+				p := payload{}
+				require.NoError(t, json.Unmarshal([]byte(stdout), &p))
+				assert.Equal(t, "zhangsan", p.User)
+				assert.Equal(t, "prod", p.Title)
+				assert.Equal(t, "HighCPU", p.Alert.Labels["alertname"])
+				assert.Equal(t, "/etc/alert.yaml", p.Args.ConfigFile)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ScriptAlertContext{
+				Message: testMessage("严重:#FF0000"),
+				Title:   "prod",
+				Script:  writeScript(t, dir, tt.input+".sh", tt.body),
+				Args:    Arg{ConfigFile: "/etc/alert.yaml"},
+				Input:   tt.input,
+				Env:     map[string]string{"EXTRA": "extra"},
+			}
+			s := NewScriptAlert().WithAllowedScripts(filepath.Join(dir, "*.sh"))
+			if tt.isolate {
+				s.WithIsolateEnv()
+			}
+			results, err := s.Run(context.Background(), c, []string{"zhangsan"})
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			assert.Equal(t, 0, results[0].ExitCode)
+			assert.Equal(t, "zhangsan", results[0].User)
+			assert.Equal(t, "fp0", results[0].Fingerprint)
+			tt.verify(t, results[0].Stdout)
+		})
+	}
+}
+
+// TestScriptAlertFailure 测试脚本失败、超时和输出截断
+func TestScriptAlertFailure(t *testing.T) {
+	dir := t.TempDir()
+	c := &ScriptAlertContext{Message: testMessage("严重"), Title: "prod"}
+
+	c.Script = writeScript(t, dir, "fail.sh", `echo started; echo "connection refused" >&2; exit 3`)
+	results, err := NewScriptAlert().WithAllowAll().Run(context.Background(), c, []string{"zhangsan"})
+	var scriptErr *ScriptError
+	require.True(t, errors.As(err, &scriptErr))
+	assert.Equal(t, 3, scriptErr.Result.ExitCode)
+	assert.Equal(t, "started\n", scriptErr.Result.Stdout)
+	assert.Contains(t, err.Error(), "connection refused")
+	require.Len(t, results, 1)
+	assert.Equal(t, 3, results[0].ExitCode)
+
+	c.Script = writeScript(t, dir, "sleep.sh", `sleep 10`)
+	start := time.Now()
+	results, err = NewScriptAlert().WithAllowAll().WithTimeout(100*time.Millisecond).Run(context.Background(), c, []string{"zhangsan"})
+	assert.ErrorContains(t, err, "timed out after 100ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].TimedOut)
+	assert.Equal(t, -1, results[0].ExitCode)
+
+	c.Script = writeScript(t, dir, "output.sh", `i=0; while [ $i -lt 100 ]; do echo 0123456789; i=$((i+1)); done`)
+	results, err = NewScriptAlert().WithAllowAll().WithMaxOutputSize(25).Run(context.Background(), c, []string{"zhangsan"})
+	require.NoError(t, err)
+	assert.True(t, results[0].Truncated)
+	assert.Equal(t, "0123456789\n0123456789\n012", results[0].Stdout)
+}
+
+// TestScriptAlertAllowedScripts 测试只允许执行白名单中的脚本
+func TestScriptAlertAllowedScripts(t *testing.T) {
+	dir := t.TempDir()
+	allowed := writeScript(t, dir, "allowed.sh", `exit 0`)
+	denied := writeScript(t, t.TempDir(), "denied.sh", `exit 0`)
+	s := NewScriptAlert().WithAllowedScripts(filepath.Join(dir, "*.sh"))
+
+	c := &ScriptAlertContext{Message: testMessage("严重"), Script: allowed}
+	require.NoError(t, s.Execute(c, []string{"zhangsan"}))
+	require.NoError(t, s.ExecuteTest(c))
+
+	c.Script = denied
+	assert.ErrorContains(t, s.Execute(c, []string{"zhangsan"}), "is not allowed")
+	assert.ErrorContains(t, s.ExecuteTest(c), "is not allowed")
+
+	// 相对路径按绝对路径匹配
+	c.Script = filepath.Join(dir, "..", filepath.Base(dir), "allowed.sh")
+	require.NoError(t, s.Execute(c, []string{"zhangsan"}))
+
+	// 没有配置白名单时默认拒绝，AllowAll 时允许任意脚本
+	c.Script = allowed
+	assert.ErrorContains(t, NewScriptAlert().Execute(c, []string{"zhangsan"}), "no allowed scripts configured")
+	require.NoError(t, NewScriptAlert().WithAllowAll().Execute(c, []string{"zhangsan"}))
+}
+
+// TestScriptAlertSeverities 测试触发脚本的告警级别
+func TestScriptAlertSeverities(t *testing.T) {
+	script := writeScript(t, t.TempDir(), "ok.sh", `exit 0`)
+	msg := testMessage("严重:#FF0000", "警告:#FFC92D", "致命", "")
+	tests := []struct {
+		name       string
+		strategy   []string
+		context    []string
+		wantAlerts []string
+	}{
+		{name: "默认级别", wantAlerts: []string{"fp0", "fp2"}},
+		{name: "策略设置的级别", strategy: []string{"警告"}, wantAlerts: []string{"fp1"}},
+		{name: "上下文覆盖策略", strategy: []string{"警告"}, context: []string{"致命"}, wantAlerts: []string{"fp2"}},
+		{name: "所有级别", strategy: []string{SeverityAll}, wantAlerts: []string{"fp0", "fp1", "fp2", "fp3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ScriptAlertContext{Message: msg, Script: script, Severities: tt.context}
+			results, err := NewScriptAlert().WithAllowAll().WithSeverities(tt.strategy...).Run(context.Background(), c, []string{"zhangsan"})
+			require.NoError(t, err)
+			var alerts []string
+			for _, res := range results {
+				alerts = append(alerts, res.Fingerprint)
+			}
+			assert.Equal(t, tt.wantAlerts, alerts)
+		})
+	}
+}
@@ -3,9 +3,19 @@ package script
 import (
 	"encoding/json"
 
+	prommodel "github.com/prometheus/common/model"
 	"github.piwriw.go-tools/pkg/alertmanager/common"
 )
 
+const (
+	// InputArgs 通过命令行参数 --user、--msg、--alert、--args 传递告警
+	InputArgs = "args"
+	// InputEnv 通过 ALERT_ 开头的环境变量传递告警
+	InputEnv = "env"
+	// InputStdin 通过标准输入传递 JSON 格式的告警
+	InputStdin = "stdin"
+)
+
 // ScriptAlertContext 脚本告警上下文
 type ScriptAlertContext struct {
 	Message        common.CustomMsg
@@ -14,9 +24,21 @@ type ScriptAlertContext struct {
 	AlertID        string `json:"alert_id"`
 	Script         string `json:"script"`
 	Args           Arg    `json:"args"`
+	// Input 告警的传递方式：args（默认）、env、stdin
+	Input string `json:"input,omitempty"`
+	// Env 脚本额外的环境变量
+	Env map[string]string `json:"env,omitempty"`
+	// WorkDir 脚本的工作目录，默认为脚本所在目录
+	WorkDir string `json:"work_dir,omitempty"`
+	// Timeout 覆盖策略的执行超时时间，例如 10s
+	Timeout prommodel.Duration `json:"timeout,omitempty"`
+	// Severities 覆盖策略中触发脚本的告警级别
+	Severities []string `json:"severities,omitempty"`
+	// Template 覆盖告警方式默认的消息模板
+	Template string `json:"template,omitempty"`
 }
 
-var _ = common.AlertContext(&ScriptAlertContext{})
+var _ = common.TemplateContext(&ScriptAlertContext{})
 
 func (s *ScriptAlertContext) GetAlertString(fingerprint string) string {
 	for _, alert := range s.Message.Alerts {
@@ -46,3 +68,7 @@ func (a *Arg) String() string {
 func (s *ScriptAlertContext) GetMethod() string {
 	return common.MethodScript
 }
+
+func (s *ScriptAlertContext) TemplateNames() []string {
+	return common.NonEmpty(s.Template)
+}
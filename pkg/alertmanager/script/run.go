@@ -0,0 +1,198 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// Result 一次脚本执行的结果
+type Result struct {
+	Script      string `json:"script"`
+	User        string `json:"user"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// ExitCode 脚本的退出码，脚本没有启动或被超时终止时为 -1
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	// Truncated 输出超过长度限制被截断
+	Truncated bool          `json:"truncated,omitempty"`
+	TimedOut  bool          `json:"timed_out,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ScriptError 脚本执行失败，包含执行结果
+type ScriptError struct {
+	Result Result
+}
+
+func (e *ScriptError) Error() string {
+	msg := fmt.Sprintf("[alert]:script %s for user %s failed: %s", e.Result.Script, e.Result.User, e.Result.Error)
+	if stderr := strings.TrimSpace(e.Result.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// payload 传递给脚本的告警
+type payload struct {
+	User    string          `json:"user"`
+	Message string          `json:"message"`
+	Title   string          `json:"title"`
+	Alert   *template.Alert `json:"alert,omitempty"`
+	Args    Arg             `json:"args"`
+}
+
+// allowed 返回脚本的绝对路径，路径必须匹配 AllowedScripts 之一，设置 AllowAll 时不限制
+func (s *ScriptAlert) allowed(script string) (string, error) {
+	if script == "" {
+		return "", errors.New("[alert]:script is empty")
+	}
+	path, err := filepath.Abs(script)
+	if err != nil {
+		return "", fmt.Errorf("[alert]:resolve script %s failed: %w", script, err)
+	}
+	if s.AllowAll {
+		return path, nil
+	}
+	for _, pattern := range s.AllowedScripts {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return path, nil
+		}
+	}
+	if len(s.AllowedScripts) == 0 {
+		return "", fmt.Errorf("[alert]:script %s is not allowed, no allowed scripts configured", path)
+	}
+	return "", fmt.Errorf("[alert]:script %s is not allowed", path)
+}
+
+// run 执行脚本并收集输出，超时后终止脚本
+func (s *ScriptAlert) run(ctx context.Context, scriptContext *ScriptAlertContext, script string, p payload, args []string) Result {
+	timeout := s.timeout()
+	if scriptContext.Timeout > 0 {
+		timeout = time.Duration(scriptContext.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res := Result{Script: script, User: p.User, ExitCode: -1}
+	if p.Alert != nil {
+		res.Fingerprint = p.Alert.Fingerprint
+	}
+	cmd := exec.CommandContext(ctx, script, args...)
+	// 脚本退出后子进程仍持有输出管道时，最多再等待 WaitDelay
+	cmd.WaitDelay = time.Second
+	cmd.Dir = scriptContext.WorkDir
+	if cmd.Dir == "" {
+		cmd.Dir = filepath.Dir(script)
+	}
+	cmd.Env = environ(scriptContext, p, s.IsolateEnv)
+	if scriptContext.Input == InputStdin {
+		data, _ := json.Marshal(p)
+		cmd.Stdin = bytes.NewReader(data)
+	}
+	limit := s.maxOutputSize()
+	stdout, stderr := &limitedBuffer{limit: limit}, &limitedBuffer{limit: limit}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	res.Duration = time.Since(start)
+	res.Stdout, res.Stderr = stdout.String(), stderr.String()
+	res.Truncated = stdout.truncated || stderr.truncated
+	if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		res.TimedOut = true
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// environ 生成脚本的环境变量，默认继承服务的所有环境变量，isolate 为 true 时只继承 PATH、HOME、LANG、TZ
+// env 方式额外传递告警：ALERT_USER、ALERT_MESSAGE、ALERT_TITLE、ALERT_STATUS、ALERT_FINGERPRINT、
+// ALERT_JSON、ALERT_ARGS，以及每个标签对应的 ALERT_LABEL_<NAME>
+func environ(scriptContext *ScriptAlertContext, p payload, isolate bool) []string {
+	var env []string
+	if isolate {
+		for _, name := range []string{"PATH", "HOME", "LANG", "TZ"} {
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+	} else {
+		env = os.Environ()
+	}
+	if scriptContext.Input == InputEnv {
+		env = append(env,
+			"ALERT_USER="+p.User,
+			"ALERT_MESSAGE="+p.Message,
+			"ALERT_TITLE="+p.Title,
+			"ALERT_ARGS="+p.Args.String(),
+		)
+		if p.Alert != nil {
+			data, _ := json.Marshal(p.Alert)
+			env = append(env,
+				"ALERT_STATUS="+p.Alert.Status,
+				"ALERT_FINGERPRINT="+p.Alert.Fingerprint,
+				"ALERT_JSON="+string(data),
+			)
+			for name, value := range p.Alert.Labels {
+				env = append(env, "ALERT_LABEL_"+envName(name)+"="+value)
+			}
+		}
+	}
+	for name, value := range scriptContext.Env {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// envName 将标签名转换为环境变量名，非字母数字的字符替换为下划线
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// limitedBuffer 最多保存 limit 字节的输出，超出的部分丢弃，不会阻塞脚本的写入
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remain := b.limit - b.buf.Len(); remain < len(p) {
+		b.truncated = true
+		if remain > 0 {
+			b.buf.Write(p[:remain])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
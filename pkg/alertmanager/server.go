@@ -0,0 +1,405 @@
+package alertmanager
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/delivery"
+	"github.piwriw.go-tools/pkg/alertmanager/limit"
+	"github.piwriw.go-tools/pkg/alertmanager/route"
+)
+
+// defaultMaxBodySize Webhook 请求体默认的最大长度
+const defaultMaxBodySize = 10 << 20
+
+// AlertDispatcher 发送前处理告警的阶段，例如 dispatch.Dispatcher 的分组、去重和抑制
+type AlertDispatcher interface {
+	Dispatch(msg common.CustomMsg) error
+}
+
+// ServerOption WebhookServer 配置选项
+type ServerOption func(*WebhookServer)
+
+// WebhookServer 接收 Alertmanager Webhook（v4）消息，按 receiver 路由到告警策略的 http.Handler
+// 所有告警方式都发送成功后才返回 200，发送失败返回 500，由 Alertmanager 负责重试；
+// 设置了 SetDispatcher 时例外，见 SetDispatcher 的说明
+type WebhookServer struct {
+	manager      *AlertStrategyManager
+	config       *WebhookConfig
+	username     string
+	password     string
+	bearerTokens []string
+	maxBodySize  int64
+	dispatcher   AlertDispatcher
+	tracker      *delivery.Tracker
+	router       *route.Router
+	limiter      limit.Limiter
+	limitKey     limit.KeyFunc
+	limitReport  limit.ReportFunc
+}
+
+var _ http.Handler = (*WebhookServer)(nil)
+
+// WithBasicAuth 设置 Basic Auth 认证
+func WithBasicAuth(username, password string) ServerOption {
+	return func(s *WebhookServer) {
+		s.username = username
+		s.password = password
+	}
+}
+
+// WithBearerTokens 设置允许的 Bearer Token，可与 Basic Auth 同时使用，满足其一即可
+func WithBearerTokens(tokens ...string) ServerOption {
+	return func(s *WebhookServer) {
+		s.bearerTokens = append(s.bearerTokens, tokens...)
+	}
+}
+
+// WithMaxBodySize 设置请求体的最大长度，默认 10MB
+func WithMaxBodySize(size int64) ServerOption {
+	return func(s *WebhookServer) {
+		if size > 0 {
+			s.maxBodySize = size
+		}
+	}
+}
+
+// WithDeliveryTracker 记录每个告警方式的发送结果，发送失败时由 tracker 按退避策略重试，
+// 加入重试队列的失败不再返回 500，只有进入死信的失败才返回 500
+// 需要调用 tracker.Start 启动重试队列，否则失败的发送不会加入重试队列，仍然返回 500 由 Alertmanager 重试
+func WithDeliveryTracker(tracker *delivery.Tracker) ServerOption {
+	return func(s *WebhookServer) {
+		s.tracker = tracker
+	}
+}
+
+// WithRouter 按路由树根据告警标签选择接收者，不再使用 Alertmanager 消息中的 receiver，
+// 处于静音时间区间的告警不会发送
+func WithRouter(router *route.Router) ServerOption {
+	return func(s *WebhookServer) {
+		s.router = router
+	}
+}
+
+// WithLimiter 发送前按 keyFunc 计算每条告警的限流键，被限流的告警不发送，只记录日志和上报，不作为失败返回
+// keyFunc 为空时所有告警共用一个限流键，例如 WithLimiter(redisLimiter, limit.Keys(limit.ByReceiver, limit.ByAlertName))
+func WithLimiter(limiter limit.Limiter, keyFunc limit.KeyFunc) ServerOption {
+	return func(s *WebhookServer) {
+		s.limiter = limiter
+		s.limitKey = keyFunc
+	}
+}
+
+// WithLimitReporter 上报被限流的告警，包括 WithLimiter 和告警方式自身的限流
+func WithLimitReporter(report limit.ReportFunc) ServerOption {
+	return func(s *WebhookServer) {
+		s.limitReport = report
+	}
+}
+
+// NewWebhookServer 创建 Webhook 接收服务，校验配置中的告警方式都已注册、配置的模板都可以正常渲染
+// 服务运行期间不应再调用 manager 的 Register 方法
+func NewWebhookServer(manager *AlertStrategyManager, config *WebhookConfig, options ...ServerOption) (*WebhookServer, error) {
+	if manager == nil {
+		return nil, errors.New("[alert]:manager is nil")
+	}
+	if config == nil {
+		return nil, errors.New("[alert]:webhook config is nil")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	var templates []string
+	for _, receiver := range config.Receivers {
+		for _, target := range receiver.Targets {
+			if !manager.HasMethod(target.Method) {
+				return nil, fmt.Errorf("[alert]:receiver %s: method %s not found", receiver.Name, target.Method)
+			}
+			// 提前解析告警方式的配置，并收集接收者覆盖的模板
+			c, err := manager.NewAlertContext(target.Method, common.CustomMsg{}, target.Config)
+			if err != nil {
+				return nil, fmt.Errorf("[alert]:receiver %s: %w", receiver.Name, err)
+			}
+			if tc, ok := c.(common.TemplateContext); ok {
+				templates = append(templates, tc.TemplateNames()...)
+			}
+		}
+	}
+	if err := manager.ValidateTemplates(templates...); err != nil {
+		return nil, err
+	}
+
+	server := &WebhookServer{
+		manager:     manager,
+		config:      config,
+		maxBodySize: defaultMaxBodySize,
+	}
+	for _, option := range options {
+		option(server)
+	}
+	if server.router != nil {
+		if err := validateRoutes(config, server.router); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// validateRoutes 校验路由使用的接收者都已配置，限定的告警方式都是接收者的告警方式
+func validateRoutes(config *WebhookConfig, router *route.Router) error {
+	for name, methods := range router.Receivers() {
+		receiver, ok := config.Receiver(name)
+		if !ok || receiver.Name != name {
+			return fmt.Errorf("[alert]:route receiver %s not found", name)
+		}
+		for _, method := range methods {
+			if len(receiver.targets(method)) == 0 {
+				return fmt.Errorf("[alert]:route receiver %s has no method %s", name, method)
+			}
+		}
+	}
+	return nil
+}
+
+// SetDispatcher 设置发送前的处理阶段，收到的告警交给 dispatcher 后立即返回 200，
+// 由 dispatcher 调用 Deliver 发送，例如：
+//
+//	server, _ := NewWebhookServer(manager, cfg)
+//	d, _ := dispatch.New(server.Deliver,
+//		dispatch.WithGroupConfig(groupConfig),
+//		dispatch.WithNotifyErrorHandler(func(msg common.CustomMsg, err error) { ... }),
+//	)
+//	server.SetDispatcher(d)
+//	d.Start()
+//
+// 注意：设置后响应状态码只表示告警是否被 dispatcher 接收，不再表示是否发送成功，
+// Alertmanager 不会因为发送失败而重试。发送失败由 dispatcher 在下个 GroupInterval 重试，
+// 需要通过 dispatch.WithNotifyErrorHandler 感知发送失败。
+func (s *WebhookServer) SetDispatcher(dispatcher AlertDispatcher) {
+	s.dispatcher = dispatcher
+}
+
+// Deliver 按 receiver 将消息发送给所有告警方式，设置了路由时按路由拆分后发送
+func (s *WebhookServer) Deliver(msg common.CustomMsg) error {
+	if msg.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+	if s.router != nil {
+		return s.route(msg)
+	}
+	receiver, ok := s.config.Receiver(msg.Receiver)
+	if !ok {
+		return fmt.Errorf("[alert]:receiver %s not found", msg.Receiver)
+	}
+	return s.deliver(receiver, msg)
+}
+
+// ServeHTTP 处理 Alertmanager 的 Webhook 请求
+func (s *WebhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeResult(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if !s.authorized(r) {
+		if s.username != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="alertmanager"`)
+		}
+		writeResult(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	msg := common.CustomMsg{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodySize)).Decode(&msg); err != nil {
+		writeResult(w, http.StatusBadRequest, fmt.Errorf("decode message failed: %w", err))
+		return
+	}
+	if msg.Data == nil {
+		writeResult(w, http.StatusBadRequest, errors.New("message has no data"))
+		return
+	}
+	receiver, ok := s.config.Receiver(msg.Receiver)
+	if !ok && s.router == nil {
+		slog.Warn("WebhookServer, receiver not found", slog.String("receiver", msg.Receiver))
+		writeResult(w, http.StatusNotFound, fmt.Errorf("receiver %s not found", msg.Receiver))
+		return
+	}
+
+	if s.dispatcher != nil {
+		if err := s.dispatcher.Dispatch(msg); err != nil {
+			writeResult(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		writeResult(w, http.StatusOK, nil)
+		return
+	}
+	var err error
+	if s.router != nil {
+		err = s.route(msg)
+	} else {
+		err = s.deliver(receiver, msg)
+	}
+	if err != nil {
+		slog.Error("WebhookServer, deliver alerts failed",
+			slog.String("receiver", msg.Receiver),
+			slog.String("groupKey", msg.GroupKey),
+			slog.Any("err", err),
+		)
+		writeResult(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeResult(w, http.StatusOK, nil)
+}
+
+// authorized 未配置认证时允许所有请求
+func (s *WebhookServer) authorized(r *http.Request) bool {
+	if s.username == "" && len(s.bearerTokens) == 0 {
+		return true
+	}
+	if s.username != "" {
+		if username, password, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(username), []byte(s.username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1 {
+			return true
+		}
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, t := range s.bearerTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// route 按路由拆分消息，发送给每个命中路由的接收者
+func (s *WebhookServer) route(msg common.CustomMsg) error {
+	var errs []error
+	for _, m := range s.router.Split(msg, time.Now()) {
+		receiver, ok := s.config.Receiver(m.Receiver)
+		if !ok {
+			errs = append(errs, fmt.Errorf("[alert]:route %s: receiver %s not found", m.ID, m.Receiver))
+			continue
+		}
+		if len(m.Methods) > 0 {
+			targets := receiver.targets(m.Methods...)
+			receiver = &Receiver{Name: receiver.Name, Targets: targets}
+		}
+		slog.Debug("WebhookServer, route alerts", slog.String("route", m.ID), slog.String("receiver", m.Receiver), slog.Int("alerts", len(m.Message.Alerts)))
+		if err := s.deliver(receiver, m.Message); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", m.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver 并发执行接收者的所有告警方式，返回所有失败的错误，被限流的告警只上报，不作为失败
+func (s *WebhookServer) deliver(receiver *Receiver, msg common.CustomMsg) error {
+	errs := make([]error, len(receiver.Targets))
+	var wg sync.WaitGroup
+	for i, target := range receiver.Targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lt := limit.Target{Receiver: receiver.Name, Method: target.Method}
+			msg, ok := s.filterLimited(lt, msg)
+			if !ok {
+				return
+			}
+			send := func() (err error) {
+				// 告警方式处理异常的告警数据时可能 panic，不能影响其他告警方式和整个进程
+				defer func() {
+					if r := recover(); r != nil {
+						slog.Error("WebhookServer, alert method panicked", slog.String("method", target.Method), slog.Any("panic", r))
+						err = fmt.Errorf("[alert]:%s panicked: %v", target.Method, r)
+					}
+				}()
+				c, err := s.manager.NewAlertContext(target.Method, msg, target.Config)
+				if err != nil {
+					return err
+				}
+				return s.manager.Execute(target.Method, c, target.Users)
+			}
+			var err error
+			if s.tracker != nil {
+				err = s.tracker.Deliver(delivery.Task{
+					Method:   target.Method,
+					Receiver: receiver.Name,
+					Message:  msg,
+					Send:     send,
+				})
+			} else {
+				err = send()
+			}
+			if alerts := common.LimitedAlerts(err); len(alerts) > 0 {
+				s.reportLimited(lt, msg.GroupKey, alerts)
+			}
+			if common.IsLimited(err) {
+				err = nil
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", target.Method, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// filterLimited 按 WithLimiter 过滤消息中被限流的告警，没有可以发送的告警时返回 false
+func (s *WebhookServer) filterLimited(target limit.Target, msg common.CustomMsg) (common.CustomMsg, bool) {
+	if s.limiter == nil || msg.Data == nil {
+		return msg, true
+	}
+	allowed, limited := limit.Filter(context.Background(), s.limiter, s.limitKey, target, msg.Alerts)
+	if len(limited) == 0 {
+		return msg, true
+	}
+	if s.tracker != nil {
+		s.tracker.RecordLimited(delivery.Task{Method: target.Method, Receiver: target.Receiver, Message: msg.WithAlerts(limited)})
+	}
+	s.reportLimited(target, msg.GroupKey, limited)
+	if len(allowed) == 0 {
+		return msg, false
+	}
+	return msg.WithAlerts(allowed), true
+}
+
+// reportLimited 记录并上报被限流的告警
+func (s *WebhookServer) reportLimited(target limit.Target, groupKey string, alerts template.Alerts) {
+	slog.Warn("WebhookServer, alerts are limited",
+		slog.String("receiver", target.Receiver),
+		slog.String("method", target.Method),
+		slog.String("group_key", groupKey),
+		slog.Int("alerts", len(alerts)),
+	)
+	if s.limitReport != nil {
+		s.limitReport(limit.Report{Target: target, GroupKey: groupKey, Alerts: alerts})
+	}
+}
+
+type webhookResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func writeResult(w http.ResponseWriter, code int, err error) {
+	res := webhookResult{Status: "success"}
+	if err != nil {
+		res = webhookResult{Status: "error", Error: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
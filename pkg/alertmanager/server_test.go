@@ -0,0 +1,662 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/delivery"
+	"github.piwriw.go-tools/pkg/alertmanager/dispatch"
+	"github.piwriw.go-tools/pkg/alertmanager/internal/alerttest"
+	"github.piwriw.go-tools/pkg/alertmanager/lark"
+	"github.piwriw.go-tools/pkg/alertmanager/limit"
+	"github.piwriw.go-tools/pkg/alertmanager/route"
+	"github.piwriw.go-tools/pkg/alertmanager/script"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+)
+
+// webhookFixture Alertmanager v4 Webhook 消息
+const webhookFixture = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"HighCPU\"}",
+  "truncatedAlerts": 0,
+  "status": "firing",
+  "receiver": "ops",
+  "groupLabels": {"alertname": "HighCPU"},
+  "commonLabels": {"alertname": "HighCPU", "severity": "critical"},
+  "commonAnnotations": {},
+  "externalURL": "http://alertmanager:9093",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "HighCPU", "instance": "10.0.0.1:9100", "severity": "critical"},
+      "annotations": {"description": "CPU usage above 90%"},
+      "startsAt": "2024-01-01T00:00:00Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "http://prometheus:9090/graph",
+      "fingerprint": "c2a6a9e5d2b3f1a0"
+    }
+  ]
+}`
+
+// recordAlert 记录调用的告警策略
+type recordAlert struct {
+	mu    sync.Mutex
+	calls []recordCall
+	err   error
+	delay time.Duration
+	// panic 不为 nil 时 Execute 以该值 panic
+	panic any
+}
+
+type recordCall struct {
+	ctx   *lark.LarkAlertContext
+	users []string
+}
+
+var _ = common.AlertMethod(&recordAlert{})
+
+func (r *recordAlert) Execute(c common.AlertContext, users []string) error {
+	time.Sleep(r.delay)
+	if r.panic != nil {
+		panic(r.panic)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, recordCall{ctx: c.(*lark.LarkAlertContext), users: users})
+	return r.err
+}
+
+func (r *recordAlert) ExecuteTest(c common.AlertContext) error { return nil }
+func (r *recordAlert) Before(c common.AlertContext) error      { return nil }
+func (r *recordAlert) After(c common.AlertContext) error       { return nil }
+
+func (r *recordAlert) Calls() []recordCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recordCall(nil), r.calls...)
+}
+
+func newTestWebhookServer(t *testing.T, config string, strategies map[string]*recordAlert, options ...ServerOption) *httptest.Server {
+	t.Helper()
+	manager := NewAlertStrategyManager()
+	for method, strategy := range strategies {
+		manager.RegisterStrategy(method, strategy)
+		manager.RegisterContextFactory(method, manager.contexts[common.MethodLark])
+	}
+	cfg, err := ParseWebhookConfig([]byte(config))
+	require.NoError(t, err)
+	server, err := NewWebhookServer(manager, cfg, options...)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func postWebhook(t *testing.T, url, body string, setAuth func(r *http.Request)) (int, webhookResult) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if setAuth != nil {
+		setAuth(req)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	res := webhookResult{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	return resp.StatusCode, res
+}
+
+const testRouteConfig = `
+receivers:
+  - name: ops
+    targets:
+      - method: a
+        users: ["zhangsan"]
+        config:
+          title: 生产环境
+          webhook: http://lark
+      - method: b
+        users: ["lisi"]
+`
+
+// TestWebhookServerRoute 测试按 receiver 路由并发执行告警方式
+func TestWebhookServerRoute(t *testing.T) {
+	a := &recordAlert{delay: 100 * time.Millisecond}
+	b := &recordAlert{delay: 100 * time.Millisecond}
+	ts := newTestWebhookServer(t, testRouteConfig, map[string]*recordAlert{"a": a, "b": b})
+
+	start := time.Now()
+	code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "success", res.Status)
+	assert.Less(t, time.Since(start), 190*time.Millisecond, "告警方式应并发执行")
+
+	require.Len(t, a.Calls(), 1)
+	call := a.Calls()[0]
+	assert.Equal(t, []string{"zhangsan"}, call.users)
+	assert.Equal(t, "生产环境", call.ctx.Title)
+	assert.Equal(t, "http://lark", call.ctx.Webhook)
+	assert.Equal(t, "ops", call.ctx.Message.Receiver)
+	require.Len(t, call.ctx.Message.Alerts, 1)
+	assert.Equal(t, "HighCPU", call.ctx.Message.Alerts[0].Labels["alertname"])
+
+	require.Len(t, b.Calls(), 1)
+	assert.Equal(t, []string{"lisi"}, b.Calls()[0].users)
+}
+
+// TestWebhookServerDeliverFailed 测试任一告警方式失败时返回 500
+func TestWebhookServerDeliverFailed(t *testing.T) {
+	a := &recordAlert{}
+	b := &recordAlert{err: errors.New("send failed")}
+	ts := newTestWebhookServer(t, testRouteConfig, map[string]*recordAlert{"a": a, "b": b})
+
+	code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "error", res.Status)
+	assert.Contains(t, res.Error, "b: send failed")
+	assert.Len(t, a.Calls(), 1)
+}
+
+// TestWebhookServerAlertWithoutCategory 测试内置告警方式处理没有 category 标签的告警
+// 功能：默认的文本消息按 category 标签生成类型，标签缺失时不能 panic
+func TestWebhookServerAlertWithoutCategory(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+	larkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Content struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		mu.Lock()
+		texts = append(texts, body.Content.Text)
+		mu.Unlock()
+		w.Write([]byte(`{"code":0}`))
+	}))
+	defer larkServer.Close()
+
+	cfg, err := ParseWebhookConfig([]byte(`{"receivers":[{"name":"ops","targets":[{"method":"lark","config":{"title":"生产环境","webhook":"` + larkServer.URL + `"}}]}]}`))
+	require.NoError(t, err)
+	server, err := NewWebhookServer(NewAlertStrategyManager(), cfg)
+	require.NoError(t, err)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusOK, code, res.Error)
+	require.Len(t, texts, 1)
+	assert.Contains(t, texts[0], "类型： \n")
+	assert.Contains(t, texts[0], "告警名称：HighCPU")
+}
+
+// TestWebhookServerDeliverPanic 测试告警方式 panic 时返回 500，其他告警方式正常发送
+func TestWebhookServerDeliverPanic(t *testing.T) {
+	a := &recordAlert{}
+	b := &recordAlert{panic: "index out of range"}
+	ts := newTestWebhookServer(t, testRouteConfig, map[string]*recordAlert{"a": a, "b": b})
+
+	code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, res.Error, "b panicked: index out of range")
+	assert.Len(t, a.Calls(), 1)
+}
+
+// TestWebhookServerRequest 测试请求方法、请求体和 receiver 的校验
+func TestWebhookServerRequest(t *testing.T) {
+	a := &recordAlert{}
+	ts := newTestWebhookServer(t, `
+receivers:
+  - name: ops
+    targets:
+      - method: a
+`, map[string]*recordAlert{"a": a})
+
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "非法 JSON", body: "{", wantCode: http.StatusBadRequest},
+		{name: "空消息", body: "{}", wantCode: http.StatusBadRequest},
+		{name: "未知 receiver", body: strings.Replace(webhookFixture, `"receiver": "ops"`, `"receiver": "dev"`, 1), wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := postWebhook(t, ts.URL, tt.body, nil)
+			assert.Equal(t, tt.wantCode, code)
+		})
+	}
+	assert.Empty(t, a.Calls())
+}
+
+// TestWebhookServerDefaultReceiver 测试未匹配的 receiver 使用默认接收者
+func TestWebhookServerDefaultReceiver(t *testing.T) {
+	a := &recordAlert{}
+	ts := newTestWebhookServer(t, `
+default_receiver: fallback
+receivers:
+  - name: fallback
+    targets:
+      - method: a
+`, map[string]*recordAlert{"a": a})
+
+	code, _ := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, a.Calls(), 1)
+}
+
+// TestWebhookServerAuth 测试 Basic Auth 和 Bearer Token 认证
+func TestWebhookServerAuth(t *testing.T) {
+	a := &recordAlert{}
+	ts := newTestWebhookServer(t, testRouteConfig, map[string]*recordAlert{"a": a, "b": {}},
+		WithBasicAuth("alertmanager", "secret"),
+		WithBearerTokens("token-1", "token-2"),
+	)
+
+	tests := []struct {
+		name     string
+		setAuth  func(r *http.Request)
+		wantCode int
+	}{
+		{name: "未认证", wantCode: http.StatusUnauthorized},
+		{name: "Basic Auth 正确", setAuth: func(r *http.Request) { r.SetBasicAuth("alertmanager", "secret") }, wantCode: http.StatusOK},
+		{name: "Basic Auth 密码错误", setAuth: func(r *http.Request) { r.SetBasicAuth("alertmanager", "wrong") }, wantCode: http.StatusUnauthorized},
+		{name: "Bearer Token 正确", setAuth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-2") }, wantCode: http.StatusOK},
+		{name: "Bearer Token 错误", setAuth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-3") }, wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := postWebhook(t, ts.URL, webhookFixture, tt.setAuth)
+			assert.Equal(t, tt.wantCode, code)
+		})
+	}
+	assert.Len(t, a.Calls(), 2)
+}
+
+// TestNewWebhookServer 测试创建服务时校验告警方式
+func TestNewWebhookServer(t *testing.T) {
+	manager := NewAlertStrategyManager()
+
+	cfg, err := ParseWebhookConfig([]byte(`{"receivers":[{"name":"ops","targets":[{"method":"lark"}]}]}`))
+	require.NoError(t, err)
+	_, err = NewWebhookServer(manager, cfg)
+	require.NoError(t, err)
+
+	cfg, err = ParseWebhookConfig([]byte(`{"receivers":[{"name":"ops","targets":[{"method":"sms"}]}]}`))
+	require.NoError(t, err)
+	_, err = NewWebhookServer(manager, cfg)
+	require.Error(t, err)
+
+	_, err = NewWebhookServer(nil, cfg)
+	require.Error(t, err)
+}
+
+// TestParseWebhookConfig 测试路由配置校验
+func TestParseWebhookConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{name: "正常配置", config: testRouteConfig},
+		{name: "未知字段", config: "receivers: []\nunknown: 1", wantErr: true},
+		{name: "receiver 名称为空", config: "receivers: [{targets: [{method: a}]}]", wantErr: true},
+		{name: "receiver 重复", config: "receivers: [{name: a, targets: [{method: a}]}, {name: a, targets: [{method: a}]}]", wantErr: true},
+		{name: "没有告警方式", config: "receivers: [{name: a}]", wantErr: true},
+		{name: "告警方式为空", config: "receivers: [{name: a, targets: [{users: [u]}]}]", wantErr: true},
+		{name: "默认接收者不存在", config: "default_receiver: b\nreceivers: [{name: a, targets: [{method: a}]}]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWebhookConfig([]byte(tt.config))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "webhook.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testRouteConfig), 0o644))
+	cfg, err := LoadWebhookConfig(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.Receivers, 1)
+	assert.JSONEq(t, `{"title":"生产环境","webhook":"http://lark"}`, string(cfg.Receivers[0].Targets[0].Config))
+}
+
+// TestWebhookServerTemplates 测试告警方式使用模板渲染消息，接收者可以覆盖模板
+func TestWebhookServerTemplates(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+	larkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Content struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		mu.Lock()
+		texts = append(texts, body.Content.Text)
+		mu.Unlock()
+		w.Write([]byte(`{"code":0}`))
+	}))
+	defer larkServer.Close()
+
+	templates := tmpl.New()
+	require.NoError(t, templates.ParseText(lark.DefaultTemplate,
+		`[{{ .Title }}] {{ range .Alerts }}{{ .Labels.alertname }} {{ humanizeTime .StartsAt }}{{ end }} @{{ join "," .Users }}`))
+	require.NoError(t, templates.ParseText("lark.short", `{{ .Status }}:{{ len .Alerts.Firing }}`))
+	manager := NewAlertStrategyManager(WithTemplates(templates))
+
+	cfg, err := ParseWebhookConfig([]byte(`
+receivers:
+  - name: ops
+    targets:
+      - method: lark
+        users: ["u1", "u2"]
+        config: {title: 生产环境, webhook: ` + larkServer.URL + `}
+      - method: lark
+        config: {title: 生产环境, webhook: ` + larkServer.URL + `, template: lark.short}
+`))
+	require.NoError(t, err)
+	server, err := NewWebhookServer(manager, cfg)
+	require.NoError(t, err)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	code, _ := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.ElementsMatch(t, []string{
+		"[生产环境] HighCPU 2024-01-01 00:00:00 @u1,u2",
+		"firing:1",
+	}, texts)
+
+	t.Run("覆盖的模板不存在", func(t *testing.T) {
+		cfg, err := ParseWebhookConfig([]byte(`{"receivers":[{"name":"ops","targets":[{"method":"lark","config":{"template":"missing"}}]}]}`))
+		require.NoError(t, err)
+		_, err = NewWebhookServer(manager, cfg)
+		require.ErrorContains(t, err, "missing")
+
+		_, err = NewWebhookServer(NewAlertStrategyManager(), cfg)
+		require.Error(t, err)
+	})
+
+	t.Run("默认模板渲染失败", func(t *testing.T) {
+		templates := tmpl.New()
+		require.NoError(t, templates.ParseText(lark.DefaultTemplate, `{{ humanizeTime .Title }}`))
+		_, err := NewWebhookServer(NewAlertStrategyManager(WithTemplates(templates)), cfg)
+		require.Error(t, err)
+	})
+
+	t.Run("告警方式配置错误", func(t *testing.T) {
+		cfg, err := ParseWebhookConfig([]byte(`{"receivers":[{"name":"ops","targets":[{"method":"lark","config":{"title":1}}]}]}`))
+		require.NoError(t, err)
+		_, err = NewWebhookServer(manager, cfg)
+		require.Error(t, err)
+	})
+}
+
+// TestWebhookServerDispatcher 测试设置 dispatcher 后分组发送
+func TestWebhookServerDispatcher(t *testing.T) {
+	a := &recordAlert{}
+	manager := NewAlertStrategyManager()
+	manager.RegisterStrategy("a", a)
+	manager.RegisterContextFactory("a", manager.contexts[common.MethodLark])
+	cfg, err := ParseWebhookConfig([]byte(`
+receivers:
+  - name: ops
+    targets:
+      - method: a
+        users: ["zhangsan"]
+`))
+	require.NoError(t, err)
+	server, err := NewWebhookServer(manager, cfg)
+	require.NoError(t, err)
+
+	d, err := dispatch.New(server.Deliver,
+		dispatch.WithGroupConfig(dispatch.GroupConfig{GroupBy: []string{"alertname"}, GroupWait: 50 * time.Millisecond}),
+		dispatch.WithTickInterval(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	server.SetDispatcher(d)
+	d.Start()
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	code, _ := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, a.Calls(), "GroupWait 内不发送")
+
+	require.Eventually(t, func() bool { return len(a.Calls()) == 1 }, time.Second, 10*time.Millisecond)
+	call := a.Calls()[0]
+	assert.Equal(t, []string{"zhangsan"}, call.users)
+	assert.Equal(t, `ops:{alertname="HighCPU"}`, call.ctx.Message.GroupKey)
+
+	require.NoError(t, d.Stop())
+	code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, res.Error, dispatch.ErrStopped.Error())
+	assert.Len(t, a.Calls(), 1, "重复推送的告警只发送一次")
+}
+
+// TestWebhookServerDeliveryTracker 测试记录发送结果，失败时加入重试队列
+func TestWebhookServerDeliveryTracker(t *testing.T) {
+	a := &recordAlert{}
+	b := &recordAlert{err: errors.New("send failed")}
+	log := delivery.NewMemoryLog(0)
+	tracker, err := delivery.NewTracker(log, delivery.WithRetryPolicy(delivery.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour}))
+	require.NoError(t, err)
+	ts := newTestWebhookServer(t, testRouteConfig, map[string]*recordAlert{"a": a, "b": b}, WithDeliveryTracker(tracker))
+
+	// 重试队列没有运行时返回 500
+	code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, res.Error, delivery.ErrNotRunning.Error())
+	assert.Zero(t, tracker.Pending())
+
+	tracker.Start()
+	t.Cleanup(tracker.Stop)
+	code, _ = postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusOK, code, "失败的发送加入重试队列")
+	assert.Equal(t, 1, tracker.Pending())
+
+	records, err := log.Query(context.Background(), delivery.Query{Fingerprint: "c2a6a9e5d2b3f1a0"})
+	require.NoError(t, err)
+	require.Len(t, records, 4, "两次推送各记录两条")
+	records = records[:2]
+	status := map[string]delivery.Status{}
+	for _, r := range records {
+		assert.Equal(t, "ops", r.Receiver)
+		status[r.Method] = r.Status
+	}
+	assert.Equal(t, map[string]delivery.Status{"a": delivery.StatusSuccess, "b": delivery.StatusFailed}, status)
+
+	// 不重试时返回 500
+	tracker, err = delivery.NewTracker(log, delivery.WithRetryPolicy(delivery.RetryPolicy{MaxAttempts: 1}))
+	require.NoError(t, err)
+	ts = newTestWebhookServer(t, testRouteConfig, map[string]*recordAlert{"a": a, "b": b}, WithDeliveryTracker(tracker))
+	code, res = postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, res.Error, "dead letter")
+}
+
+// TestWebhookServerLimiter 测试发送前按告警限流，被限流的告警上报并记录，不返回失败
+func TestWebhookServerLimiter(t *testing.T) {
+	a := &recordAlert{}
+	b := &recordAlert{}
+	limiter, err := limit.NewSlidingWindow(1, time.Hour)
+	require.NoError(t, err)
+	log := delivery.NewMemoryLog(0)
+	tracker, err := delivery.NewTracker(log)
+	require.NoError(t, err)
+	var mu sync.Mutex
+	var reports []limit.Report
+	ts := newTestWebhookServer(t, testRouteConfig, map[string]*recordAlert{"a": a, "b": b},
+		WithDeliveryTracker(tracker),
+		WithLimiter(limiter, limit.Keys(limit.ByMethod, limit.ByAlertName)),
+		WithLimitReporter(func(r limit.Report) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, r)
+		}),
+	)
+
+	for i := 0; i < 2; i++ {
+		code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "success", res.Status)
+	}
+	assert.Len(t, a.Calls(), 1, "第二次被限流")
+	assert.Len(t, b.Calls(), 1, "第二次被限流")
+
+	mu.Lock()
+	require.Len(t, reports, 2)
+	for _, r := range reports {
+		assert.Equal(t, "ops", r.Receiver)
+		assert.Equal(t, "{}:{alertname=\"HighCPU\"}", r.GroupKey)
+		require.Len(t, r.Alerts, 1)
+		assert.Equal(t, "c2a6a9e5d2b3f1a0", r.Alerts[0].Fingerprint)
+	}
+	mu.Unlock()
+
+	records, err := log.Query(context.Background(), delivery.Query{Status: delivery.StatusLimited})
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+}
+
+// TestWebhookServerStrategyLimited 测试告警方式自身限流时上报告警，不返回失败
+func TestWebhookServerStrategyLimited(t *testing.T) {
+	var msg common.CustomMsg
+	require.NoError(t, json.Unmarshal([]byte(webhookFixture), &msg))
+	a := &recordAlert{err: common.NewLimitedError(msg.Alerts)}
+	b := &recordAlert{err: errors.Join(errors.New("send failed"), common.NewLimitedError(msg.Alerts))}
+	var mu sync.Mutex
+	methods := map[string]int{}
+	ts := newTestWebhookServer(t, testRouteConfig, map[string]*recordAlert{"a": a, "b": b},
+		WithLimitReporter(func(r limit.Report) {
+			mu.Lock()
+			defer mu.Unlock()
+			methods[r.Method] += len(r.Alerts)
+		}),
+	)
+
+	code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusInternalServerError, code, "同时有其他失败时仍然返回失败")
+	assert.Contains(t, res.Error, "b: send failed")
+	assert.NotContains(t, res.Error, "a:")
+	mu.Lock()
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, methods)
+	mu.Unlock()
+}
+
+// TestWebhookServerScriptLimited 测试脚本告警被限流时返回 errors.Join 合并的限流错误，
+// 按限流处理：上报告警，记录为 limited，不重试也不返回失败
+func TestWebhookServerScriptLimited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alert.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\nexit 0\n"), 0o755))
+	manager := NewAlertStrategyManager()
+	manager.RegisterStrategy(common.MethodScript, script.NewScriptAlert().WithAllowedScripts(path).WithLimit(alerttest.DenyLimit{}))
+	cfg, err := ParseWebhookConfig([]byte(`{"receivers":[{"name":"ops","targets":[{"method":"script","users":["zhangsan"],"config":{"script":"` + path + `"}}]}]}`))
+	require.NoError(t, err)
+
+	log := delivery.NewMemoryLog(0)
+	tracker, err := delivery.NewTracker(log)
+	require.NoError(t, err)
+	tracker.Start()
+	t.Cleanup(tracker.Stop)
+	var reported int
+	server, err := NewWebhookServer(manager, cfg,
+		WithDeliveryTracker(tracker),
+		WithLimitReporter(func(r limit.Report) { reported += len(r.Alerts) }),
+	)
+	require.NoError(t, err)
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	code, res := postWebhook(t, ts.URL, webhookFixture, nil)
+	assert.Equal(t, http.StatusOK, code, res.Error)
+	assert.Equal(t, 1, reported)
+	assert.Zero(t, tracker.Pending(), "限流不重试")
+	records, err := log.Query(context.Background(), delivery.Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, delivery.StatusLimited, records[0].Status)
+}
+
+// TestWebhookServerRouter 测试按路由树选择接收者和告警方式
+func TestWebhookServerRouter(t *testing.T) {
+	newRouter := func(config string) *route.Router {
+		cfg, err := route.Parse([]byte(config))
+		require.NoError(t, err)
+		router, err := route.NewRouter(cfg)
+		require.NoError(t, err)
+		return router
+	}
+	config := testRouteConfig + `
+  - name: dba
+    targets:
+      - method: a
+        users: ["wangwu"]
+`
+	a := &recordAlert{}
+	b := &recordAlert{}
+	ts := newTestWebhookServer(t, config, map[string]*recordAlert{"a": a, "b": b}, WithRouter(newRouter(`
+route:
+  receiver: ops
+  routes:
+    - matchers: ['severity="critical"']
+      receiver: ops
+      methods: [b]
+      continue: true
+    - matchers: ['instance=~"10\\.0\\..*"']
+      receiver: dba
+`)))
+
+	// 使用路由时不再按消息中的 receiver 查找接收者
+	code, _ := postWebhook(t, ts.URL, strings.Replace(webhookFixture, `"receiver": "ops"`, `"receiver": "unknown"`, 1), nil)
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, a.Calls(), 1)
+	assert.Equal(t, []string{"wangwu"}, a.Calls()[0].users)
+	assert.Equal(t, "dba", a.Calls()[0].ctx.Message.Receiver)
+	require.Len(t, b.Calls(), 1)
+	assert.Equal(t, []string{"lisi"}, b.Calls()[0].users)
+	assert.Equal(t, "ops", b.Calls()[0].ctx.Message.Receiver)
+
+	t.Run("路由的接收者不存在", func(t *testing.T) {
+		cfg, err := ParseWebhookConfig([]byte(testRouteConfig))
+		require.NoError(t, err)
+		manager := NewAlertStrategyManager()
+		for _, method := range []string{"a", "b"} {
+			manager.RegisterStrategy(method, a)
+			manager.RegisterContextFactory(method, manager.contexts[common.MethodLark])
+		}
+		_, err = NewWebhookServer(manager, cfg, WithRouter(newRouter(`route: {receiver: ops, routes: [{receiver: dba}]}`)))
+		assert.ErrorContains(t, err, "route receiver dba not found")
+		_, err = NewWebhookServer(manager, cfg, WithRouter(newRouter(`route: {receiver: ops, methods: [c]}`)))
+		assert.ErrorContains(t, err, "route receiver ops has no method c")
+	})
+}
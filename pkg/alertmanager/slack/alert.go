@@ -0,0 +1,162 @@
+package slack
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+	"github.piwriw.go-tools/pkg/httputil"
+)
+
+// DefaultTemplate Slack 消息默认使用的模板名称，模板渲染的结果作为 mrkdwn 文本发送
+const DefaultTemplate = "slack.message"
+
+// SlackAlert Slack Incoming Webhook 告警策略，默认使用 Block Kit 发送告警
+type SlackAlert struct {
+	Client     *http.Client
+	BeforeHook common.HookFunc
+	AfterHook  common.HookFunc
+	LimitFunc  common.LimitOption
+	// Templates 消息模板，未设置或模板不存在时使用 Block Kit 消息
+	Templates *tmpl.Templates
+}
+
+var _ = common.AlertMethod(&SlackAlert{})
+
+func NewSlackAlert() *SlackAlert {
+	return &SlackAlert{Client: http.NewHTTPClient()}
+}
+
+func NewSlackAlertWithClient(client *http.Client) *SlackAlert {
+	return &SlackAlert{Client: client}
+}
+
+func (s *SlackAlert) WithLimit(limit common.LimitOption) *SlackAlert {
+	if limit == nil {
+		return s
+	}
+	s.LimitFunc = limit
+	return s
+}
+
+func (s *SlackAlert) WithTemplates(templates *tmpl.Templates) *SlackAlert {
+	s.Templates = templates
+	return s
+}
+
+func (s *SlackAlert) WithBeforeHook(hook common.HookFunc) *SlackAlert {
+	if hook == nil {
+		return s
+	}
+	s.BeforeHook = hook
+	return s
+}
+
+func (s *SlackAlert) WithAfterHook(hook common.HookFunc) *SlackAlert {
+	if hook == nil {
+		return s
+	}
+	s.AfterHook = hook
+	return s
+}
+
+func (s *SlackAlert) Before(c common.AlertContext) error {
+	if s.BeforeHook != nil {
+		if err := s.BeforeHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SlackAlert) After(c common.AlertContext) error {
+	if s.AfterHook != nil {
+		if err := s.AfterHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SlackAlert) Limit(idx int, alerts template.Alerts) bool {
+	if s.LimitFunc != nil {
+		if !s.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func (s *SlackAlert) Execute(c common.AlertContext, users []string) error {
+	if err := s.Before(c); err != nil {
+		return common.ErrorBeforeHook
+	}
+	slackContext, ok := c.(*SlackAlertContext)
+	if !ok {
+		return errors.New("invalid context type for SlackAlert")
+	}
+	slog.Debug("SlackAlert is Execute", slog.Any("sendToUser", users), slog.Any("Context", slackContext))
+	if slackContext.Message.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+	if s.Limit(0, slackContext.Message.Alerts) {
+		return common.NewLimitedError(slackContext.Message.Alerts)
+	}
+
+	msg := Message{
+		Channel: slackContext.Channel,
+		Text:    header(slackContext.Title, slackContext.Message.Data),
+	}
+	if name := s.Templates.Resolve(slackContext.Template, DefaultTemplate); name != "" {
+		text, err := s.Templates.Render(name, tmpl.NewData(slackContext.Message, slackContext.Title, users))
+		if err != nil {
+			slog.Error("SlackAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
+			return err
+		}
+		msg.Blocks = []Block{{Type: "section", Text: markdown(text)}}
+	} else {
+		msg.Blocks = alertBlocks(slackContext.Title, slackContext.Message.Data, users)
+	}
+	if err := s.send(slackContext.Webhook, msg); err != nil {
+		return err
+	}
+	if err := s.After(c); err != nil {
+		return common.ErrorAfterHook
+	}
+	return nil
+}
+
+// send 发送消息，Slack 成功时返回 200 和 ok，失败时返回非 2xx 和错误原因
+func (s *SlackAlert) send(webhook string, msg Message) error {
+	_, err := s.Client.NewRequest("POST", webhook).
+		SetJSONBody(msg).
+		ErrorOnStatus(true).
+		Do()
+	if err != nil {
+		slog.Error("SlackAlert, Send data to Slack failed", slog.Any("err", err))
+		return fmt.Errorf("[alert]:send slack message failed: %w", err)
+	}
+	return nil
+}
+
+func (s *SlackAlert) ExecuteTest(c common.AlertContext) error {
+	slackContext, ok := c.(*SlackAlertContext)
+	if !ok {
+		return errors.New("invalid context type for SlackAlert")
+	}
+	text := fmt.Sprintf("【%s】Slack 告警测试：收到本消息说明 Slack 告警配置成功！", slackContext.Title)
+	slog.Debug("SlackAlert is ExecuteTest", slog.Any("Context", slackContext))
+	return s.send(slackContext.Webhook, Message{
+		Channel: slackContext.Channel,
+		Text:    text,
+		Blocks:  []Block{{Type: "section", Text: markdown(text)}},
+	})
+}
@@ -0,0 +1,94 @@
+package slack
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/internal/alerttest"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+)
+
+// testMessage 返回包含 n 条告警的消息，摘要中包含需要转义的字符
+func testMessage(n int) common.CustomMsg {
+	alerts := make([]template.Alert, n)
+	for i := range alerts {
+		alerts[i] = alerttest.Alert("firing", template.KV{"instance": "10.0.0.1:9100"}, template.KV{"summary": "CPU <90%>"})
+	}
+	return alerttest.Message(alerts...)
+}
+
+// TestSlackAlertExecute 测试 Block Kit 消息
+func TestSlackAlertExecute(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, "ok"))
+	c := &SlackAlertContext{Message: testMessage(1), Title: "prod", Webhook: ts.URL, Channel: "#ops"}
+	require.NoError(t, NewSlackAlert().Execute(c, []string{"U123"}))
+
+	require.Len(t, *requests, 1)
+	msg := alerttest.JSON[Message](t, (*requests)[0])
+	assert.Equal(t, "#ops", msg.Channel)
+	assert.Equal(t, "[prod] 活跃 1 条告警", msg.Text)
+	require.Len(t, msg.Blocks, 4)
+	assert.Equal(t, "header", msg.Blocks[0].Type)
+	assert.Equal(t, "plain_text", msg.Blocks[0].Text.Type)
+	assert.Equal(t, "<@U123>", msg.Blocks[1].Text.Text)
+	assert.Equal(t, "*HighCPU* CPU &lt;90%&gt;", msg.Blocks[2].Text.Text)
+	require.Len(t, msg.Blocks[2].Fields, 4)
+	assert.Equal(t, "*级别*\ncritical", msg.Blocks[2].Fields[1].Text)
+	assert.Equal(t, "context", msg.Blocks[3].Type)
+	assert.Equal(t, "<http://alertmanager:9093|Alertmanager>", msg.Blocks[3].Elements[0].Text)
+}
+
+// TestAlertBlocks 测试超过 Slack block 数量上限时截断
+func TestAlertBlocks(t *testing.T) {
+	blocks := alertBlocks("prod", testMessage(100).Data, nil)
+	assert.Len(t, blocks, maxBlocks)
+	assert.Equal(t, "还有 53 条告警未显示", blocks[len(blocks)-2].Text.Text)
+
+	assert.Equal(t, "abc", truncate("abc", 3))
+	assert.Equal(t, "a…", truncate("abc", 2))
+	assert.LessOrEqual(t, len([]rune(markdown(strings.Repeat("告", 4000)).Text)), maxSectionLen)
+}
+
+// TestSlackAlertTemplate 测试使用模板渲染消息
+func TestSlackAlertTemplate(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, "ok"))
+	templates := tmpl.New()
+	require.NoError(t, templates.ParseText(DefaultTemplate, `*{{ .Title }}* {{ len .Alerts.Firing }} firing`))
+
+	alert := NewSlackAlert().WithTemplates(templates)
+	require.NoError(t, alert.Execute(&SlackAlertContext{Message: testMessage(2), Title: "prod", Webhook: ts.URL}, nil))
+	require.Len(t, *requests, 1)
+	msg := alerttest.JSON[Message](t, (*requests)[0])
+	require.Len(t, msg.Blocks, 1)
+	assert.Equal(t, "mrkdwn", msg.Blocks[0].Text.Type)
+	assert.Equal(t, "*prod* 2 firing", msg.Blocks[0].Text.Text)
+}
+
+// TestSlackAlertFailed 测试发送失败的情况
+func TestSlackAlertFailed(t *testing.T) {
+	ts, _ := alerttest.NewServer(t, alerttest.Reply(http.StatusNotFound, "no_service"))
+	c := &SlackAlertContext{Message: testMessage(1), Webhook: ts.URL}
+
+	err := NewSlackAlert().Execute(c, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no_service")
+
+	err = NewSlackAlert().WithLimit(alerttest.DenyLimit{}).Execute(c, nil)
+	require.ErrorIs(t, err, common.ErrorLimited)
+	assert.Len(t, common.LimitedAlerts(err), len(c.Message.Alerts), "上报被限流的告警")
+
+	require.Error(t, NewSlackAlert().Execute(&SlackAlertContext{Webhook: ts.URL}, nil), "消息没有数据")
+}
+
+// TestSlackAlertExecuteTest 测试发送测试消息
+func TestSlackAlertExecuteTest(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, "ok"))
+	require.NoError(t, NewSlackAlert().ExecuteTest(&SlackAlertContext{Title: "prod", Webhook: ts.URL}))
+	require.Len(t, *requests, 1)
+	assert.Contains(t, alerttest.JSON[Message](t, (*requests)[0]).Text, "prod")
+}
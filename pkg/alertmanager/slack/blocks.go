@@ -0,0 +1,106 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// Slack 限制：header 文本最长 150 个字符，section 文本最长 3000 个字符，一条消息最多 50 个 block
+const (
+	maxHeaderLen  = 150
+	maxSectionLen = 3000
+	maxBlocks     = 50
+)
+
+// Message Slack Incoming Webhook 的请求体
+type Message struct {
+	Channel string  `json:"channel,omitempty"`
+	Text    string  `json:"text"`
+	Blocks  []Block `json:"blocks,omitempty"`
+}
+
+// Block Block Kit 中的 block
+type Block struct {
+	Type     string  `json:"type"`
+	Text     *Text   `json:"text,omitempty"`
+	Fields   []*Text `json:"fields,omitempty"`
+	Elements []*Text `json:"elements,omitempty"`
+}
+
+// Text Block Kit 中的文本对象
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func plainText(text string) *Text {
+	return &Text{Type: "plain_text", Text: truncate(text, maxHeaderLen)}
+}
+
+func markdown(text string) *Text {
+	return &Text{Type: "mrkdwn", Text: truncate(text, maxSectionLen)}
+}
+
+// truncate 按字符截断文本
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// escape 转义 mrkdwn 中的控制字符
+func escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// mentions 生成 @ 用户的文本，users 为 Slack 用户 ID
+func mentions(users []string) string {
+	res := make([]string, 0, len(users))
+	for _, user := range users {
+		res = append(res, fmt.Sprintf("<@%s>", user))
+	}
+	return strings.Join(res, " ")
+}
+
+// header 消息的标题
+func header(title string, data *template.Data) string {
+	return fmt.Sprintf("[%s] %s %d 条告警", title, common.StatusText(data.Status), len(data.Alerts))
+}
+
+// alertBlocks 使用 Block Kit 生成告警消息，每条告警一个 section，超过 block 数量上限的告警合并为一条说明
+func alertBlocks(title string, data *template.Data, users []string) []Block {
+	blocks := []Block{{Type: "header", Text: plainText(header(title, data))}}
+	if len(users) > 0 {
+		blocks = append(blocks, Block{Type: "section", Text: markdown(mentions(users))})
+	}
+	// 预留 footer 和截断说明的位置
+	remaining := maxBlocks - len(blocks) - 2
+	for idx, alert := range data.Alerts {
+		if idx >= remaining {
+			blocks = append(blocks, Block{Type: "section", Text: markdown(fmt.Sprintf("还有 %d 条告警未显示", len(data.Alerts)-idx))})
+			break
+		}
+		blocks = append(blocks, Block{
+			Type: "section",
+			Text: markdown(fmt.Sprintf("*%s* %s", escape(alert.Labels["alertname"]), escape(common.AlertSummary(alert)))),
+			Fields: []*Text{
+				markdown("*状态*\n" + common.StatusText(alert.Status)),
+				markdown("*级别*\n" + escape(alert.Labels["severity"])),
+				markdown("*实例*\n" + escape(alert.Labels["instance"])),
+				markdown("*开始时间*\n" + alert.StartsAt.Format("2006-01-02 15:04:05")),
+			},
+		})
+	}
+	if data.ExternalURL != "" {
+		blocks = append(blocks, Block{
+			Type:     "context",
+			Elements: []*Text{markdown(fmt.Sprintf("<%s|Alertmanager>", data.ExternalURL))},
+		})
+	}
+	return blocks
+}
@@ -0,0 +1,26 @@
+package slack
+
+import (
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// SlackAlertContext Slack Incoming Webhook 告警上下文
+type SlackAlertContext struct {
+	Message common.CustomMsg
+	Title   string `json:"title"`
+	Webhook string `json:"webhook"`
+	// Channel 覆盖 Incoming Webhook 默认的频道，新版 Slack App 的 Webhook 会忽略该字段
+	Channel string `json:"channel,omitempty"`
+	// Template 覆盖告警方式默认的消息模板
+	Template string `json:"template,omitempty"`
+}
+
+var _ = common.TemplateContext(&SlackAlertContext{})
+
+func (s *SlackAlertContext) GetMethod() string {
+	return common.MethodSlack
+}
+
+func (s *SlackAlertContext) TemplateNames() []string {
+	return common.NonEmpty(s.Template)
+}
@@ -0,0 +1,157 @@
+package teams
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+	"github.piwriw.go-tools/pkg/httputil"
+)
+
+// DefaultTemplate Teams 消息默认使用的模板名称，模板渲染的结果作为卡片中的 TextBlock 发送，支持 Markdown
+const DefaultTemplate = "teams.message"
+
+// TeamsAlert Microsoft Teams 告警策略，使用 Adaptive Card 发送告警
+type TeamsAlert struct {
+	Client     *http.Client
+	BeforeHook common.HookFunc
+	AfterHook  common.HookFunc
+	LimitFunc  common.LimitOption
+	// Templates 消息模板，未设置或模板不存在时使用内置的卡片格式
+	Templates *tmpl.Templates
+}
+
+var _ = common.AlertMethod(&TeamsAlert{})
+
+func NewTeamsAlert() *TeamsAlert {
+	return &TeamsAlert{Client: http.NewHTTPClient()}
+}
+
+func NewTeamsAlertWithClient(client *http.Client) *TeamsAlert {
+	return &TeamsAlert{Client: client}
+}
+
+func (t *TeamsAlert) WithLimit(limit common.LimitOption) *TeamsAlert {
+	if limit == nil {
+		return t
+	}
+	t.LimitFunc = limit
+	return t
+}
+
+func (t *TeamsAlert) WithTemplates(templates *tmpl.Templates) *TeamsAlert {
+	t.Templates = templates
+	return t
+}
+
+func (t *TeamsAlert) WithBeforeHook(hook common.HookFunc) *TeamsAlert {
+	if hook == nil {
+		return t
+	}
+	t.BeforeHook = hook
+	return t
+}
+
+func (t *TeamsAlert) WithAfterHook(hook common.HookFunc) *TeamsAlert {
+	if hook == nil {
+		return t
+	}
+	t.AfterHook = hook
+	return t
+}
+
+func (t *TeamsAlert) Before(c common.AlertContext) error {
+	if t.BeforeHook != nil {
+		if err := t.BeforeHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TeamsAlert) After(c common.AlertContext) error {
+	if t.AfterHook != nil {
+		if err := t.AfterHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TeamsAlert) Limit(idx int, alerts template.Alerts) bool {
+	if t.LimitFunc != nil {
+		if !t.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func (t *TeamsAlert) Execute(c common.AlertContext, users []string) error {
+	if err := t.Before(c); err != nil {
+		return common.ErrorBeforeHook
+	}
+	teamsContext, ok := c.(*TeamsAlertContext)
+	if !ok {
+		return errors.New("invalid context type for TeamsAlert")
+	}
+	slog.Debug("TeamsAlert is Execute", slog.Any("sendToUser", users), slog.Any("Context", teamsContext))
+	if teamsContext.Message.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+	if t.Limit(0, teamsContext.Message.Alerts) {
+		return common.NewLimitedError(teamsContext.Message.Alerts)
+	}
+
+	var card *AdaptiveCard
+	if name := t.Templates.Resolve(teamsContext.Template, DefaultTemplate); name != "" {
+		text, err := t.Templates.Render(name, tmpl.NewData(teamsContext.Message, teamsContext.Title, users))
+		if err != nil {
+			slog.Error("TeamsAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
+			return err
+		}
+		card = newCard(header(teamsContext.Title, teamsContext.Message.Data), users)
+		card.Body = append(card.Body, Element{Type: "TextBlock", Text: text, Wrap: true})
+	} else {
+		card = alertCard(teamsContext.Title, teamsContext.Message.Data, users)
+	}
+	if err := t.send(teamsContext.Webhook, card); err != nil {
+		return err
+	}
+	if err := t.After(c); err != nil {
+		return common.ErrorAfterHook
+	}
+	return nil
+}
+
+// send 发送卡片，Teams 成功时返回 200 或 202
+func (t *TeamsAlert) send(webhook string, card *AdaptiveCard) error {
+	_, err := t.Client.NewRequest("POST", webhook).
+		SetJSONBody(newMessage(card)).
+		ErrorOnStatus(true).
+		Do()
+	if err != nil {
+		slog.Error("TeamsAlert, Send data to Teams failed", slog.Any("err", err))
+		return fmt.Errorf("[alert]:send teams message failed: %w", err)
+	}
+	return nil
+}
+
+func (t *TeamsAlert) ExecuteTest(c common.AlertContext) error {
+	teamsContext, ok := c.(*TeamsAlertContext)
+	if !ok {
+		return errors.New("invalid context type for TeamsAlert")
+	}
+	slog.Debug("TeamsAlert is ExecuteTest", slog.Any("Context", teamsContext))
+	card := newCard(fmt.Sprintf("【%s】Teams 告警测试", teamsContext.Title), nil)
+	card.Body = append(card.Body, Element{Type: "TextBlock", Text: "收到本消息说明 Teams 告警配置成功！", Wrap: true})
+	return t.send(teamsContext.Webhook, card)
+}
@@ -0,0 +1,84 @@
+package teams
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/internal/alerttest"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+)
+
+// testMessage 返回包含一条恢复告警的消息
+func testMessage() common.CustomMsg {
+	return alerttest.Message(alerttest.Alert("resolved", template.KV{"instance": "10.0.0.1:9100"}, template.KV{"description": "CPU usage above 90%"}))
+}
+
+// TestTeamsAlertExecute 测试 Adaptive Card 消息
+func TestTeamsAlertExecute(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusAccepted, ""))
+	c := &TeamsAlertContext{Message: testMessage(), Title: "prod", Webhook: ts.URL}
+	require.NoError(t, NewTeamsAlert().Execute(c, []string{"zhangsan@example.com"}))
+
+	require.Len(t, *requests, 1)
+	msg := alerttest.JSON[Message](t, (*requests)[0])
+	assert.Equal(t, "message", msg.Type)
+	require.Len(t, msg.Attachments, 1)
+	assert.Equal(t, adaptiveCardContentType, msg.Attachments[0].ContentType)
+
+	card := msg.Attachments[0].Content
+	assert.Equal(t, "AdaptiveCard", card.Type)
+	assert.Equal(t, adaptiveCardVersion, card.Version)
+	require.Len(t, card.Body, 3)
+	assert.Equal(t, "[prod] 恢复 1 条告警", card.Body[0].Text)
+	assert.Equal(t, "<at>zhangsan@example.com</at>", card.Body[1].Text)
+	require.Len(t, card.MSTeams.Entities, 1)
+	assert.Equal(t, "zhangsan@example.com", card.MSTeams.Entities[0].Mentioned.ID)
+
+	container := card.Body[2]
+	assert.Equal(t, "Container", container.Type)
+	assert.Equal(t, "HighCPU CPU usage above 90%", container.Items[0].Text)
+	assert.Equal(t, "Good", container.Items[0].Color)
+	assert.Equal(t, Fact{Title: "实例", Value: "10.0.0.1:9100"}, container.Items[1].Facts[2])
+	require.Len(t, card.Actions, 1)
+	assert.Equal(t, "http://alertmanager:9093", card.Actions[0].URL)
+}
+
+// TestTeamsAlertTemplate 测试使用模板渲染消息
+func TestTeamsAlertTemplate(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, ""))
+	templates := tmpl.New()
+	require.NoError(t, templates.ParseText("custom", `**{{ .Title }}** {{ (index .Alerts 0).Labels.instance }}`))
+
+	alert := NewTeamsAlert().WithTemplates(templates)
+	require.NoError(t, alert.Execute(&TeamsAlertContext{Message: testMessage(), Title: "prod", Webhook: ts.URL, Template: "custom"}, nil))
+	require.Len(t, *requests, 1)
+	body := alerttest.JSON[Message](t, (*requests)[0]).Attachments[0].Content.Body
+	require.Len(t, body, 2)
+	assert.Equal(t, "**prod** 10.0.0.1:9100", body[1].Text)
+}
+
+// TestTeamsAlertFailed 测试发送失败的情况
+func TestTeamsAlertFailed(t *testing.T) {
+	ts, _ := alerttest.NewServer(t, alerttest.Reply(http.StatusBadRequest, ""))
+	c := &TeamsAlertContext{Message: testMessage(), Webhook: ts.URL}
+
+	err := NewTeamsAlert().Execute(c, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "400")
+
+	err = NewTeamsAlert().WithLimit(alerttest.DenyLimit{}).Execute(c, nil)
+	require.ErrorIs(t, err, common.ErrorLimited)
+	assert.Len(t, common.LimitedAlerts(err), len(c.Message.Alerts), "上报被限流的告警")
+}
+
+// TestTeamsAlertExecuteTest 测试发送测试消息
+func TestTeamsAlertExecuteTest(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusAccepted, ""))
+	require.NoError(t, NewTeamsAlert().ExecuteTest(&TeamsAlertContext{Title: "prod", Webhook: ts.URL}))
+	require.Len(t, *requests, 1)
+	assert.Contains(t, alerttest.JSON[Message](t, (*requests)[0]).Attachments[0].Content.Body[0].Text, "prod")
+}
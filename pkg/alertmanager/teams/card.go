@@ -0,0 +1,171 @@
+package teams
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+const (
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.4"
+)
+
+// Message Teams Webhook 的请求体，消息内容为一张 Adaptive Card
+type Message struct {
+	Type        string       `json:"type"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+// Attachment 消息附件
+type Attachment struct {
+	ContentType string        `json:"contentType"`
+	ContentURL  *string       `json:"contentUrl"`
+	Content     *AdaptiveCard `json:"content"`
+}
+
+// AdaptiveCard Adaptive Card 卡片
+type AdaptiveCard struct {
+	Schema  string         `json:"$schema"`
+	Type    string         `json:"type"`
+	Version string         `json:"version"`
+	Body    []Element      `json:"body"`
+	Actions []Action       `json:"actions,omitempty"`
+	MSTeams *MSTeamsConfig `json:"msteams,omitempty"`
+}
+
+// Element 卡片中的元素，支持 TextBlock、FactSet 和 Container
+type Element struct {
+	Type      string    `json:"type"`
+	Text      string    `json:"text,omitempty"`
+	Size      string    `json:"size,omitempty"`
+	Weight    string    `json:"weight,omitempty"`
+	Color     string    `json:"color,omitempty"`
+	Wrap      bool      `json:"wrap,omitempty"`
+	Separator bool      `json:"separator,omitempty"`
+	Facts     []Fact    `json:"facts,omitempty"`
+	Items     []Element `json:"items,omitempty"`
+}
+
+// Fact FactSet 中的键值对
+type Fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// Action 卡片按钮
+type Action struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// MSTeamsConfig Teams 扩展配置
+type MSTeamsConfig struct {
+	Width    string    `json:"width,omitempty"`
+	Entities []Mention `json:"entities,omitempty"`
+}
+
+// Mention @ 用户，Text 需要出现在卡片的文本中
+type Mention struct {
+	Type      string    `json:"type"`
+	Text      string    `json:"text"`
+	Mentioned Mentioned `json:"mentioned"`
+}
+
+// Mentioned 被 @ 的用户，ID 为 Azure AD 对象 ID 或 UPN
+type Mentioned struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// newMessage 将卡片包装为 Teams 消息
+func newMessage(card *AdaptiveCard) Message {
+	return Message{
+		Type: "message",
+		Attachments: []Attachment{{
+			ContentType: adaptiveCardContentType,
+			Content:     card,
+		}},
+	}
+}
+
+// newCard 创建包含标题的卡片，users 不为空时在标题下方 @ 用户
+func newCard(title string, users []string) *AdaptiveCard {
+	card := &AdaptiveCard{
+		Schema:  adaptiveCardSchema,
+		Type:    "AdaptiveCard",
+		Version: adaptiveCardVersion,
+		Body: []Element{{
+			Type:   "TextBlock",
+			Text:   title,
+			Size:   "Large",
+			Weight: "Bolder",
+			Wrap:   true,
+		}},
+		MSTeams: &MSTeamsConfig{Width: "Full"},
+	}
+	if len(users) > 0 {
+		texts := make([]string, 0, len(users))
+		for _, user := range users {
+			text := fmt.Sprintf("<at>%s</at>", user)
+			texts = append(texts, text)
+			card.MSTeams.Entities = append(card.MSTeams.Entities, Mention{
+				Type:      "mention",
+				Text:      text,
+				Mentioned: Mentioned{ID: user, Name: user},
+			})
+		}
+		card.Body = append(card.Body, Element{Type: "TextBlock", Text: strings.Join(texts, " "), Wrap: true})
+	}
+	return card
+}
+
+// header 消息的标题
+func header(title string, data *template.Data) string {
+	return fmt.Sprintf("[%s] %s %d 条告警", title, common.StatusText(data.Status), len(data.Alerts))
+}
+
+// statusColor 告警状态对应的文本颜色
+func statusColor(status string) string {
+	if status == "resolved" {
+		return "Good"
+	}
+	return "Attention"
+}
+
+// alertCard 生成告警卡片，每条告警一个 Container
+func alertCard(title string, data *template.Data, users []string) *AdaptiveCard {
+	card := newCard(header(title, data), users)
+	for _, alert := range data.Alerts {
+		card.Body = append(card.Body, Element{
+			Type:      "Container",
+			Separator: true,
+			Items: []Element{
+				{
+					Type:   "TextBlock",
+					Text:   fmt.Sprintf("%s %s", alert.Labels["alertname"], common.AlertSummary(alert)),
+					Weight: "Bolder",
+					Color:  statusColor(alert.Status),
+					Wrap:   true,
+				},
+				{
+					Type: "FactSet",
+					Facts: []Fact{
+						{Title: "状态", Value: common.StatusText(alert.Status)},
+						{Title: "级别", Value: alert.Labels["severity"]},
+						{Title: "实例", Value: alert.Labels["instance"]},
+						{Title: "开始时间", Value: alert.StartsAt.Format("2006-01-02 15:04:05")},
+					},
+				},
+			},
+		})
+	}
+	if data.ExternalURL != "" {
+		card.Actions = append(card.Actions, Action{Type: "Action.OpenUrl", Title: "Alertmanager", URL: data.ExternalURL})
+	}
+	return card
+}
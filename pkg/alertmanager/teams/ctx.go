@@ -0,0 +1,24 @@
+package teams
+
+import (
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// TeamsAlertContext Microsoft Teams 告警上下文，Webhook 为 Teams Workflows 或 Incoming Webhook 地址
+type TeamsAlertContext struct {
+	Message common.CustomMsg
+	Title   string `json:"title"`
+	Webhook string `json:"webhook"`
+	// Template 覆盖告警方式默认的消息模板
+	Template string `json:"template,omitempty"`
+}
+
+var _ = common.TemplateContext(&TeamsAlertContext{})
+
+func (t *TeamsAlertContext) GetMethod() string {
+	return common.MethodTeams
+}
+
+func (t *TeamsAlertContext) TemplateNames() []string {
+	return common.NonEmpty(t.Template)
+}
@@ -0,0 +1,323 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+	"github.piwriw.go-tools/pkg/httputil"
+)
+
+// DefaultTemplate Telegram 消息默认使用的模板名称，模板渲染的结果按 HTML 格式发送，
+// 模板中需要使用 html 函数转义标签和注解中的 <、> 和 &
+const DefaultTemplate = "telegram.message"
+
+const (
+	defaultAPIURL = "https://api.telegram.org"
+	// maxMessageLen Telegram 单条消息解析 HTML 后最多 4096 个 UTF-16 编码单元
+	maxMessageLen = 4096
+)
+
+// TelegramAlert Telegram Bot API 告警策略
+type TelegramAlert struct {
+	Client     *http.Client
+	BeforeHook common.HookFunc
+	AfterHook  common.HookFunc
+	LimitFunc  common.LimitOption
+	// Templates 消息模板，未设置或模板不存在时使用内置的消息格式
+	Templates *tmpl.Templates
+}
+
+var _ = common.AlertMethod(&TelegramAlert{})
+
+func NewTelegramAlert() *TelegramAlert {
+	return &TelegramAlert{Client: http.NewHTTPClient()}
+}
+
+func NewTelegramAlertWithClient(client *http.Client) *TelegramAlert {
+	return &TelegramAlert{Client: client}
+}
+
+func (t *TelegramAlert) WithLimit(limit common.LimitOption) *TelegramAlert {
+	if limit == nil {
+		return t
+	}
+	t.LimitFunc = limit
+	return t
+}
+
+func (t *TelegramAlert) WithTemplates(templates *tmpl.Templates) *TelegramAlert {
+	t.Templates = templates
+	return t
+}
+
+func (t *TelegramAlert) WithBeforeHook(hook common.HookFunc) *TelegramAlert {
+	if hook == nil {
+		return t
+	}
+	t.BeforeHook = hook
+	return t
+}
+
+func (t *TelegramAlert) WithAfterHook(hook common.HookFunc) *TelegramAlert {
+	if hook == nil {
+		return t
+	}
+	t.AfterHook = hook
+	return t
+}
+
+func (t *TelegramAlert) Before(c common.AlertContext) error {
+	if t.BeforeHook != nil {
+		if err := t.BeforeHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TelegramAlert) After(c common.AlertContext) error {
+	if t.AfterHook != nil {
+		if err := t.AfterHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TelegramAlert) Limit(idx int, alerts template.Alerts) bool {
+	if t.LimitFunc != nil {
+		if !t.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func (t *TelegramAlert) Execute(c common.AlertContext, users []string) error {
+	if err := t.Before(c); err != nil {
+		return common.ErrorBeforeHook
+	}
+	telegramContext, ok := c.(*TelegramAlertContext)
+	if !ok {
+		return errors.New("invalid context type for TelegramAlert")
+	}
+	slog.Debug("TelegramAlert is Execute", slog.Any("sendToUser", users), slog.String("chatID", telegramContext.ChatID))
+	if telegramContext.Message.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+	if t.Limit(0, telegramContext.Message.Alerts) {
+		return common.NewLimitedError(telegramContext.Message.Alerts)
+	}
+
+	var text string
+	if name := t.Templates.Resolve(telegramContext.Template, DefaultTemplate); name != "" {
+		res, err := t.Templates.Render(name, tmpl.NewData(telegramContext.Message, telegramContext.Title, users))
+		if err != nil {
+			slog.Error("TelegramAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
+			return err
+		}
+		text = res
+	} else {
+		text = alertText(telegramContext.Title, telegramContext.Message.Data, users)
+	}
+	if err := t.send(telegramContext, text); err != nil {
+		return err
+	}
+	if err := t.After(c); err != nil {
+		return common.ErrorAfterHook
+	}
+	return nil
+}
+
+// alertText 生成 HTML 格式的告警消息，users 为 Telegram 用户名
+func alertText(title string, data *template.Data, users []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>[%s] %s %d 条告警</b>\n", html.EscapeString(title), common.StatusText(data.Status), len(data.Alerts))
+	for _, alert := range data.Alerts {
+		fmt.Fprintf(&b, "\n<b>%s</b> %s\n", html.EscapeString(alert.Labels["alertname"]), html.EscapeString(common.AlertSummary(alert)))
+		fmt.Fprintf(&b, "状态：%s\n", common.StatusText(alert.Status))
+		if severity := alert.Labels["severity"]; severity != "" {
+			fmt.Fprintf(&b, "级别：%s\n", html.EscapeString(severity))
+		}
+		if instance := alert.Labels["instance"]; instance != "" {
+			fmt.Fprintf(&b, "实例：<code>%s</code>\n", html.EscapeString(instance))
+		}
+		fmt.Fprintf(&b, "开始时间：%s\n", alert.StartsAt.Format("2006-01-02 15:04:05"))
+	}
+	if len(users) > 0 {
+		b.WriteString("\n")
+		for i, user := range users {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString("@" + html.EscapeString(strings.TrimPrefix(user, "@")))
+		}
+	}
+	return b.String()
+}
+
+// truncate 截断超过 Telegram 长度限制的 HTML 消息
+// Telegram 按解析 HTML 后的文本计算长度，单位为 UTF-16 编码单元。截断时标签不计入长度，
+// 不拆分标签和实体，并在末尾补齐未闭合的标签
+func truncate(text string) string {
+	if htmlLen(text) <= maxMessageLen {
+		return text
+	}
+	var b strings.Builder
+	var open []string
+	n := 0
+	for text != "" {
+		token, width := htmlToken(text)
+		// 保留一个单位用于省略号
+		if n+width > maxMessageLen-1 {
+			break
+		}
+		text = text[len(token):]
+		n += width
+		b.WriteString(token)
+		if width > 0 {
+			continue
+		}
+		name := tagName(token)
+		if !strings.HasPrefix(token, "</") {
+			open = append(open, name)
+			continue
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i] == name {
+				open = open[:i]
+				break
+			}
+		}
+	}
+	b.WriteString("…")
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+// htmlLen 返回 HTML 消息解析后的文本长度，单位为 UTF-16 编码单元
+func htmlLen(text string) int {
+	n := 0
+	for text != "" {
+		token, width := htmlToken(text)
+		text = text[len(token):]
+		n += width
+	}
+	return n
+}
+
+// htmlToken 返回 HTML 文本开头的标签、实体或字符，以及它解析后占用的 UTF-16 编码单元数，标签不占用长度
+func htmlToken(text string) (string, int) {
+	switch text[0] {
+	case '<':
+		if end := strings.IndexByte(text, '>'); end > 0 {
+			return text[:end+1], 0
+		}
+	case '&':
+		if end := strings.IndexByte(text, ';'); end > 1 && isEntityName(text[1:end]) {
+			return text[:end+1], 1
+		}
+	}
+	r, size := utf8.DecodeRuneInString(text)
+	if r > 0xFFFF {
+		// 基本多文种平面以外的字符占用两个 UTF-16 编码单元
+		return text[:size], 2
+	}
+	return text[:size], 1
+}
+
+// isEntityName 判断是否为 &amp; 或 &#38; 这样的实体名称
+func isEntityName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '#') {
+			return false
+		}
+	}
+	return true
+}
+
+// tagName 返回标签名称，例如 <a href="..."> 和 </a> 都返回 a
+func tagName(tag string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(tag, "<"), "/")
+	if i := strings.IndexAny(name, " \t\n>"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ToLower(name)
+}
+
+type sendMessageReq struct {
+	ChatID                string `json:"chat_id"`
+	MessageThreadID       int    `json:"message_thread_id,omitempty"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type telegramRes struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+// send 调用 sendMessage 发送 HTML 消息，错误信息中的 Bot Token 会被隐藏
+func (t *TelegramAlert) send(telegramContext *TelegramAlertContext, text string) error {
+	if telegramContext.BotToken == "" || telegramContext.ChatID == "" {
+		return errors.New("[alert]:telegram bot_token and chat_id are required")
+	}
+	apiURL := telegramContext.APIURL
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
+	url := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(apiURL, "/"), telegramContext.BotToken)
+	resp, err := t.Client.NewRequest("POST", url).
+		SetJSONBody(sendMessageReq{
+			ChatID:                telegramContext.ChatID,
+			MessageThreadID:       telegramContext.MessageThreadID,
+			Text:                  truncate(text),
+			ParseMode:             "HTML",
+			DisableWebPagePreview: true,
+		}).
+		ErrorOnStatus(false).
+		Do()
+	if err != nil {
+		err = errors.New(strings.ReplaceAll(err.Error(), telegramContext.BotToken, "<token>"))
+		slog.Error("TelegramAlert, Send data to Telegram failed", slog.Any("err", err))
+		return fmt.Errorf("[alert]:send telegram message failed: %w", err)
+	}
+	res := &telegramRes{}
+	if err = json.Unmarshal(resp.Body, res); err != nil {
+		slog.Error("TelegramAlert, Unmarshal response is failed", slog.Int("status", resp.StatusCode), slog.Any("err", err))
+		return fmt.Errorf("[alert]:unmarshal telegram response failed: %w", err)
+	}
+	if !res.OK {
+		slog.Error("TelegramAlert, Send data to Telegram failed", slog.Any("res", res))
+		return fmt.Errorf("[alert]:send telegram message failed: %d %s", res.ErrorCode, res.Description)
+	}
+	return nil
+}
+
+func (t *TelegramAlert) ExecuteTest(c common.AlertContext) error {
+	telegramContext, ok := c.(*TelegramAlertContext)
+	if !ok {
+		return errors.New("invalid context type for TelegramAlert")
+	}
+	slog.Debug("TelegramAlert is ExecuteTest", slog.String("chatID", telegramContext.ChatID))
+	text := fmt.Sprintf("【%s】Telegram 告警测试：收到本消息说明 Telegram 告警配置成功！", html.EscapeString(telegramContext.Title))
+	return t.send(telegramContext, text)
+}
@@ -0,0 +1,124 @@
+package telegram
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/internal/alerttest"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+)
+
+const testToken = "123456:secret"
+
+// reply 模拟 Telegram Bot API 的 sendMessage 接口，Bot Token 或 chat_id 错误时返回错误
+func reply(w http.ResponseWriter, req alerttest.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if req.Path != "/bot"+testToken+"/sendMessage" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"ok":false,"error_code":401,"description":"Unauthorized"}`)
+		return
+	}
+	msg := sendMessageReq{}
+	if err := json.Unmarshal(req.Body, &msg); err != nil || msg.ChatID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+		return
+	}
+	io.WriteString(w, `{"ok":true,"result":{"message_id":1}}`)
+}
+
+// testMessage 返回一条摘要中包含 HTML 特殊字符的告警
+func testMessage() common.CustomMsg {
+	return alerttest.Message(alerttest.Alert("firing", template.KV{"instance": "10.0.0.1:9100"}, template.KV{"summary": "CPU > 90% & rising"}))
+}
+
+// TestTelegramAlertExecute 测试发送 HTML 消息
+func TestTelegramAlertExecute(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, reply)
+	c := &TelegramAlertContext{Message: testMessage(), Title: "prod", BotToken: testToken, ChatID: "-100123", APIURL: ts.URL + "/", MessageThreadID: 7}
+	require.NoError(t, NewTelegramAlert().Execute(c, []string{"@zhangsan", "lisi"}))
+
+	require.Len(t, *requests, 1)
+	req := alerttest.JSON[sendMessageReq](t, (*requests)[0])
+	assert.Equal(t, "-100123", req.ChatID)
+	assert.Equal(t, 7, req.MessageThreadID)
+	assert.Equal(t, "HTML", req.ParseMode)
+	assert.True(t, req.DisableWebPagePreview)
+	assert.Equal(t, "<b>[prod] 活跃 1 条告警</b>\n\n"+
+		"<b>HighCPU</b> CPU &gt; 90% &amp; rising\n"+
+		"状态：活跃\n级别：critical\n实例：<code>10.0.0.1:9100</code>\n开始时间：2024-01-01 00:00:00\n"+
+		"\n@zhangsan @lisi", req.Text)
+}
+
+// TestTelegramAlertTemplate 测试使用模板渲染消息
+func TestTelegramAlertTemplate(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, reply)
+	templates := tmpl.New()
+	require.NoError(t, templates.ParseText(DefaultTemplate, `<b>{{ .Title }}</b> {{ html (index .Alerts 0).Annotations.summary }}`))
+
+	alert := NewTelegramAlert().WithTemplates(templates)
+	c := &TelegramAlertContext{Message: testMessage(), Title: "prod", BotToken: testToken, ChatID: "1", APIURL: ts.URL}
+	require.NoError(t, alert.Execute(c, nil))
+	require.Len(t, *requests, 1)
+	assert.Equal(t, "<b>prod</b> CPU &gt; 90% &amp; rising", alerttest.JSON[sendMessageReq](t, (*requests)[0]).Text)
+}
+
+// TestTruncate 测试按解析后的 UTF-16 长度截断 HTML 消息，不拆分标签和实体
+func TestTruncate(t *testing.T) {
+	a := strings.Repeat("a", maxMessageLen-2)
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "未超过长度", text: "<b>" + a + "</b>&amp;", want: "<b>" + a + "</b>&amp;"},
+		{name: "按字符截断", text: strings.Repeat("告", 5000), want: strings.Repeat("告", maxMessageLen-1) + "…"},
+		{name: "截断位置在标签内", text: "<b>" + a + "</b> <code>x&amp;y</code>", want: "<b>" + a + "</b> <code>…</code>"},
+		{name: "截断位置在链接内", text: `<a href="http://alertmanager:9093">` + a + "xyz</a>", want: `<a href="http://alertmanager:9093">` + a + "x…</a>"},
+		{name: "不拆分实体", text: a + "&amp;&lt;&gt;", want: a + "&amp;…"},
+		{name: "四字节字符占用两个单位", text: strings.Repeat("😀", maxMessageLen/2+1), want: strings.Repeat("😀", maxMessageLen/2-1) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.text)
+			assert.Equal(t, tt.want, got)
+			assert.LessOrEqual(t, htmlLen(got), maxMessageLen)
+		})
+	}
+}
+
+// TestTelegramAlertFailed 测试发送失败时返回 Bot API 的错误，并隐藏 Bot Token
+func TestTelegramAlertFailed(t *testing.T) {
+	ts, _ := alerttest.NewServer(t, reply)
+
+	err := NewTelegramAlert().Execute(&TelegramAlertContext{Message: testMessage(), BotToken: "wrong", ChatID: "1", APIURL: ts.URL}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401 Unauthorized")
+
+	err = NewTelegramAlert().Execute(&TelegramAlertContext{Message: testMessage(), BotToken: testToken, APIURL: ts.URL}, nil)
+	require.Error(t, err, "缺少 chat_id")
+
+	err = NewTelegramAlert().Execute(&TelegramAlertContext{Message: testMessage(), BotToken: testToken, ChatID: "1", APIURL: "http://127.0.0.1:1"}, nil)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), testToken)
+
+	c := &TelegramAlertContext{Message: testMessage(), BotToken: testToken, ChatID: "1", APIURL: ts.URL}
+	err = NewTelegramAlert().WithLimit(alerttest.DenyLimit{}).Execute(c, nil)
+	require.ErrorIs(t, err, common.ErrorLimited)
+	assert.Len(t, common.LimitedAlerts(err), len(c.Message.Alerts), "上报被限流的告警")
+}
+
+// TestTelegramAlertExecuteTest 测试发送测试消息
+func TestTelegramAlertExecuteTest(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, reply)
+	require.NoError(t, NewTelegramAlert().ExecuteTest(&TelegramAlertContext{Title: "<prod>", BotToken: testToken, ChatID: "1", APIURL: ts.URL}))
+	require.Len(t, *requests, 1)
+	assert.Contains(t, alerttest.JSON[sendMessageReq](t, (*requests)[0]).Text, "&lt;prod&gt;")
+}
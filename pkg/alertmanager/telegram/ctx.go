@@ -0,0 +1,30 @@
+package telegram
+
+import (
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// TelegramAlertContext Telegram Bot 告警上下文
+type TelegramAlertContext struct {
+	Message  common.CustomMsg
+	Title    string `json:"title"`
+	BotToken string `json:"bot_token"`
+	// ChatID 用户、群组 ID 或频道用户名（@channel）
+	ChatID string `json:"chat_id"`
+	// APIURL Bot API 地址，默认 https://api.telegram.org，使用自建 Bot API 服务时设置
+	APIURL string `json:"api_url,omitempty"`
+	// MessageThreadID 发送到论坛群组的指定话题
+	MessageThreadID int `json:"message_thread_id,omitempty"`
+	// Template 覆盖告警方式默认的消息模板
+	Template string `json:"template,omitempty"`
+}
+
+var _ = common.TemplateContext(&TelegramAlertContext{})
+
+func (t *TelegramAlertContext) GetMethod() string {
+	return common.MethodTelegram
+}
+
+func (t *TelegramAlertContext) TemplateNames() []string {
+	return common.NonEmpty(t.Template)
+}
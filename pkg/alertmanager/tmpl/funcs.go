@@ -0,0 +1,132 @@
+package tmpl
+
+import (
+	htmltemplate "html/template"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.piwriw.go-tools/pkg/format"
+)
+
+// DefaultTimeLayout humanizeTime 默认的时间格式
+const DefaultTimeLayout = "2006-01-02 15:04:05"
+
+// FuncMap 模板可用的函数，与 Alertmanager 模板的函数保持一致，并增加了时间和字节的格式化
+//
+//	title           首字母大写
+//	toUpper         转大写
+//	toLower         转小写
+//	join            使用分隔符拼接字符串切片：{{ join ", " .Users }}
+//	match           正则匹配：{{ if match "^db" .Labels.job }}
+//	reReplaceAll    正则替换：{{ reReplaceAll ":.*" "" .Labels.instance }}
+//	stringSlice     构造字符串切片
+//	safeHtml        标记为安全的 HTML，仅在 HTML 模板中不转义
+//	humanizeTime    格式化时间，默认格式为 2006-01-02 15:04:05：{{ humanizeTime .StartsAt }}
+//	tz              转换时区：{{ humanizeTime (tz "Asia/Shanghai" .StartsAt) }}
+//	since           距今的时长
+//	humanizeDuration 格式化时长，参数为 time.Duration 或秒数：{{ humanizeDuration (since .StartsAt) }}
+//	humanizeBytes   格式化字节数：{{ humanizeBytes .Annotations.value }}
+func FuncMap() map[string]any {
+	return map[string]any{
+		"title":            title,
+		"toUpper":          strings.ToUpper,
+		"toLower":          strings.ToLower,
+		"join":             func(sep string, s []string) string { return strings.Join(s, sep) },
+		"match":            regexp.MatchString,
+		"reReplaceAll":     reReplaceAll,
+		"stringSlice":      func(s ...string) []string { return s },
+		"safeHtml":         func(text string) htmltemplate.HTML { return htmltemplate.HTML(text) },
+		"humanizeTime":     humanizeTime,
+		"tz":               tz,
+		"since":            time.Since,
+		"humanizeDuration": humanizeDuration,
+		"humanizeBytes":    humanizeBytes,
+	}
+}
+
+// title 将每个单词的首字母转为大写，其余字母保持不变
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(prev) || unicode.IsPunct(prev) {
+			prev = r
+			return unicode.ToTitle(r)
+		}
+		prev = r
+		return r
+	}, s)
+}
+
+func reReplaceAll(pattern, repl, text string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(text, repl), nil
+}
+
+func humanizeTime(t time.Time, layout ...string) string {
+	if len(layout) > 0 && layout[0] != "" {
+		return t.Format(layout[0])
+	}
+	return t.Format(DefaultTimeLayout)
+}
+
+func tz(name string, t time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(loc), nil
+}
+
+// humanizeDuration 将时长格式化为 "1d 2h 3m 4s" 的形式，不足 1 秒时保留毫秒
+func humanizeDuration(v any) string {
+	var seconds float64
+	switch d := v.(type) {
+	case time.Duration:
+		seconds = d.Seconds()
+	default:
+		seconds = format.ToFloat64(v)
+	}
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return strconv.FormatFloat(seconds, 'f', -1, 64)
+	}
+
+	sign := ""
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	if seconds < 1 {
+		return sign + time.Duration(seconds*float64(time.Second)).Round(time.Millisecond).String()
+	}
+
+	total := int64(seconds)
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"d", 86400},
+		{"h", 3600},
+		{"m", 60},
+		{"s", 1},
+	}
+	parts := make([]string, 0, len(units))
+	for _, unit := range units {
+		if n := total / unit.size; n > 0 {
+			parts = append(parts, strconv.FormatInt(n, 10)+unit.suffix)
+			total %= unit.size
+		}
+	}
+	return sign + strings.Join(parts, " ")
+}
+
+// humanizeBytes 参数可以是数字或数字字符串，例如标签和注解中的值
+func humanizeBytes(v any) string {
+	return format.HumanReadableBytes(format.ToFloat64(v))
+}
@@ -0,0 +1,215 @@
+// Package tmpl 告警消息模板，各告警方式从磁盘加载的 text/template 和 html/template 渲染消息
+//
+// 以 .html、.htm、.gohtml 结尾的文件按 html/template 解析，其余文件按 text/template 解析。
+// 文件名和文件中 {{ define "name" }} 定义的模板都可以作为模板名称使用。
+package tmpl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/prometheus/alertmanager/notify/webhook"
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// Data 渲染模板时的数据，包含 Alertmanager Webhook 消息的所有字段
+//
+//	{{ .Title }} {{ .Status }} {{ len .Alerts.Firing }}
+//	{{ range .Alerts }}{{ .Labels.alertname }} {{ humanizeTime .StartsAt }}{{ end }}
+type Data struct {
+	common.CustomMsg
+	// Title 告警上下文中配置的标题
+	Title string
+	// Users 接收告警的用户
+	Users []string
+}
+
+// NewData 创建模板数据
+func NewData(msg common.CustomMsg, title string, users []string) *Data {
+	return &Data{CustomMsg: msg, Title: title, Users: users}
+}
+
+// ForAlert 返回只包含一条告警的模板数据，用于逐条发送告警的告警方式
+func (d *Data) ForAlert(alert template.Alert) *Data {
+	res := *d
+	if d.Message.Data != nil {
+		data := *d.Message.Data
+		data.Alerts = template.Alerts{alert}
+		res.Message.Data = &data
+	}
+	return &res
+}
+
+// Templates 告警消息模板集合
+type Templates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// New 创建空的模板集合
+func New() *Templates {
+	return &Templates{
+		text: texttemplate.New("").Option("missingkey=zero").Funcs(FuncMap()),
+		html: htmltemplate.New("").Option("missingkey=zero").Funcs(FuncMap()),
+	}
+}
+
+// Load 加载匹配 patterns 的模板文件
+func Load(patterns ...string) (*Templates, error) {
+	t := New()
+	if err := t.ParseGlob(patterns...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ParseGlob 加载匹配 patterns 的模板文件，pattern 没有匹配到文件时返回错误
+func (t *Templates) ParseGlob(patterns ...string) error {
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("[alert]:template pattern %s matches no files", pattern)
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name := filepath.Base(path)
+			if isHTML(path) {
+				err = t.ParseHTML(name, string(data))
+			} else {
+				err = t.ParseText(name, string(data))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ParseText 按 text/template 解析模板
+func (t *Templates) ParseText(name, text string) error {
+	if _, err := t.text.New(name).Parse(text); err != nil {
+		return fmt.Errorf("[alert]:parse template %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// ParseHTML 按 html/template 解析模板，输出内容会根据上下文转义
+func (t *Templates) ParseHTML(name, text string) error {
+	if _, err := t.html.New(name).Parse(text); err != nil {
+		return fmt.Errorf("[alert]:parse template %s failed: %w", name, err)
+	}
+	return nil
+}
+
+func isHTML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".gohtml":
+		return true
+	}
+	return false
+}
+
+// Has 判断模板是否存在
+func (t *Templates) Has(name string) bool {
+	if t == nil || name == "" {
+		return false
+	}
+	return t.text.Lookup(name) != nil || t.html.Lookup(name) != nil
+}
+
+// Resolve 返回需要使用的模板名称：优先使用接收者配置的 override，其次是告警方式默认的 fallback，
+// 未加载模板或默认模板不存在时返回空字符串，此时告警方式使用内置的消息格式
+func (t *Templates) Resolve(override, fallback string) string {
+	if t == nil {
+		return ""
+	}
+	if override != "" {
+		return override
+	}
+	if t.Has(fallback) {
+		return fallback
+	}
+	return ""
+}
+
+// Render 渲染模板，同名模板优先使用 text/template
+func (t *Templates) Render(name string, data *Data) (string, error) {
+	if t == nil {
+		return "", errors.New("[alert]:templates is nil")
+	}
+	var buf bytes.Buffer
+	var err error
+	switch {
+	case t.text.Lookup(name) != nil:
+		err = t.text.ExecuteTemplate(&buf, name, data)
+	case t.html.Lookup(name) != nil:
+		err = t.html.ExecuteTemplate(&buf, name, data)
+	default:
+		return "", fmt.Errorf("[alert]:template %s not found", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("[alert]:render template %s failed: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// Validate 校验模板存在，并使用示例告警渲染一次，用于启动时提前发现模板错误
+func (t *Templates) Validate(names ...string) error {
+	data := sampleData()
+	var errs []error
+	for _, name := range names {
+		if _, err := t.Render(name, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sampleData 校验模板使用的示例数据
+func sampleData() *Data {
+	now := time.Now()
+	alert := template.Alert{
+		Status: "firing",
+		Labels: template.KV{
+			"alertname": "SampleAlert",
+			"instance":  "127.0.0.1:9100",
+			"severity":  "critical",
+		},
+		Annotations: template.KV{
+			"summary":     "sample summary",
+			"description": "sample description",
+		},
+		StartsAt:     now.Add(-time.Minute),
+		GeneratorURL: "http://localhost:9090",
+		Fingerprint:  "0000000000000000",
+	}
+	msg := common.CustomMsg{Message: webhook.Message{
+		Data: &template.Data{
+			Receiver:          "sample",
+			Status:            "firing",
+			Alerts:            template.Alerts{alert},
+			GroupLabels:       template.KV{"alertname": "SampleAlert"},
+			CommonLabels:      alert.Labels,
+			CommonAnnotations: alert.Annotations,
+			ExternalURL:       "http://localhost:9093",
+		},
+		Version:  "4",
+		GroupKey: "{}:{alertname=\"SampleAlert\"}",
+	}}
+	return NewData(msg, "sample", []string{"sample"})
+}
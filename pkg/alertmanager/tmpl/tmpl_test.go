@@ -0,0 +1,122 @@
+package tmpl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFuncMap 测试模板函数
+func TestFuncMap(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "title", text: `{{ title "high cpu-usage" }}`, want: "High Cpu-Usage"},
+		{name: "toUpper", text: `{{ toUpper "abc" }}`, want: "ABC"},
+		{name: "toLower", text: `{{ toLower "ABC" }}`, want: "abc"},
+		{name: "join", text: `{{ join "," (stringSlice "a" "b") }}`, want: "a,b"},
+		{name: "match", text: `{{ match "^db" "db-1" }}`, want: "true"},
+		{name: "reReplaceAll", text: `{{ reReplaceAll ":.*" "" "10.0.0.1:9100" }}`, want: "10.0.0.1"},
+		{name: "humanizeTime", text: `{{ humanizeTime (index .Alerts 0).StartsAt }}`, want: "2024-01-02 03:04:05"},
+		{name: "humanizeTime 自定义格式", text: `{{ humanizeTime (index .Alerts 0).StartsAt "15:04" }}`, want: "03:04"},
+		{name: "tz", text: `{{ humanizeTime (tz "Asia/Shanghai" (index .Alerts 0).StartsAt) }}`, want: "2024-01-02 11:04:05"},
+		{name: "humanizeDuration 秒数", text: `{{ humanizeDuration 90061 }}`, want: "1d 1h 1m 1s"},
+		{name: "humanizeDuration 字符串", text: `{{ humanizeDuration "0.25" }}`, want: "250ms"},
+		{name: "humanizeBytes", text: `{{ humanizeBytes "1572864" }}`, want: "1.50 MB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := New()
+			require.NoError(t, templates.ParseText(tt.name, tt.text))
+			data := sampleData()
+			data.Alerts[0].StartsAt = start
+			got, err := templates.Render(tt.name, data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestHumanizeDuration 测试时长格式化
+func TestHumanizeDuration(t *testing.T) {
+	assert.Equal(t, "1m 5s", humanizeDuration(65*time.Second))
+	assert.Equal(t, "-2h", humanizeDuration(-2*time.Hour))
+	assert.Equal(t, "0s", humanizeDuration(0))
+}
+
+// TestLoad 测试从文件加载 text 和 html 模板
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lark.tmpl"),
+		[]byte(`{{ define "lark.message" }}[{{ .Title }}] {{ range .Alerts }}{{ .Labels.alertname }}{{ end }}{{ end }}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "email.html"),
+		[]byte(`<p>{{ .CommonAnnotations.summary }}</p>`), 0o644))
+
+	templates, err := Load(filepath.Join(dir, "*.tmpl"), filepath.Join(dir, "*.html"))
+	require.NoError(t, err)
+	assert.True(t, templates.Has("lark.message"))
+	assert.True(t, templates.Has("email.html"))
+	assert.False(t, templates.Has("dingtalk.message"))
+
+	data := sampleData()
+	data.CommonAnnotations["summary"] = "<b>cpu</b>"
+	got, err := templates.Render("lark.message", data)
+	require.NoError(t, err)
+	assert.Equal(t, "[sample] SampleAlert", got)
+
+	// html 模板会转义内容
+	got, err = templates.Render("email.html", data)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>&lt;b&gt;cpu&lt;/b&gt;</p>", got)
+
+	_, err = Load(filepath.Join(dir, "*.missing"))
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.tmpl"), []byte(`{{ .Title `), 0o644))
+	_, err = Load(filepath.Join(dir, "*.tmpl"))
+	require.Error(t, err)
+}
+
+// TestValidate 测试启动时校验模板
+func TestValidate(t *testing.T) {
+	templates := New()
+	require.NoError(t, templates.ParseText("ok", `{{ .Title }}`))
+	require.NoError(t, templates.ParseText("bad", `{{ humanizeTime .Title }}`))
+
+	require.NoError(t, templates.Validate("ok"))
+	require.Error(t, templates.Validate("bad"))
+	require.Error(t, templates.Validate("missing"))
+}
+
+// TestResolve 测试模板名称的选择
+func TestResolve(t *testing.T) {
+	var empty *Templates
+	assert.Equal(t, "", empty.Resolve("custom", "lark.message"))
+
+	templates := New()
+	assert.Equal(t, "", templates.Resolve("", "lark.message"))
+	assert.Equal(t, "custom", templates.Resolve("custom", "lark.message"))
+	require.NoError(t, templates.ParseText("lark.message", "x"))
+	assert.Equal(t, "lark.message", templates.Resolve("", "lark.message"))
+}
+
+// TestForAlert 测试单条告警的模板数据不影响原数据
+func TestForAlert(t *testing.T) {
+	data := sampleData()
+	data.Alerts = append(data.Alerts, template.Alert{Status: "resolved"})
+
+	single := data.ForAlert(data.Alerts[1])
+	assert.Len(t, single.Alerts, 1)
+	assert.Equal(t, "resolved", single.Alerts[0].Status)
+	assert.Len(t, data.Alerts, 2)
+	assert.Equal(t, data.Title, single.Title)
+}
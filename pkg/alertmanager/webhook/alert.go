@@ -0,0 +1,192 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+	"github.piwriw.go-tools/pkg/httputil"
+)
+
+// DefaultTemplate 通用 Webhook 默认使用的请求体模板名称
+// 未加载模板时发送 Payload 格式的 JSON 请求体
+const DefaultTemplate = "webhook.body"
+
+// Payload 未配置模板时发送的请求体，包含 Alertmanager Webhook 消息的所有字段
+type Payload struct {
+	*template.Data
+	Version         string   `json:"version"`
+	GroupKey        string   `json:"groupKey"`
+	TruncatedAlerts uint64   `json:"truncatedAlerts"`
+	Title           string   `json:"title"`
+	Users           []string `json:"users"`
+	Test            bool     `json:"test,omitempty"`
+}
+
+// WebhookAlert 通用 Webhook 告警策略，将告警以 POST 请求发送到任意 HTTP 接口，2xx 响应视为发送成功
+type WebhookAlert struct {
+	Client     *http.Client
+	BeforeHook common.HookFunc
+	AfterHook  common.HookFunc
+	LimitFunc  common.LimitOption
+	// Templates 请求体模板，未设置或模板不存在时发送 Payload 格式的 JSON
+	Templates *tmpl.Templates
+}
+
+var _ = common.AlertMethod(&WebhookAlert{})
+
+func NewWebhookAlert() *WebhookAlert {
+	return &WebhookAlert{Client: http.NewHTTPClient()}
+}
+
+func NewWebhookAlertWithClient(client *http.Client) *WebhookAlert {
+	return &WebhookAlert{Client: client}
+}
+
+func (w *WebhookAlert) WithLimit(limit common.LimitOption) *WebhookAlert {
+	if limit == nil {
+		return w
+	}
+	w.LimitFunc = limit
+	return w
+}
+
+func (w *WebhookAlert) WithTemplates(templates *tmpl.Templates) *WebhookAlert {
+	w.Templates = templates
+	return w
+}
+
+func (w *WebhookAlert) WithBeforeHook(hook common.HookFunc) *WebhookAlert {
+	if hook == nil {
+		return w
+	}
+	w.BeforeHook = hook
+	return w
+}
+
+func (w *WebhookAlert) WithAfterHook(hook common.HookFunc) *WebhookAlert {
+	if hook == nil {
+		return w
+	}
+	w.AfterHook = hook
+	return w
+}
+
+func (w *WebhookAlert) Before(c common.AlertContext) error {
+	if w.BeforeHook != nil {
+		if err := w.BeforeHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WebhookAlert) After(c common.AlertContext) error {
+	if w.AfterHook != nil {
+		if err := w.AfterHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WebhookAlert) Limit(idx int, alerts template.Alerts) bool {
+	if w.LimitFunc != nil {
+		if !w.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func (w *WebhookAlert) Execute(c common.AlertContext, users []string) error {
+	if err := w.Before(c); err != nil {
+		return common.ErrorBeforeHook
+	}
+	webhookContext, ok := c.(*WebhookAlertContext)
+	if !ok {
+		return errors.New("invalid context type for WebhookAlert")
+	}
+	slog.Debug("WebhookAlert is Execute", slog.Any("sendToUser", users), slog.Any("Context", webhookContext))
+	if webhookContext.Message.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+	if w.Limit(0, webhookContext.Message.Alerts) {
+		return common.NewLimitedError(webhookContext.Message.Alerts)
+	}
+
+	contentType := string(http.JSON)
+	var body []byte
+	if name := w.Templates.Resolve(webhookContext.Template, DefaultTemplate); name != "" {
+		text, err := w.Templates.Render(name, tmpl.NewData(webhookContext.Message, webhookContext.Title, users))
+		if err != nil {
+			slog.Error("WebhookAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
+			return err
+		}
+		body = []byte(text)
+		if webhookContext.ContentType != "" {
+			contentType = webhookContext.ContentType
+		}
+	} else {
+		msg := webhookContext.Message
+		payload := Payload{
+			Data:            msg.Data,
+			Version:         msg.Version,
+			GroupKey:        msg.GroupKey,
+			TruncatedAlerts: msg.TruncatedAlerts,
+			Title:           webhookContext.Title,
+			Users:           users,
+		}
+		body, _ = json.Marshal(payload)
+	}
+	if err := w.send(webhookContext, contentType, body); err != nil {
+		return err
+	}
+	if err := w.After(c); err != nil {
+		return common.ErrorAfterHook
+	}
+	return nil
+}
+
+// send 发送请求，非 2xx 响应返回错误
+func (w *WebhookAlert) send(webhookContext *WebhookAlertContext, contentType string, body []byte) error {
+	_, err := w.Client.NewRequest("POST", webhookContext.URL).
+		SetHeaders(webhookContext.Headers).
+		SetHeader("Content-Type", contentType).
+		SetBody(body).
+		ErrorOnStatus(true).
+		Do()
+	if err != nil {
+		slog.Error("WebhookAlert, Send data to Webhook failed", slog.String("url", webhookContext.URL), slog.Any("err", err))
+		return fmt.Errorf("[alert]:send webhook failed: %w", err)
+	}
+	return nil
+}
+
+func (w *WebhookAlert) ExecuteTest(c common.AlertContext) error {
+	webhookContext, ok := c.(*WebhookAlertContext)
+	if !ok {
+		return errors.New("invalid context type for WebhookAlert")
+	}
+	payload := Payload{
+		Data: &template.Data{
+			Status: "firing",
+			Alerts: template.Alerts{},
+		},
+		Version: "4",
+		Title:   fmt.Sprintf("【%s】Webhook 告警测试：收到本消息说明 Webhook 告警配置成功！", webhookContext.Title),
+		Test:    true,
+	}
+	slog.Debug("WebhookAlert is ExecuteTest", slog.Any("Context", webhookContext))
+	body, _ := json.Marshal(payload)
+	return w.send(webhookContext, string(http.JSON), body)
+}
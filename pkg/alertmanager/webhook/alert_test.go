@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/internal/alerttest"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+)
+
+// testMessage 返回包含分组信息的 Alertmanager 消息
+func testMessage() common.CustomMsg {
+	alert := alerttest.Alert("firing", nil, template.KV{"summary": "CPU usage above 90%"})
+	alert.Fingerprint = "a"
+	msg := alerttest.Message(alert)
+	msg.Receiver = "ops"
+	msg.Version = "4"
+	msg.GroupKey = `{}:{alertname="HighCPU"}`
+	return msg
+}
+
+// TestWebhookAlertExecute 测试未配置模板时发送 Alertmanager 消息
+func TestWebhookAlertExecute(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusNoContent, ""))
+	alert := NewWebhookAlert()
+	c := &WebhookAlertContext{
+		Message: testMessage(),
+		Title:   "生产环境",
+		URL:     ts.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}
+	require.NoError(t, alert.Execute(c, []string{"zhangsan"}))
+
+	require.Len(t, *requests, 1)
+	req := (*requests)[0]
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+	assert.Contains(t, req.Header.Get("Content-Type"), "application/json")
+
+	payload := map[string]any{}
+	require.NoError(t, json.Unmarshal(req.Body, &payload))
+	assert.Equal(t, "生产环境", payload["title"])
+	assert.Equal(t, []any{"zhangsan"}, payload["users"])
+	assert.Equal(t, "4", payload["version"])
+	assert.Equal(t, "ops", payload["receiver"])
+	assert.Equal(t, `{}:{alertname="HighCPU"}`, payload["groupKey"])
+	require.Len(t, payload["alerts"], 1)
+}
+
+// TestWebhookAlertTemplate 测试使用模板渲染请求体
+func TestWebhookAlertTemplate(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, ""))
+	templates := tmpl.New()
+	require.NoError(t, templates.ParseText(DefaultTemplate,
+		`{"text":"{{ .Title }} {{ (index .Alerts 0).Labels.alertname }}","users":"{{ join "," .Users }}"}`))
+	require.NoError(t, templates.ParseText("form", `title={{ .Title }}`))
+
+	alert := NewWebhookAlert().WithTemplates(templates)
+	require.NoError(t, alert.Execute(&WebhookAlertContext{Message: testMessage(), Title: "prod", URL: ts.URL}, []string{"a", "b"}))
+	require.Len(t, *requests, 1)
+	assert.JSONEq(t, `{"text":"prod HighCPU","users":"a,b"}`, string((*requests)[0].Body))
+
+	// 接收者覆盖模板和请求体类型
+	c := &WebhookAlertContext{Message: testMessage(), Title: "prod", URL: ts.URL, Template: "form", ContentType: "application/x-www-form-urlencoded"}
+	require.NoError(t, alert.Execute(c, nil))
+	require.Len(t, *requests, 2)
+	assert.Equal(t, "title=prod", string((*requests)[1].Body))
+	assert.Equal(t, "application/x-www-form-urlencoded", (*requests)[1].Header.Get("Content-Type"))
+}
+
+// TestWebhookAlertFailed 测试发送失败的情况
+func TestWebhookAlertFailed(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusInternalServerError, ""))
+	c := &WebhookAlertContext{Message: testMessage(), URL: ts.URL}
+
+	err := NewWebhookAlert().Execute(c, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "500")
+
+	err = NewWebhookAlert().WithLimit(alerttest.DenyLimit{}).Execute(c, nil)
+	require.ErrorIs(t, err, common.ErrorLimited)
+	assert.Len(t, common.LimitedAlerts(err), len(c.Message.Alerts), "上报被限流的告警")
+
+	err = NewWebhookAlert().WithBeforeHook(func(c common.AlertContext) error { return errors.New("stop") }).Execute(c, nil)
+	require.ErrorIs(t, err, common.ErrorBeforeHook)
+	assert.Len(t, *requests, 1, "限流和 Before Hook 失败时不发送")
+
+	require.Error(t, NewWebhookAlert().Execute(&wrongContext{}, nil))
+}
+
+// TestWebhookAlertExecuteTest 测试发送测试消息
+func TestWebhookAlertExecuteTest(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, ""))
+	var after bool
+	alert := NewWebhookAlertWithClient(NewWebhookAlert().Client).WithAfterHook(func(c common.AlertContext) error {
+		after = true
+		return nil
+	})
+	require.NoError(t, alert.ExecuteTest(&WebhookAlertContext{Title: "prod", URL: ts.URL}))
+	assert.False(t, after, "ExecuteTest 不执行 Hook")
+
+	require.Len(t, *requests, 1)
+	payload := Payload{}
+	require.NoError(t, json.Unmarshal((*requests)[0].Body, &payload))
+	assert.True(t, payload.Test)
+	assert.Contains(t, payload.Title, "prod")
+}
+
+type wrongContext struct{}
+
+func (wrongContext) GetMethod() string { return "wrong" }
@@ -0,0 +1,28 @@
+package webhook
+
+import (
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// WebhookAlertContext 通用 Webhook 告警上下文
+type WebhookAlertContext struct {
+	Message common.CustomMsg
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	// Headers 额外的请求头，例如 Authorization
+	Headers map[string]string `json:"headers,omitempty"`
+	// ContentType 模板渲染的请求体类型，默认 application/json
+	ContentType string `json:"content_type,omitempty"`
+	// Template 覆盖告警方式默认的请求体模板
+	Template string `json:"template,omitempty"`
+}
+
+var _ = common.TemplateContext(&WebhookAlertContext{})
+
+func (w *WebhookAlertContext) GetMethod() string {
+	return common.MethodWebhook
+}
+
+func (w *WebhookAlertContext) TemplateNames() []string {
+	return common.NonEmpty(w.Template)
+}
@@ -9,15 +9,34 @@ import (
 
 	"github.com/prometheus/alertmanager/template"
 	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
 	"github.piwriw.go-tools/pkg/httputil"
 )
 
+// jsonHeaders 通过请求头设置 Content-Type，避免并发发送时调用 Client.JSON() 修改共享的客户端
+var jsonHeaders = map[string]string{"Content-Type": string(http.JSON)}
+
+// DefaultTemplate 企业微信消息默认使用的模板名称，模板渲染的结果作为文本消息发送
+const DefaultTemplate = "wechat.message"
+
 // WechatAlert 微信告警策略
 type WechatAlert struct {
 	Client     *http.Client
 	BeforeHook common.HookFunc
 	AfterHook  common.HookFunc
 	LimitFunc  common.LimitOption
+	// Templates 消息模板，未设置或模板不存在时使用内置的消息格式
+	Templates *tmpl.Templates
+}
+
+var _ = common.AlertMethod(&WechatAlert{})
+
+func NewWechatAlert() *WechatAlert {
+	return &WechatAlert{Client: http.NewHTTPClient()}
+}
+
+func NewWechatAlertWithClient(client *http.Client) *WechatAlert {
+	return &WechatAlert{Client: client}
 }
 
 type wechatRes struct {
@@ -33,6 +52,11 @@ func (w *WechatAlert) WithLimit(limit common.LimitOption) *WechatAlert {
 	return w
 }
 
+func (w *WechatAlert) WithTemplates(templates *tmpl.Templates) *WechatAlert {
+	w.Templates = templates
+	return w
+}
+
 func (w *WechatAlert) WithBeforeHook(hook common.HookFunc) *WechatAlert {
 	if hook == nil {
 		return w
@@ -69,16 +93,16 @@ func (w *WechatAlert) After(c common.AlertContext) error {
 
 func (w *WechatAlert) Limit(idx int, alerts template.Alerts) bool {
 	if w.LimitFunc != nil {
-		slog.Warn("Current Alert is Limited",
-			slog.Int("remaining_alert_count", len(alerts[idx:])),
-			slog.Any("remaining_alerts", alerts[idx:]),
-		)
-		if w.LimitFunc.Allow() {
+		if !w.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
 			return true
 		}
 		return false
 	}
-	return true
+	return false
 }
 
 func (w *WechatAlert) Execute(c common.AlertContext, users []string) error {
@@ -86,46 +110,90 @@ func (w *WechatAlert) Execute(c common.AlertContext, users []string) error {
 	if !ok {
 		return errors.New("invalid context type for WechatAlert")
 	}
+	if name := w.Templates.Resolve(wechatContext.Template, DefaultTemplate); name != "" {
+		if w.Limit(0, wechatContext.Message.Alerts) {
+			return common.NewLimitedError(wechatContext.Message.Alerts)
+		}
+		text, err := w.Templates.Render(name, tmpl.NewData(wechatContext.Message, wechatContext.Title, users))
+		if err != nil {
+			slog.Error("WechatAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
+			return err
+		}
+		return w.send(wechatContext, text, users)
+	}
+	if wechatContext.MsgType == common.MsgTypeMarkdown {
+		// Markdown 消息将所有告警合并为一条消息发送
+		if wechatContext.Message.Data == nil {
+			return errors.New("[alert]:message has no data")
+		}
+		if w.Limit(0, wechatContext.Message.Alerts) {
+			return common.NewLimitedError(wechatContext.Message.Alerts)
+		}
+		return w.send(wechatContext, common.AlertMarkdown(wechatContext.Title, wechatContext.Message.Data), users)
+	}
 	for idx, wa := range wechatContext.Message.Alerts {
 		if w.Limit(idx, wechatContext.Message.Alerts) {
-			return errors.New("alert is limited")
+			return common.NewLimitedError(wechatContext.Message.Alerts[idx:])
 		}
 		severity := wa.Labels["severity"]
 		severities := strings.Split(severity, ":")
 		status := severities[0]
-		typ := strings.Split(wa.Labels["category"], ".")[1]
+		typ := common.AlertCategory(wa)
 		if wa.Status == "resolved" {
 			status = "恢复"
 		}
 
 		message := fmt.Sprintf(common.AlertFormat,
 			wechatContext.Title, typ, wa.Labels["name"], wa.Labels["ip"], wa.Labels["alertname"], status, wa.Annotations["description"], wa.StartsAt.Format("2006-01-02 15:04:05"))
-		data := map[string]any{
-			"msgtype": "text",
-			"text": map[string]any{
-				"content":               message,
-				"mentioned_mobile_list": users,
-			},
-		}
-
-		req, _ := json.Marshal(data)
-		body, err := w.Client.JSON().Post(wechatContext.WechatWebhook, req)
-		if err != nil {
-			slog.Error("Wechat, Send data to Wechat failed, ", slog.Any("err", err))
+		if err := w.send(wechatContext, message, users); err != nil {
 			return err
 		}
-		wechatRes := &wechatRes{}
-		if err = json.Unmarshal(body, &wechatRes); err != nil {
-			slog.Error("WechatAlert, Unmarshal response is failed", slog.Any("err", err))
-			return err
+	}
+	return nil
+}
+
+// send 按上下文配置的消息类型发送消息，并提醒指定的用户
+func (w *WechatAlert) send(wechatContext *WechatAlertContext, content string, users []string) error {
+	var data map[string]any
+	switch wechatContext.MsgType {
+	case "", common.MsgTypeText:
+		text := map[string]any{"content": content}
+		if wechatContext.MentionBy == common.MentionByUserID {
+			text["mentioned_list"] = users
+		} else {
+			text["mentioned_mobile_list"] = users
 		}
-		if wechatRes.Errcode != 0 {
-			slog.Error("WechatAlert, Send data to WechatAlert failed, ", slog.Any("err", wechatRes))
-			return errors.New(wechatRes.Errmsg)
+		data = map[string]any{"msgtype": "text", "text": text}
+	case common.MsgTypeMarkdown:
+		// Markdown 消息只支持通过 <@userid> 提醒用户
+		if wechatContext.MentionBy == common.MentionByUserID {
+			for _, user := range users {
+				content += fmt.Sprintf("<@%s>", user)
+			}
 		}
+		data = map[string]any{"msgtype": "markdown", "markdown": map[string]any{"content": content}}
+	default:
+		return fmt.Errorf("[alert]:wechat msg_type %s is not supported", wechatContext.MsgType)
+	}
+
+	req, _ := json.Marshal(data)
+	body, err := w.Client.PostWithHeaders(wechatContext.WechatWebhook, jsonHeaders, req)
+	if err != nil {
+		slog.Error("Wechat, Send data to Wechat failed, ", slog.Any("err", err))
+		return err
+	}
+	wechatRes := &wechatRes{}
+	if err = json.Unmarshal(body, &wechatRes); err != nil {
+		slog.Error("WechatAlert, Unmarshal response is failed", slog.Any("err", err))
+		return err
+	}
+	if wechatRes.Errcode != 0 {
+		slog.Error("WechatAlert, Send data to WechatAlert failed, ", slog.Any("err", wechatRes))
+		return errors.New(wechatRes.Errmsg)
 	}
 	return nil
 }
+
 func (w *WechatAlert) ExecuteTest(c common.AlertContext) error {
 	wechatContext, ok := c.(*WechatAlertContext)
 	if !ok {
@@ -0,0 +1,235 @@
+package wechat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/tmpl"
+	"github.piwriw.go-tools/pkg/httputil"
+)
+
+// DefaultAppTemplate 企业微信应用消息默认使用的模板名称，模板渲染的结果按 msg_type 作为文本或 Markdown 发送
+const DefaultAppTemplate = "wechat_app.message"
+
+const defaultAPIURL = "https://qyapi.weixin.qq.com"
+
+// WechatAppAlert 企业微信应用消息告警策略，通过企业 ID 和应用 Secret 获取 access_token 后发送应用消息
+type WechatAppAlert struct {
+	Client     *http.Client
+	BeforeHook common.HookFunc
+	AfterHook  common.HookFunc
+	LimitFunc  common.LimitOption
+	// Templates 消息模板，未设置或模板不存在时使用内置的消息格式
+	Templates *tmpl.Templates
+
+	tokens tokenCache
+}
+
+var _ = common.AlertMethod(&WechatAppAlert{})
+
+func NewWechatAppAlert() *WechatAppAlert {
+	return &WechatAppAlert{Client: http.NewHTTPClient()}
+}
+
+func NewWechatAppAlertWithClient(client *http.Client) *WechatAppAlert {
+	return &WechatAppAlert{Client: client}
+}
+
+func (w *WechatAppAlert) WithLimit(limit common.LimitOption) *WechatAppAlert {
+	if limit == nil {
+		return w
+	}
+	w.LimitFunc = limit
+	return w
+}
+
+func (w *WechatAppAlert) WithTemplates(templates *tmpl.Templates) *WechatAppAlert {
+	w.Templates = templates
+	return w
+}
+
+func (w *WechatAppAlert) WithBeforeHook(hook common.HookFunc) *WechatAppAlert {
+	if hook == nil {
+		return w
+	}
+	w.BeforeHook = hook
+	return w
+}
+
+func (w *WechatAppAlert) WithAfterHook(hook common.HookFunc) *WechatAppAlert {
+	if hook == nil {
+		return w
+	}
+	w.AfterHook = hook
+	return w
+}
+
+func (w *WechatAppAlert) Before(c common.AlertContext) error {
+	if w.BeforeHook != nil {
+		if err := w.BeforeHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WechatAppAlert) After(c common.AlertContext) error {
+	if w.AfterHook != nil {
+		if err := w.AfterHook(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WechatAppAlert) Limit(idx int, alerts template.Alerts) bool {
+	if w.LimitFunc != nil {
+		if !w.LimitFunc.Allow() {
+			slog.Warn("Current Alert is Limited",
+				slog.Int("remaining_alert_count", len(alerts[idx:])),
+				slog.Any("remaining_alerts", alerts[idx:]),
+			)
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func (w *WechatAppAlert) Execute(c common.AlertContext, users []string) error {
+	if err := w.Before(c); err != nil {
+		return common.ErrorBeforeHook
+	}
+	appContext, ok := c.(*WechatAppAlertContext)
+	if !ok {
+		return errors.New("invalid context type for WechatAppAlert")
+	}
+	slog.Debug("WechatAppAlert is Execute", slog.Any("sendToUser", users), slog.Int64("agentID", appContext.AgentID))
+	if appContext.Message.Data == nil {
+		return errors.New("[alert]:message has no data")
+	}
+	if w.Limit(0, appContext.Message.Alerts) {
+		return common.NewLimitedError(appContext.Message.Alerts)
+	}
+
+	content := common.AlertMarkdown(appContext.Title, appContext.Message.Data)
+	if name := w.Templates.Resolve(appContext.Template, DefaultAppTemplate); name != "" {
+		text, err := w.Templates.Render(name, tmpl.NewData(appContext.Message, appContext.Title, users))
+		if err != nil {
+			slog.Error("WechatAppAlert, Render template failed", slog.String("template", name), slog.Any("err", err))
+			return err
+		}
+		content = text
+	}
+	data, err := appMessage(appContext, content, users)
+	if err != nil {
+		return err
+	}
+	if err = w.send(appContext, data); err != nil {
+		return err
+	}
+	if err := w.After(c); err != nil {
+		return common.ErrorAfterHook
+	}
+	return nil
+}
+
+// appMessage 按消息类型生成应用消息，users、ToParty 和 ToTag 都为空时返回配置错误，
+// 避免误发送给应用可见范围内的所有成员（@all）
+// card 类型的链接指向 Alertmanager，消息中没有 ExternalURL 时按 markdown 类型发送
+func appMessage(c *WechatAppAlertContext, content string, users []string) (map[string]any, error) {
+	if len(users) == 0 && c.ToParty == "" && c.ToTag == "" {
+		return nil, errors.New("[alert]:wechat_app requires users, to_party or to_tag")
+	}
+	data := map[string]any{
+		"agentid": c.AgentID,
+		"touser":  strings.Join(users, "|"),
+		"toparty": c.ToParty,
+		"totag":   c.ToTag,
+	}
+
+	msgType := c.MsgType
+	if msgType == common.MsgTypeCard && (c.Message.Data == nil || c.Message.ExternalURL == "") {
+		msgType = common.MsgTypeMarkdown
+	}
+	switch msgType {
+	case "", common.MsgTypeText:
+		data["msgtype"] = "text"
+		data["text"] = map[string]any{"content": content}
+	case common.MsgTypeMarkdown:
+		data["msgtype"] = "markdown"
+		data["markdown"] = map[string]any{"content": content}
+	case common.MsgTypeCard:
+		data["msgtype"] = "textcard"
+		data["textcard"] = map[string]any{
+			"title":       fmt.Sprintf("[%s] %s %d 条告警", c.Title, common.StatusText(c.Message.Status), len(c.Message.Alerts)),
+			"description": content,
+			"url":         c.Message.ExternalURL,
+			"btntxt":      "详情",
+		}
+	default:
+		return nil, fmt.Errorf("[alert]:wechat_app msg_type %s is not supported", c.MsgType)
+	}
+	return data, nil
+}
+
+// send 发送应用消息，access_token 失效时刷新后重试一次
+func (w *WechatAppAlert) send(appContext *WechatAppAlertContext, data map[string]any) error {
+	if appContext.CorpID == "" || appContext.CorpSecret == "" {
+		return errors.New("[alert]:wechat_app corp_id and corp_secret are required")
+	}
+	apiURL := strings.TrimSuffix(appContext.APIURL, "/")
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
+	req, _ := json.Marshal(data)
+	for attempt := 0; ; attempt++ {
+		token, err := w.tokens.get(w.Client, apiURL, appContext.CorpID, appContext.CorpSecret)
+		if err != nil {
+			slog.Error("WechatAppAlert, Get access token failed", slog.String("corpID", appContext.CorpID), slog.Any("err", err))
+			return err
+		}
+		body, err := w.Client.PostWithHeaders(apiURL+"/cgi-bin/message/send?access_token="+url.QueryEscape(token), jsonHeaders, req)
+		if err != nil {
+			err = redact(err, token)
+			slog.Error("WechatAppAlert, Send data to Wechat failed, ", slog.Any("err", err))
+			return err
+		}
+		wechatRes := &wechatRes{}
+		if err = json.Unmarshal(body, &wechatRes); err != nil {
+			slog.Error("WechatAppAlert, Unmarshal response is failed", slog.Any("err", err))
+			return err
+		}
+		if tokenInvalid(wechatRes.Errcode) && attempt == 0 {
+			slog.Warn("WechatAppAlert, access token is invalid, refresh", slog.Int("errcode", wechatRes.Errcode))
+			w.tokens.invalidate(apiURL, appContext.CorpID, appContext.CorpSecret, token)
+			continue
+		}
+		if wechatRes.Errcode != 0 {
+			slog.Error("WechatAppAlert, Send data to Wechat failed, ", slog.Any("err", wechatRes))
+			return errors.New(wechatRes.Errmsg)
+		}
+		return nil
+	}
+}
+
+func (w *WechatAppAlert) ExecuteTest(c common.AlertContext) error {
+	appContext, ok := c.(*WechatAppAlertContext)
+	if !ok {
+		return errors.New("invalid context type for WechatAppAlert")
+	}
+	slog.Debug("WechatAppAlert is ExecuteTest", slog.Int64("agentID", appContext.AgentID))
+	test := *appContext
+	test.MsgType = common.MsgTypeText
+	data, err := appMessage(&test, fmt.Sprintf("【%s】企业微信应用告警测试：收到本消息说明企业微信应用告警配置成功！", appContext.Title), nil)
+	if err != nil {
+		return err
+	}
+	return w.send(appContext, data)
+}
@@ -0,0 +1,34 @@
+package wechat
+
+import (
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+)
+
+// WechatAppAlertContext 企业微信应用消息告警上下文，users 为企业微信用户 ID
+type WechatAppAlertContext struct {
+	Message    common.CustomMsg
+	Title      string `json:"title"`
+	CorpID     string `json:"corp_id"`
+	CorpSecret string `json:"corp_secret"`
+	AgentID    int64  `json:"agent_id"`
+	// ToParty 接收消息的部门 ID，多个用 | 分隔
+	ToParty string `json:"to_party,omitempty"`
+	// ToTag 接收消息的标签 ID，多个用 | 分隔
+	ToTag string `json:"to_tag,omitempty"`
+	// MsgType 消息类型：text（默认）、markdown、card（文本卡片，链接到 Alertmanager）
+	MsgType string `json:"msg_type,omitempty"`
+	// APIURL 企业微信 API 地址，默认 https://qyapi.weixin.qq.com
+	APIURL string `json:"api_url,omitempty"`
+	// Template 覆盖告警方式默认的消息模板
+	Template string `json:"template,omitempty"`
+}
+
+var _ = common.TemplateContext(&WechatAppAlertContext{})
+
+func (w *WechatAppAlertContext) GetMethod() string {
+	return common.MethodWechatApp
+}
+
+func (w *WechatAppAlertContext) TemplateNames() []string {
+	return common.NonEmpty(w.Template)
+}
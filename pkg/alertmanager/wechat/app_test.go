@@ -0,0 +1,271 @@
+package wechat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/alertmanager/common"
+	"github.piwriw.go-tools/pkg/alertmanager/internal/alerttest"
+)
+
+// appServer 模拟企业微信 API，记录获取 access_token 的次数和收到的应用消息
+type appServer struct {
+	mu       sync.Mutex
+	fetches  int
+	messages []map[string]any
+	// expired 发送消息时返回 access_token 过期的 token
+	expired map[string]bool
+	// status 接口返回的 HTTP 状态码
+	status int
+	// expiresIn 返回的 access_token 有效期，单位为秒
+	expiresIn int
+	// release 不为空时获取 access_token 的请求等待 release 关闭后返回，fetching 用于通知请求已经开始
+	release  chan struct{}
+	fetching chan struct{}
+}
+
+func newAppServer(t *testing.T) (*httptest.Server, *appServer) {
+	t.Helper()
+	s := &appServer{expired: map[string]bool{}, status: http.StatusOK, expiresIn: 7200}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/gettoken", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("corpsecret") != "corp-secret" {
+			io.WriteString(w, `{"errcode":40001,"errmsg":"invalid credential"}`)
+			return
+		}
+		if s.release != nil {
+			s.fetching <- struct{}{}
+			<-s.release
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+		fmt.Fprintf(w, `{"errcode":0,"errmsg":"ok","access_token":"token-%d","expires_in":%d}`, s.fetches, s.expiresIn)
+	})
+	mux.HandleFunc("/cgi-bin/message/send", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		if s.expired[r.URL.Query().Get("access_token")] {
+			io.WriteString(w, `{"errcode":42001,"errmsg":"access_token expired"}`)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		msg := map[string]any{}
+		require.NoError(t, json.Unmarshal(data, &msg))
+		msg["access_token"] = r.URL.Query().Get("access_token")
+		s.messages = append(s.messages, msg)
+		io.WriteString(w, `{"errcode":0,"errmsg":"ok"}`)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts, s
+}
+
+func testAppContext(apiURL string) *WechatAppAlertContext {
+	return &WechatAppAlertContext{Message: alerttest.HighCPUMessage("firing"), Title: "prod", CorpID: "corp", CorpSecret: "corp-secret", AgentID: 1000002, APIURL: apiURL}
+}
+
+// TestWechatAppAlertToken 测试 access_token 的缓存、过期和失效刷新
+func TestWechatAppAlertToken(t *testing.T) {
+	ts, s := newAppServer(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := NewWechatAppAlert()
+	w.tokens.now = func() time.Time { return now }
+	c := testAppContext(ts.URL)
+
+	require.NoError(t, w.Execute(c, []string{"zhangsan"}))
+	require.NoError(t, w.Execute(c, []string{"zhangsan"}))
+	assert.Equal(t, 1, s.fetches)
+
+	// 过期前 5 分钟刷新
+	now = now.Add(2*time.Hour - 4*time.Minute)
+	require.NoError(t, w.Execute(c, []string{"zhangsan"}))
+	assert.Equal(t, 2, s.fetches)
+
+	// token 被提前吊销时刷新后重试
+	s.expired["token-2"] = true
+	require.NoError(t, w.Execute(c, []string{"zhangsan"}))
+	assert.Equal(t, 3, s.fetches)
+
+	require.Len(t, s.messages, 4)
+	assert.Equal(t, []any{"token-1", "token-1", "token-2", "token-3"}, []any{
+		s.messages[0]["access_token"], s.messages[1]["access_token"], s.messages[2]["access_token"], s.messages[3]["access_token"],
+	})
+}
+
+// TestTokenCacheConcurrent 测试获取 access_token 期间不持有锁，不阻塞其他应用的请求
+func TestTokenCacheConcurrent(t *testing.T) {
+	ts, s := newAppServer(t)
+	s.release, s.fetching = make(chan struct{}), make(chan struct{}, 10)
+	client := NewWechatAppAlert().Client
+	cache := &tokenCache{}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 5)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := cache.get(client, ts.URL, "corp", "corp-secret")
+			assert.NoError(t, err)
+			tokens[i] = token
+		}(i)
+	}
+	<-s.fetching
+
+	// 获取期间其他应用的请求不需要等待
+	_, err := cache.get(client, ts.URL, "corp", "other-secret")
+	assert.ErrorContains(t, err, "40001")
+
+	close(s.release)
+	wg.Wait()
+	assert.LessOrEqual(t, s.fetches, len(tokens))
+	for _, token := range tokens {
+		assert.NotEmpty(t, token)
+	}
+	token, err := cache.get(client, ts.URL, "corp", "corp-secret")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("token-%d", s.fetches), token, "获取后使用缓存")
+}
+
+// TestTokenCacheShortExpires 测试有效期较短时最多提前一半有效期刷新
+func TestTokenCacheShortExpires(t *testing.T) {
+	ts, s := newAppServer(t)
+	s.expiresIn = 120
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := NewWechatAppAlert().Client
+	cache := &tokenCache{now: func() time.Time { return now }}
+
+	for i := 0; i < 2; i++ {
+		token, err := cache.get(client, ts.URL, "corp", "corp-secret")
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+	}
+
+	now = now.Add(time.Minute)
+	token, err := cache.get(client, ts.URL, "corp", "corp-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+}
+
+// TestWechatAppAlertMessage 测试接收者和消息类型
+func TestWechatAppAlertMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    func(c *WechatAppAlertContext)
+		users  []string
+		verify func(t *testing.T, msg map[string]any)
+	}{
+		{
+			name:  "文本消息发送给多个用户",
+			ctx:   func(c *WechatAppAlertContext) {},
+			users: []string{"zhangsan", "lisi"},
+			verify: func(t *testing.T, msg map[string]any) {
+				assert.Equal(t, "zhangsan|lisi", msg["touser"])
+				assert.Equal(t, float64(1000002), msg["agentid"])
+				assert.Equal(t, "text", msg["msgtype"])
+				assert.Contains(t, msg["text"].(map[string]any)["content"], "**HighCPU**")
+			},
+		},
+		{
+			name: "发送给标签的Markdown消息",
+			ctx: func(c *WechatAppAlertContext) {
+				c.MsgType = common.MsgTypeMarkdown
+				c.ToTag = "1"
+			},
+			verify: func(t *testing.T, msg map[string]any) {
+				assert.Equal(t, "", msg["touser"])
+				assert.Equal(t, "1", msg["totag"])
+				assert.Equal(t, "markdown", msg["msgtype"])
+			},
+		},
+		{
+			name: "发送给部门的文本卡片",
+			ctx: func(c *WechatAppAlertContext) {
+				c.MsgType = common.MsgTypeCard
+				c.ToParty = "2|3"
+			},
+			verify: func(t *testing.T, msg map[string]any) {
+				assert.Equal(t, "", msg["touser"])
+				assert.Equal(t, "2|3", msg["toparty"])
+				assert.Equal(t, "textcard", msg["msgtype"])
+				card := msg["textcard"].(map[string]any)
+				assert.Equal(t, "[prod] 活跃 1 条告警", card["title"])
+				assert.Equal(t, "http://alertmanager:9093", card["url"])
+			},
+		},
+		{
+			name: "没有ExternalURL时卡片按Markdown发送",
+			ctx: func(c *WechatAppAlertContext) {
+				c.MsgType = common.MsgTypeCard
+				c.Message.ExternalURL = ""
+			},
+			users: []string{"zhangsan"},
+			verify: func(t *testing.T, msg map[string]any) {
+				assert.Equal(t, "markdown", msg["msgtype"])
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, s := newAppServer(t)
+			c := testAppContext(ts.URL)
+			tt.ctx(c)
+			require.NoError(t, NewWechatAppAlert().Execute(c, tt.users))
+			require.Len(t, s.messages, 1)
+			tt.verify(t, s.messages[0])
+		})
+	}
+}
+
+// TestWechatAppAlertError 测试错误信息不泄露密钥和 access_token
+func TestWechatAppAlertError(t *testing.T) {
+	ts, s := newAppServer(t)
+	c := testAppContext(ts.URL)
+
+	// 没有接收者时不发送给所有人
+	assert.ErrorContains(t, NewWechatAppAlert().Execute(c, nil), "requires users, to_party or to_tag")
+	assert.ErrorContains(t, NewWechatAppAlert().ExecuteTest(c), "requires users, to_party or to_tag")
+	assert.Empty(t, s.messages)
+
+	c.ToParty = "2"
+	c.CorpSecret = ""
+	assert.ErrorContains(t, NewWechatAppAlert().Execute(c, nil), "corp_secret are required")
+
+	c.CorpSecret = "wrong-secret"
+	err := NewWechatAppAlert().ExecuteTest(c)
+	assert.ErrorContains(t, err, "40001")
+	assert.NotContains(t, err.Error(), "wrong-secret")
+
+	c.CorpSecret = "corp-secret"
+	s.status = http.StatusBadGateway
+	err = NewWechatAppAlert().ExecuteTest(c)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "token-1")
+}
+
+// TestWechatAlertMarkdown 测试群机器人 Markdown 消息通过 <@userid> 提醒用户
+func TestWechatAlertMarkdown(t *testing.T) {
+	ts, requests := alerttest.NewServer(t, alerttest.Reply(http.StatusOK, `{"errcode":0,"errmsg":"ok"}`))
+
+	c := &WechatAlertContext{Message: alerttest.HighCPUMessage("firing"), Title: "prod", WechatWebhook: ts.URL, MsgType: common.MsgTypeMarkdown, MentionBy: common.MentionByUserID}
+	require.NoError(t, NewWechatAlert().Execute(c, []string{"zhangsan"}))
+	require.Len(t, *requests, 1)
+	body := alerttest.JSON[map[string]any](t, (*requests)[0])
+	assert.Equal(t, "markdown", body["msgtype"])
+	content := body["markdown"].(map[string]any)["content"].(string)
+	assert.Contains(t, content, "### [prod] 活跃 1 条告警")
+	assert.Contains(t, content, "<@zhangsan>")
+}
@@ -10,8 +10,20 @@ type WechatAlertContext struct {
 	Title   string `json:"title"`
 	// todo 删除wechat,只保留Webhook 这是个历史一致问题
 	WechatWebhook string `json:"wechat_webhook"`
+	// MsgType 消息类型：text（默认）、markdown
+	MsgType string `json:"msg_type,omitempty"`
+	// MentionBy users 的类型：mobile（默认，手机号）、user_id（企业微信用户 ID），markdown 消息只支持 user_id
+	MentionBy string `json:"mention_by,omitempty"`
+	// Template 覆盖告警方式默认的消息模板
+	Template string `json:"template,omitempty"`
 }
 
+var _ = common.TemplateContext(&WechatAlertContext{})
+
 func (w *WechatAlertContext) GetMethod() string {
 	return common.MethodWechat
 }
+
+func (w *WechatAlertContext) TemplateNames() []string {
+	return common.NonEmpty(w.Template)
+}
@@ -0,0 +1,124 @@
+package wechat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.piwriw.go-tools/pkg/httputil"
+	"golang.org/x/sync/singleflight"
+)
+
+// tokenRefreshAhead access_token 过期前提前刷新的时间，有效期较短时最多提前一半有效期
+const tokenRefreshAhead = 5 * time.Minute
+
+// accessToken 缓存的 access_token
+type accessToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// tokenCache 按企业 ID 和应用 Secret 缓存 access_token，零值可以直接使用
+// 企业微信限制获取 access_token 的频率，缓存在过期前 5 分钟刷新，收到 token 失效的错误码时主动刷新
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]accessToken
+	// group 合并同一应用并发的获取请求
+	group singleflight.Group
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+func (t *tokenCache) currentTime() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+type tokenRes struct {
+	Errcode     int    `json:"errcode"`
+	Errmsg      string `json:"errmsg"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// get 返回有效的 access_token，缓存不存在或即将过期时重新获取
+// 获取期间不持有锁，同一应用并发的获取请求合并为一次
+func (t *tokenCache) get(client *http.Client, apiURL, corpID, secret string) (string, error) {
+	key := apiURL + "\x00" + corpID + "\x00" + secret
+	t.mu.Lock()
+	token, ok := t.tokens[key]
+	t.mu.Unlock()
+	if ok && t.currentTime().Before(token.expiresAt) {
+		return token.value, nil
+	}
+
+	value, err, _ := t.group.Do(key, func() (any, error) {
+		return t.fetch(client, key, apiURL, corpID, secret)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// fetch 调用 gettoken 接口获取 access_token 并写入缓存
+func (t *tokenCache) fetch(client *http.Client, key, apiURL, corpID, secret string) (string, error) {
+	start := t.currentTime()
+	query := url.Values{"corpid": {corpID}, "corpsecret": {secret}}
+	body, err := client.Get(apiURL + "/cgi-bin/gettoken?" + query.Encode())
+	if err != nil {
+		return "", fmt.Errorf("[alert]:get wechat access token failed: %w", redact(err, secret))
+	}
+	res := &tokenRes{}
+	if err = json.Unmarshal(body, res); err != nil {
+		return "", fmt.Errorf("[alert]:unmarshal wechat access token failed: %w", err)
+	}
+	if res.Errcode != 0 || res.AccessToken == "" {
+		return "", fmt.Errorf("[alert]:get wechat access token failed: %d %s", res.Errcode, res.Errmsg)
+	}
+
+	ttl := time.Duration(res.ExpiresIn) * time.Second
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tokens == nil {
+		t.tokens = make(map[string]accessToken)
+	}
+	t.tokens[key] = accessToken{
+		value:     res.AccessToken,
+		expiresAt: start.Add(ttl - min(tokenRefreshAhead, ttl/2)),
+	}
+	return res.AccessToken, nil
+}
+
+// invalidate 删除失效的 access_token，token 已被其他请求刷新时不删除
+func (t *tokenCache) invalidate(apiURL, corpID, secret, value string) {
+	key := apiURL + "\x00" + corpID + "\x00" + secret
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if token, ok := t.tokens[key]; ok && token.value == value {
+		delete(t.tokens, key)
+	}
+}
+
+// redact 隐藏错误信息中 URL 携带的密钥和 access_token
+func redact(err error, secret string) error {
+	if secret == "" {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), url.QueryEscape(secret), "<redacted>"))
+}
+
+// tokenInvalid 判断错误码是否表示 access_token 无效或过期
+func tokenInvalid(errcode int) bool {
+	switch errcode {
+	case 40001, 40014, 42001:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,332 @@
+package batch
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrKeyedManagerStopped KeyedManager 已经停止，不再接收新元素
+var ErrKeyedManagerStopped = errors.New("batch: keyed manager is stopped")
+
+// KeyedOption 配置 KeyedManager 的函数类型
+type KeyedOption[K comparable, T any] func(*KeyedManager[K, T])
+
+// WithKeyedBatchSize 设置单个 key 每批次最多发送的元素数量，达到该数量时立即发送
+func WithKeyedBatchSize[K comparable, T any](size int) KeyedOption[K, T] {
+	return func(m *KeyedManager[K, T]) {
+		if size > 0 {
+			m.batchSize = size
+		}
+	}
+}
+
+// WithKeyedMaxAge 设置元素最长等待时间，分组中最早的元素等待超过该时间后整组发送
+func WithKeyedMaxAge[K comparable, T any](age time.Duration) KeyedOption[K, T] {
+	return func(m *KeyedManager[K, T]) {
+		if age > 0 {
+			m.maxAge = age
+		}
+	}
+}
+
+// WithCoalesce 开启同 key 内的去重合并
+// idFunc 返回元素的去重标识，同一分组内标识相同且尚未发送的元素会被合并，
+// 合并后的元素保留在原元素的位置上，保证分组内的顺序不变。
+// merge 为 nil 时新元素直接替换旧元素。
+func WithCoalesce[K comparable, T any](idFunc func(T) string, merge func(old, new T) T) KeyedOption[K, T] {
+	return func(m *KeyedManager[K, T]) {
+		m.idFunc = idFunc
+		m.mergeFunc = merge
+	}
+}
+
+const (
+	defaultKeyedBatchSize = 64
+	defaultKeyedMaxAge    = time.Second
+)
+
+// group 单个 key 下等待发送的元素
+type group[T any] struct {
+	items   []T
+	index   map[string]int // 去重标识 -> items 下标
+	firstAt time.Time
+	timer   *time.Timer
+}
+
+// KeyedManager 按 key 分组的批处理管理器
+// 每个 key 拥有独立的队列，达到批次大小或等待超时后单独发送，
+// 同一个 key 的批次按加入顺序依次交给 batchFunc 处理。
+type KeyedManager[K comparable, T any] struct {
+	mtx       sync.Mutex
+	groups    map[K]*group[T]
+	ready     []K
+	readySet  map[K]struct{}
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	moreCh    chan struct{}
+	stopOnce  sync.Once
+	keyFunc   func(T) K
+	batchFunc func(K, []T)
+	idFunc    func(T) string
+	mergeFunc func(old, new T) T
+	batchSize int
+	maxAge    time.Duration
+	// stopped 调用 Stop 后为 true，Add 不再接收新元素
+	stopped bool
+}
+
+// NewKeyedManager 创建按 key 分组的批处理管理器
+// keyFunc 用于计算元素所属的分组，batchFunc 用于处理单个分组的一个批次
+func NewKeyedManager[K comparable, T any](keyFunc func(T) K, batchFunc func(K, []T), opts ...KeyedOption[K, T]) *KeyedManager[K, T] {
+	m := &KeyedManager[K, T]{
+		groups:    make(map[K]*group[T]),
+		readySet:  make(map[K]struct{}),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+		moreCh:    make(chan struct{}, 1),
+		keyFunc:   keyFunc,
+		batchFunc: batchFunc,
+		batchSize: defaultKeyedBatchSize,
+		maxAge:    defaultKeyedMaxAge,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Start 启动发送循环
+func (m *KeyedManager[K, T]) Start() {
+	go m.sendLoop()
+}
+
+// Stop 停止发送循环，并将所有未发送的元素按分组发送完毕，之后 Add 返回 ErrKeyedManagerStopped
+// 注意：Stop 必须在 Start 之后调用
+func (m *KeyedManager[K, T]) Stop() {
+	m.stopOnce.Do(func() {
+		m.mtx.Lock()
+		m.stopped = true
+		m.mtx.Unlock()
+		close(m.stopCh)
+		<-m.doneCh
+	})
+}
+
+// Add 将元素加入对应 key 的队列，调用 Stop 后不再接收元素，返回 ErrKeyedManagerStopped
+func (m *KeyedManager[K, T]) Add(items ...T) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.stopped {
+		return ErrKeyedManagerStopped
+	}
+	for _, item := range items {
+		m.add(item)
+	}
+	return nil
+}
+
+func (m *KeyedManager[K, T]) add(item T) {
+	key := m.keyFunc(item)
+	g, ok := m.groups[key]
+	if !ok {
+		g = &group[T]{}
+		m.groups[key] = g
+	}
+
+	if m.idFunc != nil {
+		id := m.idFunc(item)
+		if idx, exists := g.index[id]; exists {
+			if m.mergeFunc != nil {
+				g.items[idx] = m.mergeFunc(g.items[idx], item)
+			} else {
+				g.items[idx] = item
+			}
+			return
+		}
+		if g.index == nil {
+			g.index = make(map[string]int)
+		}
+		g.index[id] = len(g.items)
+	}
+
+	if len(g.items) == 0 {
+		m.resetTimerLocked(key, g)
+	}
+	g.items = append(g.items, item)
+
+	if len(g.items) >= m.batchSize {
+		m.markReadyLocked(key)
+	}
+}
+
+// QueueLen 返回指定 key 当前等待发送的元素数量
+func (m *KeyedManager[K, T]) QueueLen(key K) int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if g, ok := m.groups[key]; ok {
+		return len(g.items)
+	}
+	return 0
+}
+
+// QueueDepths 返回所有 key 当前等待发送的元素数量
+func (m *KeyedManager[K, T]) QueueDepths() map[K]int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	depths := make(map[K]int, len(m.groups))
+	for key, g := range m.groups {
+		depths[key] = len(g.items)
+	}
+	return depths
+}
+
+// Flush 立即发送指定 key 的队列，不等待批次大小或超时
+func (m *KeyedManager[K, T]) Flush(key K) {
+	m.markReady(key)
+}
+
+func (m *KeyedManager[K, T]) markReady(key K) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.markReadyLocked(key)
+}
+
+func (m *KeyedManager[K, T]) markReadyLocked(key K) {
+	if _, ok := m.readySet[key]; ok {
+		return
+	}
+	m.readySet[key] = struct{}{}
+	m.ready = append(m.ready, key)
+	m.keepNext()
+}
+
+// nextBatch 取出下一个就绪分组的一个批次
+func (m *KeyedManager[K, T]) nextBatch() (K, []T, bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var zero K
+	for len(m.ready) > 0 {
+		key := m.ready[0]
+		m.ready = m.ready[1:]
+		delete(m.readySet, key)
+
+		g, ok := m.groups[key]
+		if !ok || len(g.items) == 0 {
+			continue
+		}
+		return key, m.takeLocked(key, g), true
+	}
+	return zero, nil, false
+}
+
+// takeLocked 从分组中取出最多 batchSize 个元素，剩余元素重新计时
+func (m *KeyedManager[K, T]) takeLocked(key K, g *group[T]) []T {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+
+	n := len(g.items)
+	if n > m.batchSize {
+		n = m.batchSize
+	}
+	items := append(make([]T, 0, n), g.items[:n]...)
+
+	rest := g.items[n:]
+	if len(rest) == 0 {
+		delete(m.groups, key)
+		return items
+	}
+
+	g.items = append(make([]T, 0, len(rest)), rest...)
+	if g.index != nil {
+		g.index = make(map[string]int, len(g.items))
+		for i, item := range g.items {
+			g.index[m.idFunc(item)] = i
+		}
+	}
+	// 剩余元素已经满足批次大小则继续发送，否则从现在开始重新计时
+	if len(g.items) >= m.batchSize {
+		m.markReadyLocked(key)
+	} else {
+		m.resetTimerLocked(key, g)
+	}
+	return items
+}
+
+// resetTimerLocked 从当前时间开始为分组计时，超时后分组进入就绪队列
+func (m *KeyedManager[K, T]) resetTimerLocked(key K, g *group[T]) {
+	firstAt := time.Now()
+	g.firstAt = firstAt
+	g.timer = time.AfterFunc(m.maxAge, func() {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+
+		// 分组已被发送或重新计时，忽略过期的定时器
+		if cur, ok := m.groups[key]; !ok || cur != g || !g.firstAt.Equal(firstAt) {
+			return
+		}
+		m.markReadyLocked(key)
+	})
+}
+
+func (m *KeyedManager[K, T]) sendLoop() {
+	defer close(m.doneCh)
+	for {
+		select {
+		case <-m.stopCh:
+			m.flushAll()
+			return
+		case <-m.moreCh:
+			for {
+				key, items, ok := m.nextBatch()
+				if !ok {
+					break
+				}
+				m.batchFunc(key, items)
+			}
+		}
+	}
+}
+
+// flushAll 停止时发送所有剩余的元素
+func (m *KeyedManager[K, T]) flushAll() {
+	m.mtx.Lock()
+	keys := make([]K, 0, len(m.groups))
+	keys = append(keys, m.ready...)
+	for key := range m.groups {
+		if _, ok := m.readySet[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	m.ready = nil
+	m.readySet = make(map[K]struct{})
+	m.mtx.Unlock()
+
+	for _, key := range keys {
+		for {
+			m.mtx.Lock()
+			g, ok := m.groups[key]
+			if !ok || len(g.items) == 0 {
+				m.mtx.Unlock()
+				break
+			}
+			items := m.takeLocked(key, g)
+			m.mtx.Unlock()
+			m.batchFunc(key, items)
+		}
+	}
+}
+
+func (m *KeyedManager[K, T]) keepNext() {
+	select {
+	case m.moreCh <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,292 @@
+package batch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type keyedItem struct {
+	Receiver string
+	ID       string
+	Value    int
+}
+
+type keyedRecorder struct {
+	mu      sync.Mutex
+	batches map[string][][]keyedItem
+}
+
+func newKeyedRecorder() *keyedRecorder {
+	return &keyedRecorder{batches: make(map[string][][]keyedItem)}
+}
+
+func (r *keyedRecorder) record(key string, items []keyedItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches[key] = append(r.batches[key], items)
+}
+
+func (r *keyedRecorder) get(key string) [][]keyedItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]keyedItem(nil), r.batches[key]...)
+}
+
+func receiverKey(item keyedItem) string { return item.Receiver }
+
+func itemID(item keyedItem) string { return item.ID }
+
+// TestNewKeyedManager 测试 NewKeyedManager 构造函数及选项
+func TestNewKeyedManager(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []KeyedOption[string, keyedItem]
+		batchSize int
+		maxAge    time.Duration
+	}{
+		{
+			name:      "默认配置",
+			batchSize: defaultKeyedBatchSize,
+			maxAge:    defaultKeyedMaxAge,
+		},
+		{
+			name: "自定义批次大小和等待时间",
+			opts: []KeyedOption[string, keyedItem]{
+				WithKeyedBatchSize[string, keyedItem](5),
+				WithKeyedMaxAge[string, keyedItem](time.Minute),
+			},
+			batchSize: 5,
+			maxAge:    time.Minute,
+		},
+		{
+			name: "非法参数保持默认值",
+			opts: []KeyedOption[string, keyedItem]{
+				WithKeyedBatchSize[string, keyedItem](0),
+				WithKeyedMaxAge[string, keyedItem](-time.Second),
+			},
+			batchSize: defaultKeyedBatchSize,
+			maxAge:    defaultKeyedMaxAge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewKeyedManager(receiverKey, func(string, []keyedItem) {}, tt.opts...)
+			if m.batchSize != tt.batchSize {
+				t.Errorf("期望 batchSize=%d, 实际=%d", tt.batchSize, m.batchSize)
+			}
+			if m.maxAge != tt.maxAge {
+				t.Errorf("期望 maxAge=%v, 实际=%v", tt.maxAge, m.maxAge)
+			}
+		})
+	}
+}
+
+// TestKeyedManager_FlushOnSize 测试分组达到批次大小后立即发送，且各分组互不影响
+func TestKeyedManager_FlushOnSize(t *testing.T) {
+	rec := newKeyedRecorder()
+	m := NewKeyedManager(receiverKey, rec.record,
+		WithKeyedBatchSize[string, keyedItem](2),
+		WithKeyedMaxAge[string, keyedItem](time.Hour),
+	)
+	m.Start()
+	defer m.Stop()
+
+	m.Add(keyedItem{Receiver: "a", Value: 1}, keyedItem{Receiver: "b", Value: 1}, keyedItem{Receiver: "a", Value: 2})
+
+	waitFor(t, func() bool { return len(rec.get("a")) == 1 })
+
+	batches := rec.get("a")
+	if got := []int{batches[0][0].Value, batches[0][1].Value}; got[0] != 1 || got[1] != 2 {
+		t.Errorf("期望分组 a 按顺序发送 [1 2], 实际=%v", got)
+	}
+	if len(rec.get("b")) != 0 {
+		t.Error("分组 b 未达到批次大小，不应被发送")
+	}
+	if depth := m.QueueLen("b"); depth != 1 {
+		t.Errorf("期望分组 b 队列长度=1, 实际=%d", depth)
+	}
+}
+
+// TestKeyedManager_FlushOnAge 测试分组等待超时后发送
+func TestKeyedManager_FlushOnAge(t *testing.T) {
+	rec := newKeyedRecorder()
+	m := NewKeyedManager(receiverKey, rec.record,
+		WithKeyedBatchSize[string, keyedItem](100),
+		WithKeyedMaxAge[string, keyedItem](20*time.Millisecond),
+	)
+	m.Start()
+	defer m.Stop()
+
+	m.Add(keyedItem{Receiver: "a", Value: 1})
+	if depth := m.QueueLen("a"); depth != 1 {
+		t.Errorf("期望分组 a 队列长度=1, 实际=%d", depth)
+	}
+
+	waitFor(t, func() bool { return len(rec.get("a")) == 1 })
+
+	if depth := m.QueueLen("a"); depth != 0 {
+		t.Errorf("发送后期望分组 a 队列长度=0, 实际=%d", depth)
+	}
+}
+
+// TestKeyedManager_Coalesce 测试同一分组内的重复元素合并
+func TestKeyedManager_Coalesce(t *testing.T) {
+	tests := []struct {
+		name     string
+		merge    func(old, new keyedItem) keyedItem
+		expected []int
+	}{
+		{
+			name:     "后到的元素替换未发送的元素",
+			expected: []int{3, 2},
+		},
+		{
+			name: "使用合并函数",
+			merge: func(old, new keyedItem) keyedItem {
+				new.Value += old.Value
+				return new
+			},
+			expected: []int{4, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := newKeyedRecorder()
+			m := NewKeyedManager(receiverKey, rec.record,
+				WithKeyedMaxAge[string, keyedItem](time.Hour),
+				WithCoalesce[string, keyedItem](itemID, tt.merge),
+			)
+			m.Start()
+
+			m.Add(
+				keyedItem{Receiver: "a", ID: "x", Value: 1},
+				keyedItem{Receiver: "a", ID: "y", Value: 2},
+				keyedItem{Receiver: "a", ID: "x", Value: 3},
+			)
+			if depth := m.QueueLen("a"); depth != 2 {
+				t.Errorf("期望合并后队列长度=2, 实际=%d", depth)
+			}
+			m.Stop()
+
+			batches := rec.get("a")
+			if len(batches) != 1 || len(batches[0]) != len(tt.expected) {
+				t.Fatalf("期望发送 1 个批次 %d 个元素, 实际=%v", len(tt.expected), batches)
+			}
+			for i, v := range tt.expected {
+				if batches[0][i].Value != v {
+					t.Errorf("第 %d 个元素期望=%d, 实际=%d", i, v, batches[0][i].Value)
+				}
+			}
+		})
+	}
+}
+
+// TestKeyedManager_QueueDepths 测试按 key 统计队列长度
+func TestKeyedManager_QueueDepths(t *testing.T) {
+	m := NewKeyedManager(receiverKey, func(string, []keyedItem) {},
+		WithKeyedMaxAge[string, keyedItem](time.Hour),
+	)
+
+	m.Add(keyedItem{Receiver: "a"}, keyedItem{Receiver: "a"}, keyedItem{Receiver: "b"})
+
+	depths := m.QueueDepths()
+	if depths["a"] != 2 || depths["b"] != 1 || len(depths) != 2 {
+		t.Errorf("期望 map[a:2 b:1], 实际=%v", depths)
+	}
+	if depth := m.QueueLen("c"); depth != 0 {
+		t.Errorf("不存在的分组期望队列长度=0, 实际=%d", depth)
+	}
+}
+
+// TestKeyedManager_StopFlushesAll 测试停止时按批次发送所有剩余元素并保持顺序
+func TestKeyedManager_StopFlushesAll(t *testing.T) {
+	rec := newKeyedRecorder()
+	m := NewKeyedManager(receiverKey, rec.record,
+		WithKeyedBatchSize[string, keyedItem](3),
+		WithKeyedMaxAge[string, keyedItem](time.Hour),
+	)
+	m.Start()
+
+	for i := 0; i < 2; i++ {
+		m.Add(keyedItem{Receiver: "a", Value: i})
+	}
+	m.Stop()
+	// 多次调用 Stop 不应阻塞
+	m.Stop()
+
+	// 停止后不再接收新元素
+	if err := m.Add(keyedItem{Receiver: "a", Value: 2}); !errors.Is(err, ErrKeyedManagerStopped) {
+		t.Errorf("停止后 Add 期望返回 ErrKeyedManagerStopped, 实际=%v", err)
+	}
+	if depth := m.QueueLen("a"); depth != 0 {
+		t.Errorf("停止后期望队列长度=0, 实际=%d", depth)
+	}
+
+	batches := rec.get("a")
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("期望 1 个批次 2 个元素, 实际=%v", batches)
+	}
+	for i, item := range batches[0] {
+		if item.Value != i {
+			t.Errorf("第 %d 个元素期望=%d, 实际=%d", i, i, item.Value)
+		}
+	}
+}
+
+// TestKeyedManager_Concurrent 测试并发添加时分组内顺序不变
+func TestKeyedManager_Concurrent(t *testing.T) {
+	const perKey = 200
+	rec := newKeyedRecorder()
+	m := NewKeyedManager(receiverKey, rec.record,
+		WithKeyedBatchSize[string, keyedItem](7),
+		WithKeyedMaxAge[string, keyedItem](5*time.Millisecond),
+	)
+	m.Start()
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for i := 0; i < perKey; i++ {
+				m.Add(keyedItem{Receiver: key, Value: i})
+			}
+		}(key)
+	}
+	wg.Wait()
+	m.Stop()
+
+	for _, key := range []string{"a", "b", "c"} {
+		next := 0
+		for _, batch := range rec.get(key) {
+			if len(batch) > 7 {
+				t.Errorf("分组 %s 批次大小超过限制: %d", key, len(batch))
+			}
+			for _, item := range batch {
+				if item.Value != next {
+					t.Fatalf("分组 %s 顺序错误, 期望=%d, 实际=%d", key, next, item.Value)
+				}
+				next++
+			}
+		}
+		if next != perKey {
+			t.Errorf("分组 %s 期望发送 %d 个元素, 实际=%d", key, perKey, next)
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("等待条件超时")
+}
@@ -67,7 +67,7 @@ func TestManager_queueLen(t *testing.T) {
 
 	t.Run("添加元素后的队列长度", func(t *testing.T) {
 		manager.mtx.Lock()
-		manager.queues = append(manager.queues, &queue{1}, &queue{2})
+		manager.queues = append(manager.queues, newQueue(1), newQueue(2))
 		manager.mtx.Unlock()
 
 		if length := manager.queueLen(); length != 2 {
@@ -96,21 +96,21 @@ func TestManager_nextBatch(t *testing.T) {
 		{
 			name:          "队列元素少于批次大小",
 			batchSize:     10,
-			initialQueues: []*queue{{1}, {2}, {3}},
+			initialQueues: []*queue{newQueue(1), newQueue(2), newQueue(3)},
 			expectedCount: 3,
 			remainCount:   0,
 		},
 		{
 			name:          "队列元素等于批次大小",
 			batchSize:     3,
-			initialQueues: []*queue{{1}, {2}, {3}},
+			initialQueues: []*queue{newQueue(1), newQueue(2), newQueue(3)},
 			expectedCount: 3,
 			remainCount:   0,
 		},
 		{
 			name:          "队列元素多于批次大小",
 			batchSize:     2,
-			initialQueues: []*queue{{1}, {2}, {3}, {4}, {5}},
+			initialQueues: []*queue{newQueue(1), newQueue(2), newQueue(3), newQueue(4), newQueue(5)},
 			expectedCount: 2,
 			remainCount:   3,
 		},
@@ -162,14 +162,12 @@ func TestManager_keepNext(t *testing.T) {
 func TestManager_sendLoop(t *testing.T) {
 	t.Run("sendLoop 应处理批次", func(t *testing.T) {
 		var callCount int32
-		var receivedItems []*queue
 
 		manager := NewManager(2, func(items []*queue) {
 			atomic.AddInt32(&callCount, 1)
-			receivedItems = items
 		})
 
-		manager.queues = []*queue{{1}, {2}, {3}, {4}}
+		manager.queues = []*queue{newQueue(1), newQueue(2), newQueue(3), newQueue(4)}
 		manager.Start()
 
 		// 触发批处理
@@ -215,7 +213,7 @@ func TestManager_sendOneBatch(t *testing.T) {
 			receivedItems = items
 		})
 
-		manager.queues = []*queue{{1}, {2}}
+		manager.queues = []*queue{newQueue(1), newQueue(2)}
 		manager.sendOneBatch()
 
 		if !called {
@@ -251,7 +249,7 @@ func TestManager_Concurrent(t *testing.T) {
 			go func(idx int) {
 				defer wg.Done()
 				manager.mtx.Lock()
-				manager.queues = append(manager.queues, &queue{idx})
+				manager.queues = append(manager.queues, newQueue(idx))
 				manager.mtx.Unlock()
 				manager.keepNext()
 			}(i)
@@ -268,7 +266,7 @@ func TestManager_Concurrent(t *testing.T) {
 
 	t.Run("并发 queueLen 调用", func(t *testing.T) {
 		manager := NewManager(10, func(items []*queue) {})
-		manager.queues = []*queue{{1}, {2}, {3}}
+		manager.queues = []*queue{newQueue(1), newQueue(2), newQueue(3)}
 
 		var wg sync.WaitGroup
 		for i := 0; i < 100; i++ {
@@ -289,7 +287,7 @@ func BenchmarkManager_nextBatch(b *testing.B) {
 	manager := NewManager(100, func(items []*queue) {})
 	manager.queues = make([]*queue, 1000)
 	for i := 0; i < 1000; i++ {
-		manager.queues[i] = &queue{i}
+		manager.queues[i] = newQueue(i)
 	}
 
 	b.ResetTimer()
@@ -303,7 +301,7 @@ func BenchmarkManager_queueLen(b *testing.B) {
 	manager := NewManager(100, func(items []*queue) {})
 	manager.queues = make([]*queue, 1000)
 	for i := 0; i < 1000; i++ {
-		manager.queues[i] = &queue{i}
+		manager.queues[i] = newQueue(i)
 	}
 
 	b.ResetTimer()
@@ -315,10 +313,10 @@ func BenchmarkManager_queueLen(b *testing.B) {
 // ExampleNewManager 示例函数
 func ExampleNewManager() {
 	// 创建一个批处理管理器，每批次最多处理 10 个项目
-	manager := NewManager(10, func(items []interface{}) {
+	manager := NewManager(10, func(items []*queue) {
 		// 处理批次中的项目
 		for _, item := range items {
-			println(item)
+			println(*item)
 		}
 	})
 
@@ -326,8 +324,14 @@ func ExampleNewManager() {
 	manager.Start()
 
 	// 添加项目到队列
-	manager.queues = append(manager.queues, &queue{"item1"})
+	manager.queues = append(manager.queues, newQueue("item1"))
 	manager.keepNext()
 
 	_ = manager
 }
+
+// newQueue 返回指向 v 的 *queue
+func newQueue(v interface{}) *queue {
+	q := queue(v)
+	return &q
+}
@@ -0,0 +1,214 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 熔断器处于打开状态时返回的错误
+var ErrCircuitOpen = errors.New("http: circuit breaker is open")
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+	// CircuitClosed 关闭状态，请求正常通过
+	CircuitClosed CircuitState = iota
+	// CircuitOpen 打开状态，请求直接失败
+	CircuitOpen
+	// CircuitHalfOpen 半开状态，允许少量探测请求通过
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenTimeout      = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// CircuitBreakerConfig 熔断器配置
+type CircuitBreakerConfig struct {
+	// FailureThreshold 连续失败多少次后打开熔断器，默认 5
+	FailureThreshold int
+	// OpenTimeout 熔断器打开后多久进入半开状态，默认 30s
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开状态允许同时通过的探测请求数，默认 1
+	HalfOpenRequests int
+	// IsFailure 判断请求是否失败，默认网络错误和 5xx 视为失败
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange 状态变化时回调，回调在持有锁时执行，不能再调用 CircuitBreaker 的方法
+	OnStateChange func(host string, from, to CircuitState)
+}
+
+// CircuitBreaker 按 host 独立统计的熔断器
+type CircuitBreaker struct {
+	cfg   CircuitBreakerConfig
+	mu    sync.Mutex
+	hosts map[string]*hostBreaker
+	now   func() time.Time
+}
+
+type hostBreaker struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	inflight int
+	// generation 每次状态变化时加一，状态变化前放行的请求的结果不再统计
+	generation uint64
+}
+
+// breakerTicket allow 放行请求时返回的凭证，record 根据凭证判断结果是否仍然有效
+type breakerTicket struct {
+	generation uint64
+	// probe 是否为半开状态放行的探测请求
+	probe bool
+}
+
+// NewCircuitBreaker 创建熔断器
+func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode >= http.StatusInternalServerError
+		}
+	}
+	return &CircuitBreaker{
+		cfg:   cfg,
+		hosts: make(map[string]*hostBreaker),
+		now:   time.Now,
+	}
+}
+
+// Middleware 返回熔断器中间件
+func (cb *CircuitBreaker) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			host := req.URL.Host
+			ticket, err := cb.allow(host)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := next.RoundTrip(req)
+			cb.record(host, ticket, cb.cfg.IsFailure(resp, err))
+			return resp, err
+		})
+	}
+}
+
+// CircuitBreakerMiddleware 使用配置创建熔断器中间件
+func CircuitBreakerMiddleware(cfg CircuitBreakerConfig) Middleware {
+	return NewCircuitBreaker(cfg).Middleware()
+}
+
+// State 返回 host 当前的熔断器状态
+func (cb *CircuitBreaker) State(host string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.hosts[host]
+	if !ok {
+		return CircuitClosed
+	}
+	cb.refreshLocked(host, b)
+	return b.state
+}
+
+// allow 判断是否放行 host 的请求，放行时返回请求结束后传给 record 的凭证
+func (cb *CircuitBreaker) allow(host string) (breakerTicket, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.hosts[host]
+	if !ok {
+		b = &hostBreaker{}
+		cb.hosts[host] = b
+	}
+	cb.refreshLocked(host, b)
+
+	ticket := breakerTicket{generation: b.generation}
+	switch b.state {
+	case CircuitOpen:
+		return ticket, fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	case CircuitHalfOpen:
+		if b.inflight >= cb.cfg.HalfOpenRequests {
+			return ticket, fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+		b.inflight++
+		ticket.probe = true
+	}
+	return ticket, nil
+}
+
+// record 统计请求结果，请求放行后熔断器状态已经变化时忽略该结果
+func (cb *CircuitBreaker) record(host string, ticket breakerTicket, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.hosts[host]
+	if ticket.generation != b.generation {
+		return
+	}
+	switch b.state {
+	case CircuitHalfOpen:
+		b.inflight--
+		if failed {
+			cb.setStateLocked(host, b, CircuitOpen)
+			return
+		}
+		cb.setStateLocked(host, b, CircuitClosed)
+	case CircuitClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= cb.cfg.FailureThreshold {
+			cb.setStateLocked(host, b, CircuitOpen)
+		}
+	}
+}
+
+// refreshLocked 打开时间超过 OpenTimeout 后进入半开状态
+func (cb *CircuitBreaker) refreshLocked(host string, b *hostBreaker) {
+	if b.state == CircuitOpen && cb.now().Sub(b.openedAt) >= cb.cfg.OpenTimeout {
+		cb.setStateLocked(host, b, CircuitHalfOpen)
+	}
+}
+
+func (cb *CircuitBreaker) setStateLocked(host string, b *hostBreaker, state CircuitState) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.inflight = 0
+	if state == CircuitOpen {
+		b.openedAt = cb.now()
+	}
+	if from != state && cb.cfg.OnStateChange != nil {
+		cb.cfg.OnStateChange(host, from, state)
+	}
+}
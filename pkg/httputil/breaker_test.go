@@ -0,0 +1,153 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCircuitBreaker 测试熔断器状态流转：closed -> open -> half-open -> closed/open
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	now := time.Now()
+	var transitions []string
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		OnStateChange: func(h string, from, to CircuitState) {
+			assert.Equal(t, host, h)
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	cb.now = func() time.Time { return now }
+	client := NewHTTPClient(WithMiddlewares(cb.Middleware()))
+
+	// 连续失败达到阈值后打开
+	for i := 0; i < 2; i++ {
+		_, err := client.Get(server.URL)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, CircuitOpen, cb.State(host))
+
+	// 打开状态直接失败，不发送请求
+	_, err := client.Get(server.URL)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// 超时后进入半开状态，探测失败重新打开
+	now = now.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, cb.State(host))
+	_, err = client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, CircuitOpen, cb.State(host))
+
+	// 再次超时后探测成功，关闭熔断器
+	now = now.Add(time.Minute)
+	failing.Store(false)
+	_, err = client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, CircuitClosed, cb.State(host))
+
+	assert.Equal(t, []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+		"open->half-open",
+		"half-open->closed",
+	}, transitions)
+}
+
+// TestCircuitBreakerPerHost 测试熔断器按 host 独立统计
+func TestCircuitBreakerPerHost(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	cb := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1})
+	client := NewHTTPClient(WithMiddlewares(cb.Middleware()))
+
+	_, err := client.Get(bad.URL)
+	require.NoError(t, err)
+	_, err = client.Get(bad.URL)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+
+	_, err = client.Get(good.URL)
+	require.NoError(t, err)
+	assert.Equal(t, CircuitClosed, cb.State(strings.TrimPrefix(good.URL, "http://")))
+	assert.Equal(t, CircuitClosed, cb.State("unknown:80"))
+}
+
+// TestCircuitBreakerSuccessResetsFailures 测试成功请求重置连续失败计数
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2})
+	for _, failed := range []bool{true, false, true} {
+		ticket, err := cb.allow("h")
+		require.NoError(t, err)
+		cb.record("h", ticket, failed)
+	}
+	assert.Equal(t, CircuitClosed, cb.State("h"))
+}
+
+// TestCircuitBreakerStaleResult 测试熔断器状态变化前放行的慢请求不影响之后的状态和半开探测
+func TestCircuitBreakerStaleResult(t *testing.T) {
+	now := time.Now()
+	cb := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	cb.now = func() time.Time { return now }
+
+	// 关闭状态放行一个慢请求，随后另一个请求失败打开熔断器
+	slow, err := cb.allow("h")
+	require.NoError(t, err)
+	failed, err := cb.allow("h")
+	require.NoError(t, err)
+	cb.record("h", failed, true)
+	require.Equal(t, CircuitOpen, cb.State("h"))
+
+	// 超时后进入半开状态并放行一个探测请求
+	now = now.Add(time.Minute)
+	probe, err := cb.allow("h")
+	require.NoError(t, err)
+	require.Equal(t, CircuitHalfOpen, cb.State("h"))
+
+	// 慢请求的结果已经过期，不能关闭熔断器，也不能释放探测名额
+	cb.record("h", slow, false)
+	assert.Equal(t, CircuitHalfOpen, cb.State("h"))
+	_, err = cb.allow("h")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// 探测成功后关闭熔断器，过期的失败结果不计入失败次数
+	cb.record("h", probe, false)
+	assert.Equal(t, CircuitClosed, cb.State("h"))
+	cb.record("h", failed, true)
+	assert.Equal(t, CircuitClosed, cb.State("h"))
+	assert.Equal(t, 0, cb.hosts["h"].inflight)
+}
+
+// TestCircuitStateString 测试状态字符串
+func TestCircuitStateString(t *testing.T) {
+	assert.Equal(t, "closed", CircuitClosed.String())
+	assert.Equal(t, "open", CircuitOpen.String())
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+	assert.Equal(t, "unknown(9)", CircuitState(9).String())
+}
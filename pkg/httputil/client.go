@@ -4,12 +4,9 @@ import (
 	"bytes"
 	"context"
 	"io"
-	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"time"
 )
 
@@ -36,6 +33,9 @@ const (
 type Client struct {
 	contentType   ContentType
 	authorization string
+	errorOnStatus bool
+	retry         *RetryPolicy
+	middlewares   []Middleware
 	client        *http.Client
 }
 
@@ -103,6 +103,12 @@ func NewHTTPClient(opts ...Options) *Client {
 	for _, opt := range opts {
 		opt(client)
 	}
+	if len(client.middlewares) > 0 {
+		client.client.Transport = chainMiddlewares(client.client.Transport, client.middlewares)
+	}
+	if client.retry != nil {
+		client.client.Transport = newRetryTransport(client.client.Transport, *client.retry)
+	}
 	return client
 }
 
@@ -419,58 +425,15 @@ func (h *Client) DeleteWithHeaders(url string, headers map[string]string) ([]byt
 }
 
 // PostFile sends a file in a POST request using multipart/form-data
+// 文件内容通过 PostMultipart 流式发送，不会整体读入内存
 func (h *Client) PostFile(url, fieldName, filePath string) ([]byte, error) {
-	// 创建一个缓冲区和 multipart writer
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	// 打开文件
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	// 创建文件字段
-	part, err := writer.CreateFormFile(fieldName, filepath.Base(filePath))
-	if err != nil {
-		return nil, err
-	}
-
-	// 将文件内容写入 multipart
-	_, err = io.Copy(part, file)
-	if err != nil {
-		return nil, err
-	}
-
-	// 关闭 multipart writer 以完成请求体
-	err = writer.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	// 创建 HTTP 请求
-	request, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, err
-	}
-
-	// 设置 Content-Type 为 multipart/form-data
-	request.Header.Set("Content-Type", writer.FormDataContentType())
-
-	// 发送请求
-	res, err := h.client.Do(request)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	// 读取响应
-	responseBody, err := io.ReadAll(res.Body)
+	resp, err := h.PostMultipart(context.Background(), url, MultipartForm{
+		Files: []FormFile{{FieldName: fieldName, Path: filePath}},
+	})
 	if err != nil {
 		return nil, err
 	}
-	return responseBody, nil
+	return resp.Body, nil
 }
 
 // GetCtx 发送 GET 请求，支持 context 控制请求生命周期
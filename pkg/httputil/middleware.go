@@ -0,0 +1,189 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.piwriw.go-tools/pkg/logger"
+	"golang.org/x/time/rate"
+)
+
+// Middleware 客户端中间件，包装 RoundTripper 以在请求前后执行额外逻辑
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc 将函数适配为 http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddlewares 添加客户端中间件
+// 中间件按添加顺序组合，第一个中间件最先处理请求、最后处理响应。
+// 中间件包装在 WithTransport 设置的 Transport 之外，开启重试时每次尝试都会经过中间件。
+func WithMiddlewares(middlewares ...Middleware) Options {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// chainMiddlewares 按顺序组合中间件
+func chainMiddlewares(base http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			base = middlewares[i](base)
+		}
+	}
+	return base
+}
+
+// redactedValue 脱敏后的请求头取值
+const redactedValue = "[REDACTED]"
+
+// defaultRedactHeaders 默认脱敏的请求头
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// LoggingOption 日志中间件配置
+type LoggingOption func(*loggingConfig)
+
+type loggingConfig struct {
+	redact     map[string]struct{}
+	logHeaders bool
+}
+
+// WithRedactHeaders 追加需要脱敏的请求头
+func WithRedactHeaders(headers ...string) LoggingOption {
+	return func(c *loggingConfig) {
+		for _, h := range headers {
+			c.redact[http.CanonicalHeaderKey(h)] = struct{}{}
+		}
+	}
+}
+
+// WithLogHeaders 在日志中记录请求头和响应头（脱敏后）
+func WithLogHeaders() LoggingOption {
+	return func(c *loggingConfig) {
+		c.logHeaders = true
+	}
+}
+
+// LoggingMiddleware 使用 logger.Logger 记录结构化的请求和响应日志
+// 5xx 响应和网络错误记录为 Error，4xx 记录为 Warn，其余记录为 Info
+func LoggingMiddleware(log logger.Logger, opts ...LoggingOption) Middleware {
+	cfg := &loggingConfig{redact: make(map[string]struct{})}
+	WithRedactHeaders(defaultRedactHeaders...)(cfg)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			fields := map[string]any{
+				"method":   req.Method,
+				"url":      req.URL.Redacted(),
+				"host":     req.URL.Host,
+				"duration": time.Since(start).String(),
+			}
+			if cfg.logHeaders {
+				fields["request_headers"] = redactHeaders(req.Header, cfg.redact)
+			}
+			if err != nil {
+				fields["error"] = err.Error()
+				log.WithFields(fields).Errorf("http request failed")
+				return resp, err
+			}
+
+			fields["status"] = resp.StatusCode
+			if cfg.logHeaders {
+				fields["response_headers"] = redactHeaders(resp.Header, cfg.redact)
+			}
+			l := log.WithFields(fields)
+			switch {
+			case resp.StatusCode >= http.StatusInternalServerError:
+				l.Errorf("http request completed")
+			case resp.StatusCode >= http.StatusBadRequest:
+				l.Warnf("http request completed")
+			default:
+				l.Infof("http request completed")
+			}
+			return resp, nil
+		})
+	}
+}
+
+// redactHeaders 复制请求头并替换需要脱敏的值
+func redactHeaders(header http.Header, redact map[string]struct{}) map[string]string {
+	res := make(map[string]string, len(header))
+	for key, values := range header {
+		if _, ok := redact[http.CanonicalHeaderKey(key)]; ok {
+			res[key] = redactedValue
+			continue
+		}
+		res[key] = strings.Join(values, ",")
+	}
+	return res
+}
+
+// MetricsMiddleware 使用 Prometheus 直方图记录请求耗时，按 host、method 和 status 区分
+// 网络错误的 status 为 "error"。reg 为 nil 时注册到 prometheus.DefaultRegisterer，
+// 同名指标已注册时复用已有的直方图。
+func MetricsMiddleware(reg prometheus.Registerer, namespace string) (Middleware, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http_client",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of outbound HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "method", "status"})
+	if err := reg.Register(histogram); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return nil, err
+		}
+		existing, ok := are.ExistingCollector.(*prometheus.HistogramVec)
+		if !ok {
+			return nil, err
+		}
+		histogram = existing
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			status := "error"
+			if err == nil {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			histogram.WithLabelValues(req.URL.Host, req.Method, status).Observe(time.Since(start).Seconds())
+			return resp, err
+		})
+	}, nil
+}
+
+// RateLimitMiddleware 限制客户端发出请求的速率
+// limit 为每秒允许的请求数，burst 为突发容量，等待令牌时遵循请求的 context
+func RateLimitMiddleware(limit float64, burst int) Middleware {
+	limiter := rate.NewLimiter(rate.Limit(limit), burst)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if err := limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
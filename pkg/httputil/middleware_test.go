@@ -0,0 +1,254 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.piwriw.go-tools/pkg/logger"
+)
+
+// captureLogger 记录日志级别和字段的 logger.Logger 实现
+type captureLogger struct {
+	mu      *sync.Mutex
+	entries *[]logEntry
+	fields  map[string]any
+}
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]any
+}
+
+var _ logger.Logger = (*captureLogger)(nil)
+
+func newCaptureLogger() *captureLogger {
+	return &captureLogger{mu: &sync.Mutex{}, entries: &[]logEntry{}}
+}
+
+func (l *captureLogger) add(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.entries = append(*l.entries, logEntry{level: level, msg: msg, fields: l.fields})
+}
+
+func (l *captureLogger) Entries() []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]logEntry(nil), *l.entries...)
+}
+
+func (l *captureLogger) Debug(args ...any) { l.add("debug", fmt.Sprint(args...)) }
+func (l *captureLogger) Debugf(format string, args ...any) {
+	l.add("debug", fmt.Sprintf(format, args...))
+}
+func (l *captureLogger) Info(args ...any) { l.add("info", fmt.Sprint(args...)) }
+func (l *captureLogger) Infof(format string, args ...any) {
+	l.add("info", fmt.Sprintf(format, args...))
+}
+func (l *captureLogger) Warn(args ...any) { l.add("warn", fmt.Sprint(args...)) }
+func (l *captureLogger) Warnf(format string, args ...any) {
+	l.add("warn", fmt.Sprintf(format, args...))
+}
+func (l *captureLogger) Error(args ...any) { l.add("error", fmt.Sprint(args...)) }
+func (l *captureLogger) Errorf(format string, args ...any) {
+	l.add("error", fmt.Sprintf(format, args...))
+}
+func (l *captureLogger) Fatal(args ...any) { l.add("fatal", fmt.Sprint(args...)) }
+func (l *captureLogger) Fatalf(format string, args ...any) {
+	l.add("fatal", fmt.Sprintf(format, args...))
+}
+func (l *captureLogger) SetLevel(logger.Level) {}
+func (l *captureLogger) WithFields(fields map[string]any) logger.Logger {
+	return &captureLogger{mu: l.mu, entries: l.entries, fields: fields}
+}
+
+// TestMiddlewareOrder 测试中间件按添加顺序组合
+func TestMiddlewareOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Order")))
+	}))
+	defer server.Close()
+
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+"-before")
+				req.Header.Add("X-Order", name)
+				resp, err := next.RoundTrip(req)
+				order = append(order, name+"-after")
+				return resp, err
+			})
+		}
+	}
+
+	client := NewHTTPClient(WithMiddlewares(mark("first"), nil, mark("second")))
+	body, err := client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(body))
+	assert.Equal(t, []string{"first-before", "second-before", "second-after", "first-after"}, order)
+}
+
+// TestMiddlewareWithTransport 测试中间件包装 WithTransport 设置的 Transport
+func TestMiddlewareWithTransport(t *testing.T) {
+	var called bool
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       http.NoBody,
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	})
+	mw := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			called = true
+			return next.RoundTrip(req)
+		})
+	}
+
+	// 中间件在 WithTransport 之前添加也应生效
+	client := NewHTTPClient(WithMiddlewares(mw), WithTransport(transport))
+	_, err := client.Get("http://example.invalid")
+	require.NoError(t, err)
+	assert.True(t, called)
+}
+
+// TestLoggingMiddleware 测试日志中间件的级别和请求头脱敏
+func TestLoggingMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	log := newCaptureLogger()
+	client := NewHTTPClient(
+		WithAuthorization("Bearer secret"),
+		WithMiddlewares(LoggingMiddleware(log, WithLogHeaders(), WithRedactHeaders("X-Token"))),
+	)
+
+	_, err := client.GetWithHeaders(server.URL+"/ok", map[string]string{"X-Token": "t", "X-Trace": "trace"})
+	require.NoError(t, err)
+	_, err = client.Get(server.URL + "/bad")
+	require.NoError(t, err)
+	_, err = client.Get(server.URL + "/fail")
+	require.NoError(t, err)
+
+	entries := log.Entries()
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{"info", "warn", "error"}, []string{entries[0].level, entries[1].level, entries[2].level})
+
+	fields := entries[0].fields
+	assert.Equal(t, http.MethodGet, fields["method"])
+	assert.Equal(t, http.StatusOK, fields["status"])
+	headers := fields["request_headers"].(map[string]string)
+	assert.Equal(t, redactedValue, headers["X-Token"])
+	assert.Equal(t, "trace", headers["X-Trace"])
+
+	headers = entries[1].fields["request_headers"].(map[string]string)
+	assert.Equal(t, redactedValue, headers["Authorization"])
+	assert.NotContains(t, headers["Authorization"], "secret")
+}
+
+// TestLoggingMiddlewareError 测试网络错误记录为 Error
+func TestLoggingMiddlewareError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	log := newCaptureLogger()
+	client := NewHTTPClient(WithMiddlewares(LoggingMiddleware(log)))
+	_, err := client.Get(url)
+	require.Error(t, err)
+
+	entries := log.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "error", entries[0].level)
+	assert.NotEmpty(t, entries[0].fields["error"])
+	assert.NotContains(t, entries[0].fields, "request_headers")
+}
+
+// TestMetricsMiddleware 测试 Prometheus 请求耗时直方图
+func TestMetricsMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewRegistry()
+	mw, err := MetricsMiddleware(reg, "test")
+	require.NoError(t, err)
+	// 重复注册复用已有的直方图
+	mw2, err := MetricsMiddleware(reg, "test")
+	require.NoError(t, err)
+
+	client := NewHTTPClient(WithMiddlewares(mw))
+	client2 := NewHTTPClient(WithMiddlewares(mw2))
+	_, err = client.Get(server.URL)
+	require.NoError(t, err)
+	_, err = client2.Get(server.URL + "/fail")
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(reg, "test_http_client_request_duration_seconds"))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	statuses := map[string]bool{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "status" {
+					statuses[label.GetValue()] = true
+				}
+				if label.GetName() == "host" {
+					assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), label.GetValue())
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]bool{"200": true, "503": true}, statuses)
+}
+
+// TestRateLimitMiddleware 测试出站限流
+func TestRateLimitMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := NewHTTPClient(WithMiddlewares(RateLimitMiddleware(20, 1)))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := client.Get(server.URL)
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond, "第 2、3 个请求应各等待约 50ms")
+
+	t.Run("等待令牌时 context 取消", func(t *testing.T) {
+		client := NewHTTPClient(WithMiddlewares(RateLimitMiddleware(0.001, 1)))
+		_, err := client.Get(server.URL)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = client.GetCtx(ctx, server.URL)
+		require.Error(t, err)
+	})
+}
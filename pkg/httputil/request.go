@@ -0,0 +1,269 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// maxErrorBodyLen HTTPError.Error() 中最多展示的响应体长度
+const maxErrorBodyLen = 512
+
+// Request 请求构造器，通过链式调用设置方法、URL、查询参数、请求头和请求体
+//
+//	resp, err := client.NewRequest(http.MethodGet, "http://example.com/api").
+//		WithContext(ctx).
+//		SetQuery("page", "1").
+//		SetHeader("X-Trace-Id", traceID).
+//		Do()
+type Request struct {
+	client        *Client
+	ctx           context.Context
+	method        string
+	url           string
+	query         url.Values
+	header        http.Header
+	body          []byte
+	err           error
+	errorOnStatus bool
+}
+
+// Response HTTP 响应，包含状态码、响应头和完整的响应体
+type Response struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	Request    *http.Request
+}
+
+// IsSuccess 判断响应状态码是否为 2xx
+func (r *Response) IsSuccess() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// String 返回响应体字符串
+func (r *Response) String() string {
+	return string(r.Body)
+}
+
+// HTTPError 非 2xx 响应转换成的错误，携带响应体便于排查
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	body := e.Body
+	if len(body) > maxErrorBodyLen {
+		body = body[:maxErrorBodyLen]
+	}
+	return fmt.Sprintf("http: %s %s: unexpected status %s: %s", e.Method, e.URL, e.Status, body)
+}
+
+// newHTTPError 根据响应创建 HTTPError
+func newHTTPError(resp *Response) *HTTPError {
+	e := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       resp.Body,
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = resp.Request.URL.String()
+	}
+	return e
+}
+
+// WithErrorOnStatus 设置客户端默认将非 2xx 响应转换为 *HTTPError
+// 仅对 NewRequest 构造的请求生效
+func WithErrorOnStatus() Options {
+	return func(c *Client) {
+		c.errorOnStatus = true
+	}
+}
+
+// NewRequest 创建请求构造器
+func (h *Client) NewRequest(method, rawURL string) *Request {
+	return &Request{
+		client:        h,
+		ctx:           context.Background(),
+		method:        method,
+		url:           rawURL,
+		query:         make(url.Values),
+		header:        make(http.Header),
+		errorOnStatus: h.errorOnStatus,
+	}
+}
+
+// NewRequest 使用默认客户端创建请求构造器
+func NewRequest(method, rawURL string) *Request {
+	return DefaultClient.NewRequest(method, rawURL)
+}
+
+// WithContext 设置请求的 context
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx != nil {
+		r.ctx = ctx
+	}
+	return r
+}
+
+// SetMethod 设置请求方法
+func (r *Request) SetMethod(method string) *Request {
+	r.method = method
+	return r
+}
+
+// SetURL 设置请求地址
+func (r *Request) SetURL(rawURL string) *Request {
+	r.url = rawURL
+	return r
+}
+
+// SetQuery 设置查询参数，覆盖同名参数
+func (r *Request) SetQuery(key, value string) *Request {
+	r.query.Set(key, value)
+	return r
+}
+
+// AddQuery 追加查询参数
+func (r *Request) AddQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// SetQueries 批量设置查询参数
+func (r *Request) SetQueries(params map[string]string) *Request {
+	for key, value := range params {
+		r.query.Set(key, value)
+	}
+	return r
+}
+
+// SetHeader 设置请求头，覆盖客户端默认的同名请求头
+func (r *Request) SetHeader(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// SetHeaders 批量设置请求头
+func (r *Request) SetHeaders(headers map[string]string) *Request {
+	for key, value := range headers {
+		r.header.Set(key, value)
+	}
+	return r
+}
+
+// SetAuthorization 设置本次请求的 Authorization 头
+func (r *Request) SetAuthorization(auth string) *Request {
+	r.header.Set("Authorization", auth)
+	return r
+}
+
+// SetBody 设置请求体
+func (r *Request) SetBody(data []byte) *Request {
+	r.body = data
+	return r
+}
+
+// SetJSONBody 将 v 序列化为 JSON 作为请求体，并设置 JSON 的 Content-Type
+// 序列化失败的错误在 Do 时返回
+func (r *Request) SetJSONBody(v any) *Request {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.err = fmt.Errorf("http: marshal request body: %w", err)
+		return r
+	}
+	r.body = data
+	r.header.Set("Content-Type", string(JSON))
+	return r
+}
+
+// ErrorOnStatus 设置是否将非 2xx 响应转换为 *HTTPError
+func (r *Request) ErrorOnStatus(enable bool) *Request {
+	r.errorOnStatus = enable
+	return r
+}
+
+// Build 根据构造器的配置生成 *http.Request
+func (r *Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.query) > 0 {
+		q := u.Query()
+		for key, values := range r.query {
+			q[key] = values
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	request, err := http.NewRequestWithContext(r.ctx, r.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := r.client.contentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	request.Header.Set("Content-Type", string(contentType))
+	if r.client.authorization != "" {
+		request.Header.Set("Authorization", r.client.authorization)
+	}
+	for key, values := range r.header {
+		request.Header[key] = values
+	}
+	return request, nil
+}
+
+// Do 发送请求并读取完整的响应
+// 开启 ErrorOnStatus 时，非 2xx 响应会同时返回 Response 和 *HTTPError
+func (r *Request) Do() (*Response, error) {
+	request, err := r.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.client.do(request, r.errorOnStatus)
+}
+
+// DecodeJSON 将响应体解析为 T
+func DecodeJSON[T any](resp *Response) (T, error) {
+	var v T
+	if resp == nil {
+		return v, fmt.Errorf("http: decode nil response")
+	}
+	if err := json.Unmarshal(resp.Body, &v); err != nil {
+		return v, fmt.Errorf("http: decode response body: %w", err)
+	}
+	return v, nil
+}
+
+// DoJSON 发送请求并将响应体解析为 T，非 2xx 响应始终返回 *HTTPError
+func DoJSON[T any](r *Request) (T, error) {
+	var v T
+	resp, err := r.ErrorOnStatus(true).Do()
+	if err != nil {
+		return v, err
+	}
+	return DecodeJSON[T](resp)
+}
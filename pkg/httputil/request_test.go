@@ -0,0 +1,180 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRequestDo 测试请求构造器
+// 功能：方法、查询参数、请求头、请求体和响应内容
+func TestRequestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "1", r.URL.Query().Get("page"))
+		assert.Equal(t, []string{"a", "b"}, r.URL.Query()["tag"])
+		assert.Equal(t, "keep", r.URL.Query().Get("origin"))
+		assert.Equal(t, "trace-1", r.Header.Get("X-Trace-Id"))
+		assert.Equal(t, "Bearer per-call", r.Header.Get("Authorization"))
+		assert.Equal(t, string(JSON), r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"name":"test"}`, string(body))
+
+		w.Header().Set("X-Result", "ok")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(WithAuthorization("Bearer default"))
+	resp, err := client.NewRequest(http.MethodPost, server.URL+"?origin=keep").
+		WithContext(context.Background()).
+		SetQuery("page", "1").
+		AddQuery("tag", "a").
+		AddQuery("tag", "b").
+		SetHeader("X-Trace-Id", "trace-1").
+		SetAuthorization("Bearer per-call").
+		SetJSONBody(map[string]string{"name": "test"}).
+		Do()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.True(t, resp.IsSuccess())
+	assert.Equal(t, "ok", resp.Header.Get("X-Result"))
+	assert.Equal(t, `{"id":1}`, resp.String())
+}
+
+// TestRequestDefaults 测试请求构造器继承客户端的默认配置
+func TestRequestDefaults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "Bearer default", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/xml", r.Header.Get("Content-Type"))
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(WithAuthorization("Bearer default"), WithContentType("application/xml"))
+	resp, err := client.NewRequest(http.MethodGet, server.URL).Do()
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.String())
+}
+
+// TestRequestErrorOnStatus 测试非 2xx 响应转换为 HTTPError
+func TestRequestErrorOnStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"bad"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		client  *Client
+		enable  *bool
+		wantErr bool
+	}{
+		{name: "默认不检查状态码", client: NewHTTPClient(), wantErr: false},
+		{name: "客户端开启检查", client: NewHTTPClient(WithErrorOnStatus()), wantErr: true},
+		{name: "单次请求关闭检查", client: NewHTTPClient(WithErrorOnStatus()), enable: boolPtr(false), wantErr: false},
+		{name: "单次请求开启检查", client: NewHTTPClient(), enable: boolPtr(true), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.client.NewRequest(http.MethodGet, server.URL)
+			if tt.enable != nil {
+				req.ErrorOnStatus(*tt.enable)
+			}
+			resp, err := req.Do()
+			require.NotNil(t, resp)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.False(t, resp.IsSuccess())
+			if !tt.wantErr {
+				require.NoError(t, err)
+				return
+			}
+			var httpErr *HTTPError
+			require.True(t, errors.As(err, &httpErr))
+			assert.Equal(t, http.StatusBadRequest, httpErr.StatusCode)
+			assert.Equal(t, http.MethodGet, httpErr.Method)
+			assert.Equal(t, `{"error":"bad"}`, string(httpErr.Body))
+			assert.Contains(t, httpErr.Error(), "400")
+		})
+	}
+}
+
+// TestDoJSON 测试类型化的 JSON 解析
+func TestDoJSON(t *testing.T) {
+	type result struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	t.Run("解析成功", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"id":1,"name":"test"}`))
+		}))
+		defer server.Close()
+
+		got, err := DoJSON[result](NewHTTPClient().NewRequest(http.MethodGet, server.URL))
+		require.NoError(t, err)
+		assert.Equal(t, result{ID: 1, Name: "test"}, got)
+	})
+
+	t.Run("非 2xx 返回 HTTPError", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		_, err := DoJSON[result](NewHTTPClient().NewRequest(http.MethodGet, server.URL))
+		var httpErr *HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusInternalServerError, httpErr.StatusCode)
+	})
+
+	t.Run("响应体不是 JSON", func(t *testing.T) {
+		_, err := DecodeJSON[result](&Response{Body: []byte("not json")})
+		require.Error(t, err)
+		_, err = DecodeJSON[result](nil)
+		require.Error(t, err)
+	})
+}
+
+// TestRequestBuildError 测试构造请求失败的场景
+func TestRequestBuildError(t *testing.T) {
+	client := NewHTTPClient()
+
+	_, err := client.NewRequest(http.MethodPost, "http://example.com").SetJSONBody(make(chan int)).Do()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "marshal request body")
+
+	_, err = client.NewRequest(http.MethodGet, "://invalid").Do()
+	require.Error(t, err)
+}
+
+// TestRequestContext 测试请求的 context 控制
+func TestRequestContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := NewHTTPClient().NewRequest(http.MethodGet, server.URL).WithContext(ctx).Do()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,198 @@
+package http
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay    = 10 * time.Second
+	// maxDrainBodyLen 重试前最多读取并丢弃的响应体长度，便于复用连接
+	maxDrainBodyLen = 4 << 10
+)
+
+// RetryPolicy 重试策略
+// 网络错误、429 和 5xx 响应会按指数退避（full jitter）重试，
+// 响应携带 Retry-After 时优先使用服务端给出的等待时间，超过 MaxDelay 时不再重试，直接返回该响应。
+// 请求体不支持 GetBody 时（例如 io.Pipe 流式上传）不会重试，避免把整个请求体读入内存。
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数（包含第一次请求），默认 3
+	MaxAttempts int
+	// BaseDelay 退避的基础等待时间，默认 100ms
+	BaseDelay time.Duration
+	// MaxDelay 单次退避的最大等待时间，默认 10s
+	MaxDelay time.Duration
+	// RetryNonIdempotent 是否重试 POST、PATCH 等非幂等请求
+	// 未开启时只有携带 Idempotency-Key 请求头的非幂等请求会重试
+	RetryNonIdempotent bool
+	// ShouldRetry 自定义是否重试，为 nil 时使用默认规则
+	ShouldRetry func(resp *http.Response, err error) bool
+	// OnRetry 每次重试前回调
+	OnRetry func(attempt RetryAttempt)
+}
+
+// RetryAttempt 一次失败的尝试
+type RetryAttempt struct {
+	// Attempt 失败的是第几次尝试，从 1 开始
+	Attempt int
+	Request *http.Request
+	// StatusCode 响应状态码，网络错误时为 0
+	StatusCode int
+	Err        error
+	// Delay 下一次尝试前的等待时间
+	Delay time.Duration
+}
+
+// WithRetry 设置客户端的重试策略
+// 重试在 Transport 层完成，客户端的所有请求方法都会生效，
+// 注意 WithTimeout 设置的超时时间包含所有重试的耗时。
+func WithRetry(policy RetryPolicy) Options {
+	return func(c *Client) {
+		c.retry = &policy
+	}
+}
+
+// newRetryTransport 使用重试策略包装 Transport
+func newRetryTransport(base http.RoundTripper, policy RetryPolicy) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = defaultRetryBaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = defaultRetryMaxDelay
+	}
+	return &retryTransport{base: base, policy: policy}
+}
+
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.retryable(req) || !rewindable(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			// 重新读取请求体，RoundTripper 不应修改调用方的请求
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		if attempt >= t.policy.MaxAttempts || !t.shouldRetry(r, resp, err) {
+			return resp, err
+		}
+
+		delay, ok := t.backoff(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		if t.policy.OnRetry != nil {
+			info := RetryAttempt{Attempt: attempt, Request: r, Err: err, Delay: delay}
+			if resp != nil {
+				info.StatusCode = resp.StatusCode
+			}
+			t.policy.OnRetry(info)
+		}
+		if resp != nil {
+			io.CopyN(io.Discard, resp.Body, maxDrainBodyLen)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable 判断请求是否允许重试
+func (t *retryTransport) retryable(req *http.Request) bool {
+	if t.policy.RetryNonIdempotent {
+		return true
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if t.policy.ShouldRetry != nil {
+		return t.policy.ShouldRetry(resp, err)
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// backoff 计算第 attempt 次失败后的等待时间
+// Retry-After 超过 MaxDelay 时返回 false，表示不再重试
+func (t *retryTransport) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if delay, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return delay, delay <= t.policy.MaxDelay
+		}
+	}
+	ceiling := t.policy.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := t.policy.BaseDelay << shift; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1)), true
+}
+
+// ParseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式，now 用于计算 HTTP 日期的等待时间
+// 没有响应头或格式不合法时返回 false，HTTP 日期已经过去时返回 0
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// rewindable 判断请求体能否在重试时重新读取
+// http.NewRequest 对 bytes.Buffer、bytes.Reader、strings.Reader 会自动设置 GetBody
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
@@ -0,0 +1,261 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer 前 failures 次请求返回 status，之后返回 200
+func flakyServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *int32, *[]string) {
+	t.Helper()
+	var calls int32
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		if atomic.AddInt32(&calls, 1) <= failures {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(status)
+			w.Write([]byte("failed"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls, &bodies
+}
+
+// TestRetryPolicy 测试重试策略
+// 功能：5xx、429 重试，4xx 不重试，非幂等请求需要显式开启
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		status    int
+		failures  int32
+		policy    RetryPolicy
+		header    map[string]string
+		wantCalls int32
+		wantBody  string
+	}{
+		{
+			name:      "GET 5xx 重试后成功",
+			method:    http.MethodGet,
+			status:    http.StatusServiceUnavailable,
+			failures:  2,
+			policy:    RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			wantCalls: 3,
+			wantBody:  "ok",
+		},
+		{
+			name:      "429 重试",
+			method:    http.MethodGet,
+			status:    http.StatusTooManyRequests,
+			failures:  1,
+			policy:    RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			wantCalls: 2,
+			wantBody:  "ok",
+		},
+		{
+			name:      "超过最大次数返回最后一次响应",
+			method:    http.MethodGet,
+			status:    http.StatusBadGateway,
+			failures:  5,
+			policy:    RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+			wantCalls: 2,
+			wantBody:  "failed",
+		},
+		{
+			name:      "4xx 不重试",
+			method:    http.MethodGet,
+			status:    http.StatusBadRequest,
+			failures:  1,
+			policy:    RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			wantCalls: 1,
+			wantBody:  "failed",
+		},
+		{
+			name:      "POST 默认不重试",
+			method:    http.MethodPost,
+			status:    http.StatusInternalServerError,
+			failures:  1,
+			policy:    RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			wantCalls: 1,
+			wantBody:  "failed",
+		},
+		{
+			name:      "POST 开启非幂等重试",
+			method:    http.MethodPost,
+			status:    http.StatusInternalServerError,
+			failures:  1,
+			policy:    RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryNonIdempotent: true},
+			wantCalls: 2,
+			wantBody:  "ok",
+		},
+		{
+			name:      "POST 携带 Idempotency-Key 时重试",
+			method:    http.MethodPost,
+			status:    http.StatusInternalServerError,
+			failures:  1,
+			policy:    RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			header:    map[string]string{"Idempotency-Key": "abc"},
+			wantCalls: 2,
+			wantBody:  "ok",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls, bodies := flakyServer(t, tt.failures, tt.status, nil)
+			client := NewHTTPClient(WithRetry(tt.policy))
+
+			resp, err := client.NewRequest(tt.method, server.URL).
+				SetHeaders(tt.header).
+				SetBody([]byte("payload")).
+				Do()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, resp.String())
+			assert.Equal(t, tt.wantCalls, atomic.LoadInt32(calls))
+			for _, body := range *bodies {
+				assert.Equal(t, "payload", body, "每次尝试都应发送完整的请求体")
+			}
+		})
+	}
+}
+
+// TestRetryOnRetryHook 测试 OnRetry 回调和 Retry-After
+func TestRetryOnRetryHook(t *testing.T) {
+	server, _, _ := flakyServer(t, 2, http.StatusServiceUnavailable, http.Header{"Retry-After": {"0"}})
+
+	var attempts []RetryAttempt
+	client := NewHTTPClient(WithRetry(RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Hour,
+		OnRetry: func(attempt RetryAttempt) {
+			attempts = append(attempts, attempt)
+		},
+	}))
+
+	start := time.Now()
+	body, err := client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	assert.Less(t, time.Since(start), time.Second, "应使用 Retry-After 而不是 BaseDelay")
+
+	require.Len(t, attempts, 2)
+	for i, attempt := range attempts {
+		assert.Equal(t, i+1, attempt.Attempt)
+		assert.Equal(t, http.StatusServiceUnavailable, attempt.StatusCode)
+		assert.Equal(t, time.Duration(0), attempt.Delay)
+		assert.NotNil(t, attempt.Request)
+	}
+}
+
+// TestRetryNetworkError 测试网络错误重试
+func TestRetryNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	var retries int32
+	client := NewHTTPClient(WithRetry(RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		OnRetry: func(attempt RetryAttempt) {
+			atomic.AddInt32(&retries, 1)
+			assert.Error(t, attempt.Err)
+		},
+	}))
+
+	_, err := client.Get(url)
+	require.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&retries))
+}
+
+// TestRetryUnbufferedBody 测试不支持 GetBody 的请求体不会重试，也不会被读入内存
+func TestRetryUnbufferedBody(t *testing.T) {
+	server, calls, bodies := flakyServer(t, 1, http.StatusInternalServerError, nil)
+	client := NewHTTPClient(WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+
+	req, err := http.NewRequest(http.MethodPut, server.URL, io.NopCloser(strings.NewReader("stream")))
+	require.NoError(t, err)
+	require.Nil(t, req.GetBody)
+
+	resp, err := client.client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	assert.Equal(t, []string{"stream"}, *bodies)
+}
+
+// TestRetryAfterExceedsMaxDelay 测试 Retry-After 超过 MaxDelay 时直接返回响应
+func TestRetryAfterExceedsMaxDelay(t *testing.T) {
+	server, calls, _ := flakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"86400"}})
+	client := NewHTTPClient(WithRetry(RetryPolicy{MaxAttempts: 3, MaxDelay: time.Second}))
+
+	start := time.Now()
+	resp, err := client.client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// TestParseRetryAfter 测试 Retry-After 解析
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "空值", value: "", wantOK: false},
+		{name: "秒数", value: "5", want: 5 * time.Second, wantOK: true},
+		{name: "负数", value: "-1", wantOK: false},
+		{name: "HTTP 日期", value: now.Add(10 * time.Second).Format(http.TimeFormat), want: 10 * time.Second, wantOK: true},
+		{name: "过去的日期", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+		{name: "非法值", value: "soon", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRetryAfter(tt.value, now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestRetryBackoff 测试指数退避的上限
+func TestRetryBackoff(t *testing.T) {
+	rt := newRetryTransport(nil, RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 40 * time.Millisecond}).(*retryTransport)
+	for attempt := 1; attempt <= 10; attempt++ {
+		ceiling := 10 * time.Millisecond << (attempt - 1)
+		if ceiling > 40*time.Millisecond {
+			ceiling = 40 * time.Millisecond
+		}
+		for i := 0; i < 20; i++ {
+			delay, ok := rt.backoff(attempt, nil)
+			assert.True(t, ok)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, ceiling)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// partialSuffix 下载过程中临时文件的后缀，下载完成并校验通过后重命名为目标文件
+const partialSuffix = ".part"
+
+// partialMetaSuffix 临时文件对应的远端文件校验信息（ETag 或 Last-Modified）的文件后缀，续传时作为 If-Range 发送
+const partialMetaSuffix = ".part.meta"
+
+// ErrChecksumMismatch 下载文件的 SHA-256 与期望值不一致
+var ErrChecksumMismatch = errors.New("http: checksum mismatch")
+
+// ProgressFunc 传输进度回调，transferred 为已传输的字节数，total 未知时为 -1
+// 可以直接驱动进度条，例如：
+//
+//	bar := progressbar.DefaultBytes(-1)
+//	WithProgress(func(transferred, total int64) {
+//		bar.ChangeMax64(total)
+//		bar.Set64(transferred)
+//	})
+type ProgressFunc func(transferred, total int64)
+
+// TransferOption 上传和下载的配置选项
+type TransferOption func(*transferConfig)
+
+type transferConfig struct {
+	progress ProgressFunc
+	writer   io.Writer
+	sha256   string
+	noResume bool
+	header   map[string]string
+}
+
+// WithProgress 设置传输进度回调
+func WithProgress(fn ProgressFunc) TransferOption {
+	return func(c *transferConfig) {
+		c.progress = fn
+	}
+}
+
+// WithProgressWriter 将传输的数据同时写入 w，用于兼容实现了 io.Writer 的进度条
+// 例如 progressbar.ProgressBar 每次 Write 会按写入的字节数增加进度
+func WithProgressWriter(w io.Writer) TransferOption {
+	return func(c *transferConfig) {
+		c.writer = w
+	}
+}
+
+// WithSHA256 设置下载文件期望的 SHA-256（十六进制），下载完成后校验
+func WithSHA256(sum string) TransferOption {
+	return func(c *transferConfig) {
+		c.sha256 = strings.ToLower(strings.TrimSpace(sum))
+	}
+}
+
+// WithoutResume 关闭断点续传，总是从头下载
+func WithoutResume() TransferOption {
+	return func(c *transferConfig) {
+		c.noResume = true
+	}
+}
+
+// WithTransferHeaders 设置上传或下载请求的请求头
+func WithTransferHeaders(headers map[string]string) TransferOption {
+	return func(c *transferConfig) {
+		c.header = headers
+	}
+}
+
+func applyTransferOptions(opts []TransferOption) *transferConfig {
+	cfg := &transferConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// progressReader 在读取时上报进度
+type progressReader struct {
+	r           io.Reader
+	cfg         *transferConfig
+	transferred int64
+	total       int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.transferred += int64(n)
+		if p.cfg.writer != nil {
+			p.cfg.writer.Write(b[:n])
+		}
+		if p.cfg.progress != nil {
+			p.cfg.progress(p.transferred, p.total)
+		}
+	}
+	return n, err
+}
+
+// FormFile multipart 表单中的文件
+// Path 和 Reader 二选一，使用 Path 时上传失败可以重新打开文件重试
+type FormFile struct {
+	FieldName string
+	// FileName 为空时使用 Path 的文件名
+	FileName string
+	Path     string
+	Reader   io.Reader
+}
+
+// MultipartForm multipart/form-data 请求体
+type MultipartForm struct {
+	Fields map[string]string
+	Files  []FormFile
+}
+
+// size 返回表单中文件的总大小，包含无法获取大小的 Reader 时返回 -1
+func (f *MultipartForm) size() int64 {
+	var total int64
+	for _, file := range f.Files {
+		if file.Path == "" {
+			return -1
+		}
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			return -1
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+// replayable 表单中的文件是否都可以重新打开
+func (f *MultipartForm) replayable() bool {
+	for _, file := range f.Files {
+		if file.Path == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// open 打开表单中的所有文件
+func (f *MultipartForm) open() ([]io.Reader, func(), error) {
+	readers := make([]io.Reader, 0, len(f.Files))
+	var files []*os.File
+	closeAll := func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+	for _, ff := range f.Files {
+		if ff.Path == "" {
+			if ff.Reader == nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("http: form file %q has neither path nor reader", ff.FieldName)
+			}
+			readers = append(readers, ff.Reader)
+			continue
+		}
+		file, err := os.Open(ff.Path)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, file)
+		readers = append(readers, file)
+	}
+	return readers, closeAll, nil
+}
+
+// pipe 通过 io.Pipe 流式写出 multipart 请求体，不会把文件读入内存
+func (f *MultipartForm) pipe(boundary string, cfg *transferConfig) (io.ReadCloser, error) {
+	readers, closeAll, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	if err = writer.SetBoundary(boundary); err != nil {
+		closeAll()
+		return nil, err
+	}
+	go func() {
+		defer closeAll()
+		pw.CloseWithError(f.write(writer, readers, cfg))
+	}()
+	return pr, nil
+}
+
+func (f *MultipartForm) write(writer *multipart.Writer, readers []io.Reader, cfg *transferConfig) error {
+	for key, value := range f.Fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	progress := &progressReader{cfg: cfg, total: f.size()}
+	for i, file := range f.Files {
+		name := file.FileName
+		if name == "" {
+			name = filepath.Base(file.Path)
+		}
+		part, err := writer.CreateFormFile(file.FieldName, name)
+		if err != nil {
+			return err
+		}
+		progress.r = readers[i]
+		if _, err = io.Copy(part, progress); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// PostMultipart 以 multipart/form-data 流式上传多个文件和字段
+// 请求体通过 io.Pipe 边读边发送；所有文件都通过 Path 指定时，开启重试后可以重新上传
+func (h *Client) PostMultipart(ctx context.Context, url string, form MultipartForm, opts ...TransferOption) (*Response, error) {
+	cfg := applyTransferOptions(opts)
+	// 固定 boundary，重试时重新生成的请求体与 Content-Type 保持一致
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	body, err := form.pipe(boundary, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	if form.replayable() {
+		request.GetBody = func() (io.ReadCloser, error) {
+			return form.pipe(boundary, cfg)
+		}
+	}
+	request.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	if h.authorization != "" {
+		request.Header.Set("Authorization", h.authorization)
+	}
+	for key, value := range cfg.header {
+		request.Header.Set(key, value)
+	}
+	return h.do(request, false)
+}
+
+// do 发送请求并读取完整的响应
+func (h *Client) do(request *http.Request, errorOnStatus bool) (*Response, error) {
+	res, err := h.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp := &Response{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Header:     res.Header,
+		Body:       body,
+		Request:    request,
+	}
+	if errorOnStatus && !resp.IsSuccess() {
+		return resp, newHTTPError(resp)
+	}
+	return resp, nil
+}
+
+// Download 下载文件到 dst
+// 下载过程中数据写入 dst + ".part"，远端文件的 ETag 或 Last-Modified 写入 dst + ".part.meta"。
+// 再次下载时通过 Range 和 If-Range 请求从已下载的位置继续，远端文件已经变化或服务端不支持 Range 时从头下载；
+// 没有校验信息的临时文件无法确认与远端文件一致，直接丢弃。设置 WithSHA256 时校验整个文件，校验失败会删除临时文件。
+func (h *Client) Download(ctx context.Context, url, dst string, opts ...TransferOption) error {
+	cfg := applyTransferOptions(opts)
+	partPath := dst + partialSuffix
+	metaPath := dst + partialMetaSuffix
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	var offset int64
+	var validator string
+	if !cfg.noResume {
+		if info, err := os.Stat(partPath); err == nil {
+			if data, err := os.ReadFile(metaPath); err == nil {
+				validator = strings.TrimSpace(string(data))
+			}
+			if validator != "" {
+				offset = info.Size()
+			}
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if h.authorization != "" {
+		request.Header.Set("Authorization", h.authorization)
+	}
+	for key, value := range cfg.header {
+		request.Header.Set(key, value)
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		request.Header.Set("If-Range", validator)
+	}
+
+	res, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	total := res.ContentLength
+	switch {
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		start, size, ok := parseContentRange(res.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return fmt.Errorf("http: download %s: unexpected Content-Range %q", url, res.Header.Get("Content-Range"))
+		}
+		flag = os.O_WRONLY | os.O_APPEND
+		total = size
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// 临时文件可能已经下载完整
+		if _, size, ok := parseContentRange(res.Header.Get("Content-Range")); ok && size == offset {
+			return finishDownload(partPath, dst, cfg)
+		}
+		os.Remove(partPath)
+		os.Remove(metaPath)
+		return fmt.Errorf("http: download %s: range not satisfiable, partial file removed", url)
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		// 服务端忽略了 Range 或者 If-Range 不匹配（远端文件已经变化），从头写入
+		offset = 0
+	default:
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodyLen))
+		return newHTTPError(&Response{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     res.Header,
+			Body:       body,
+			Request:    request,
+		})
+	}
+
+	// 先记录本次响应的校验信息，下载中断后据此判断能否续传
+	if validator = responseValidator(res.Header); validator != "" {
+		err = os.WriteFile(metaPath, []byte(validator), 0o644)
+	} else {
+		err = os.Remove(metaPath)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(partPath, flag, 0o644)
+	if err != nil {
+		return err
+	}
+	progress := &progressReader{r: res.Body, cfg: cfg, transferred: offset, total: total}
+	if total < 0 && res.ContentLength >= 0 {
+		progress.total = offset + res.ContentLength
+	}
+	if cfg.progress != nil {
+		cfg.progress(progress.transferred, progress.total)
+	}
+	_, err = io.Copy(file, progress)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// 保留临时文件，下次下载时继续
+		return err
+	}
+	return finishDownload(partPath, dst, cfg)
+}
+
+// finishDownload 校验临时文件并重命名为目标文件，同时删除校验信息文件
+func finishDownload(partPath, dst string, cfg *transferConfig) error {
+	metaPath := dst + partialMetaSuffix
+	if cfg.sha256 != "" {
+		sum, err := fileSHA256(partPath)
+		if err != nil {
+			return err
+		}
+		if sum != cfg.sha256 {
+			os.Remove(partPath)
+			os.Remove(metaPath)
+			return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, cfg.sha256, sum)
+		}
+	}
+	if err := os.Rename(partPath, dst); err != nil {
+		return err
+	}
+	os.Remove(metaPath)
+	return nil
+}
+
+// responseValidator 返回可以用作 If-Range 的校验信息，优先使用强 ETag，其次使用 Last-Modified
+// 弱 ETag 不能用于 If-Range
+func responseValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseContentRange 解析 Content-Range 响应头，返回起始位置和文件总大小
+// 支持 "bytes 100-199/200"、"bytes 100-199/*" 和 "bytes */200" 三种格式，总大小未知时为 -1
+func parseContentRange(value string) (start, size int64, ok bool) {
+	value, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, sizeStr, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+	size = -1
+	if sizeStr != "*" {
+		var err error
+		if size, err = strconv.ParseInt(sizeStr, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if rng == "*" {
+		return 0, size, true
+	}
+	startStr, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
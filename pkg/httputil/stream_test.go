@@ -0,0 +1,334 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostMultipart 测试流式上传多个文件和字段
+func TestPostMultipart(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a.txt")
+	require.NoError(t, os.WriteFile(pathA, []byte("hello"), 0o644))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "v1", r.FormValue("k1"))
+
+		var sb strings.Builder
+		for _, field := range []string{"a", "b"} {
+			file, header, err := r.FormFile(field)
+			require.NoError(t, err)
+			data, _ := io.ReadAll(file)
+			file.Close()
+			sb.WriteString(header.Filename + "=" + string(data) + ";")
+		}
+		w.Write([]byte(sb.String()))
+	}))
+	defer server.Close()
+
+	var last atomic.Int64
+	client := NewHTTPClient(WithAuthorization("Bearer token"))
+	resp, err := client.PostMultipart(context.Background(), server.URL, MultipartForm{
+		Fields: map[string]string{"k1": "v1"},
+		Files: []FormFile{
+			{FieldName: "a", Path: pathA},
+			{FieldName: "b", FileName: "b.bin", Reader: strings.NewReader("world!")},
+		},
+	}, WithProgress(func(transferred, total int64) {
+		// 包含 Reader 时无法预知总大小
+		assert.Equal(t, int64(-1), total)
+		last.Store(transferred)
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "a.txt=hello;b.bin=world!;", resp.String())
+	assert.Equal(t, int64(11), last.Load())
+}
+
+// TestPostMultipartRetry 测试通过 Path 上传的文件在重试时重新发送
+func TestPostMultipartRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	require.NoError(t, os.WriteFile(path, []byte("payload"), 0o644))
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "payload", string(data))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(WithRetry(RetryPolicy{
+		MaxAttempts:        2,
+		BaseDelay:          time.Millisecond,
+		RetryNonIdempotent: true,
+	}))
+	resp, err := client.PostMultipart(context.Background(), server.URL, MultipartForm{
+		Files: []FormFile{{FieldName: "file", Path: path}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+// TestPostMultipartError 测试上传参数错误
+func TestPostMultipartError(t *testing.T) {
+	client := NewHTTPClient()
+	_, err := client.PostMultipart(context.Background(), "http://example.invalid", MultipartForm{
+		Files: []FormFile{{FieldName: "file"}},
+	})
+	require.Error(t, err)
+
+	_, err = client.PostMultipart(context.Background(), "http://example.invalid", MultipartForm{
+		Files: []FormFile{{FieldName: "file", Path: "/nonexistent/file"}},
+	})
+	require.Error(t, err)
+}
+
+// rangeServer 支持 Range 请求的文件服务，记录收到的 Range 头
+func rangeServer(t *testing.T, content []byte, ranges *[]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", testETag)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testETag rangeServer 返回的 ETag
+const testETag = `"v1"`
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestDownload 测试下载、断点续传和校验
+func TestDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	tests := []struct {
+		name    string
+		partial []byte
+		// validator 临时文件的校验信息，为空时不写入校验信息文件
+		validator string
+		opts      []TransferOption
+		wantRange string
+		wantErr   error
+	}{
+		{
+			name:      "完整下载",
+			opts:      []TransferOption{WithSHA256(sha256Hex(content))},
+			wantRange: "",
+		},
+		{
+			name:      "断点续传",
+			partial:   content[:300],
+			validator: testETag,
+			opts:      []TransferOption{WithSHA256(strings.ToUpper(sha256Hex(content)))},
+			wantRange: "bytes=300-",
+		},
+		{
+			name:      "临时文件已完整",
+			partial:   content,
+			validator: testETag,
+			wantRange: "bytes=1000-",
+		},
+		{
+			name:      "远端文件已变化",
+			partial:   []byte("old content"),
+			validator: `"v0"`,
+			wantRange: "bytes=11-",
+		},
+		{
+			name:      "临时文件没有校验信息",
+			partial:   []byte("unknown"),
+			wantRange: "",
+		},
+		{
+			name:      "关闭断点续传",
+			partial:   []byte("garbage"),
+			validator: testETag,
+			opts:      []TransferOption{WithoutResume()},
+			wantRange: "",
+		},
+		{
+			name:    "校验失败",
+			opts:    []TransferOption{WithSHA256(sha256Hex([]byte("other")))},
+			wantErr: ErrChecksumMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges []string
+			server := rangeServer(t, content, &ranges)
+			dst := filepath.Join(t.TempDir(), "sub", "file.bin")
+			if tt.partial != nil {
+				require.NoError(t, os.MkdirAll(filepath.Dir(dst), 0o755))
+				require.NoError(t, os.WriteFile(dst+partialSuffix, tt.partial, 0o644))
+			}
+			if tt.validator != "" {
+				require.NoError(t, os.WriteFile(dst+partialMetaSuffix, []byte(tt.validator), 0o644))
+			}
+
+			err := NewHTTPClient().Download(context.Background(), server.URL, dst, tt.opts...)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.NoFileExists(t, dst)
+				assert.NoFileExists(t, dst+partialSuffix)
+				assert.NoFileExists(t, dst+partialMetaSuffix)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{tt.wantRange}, ranges)
+
+			data, err := os.ReadFile(dst)
+			require.NoError(t, err)
+			assert.Equal(t, content, data)
+			assert.NoFileExists(t, dst+partialSuffix)
+			assert.NoFileExists(t, dst+partialMetaSuffix)
+		})
+	}
+}
+
+// TestDownloadProgress 测试下载进度从已下载的位置开始上报
+func TestDownloadProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	var ranges []string
+	server := rangeServer(t, content, &ranges)
+	dst := filepath.Join(t.TempDir(), "file.bin")
+	require.NoError(t, os.WriteFile(dst+partialSuffix, content[:1000], 0o644))
+	require.NoError(t, os.WriteFile(dst+partialMetaSuffix, []byte(testETag), 0o644))
+
+	var reports [][2]int64
+	var written bytes.Buffer
+	err := NewHTTPClient().Download(context.Background(), server.URL, dst,
+		WithProgress(func(transferred, total int64) {
+			reports = append(reports, [2]int64{transferred, total})
+		}),
+		WithProgressWriter(&written),
+	)
+	require.NoError(t, err)
+	require.NotEmpty(t, reports)
+	assert.Equal(t, [2]int64{1000, 4096}, reports[0])
+	assert.Equal(t, [2]int64{4096, 4096}, reports[len(reports)-1])
+	assert.Equal(t, 3096, written.Len())
+}
+
+// TestDownloadInterrupted 测试下载中断后保留临时文件和校验信息，再次下载时带 If-Range 续传
+func TestDownloadInterrupted(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", testETag)
+		w.Header().Set("Content-Length", "1000")
+		w.Write(content[:300])
+	}))
+	defer broken.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.bin")
+	require.Error(t, NewHTTPClient().Download(context.Background(), broken.URL, dst))
+	data, err := os.ReadFile(dst + partialSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, content[:300], data)
+	meta, err := os.ReadFile(dst + partialMetaSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, testETag, string(meta))
+
+	var ifRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifRange = r.Header.Get("If-Range")
+		w.Header().Set("ETag", testETag)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	require.NoError(t, NewHTTPClient().Download(context.Background(), server.URL, dst))
+	assert.Equal(t, testETag, ifRange)
+	data, err = os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
+
+// TestDownloadIgnoreRange 测试服务端忽略 Range 时从头下载
+func TestDownloadIgnoreRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("full content"))
+	}))
+	defer server.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(dst+partialSuffix, []byte("full"), 0o644))
+	require.NoError(t, os.WriteFile(dst+partialMetaSuffix, []byte(testETag), 0o644))
+
+	require.NoError(t, NewHTTPClient().Download(context.Background(), server.URL, dst))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "full content", string(data))
+}
+
+// TestDownloadHTTPError 测试非 2xx 响应返回 *HTTPError
+func TestDownloadHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.txt")
+	err := NewHTTPClient().Download(context.Background(), server.URL, dst)
+	var httpErr *HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+	assert.NoFileExists(t, dst)
+}
+
+// TestParseContentRange 测试 Content-Range 解析
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantStart int64
+		wantSize  int64
+		wantOK    bool
+	}{
+		{value: "bytes 100-199/200", wantStart: 100, wantSize: 200, wantOK: true},
+		{value: "bytes 100-199/*", wantStart: 100, wantSize: -1, wantOK: true},
+		{value: "bytes */200", wantStart: 0, wantSize: 200, wantOK: true},
+		{value: "items 0-1/2"},
+		{value: "bytes 100-199"},
+		{value: "bytes x-199/200"},
+		{value: "bytes 0-1/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			start, size, ok := parseContentRange(tt.value)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.wantStart, start)
+				assert.Equal(t, tt.wantSize, size)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// ruletest 对 Prometheus 告警规则和记录规则做单元测试，测试文件格式与 promtool test rules 相同
+//
+// 用法：
+//
+//	ruletest [flags] test-file ...
+//
+// 退出码：0 全部通过，1 存在没有通过的测试，2 参数错误或测试文件、规则文件有误。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.piwriw.go-tools/pkg/prom"
+)
+
+// 退出码
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 执行命令并返回退出码
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ruletest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: ruletest [flags] test-file ...")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Runs Prometheus rule unit tests written in the promtool test rules format.")
+		fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	runPattern := fs.String("run", "", "only run test groups whose name matches the regular expression")
+	lookbackDelta := fs.Duration("lookback-delta", 5*time.Minute, "lookback delta of instant selectors")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts := []prom.RuleTestOption{
+		prom.WithRuleTestEvaluatorOptions(prom.WithLookbackDelta(*lookbackDelta)),
+	}
+	if *runPattern != "" {
+		re, err := regexp.Compile(*runPattern)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid -run: %v\n", err)
+			return exitUsage
+		}
+		opts = append(opts, prom.WithRunPattern(re))
+	}
+
+	code := exitOK
+	for _, path := range fs.Args() {
+		fmt.Fprintln(stdout, "Unit testing", path)
+		report, err := prom.RunRuleTestFile(context.Background(), path, opts...)
+		if err != nil {
+			fmt.Fprintf(stdout, "  ERROR: %v\n\n", err)
+			code = exitUsage
+			continue
+		}
+		if !report.Failed() {
+			fmt.Fprintf(stdout, "  SUCCESS (%d test groups)\n\n", len(report.Results))
+			continue
+		}
+		fmt.Fprintln(stdout, "  FAILED:")
+		writeReport(stdout, report)
+		fmt.Fprintln(stdout)
+		if code == exitOK {
+			code = exitFailed
+		}
+	}
+	return code
+}
+
+// writeReport 输出没有通过的测试组
+func writeReport(w io.Writer, report *prom.RuleTestReport) {
+	for _, res := range report.Results {
+		if !res.Failed() {
+			continue
+		}
+		fmt.Fprintf(w, "    %s:\n", res.Name)
+		if res.Err != nil {
+			fmt.Fprintf(w, "      error: %v\n", res.Err)
+		}
+		for _, f := range res.Failures {
+			fmt.Fprintln(w, indent(f.String(), "      "))
+		}
+	}
+}
+
+// indent 在每一行前添加 prefix
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+groups:
+  - name: api
+    rules:
+      - alert: InstanceDown
+        expr: up == 0
+        for: 1m
+        labels:
+          severity: page
+`
+
+// writeFiles 在临时目录中写入规则文件和测试文件，返回测试文件路径
+func writeFiles(t *testing.T, tests string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rules.yml"), []byte(testRules), 0o600))
+	path := filepath.Join(dir, "tests.yml")
+	require.NoError(t, os.WriteFile(path, []byte(tests), 0o600))
+	return path
+}
+
+func TestRun(t *testing.T) {
+	passing := writeFiles(t, `
+rule_files: [rules.yml]
+tests:
+  - name: down
+    input_series:
+      - series: 'up{instance="a"}'
+        values: '0 0 0'
+    alert_rule_test:
+      - eval_time: 2m
+        alertname: InstanceDown
+        exp_alerts:
+          - exp_labels: {instance: a, severity: page}
+  - name: up
+    input_series:
+      - series: 'up{instance="a"}'
+        values: '1 1 1'
+    alert_rule_test:
+      - eval_time: 2m
+        alertname: InstanceDown
+`)
+	failing := writeFiles(t, `
+rule_files: [rules.yml]
+tests:
+  - name: down
+    input_series:
+      - series: 'up{instance="a"}'
+        values: '0 0 0'
+    alert_rule_test:
+      - eval_time: 2m
+        alertname: InstanceDown
+`)
+
+	tests := []struct {
+		name     string   // 测试用例名称
+		args     []string // 命令行参数
+		code     int      // 期望的退出码
+		expected string   // 期望的标准输出
+	}{
+		{
+			name:     "Success",
+			args:     []string{passing},
+			code:     exitOK,
+			expected: "Unit testing " + passing + "\n  SUCCESS (2 test groups)\n\n",
+		},
+		{
+			name:     "Run pattern",
+			args:     []string{"-run", "^up$", passing},
+			code:     exitOK,
+			expected: "Unit testing " + passing + "\n  SUCCESS (1 test groups)\n\n",
+		},
+		{
+			name: "Failure",
+			args: []string{failing, passing},
+			code: exitFailed,
+			expected: "Unit testing " + failing + "\n  FAILED:\n    down:\n" +
+				"      alertname: InstanceDown, time: 2m\n" +
+				"      + {alertname=\"InstanceDown\", instance=\"a\", severity=\"page\"} annotations={}\n\n" +
+				"Unit testing " + passing + "\n  SUCCESS (2 test groups)\n\n",
+		},
+		{
+			name:     "Missing file",
+			args:     []string{"missing.yml"},
+			code:     exitUsage,
+			expected: "Unit testing missing.yml\n  ERROR: open missing.yml: no such file or directory\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(tt.args, &stdout, &stderr)
+			assert.Equal(t, tt.code, code, stderr.String())
+			assert.Equal(t, tt.expected, stdout.String())
+		})
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitUsage, run(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: ruletest")
+
+	stderr.Reset()
+	assert.Equal(t, exitUsage, run([]string{"-run", "(", "tests.yml"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "invalid -run")
+}
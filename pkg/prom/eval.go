@@ -0,0 +1,384 @@
+package prom
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/teststorage"
+)
+
+const (
+	// defaultLookbackDelta 与 Prometheus 默认的 --query.lookback-delta 相同
+	defaultLookbackDelta = 5 * time.Minute
+	// defaultMaxSamples 与 Prometheus 默认的 --query.max-samples 相同
+	defaultMaxSamples = 50000000
+	// defaultSubqueryInterval 子查询没有指定步长时的评估间隔，与 Prometheus 默认的 evaluation_interval 相同
+	defaultSubqueryInterval = time.Minute
+
+	// loadCommand 单元测试格式中加载数据的命令
+	loadCommand = "load"
+	// openMetricsContentType OpenMetrics 文本格式
+	openMetricsContentType = "application/openmetrics-text"
+	// promTextContentType Prometheus 文本格式
+	promTextContentType = "text/plain"
+	// openMetricsEOF OpenMetrics 文本以 # EOF 结尾
+	openMetricsEOF = "# EOF"
+)
+
+// Evaluator 在本地存储上执行 PromQL，不需要 Prometheus 服务
+// 用于在 CI 中对告警规则和面板查询做单元测试
+type Evaluator struct {
+	storage *teststorage.TestStorage
+	engine  *promql.Engine
+
+	start         time.Time
+	lookbackDelta time.Duration
+	maxSamples    int
+	timeout       time.Duration
+	subquery      time.Duration
+}
+
+type EvaluatorOption func(*Evaluator)
+
+// WithStartTime 设置加载数据的起始时间，默认为 Unix 零点，与 promtool 的单元测试相同
+func WithStartTime(start time.Time) EvaluatorOption {
+	return func(e *Evaluator) {
+		e.start = start
+	}
+}
+
+// WithLookbackDelta 设置瞬时选择器的回溯时间，默认 5m
+func WithLookbackDelta(delta time.Duration) EvaluatorOption {
+	return func(e *Evaluator) {
+		if delta <= 0 {
+			return
+		}
+		e.lookbackDelta = delta
+	}
+}
+
+// WithMaxSamples 设置单个查询最多加载的样本数，默认 50000000
+func WithMaxSamples(maxSamples int) EvaluatorOption {
+	return func(e *Evaluator) {
+		if maxSamples <= 0 {
+			return
+		}
+		e.maxSamples = maxSamples
+	}
+}
+
+// WithEvalTimeout 设置查询超时时间，默认 15s
+func WithEvalTimeout(timeout time.Duration) EvaluatorOption {
+	return func(e *Evaluator) {
+		if timeout <= 0 {
+			return
+		}
+		e.timeout = timeout
+	}
+}
+
+// WithSubqueryInterval 设置子查询没有指定步长时的评估间隔，默认 1m
+func WithSubqueryInterval(interval time.Duration) EvaluatorOption {
+	return func(e *Evaluator) {
+		if interval <= 0 {
+			return
+		}
+		e.subquery = interval
+	}
+}
+
+// NewEvaluator 创建 Evaluator，使用完需要调用 Close 删除本地存储
+func NewEvaluator(opts ...EvaluatorOption) (*Evaluator, error) {
+	e := &Evaluator{
+		start:         time.Unix(0, 0).UTC(),
+		lookbackDelta: defaultLookbackDelta,
+		maxSamples:    defaultMaxSamples,
+		timeout:       defaultQueryTimeout,
+		subquery:      defaultSubqueryInterval,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	stor, err := teststorage.NewWithError()
+	if err != nil {
+		return nil, err
+	}
+	e.storage = stor
+	e.engine = promql.NewEngine(promql.EngineOpts{
+		MaxSamples:    e.maxSamples,
+		Timeout:       e.timeout,
+		LookbackDelta: e.lookbackDelta,
+		NoStepSubqueryIntervalFn: func(int64) int64 {
+			return e.subquery.Milliseconds()
+		},
+		EnableAtModifier:     true,
+		EnableNegativeOffset: true,
+	})
+	return e, nil
+}
+
+// Close 关闭并删除本地存储
+func (e *Evaluator) Close() error {
+	return e.storage.Close()
+}
+
+// Time 返回起始时间之后 offset 的时间，用于指定查询时间，例如 e.Time(5*time.Minute)
+func (e *Evaluator) Time(offset time.Duration) time.Time {
+	return e.start.Add(offset)
+}
+
+// Load 按 Prometheus 单元测试的 load 格式加载序列，第 i 个值的时间为起始时间加 i 个间隔
+//
+//	load 1m
+//	    http_requests_total{job="api"} 0+10x10
+//	    up{job="api"} 1 1 _ 0 stale
+//
+// 支持 promtool 的展开写法、_ 表示缺失、stale 表示过期标记和原生直方图 {{schema:0 sum:1 count:1}}
+func (e *Evaluator) Load(input string) error {
+	app := e.storage.Appender(context.Background())
+	if err := e.load(app, input); err != nil {
+		return errors.Join(err, app.Rollback())
+	}
+	return app.Commit()
+}
+
+func (e *Evaluator) load(app storage.Appender, input string) error {
+	var interval time.Duration
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Fields(line); fields[0] == loadCommand {
+			if len(fields) != 2 {
+				return fmt.Errorf("line %d: invalid load command %q", lineNum, line)
+			}
+			step, err := prommodel.ParseDuration(fields[1])
+			if err != nil {
+				return fmt.Errorf("line %d: invalid load interval %q: %w", lineNum, fields[1], err)
+			}
+			if step <= 0 {
+				return fmt.Errorf("line %d: load interval must be positive", lineNum)
+			}
+			interval = time.Duration(step)
+			continue
+		}
+		if interval == 0 {
+			return fmt.Errorf("line %d: series defined before load command", lineNum)
+		}
+		lset, values, err := parser.ParseSeriesDesc(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		for i, v := range values {
+			if v.Omitted {
+				continue
+			}
+			ts := e.Time(time.Duration(i) * interval).UnixMilli()
+			if v.Histogram != nil {
+				_, err = app.AppendHistogram(0, lset, ts, nil, v.Histogram)
+			} else {
+				_, err = app.Append(0, lset, ts, v.Value)
+			}
+			if err != nil {
+				return fmt.Errorf("line %d: append %s: %w", lineNum, lset, err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadOpenMetrics 加载 OpenMetrics 文本格式的样本，没有以 # EOF 结尾时按 Prometheus 文本格式解析
+// 样本没有时间戳时使用 ts，可以多次调用加载不同时间的采集结果
+func (e *Evaluator) LoadOpenMetrics(data []byte, ts time.Time) error {
+	contentType := promTextContentType
+	if strings.HasSuffix(strings.TrimSpace(string(data)), openMetricsEOF) {
+		contentType = openMetricsContentType
+	}
+	p, err := textparse.New(data, contentType, "", false, false, labels.NewSymbolTable())
+	if err != nil {
+		return err
+	}
+
+	app := e.storage.Appender(context.Background())
+	if err := appendExposition(app, p, ts.UnixMilli()); err != nil {
+		return errors.Join(err, app.Rollback())
+	}
+	return app.Commit()
+}
+
+// appendExposition 将解析器中的样本写入存储
+func appendExposition(app storage.Appender, p textparse.Parser, defaultTs int64) error {
+	for {
+		entry, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("parse exposition: %w", err)
+		}
+
+		var lset labels.Labels
+		switch entry {
+		case textparse.EntrySeries:
+			_, ts, v := p.Series()
+			p.Metric(&lset)
+			_, err = app.Append(0, lset, timestampOr(ts, defaultTs), v)
+		case textparse.EntryHistogram:
+			_, ts, h, fh := p.Histogram()
+			p.Metric(&lset)
+			_, err = app.AppendHistogram(0, lset, timestampOr(ts, defaultTs), h, fh)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("append %s: %w", lset, err)
+		}
+	}
+}
+
+func timestampOr(ts *int64, defaultTs int64) int64 {
+	if ts != nil {
+		return *ts
+	}
+	return defaultTs
+}
+
+// Query 在 ts 执行即时查询
+func (e *Evaluator) Query(ctx context.Context, query string, ts time.Time) (*ResPromQL, error) {
+	q, err := e.engine.NewInstantQuery(ctx, e.storage, nil, query, ts)
+	if err != nil {
+		return nil, err
+	}
+	return e.exec(ctx, q)
+}
+
+// QueryRange 执行范围查询，结果为 Matrix
+func (e *Evaluator) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*ResPromQL, error) {
+	if step <= 0 {
+		return nil, errors.New("step must be positive")
+	}
+	q, err := e.engine.NewRangeQuery(ctx, e.storage, nil, query, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	return e.exec(ctx, q)
+}
+
+func (e *Evaluator) exec(ctx context.Context, q promql.Query) (*ResPromQL, error) {
+	defer q.Close()
+	res := q.Exec(ctx)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if warnings, _ := res.Warnings.AsStrings(q.String(), 0, 0); len(warnings) > 0 {
+		slog.Warn("Evaluator Query Warnings INFO", slog.Any("warnings", warnings))
+	}
+	value, err := convertValue(res.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &ResPromQL{value}, nil
+}
+
+// convertValue 将引擎的结果转换为 API 客户端使用的类型
+func convertValue(v parser.Value) (prommodel.Value, error) {
+	switch v := v.(type) {
+	case promql.Scalar:
+		return &prommodel.Scalar{Value: prommodel.SampleValue(v.V), Timestamp: prommodel.Time(v.T)}, nil
+	case promql.String:
+		return &prommodel.String{Value: v.V, Timestamp: prommodel.Time(v.T)}, nil
+	case promql.Vector:
+		vec := make(prommodel.Vector, 0, len(v))
+		for _, s := range v {
+			sample := &prommodel.Sample{
+				Metric:    convertLabels(s.Metric),
+				Value:     prommodel.SampleValue(s.F),
+				Timestamp: prommodel.Time(s.T),
+			}
+			if s.H != nil {
+				sample.Value = 0
+				sample.Histogram = convertHistogram(s.H)
+			}
+			vec = append(vec, sample)
+		}
+		return vec, nil
+	case promql.Matrix:
+		matrix := make(prommodel.Matrix, 0, len(v))
+		for _, series := range v {
+			stream := &prommodel.SampleStream{Metric: convertLabels(series.Metric)}
+			for _, p := range series.Floats {
+				stream.Values = append(stream.Values, prommodel.SamplePair{
+					Timestamp: prommodel.Time(p.T),
+					Value:     prommodel.SampleValue(p.F),
+				})
+			}
+			for _, p := range series.Histograms {
+				stream.Histograms = append(stream.Histograms, prommodel.SampleHistogramPair{
+					Timestamp: prommodel.Time(p.T),
+					Histogram: convertHistogram(p.H),
+				})
+			}
+			matrix = append(matrix, stream)
+		}
+		return matrix, nil
+	}
+	return nil, fmt.Errorf("unsupported result type %T", v)
+}
+
+func convertLabels(lset labels.Labels) prommodel.Metric {
+	metric := make(prommodel.Metric, lset.Len())
+	lset.Range(func(l labels.Label) {
+		metric[prommodel.LabelName(l.Name)] = prommodel.LabelValue(l.Value)
+	})
+	return metric
+}
+
+// convertHistogram 按 Prometheus HTTP API 的格式转换原生直方图
+func convertHistogram(h *histogram.FloatHistogram) *prommodel.SampleHistogram {
+	sh := &prommodel.SampleHistogram{
+		Count: prommodel.FloatString(h.Count),
+		Sum:   prommodel.FloatString(h.Sum),
+	}
+	it := h.AllBucketIterator()
+	for it.Next() {
+		b := it.At()
+		if b.Count == 0 {
+			continue
+		}
+		// 0：左开右闭，1：左闭右开，2：两端开，3：两端闭
+		boundaries := int32(2)
+		switch {
+		case b.LowerInclusive && b.UpperInclusive:
+			boundaries = 3
+		case b.LowerInclusive:
+			boundaries = 1
+		case b.UpperInclusive:
+			boundaries = 0
+		}
+		sh.Buckets = append(sh.Buckets, &prommodel.HistogramBucket{
+			Boundaries: boundaries,
+			Lower:      prommodel.FloatString(b.Lower),
+			Upper:      prommodel.FloatString(b.Upper),
+			Count:      prommodel.FloatString(b.Count),
+		})
+	}
+	return sh
+}
@@ -0,0 +1,337 @@
+package prom
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLoad = `
+# 每分钟一个样本
+load 1m
+	http_requests_total{job="api", code="200"} 0+60x10
+	http_requests_total{job="api", code="500"} 0+6x10
+	up{job="api", instance="a"} 1 1 1 0 0 _ _ 1 1 1 1
+	up{job="api", instance="b"} 1 1 stale
+
+load 30s
+	queue_length{job="worker"} 5 10 15
+`
+
+// newTestEvaluator 创建加载了 testLoad 的 Evaluator
+func newTestEvaluator(t *testing.T, opts ...EvaluatorOption) *Evaluator {
+	t.Helper()
+	e, err := NewEvaluator(opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, e.Close()) })
+	require.NoError(t, e.Load(testLoad))
+	return e
+}
+
+// vectorValues 将即时查询结果转换为 标签 -> 值
+func vectorValues(t *testing.T, res *ResPromQL) map[string]float64 {
+	t.Helper()
+	vec, ok := res.Val.(prommodel.Vector)
+	require.True(t, ok, "result should be a vector, got %T", res.Val)
+	values := make(map[string]float64, len(vec))
+	for _, s := range vec {
+		values[s.Metric.String()] = float64(s.Value)
+	}
+	return values
+}
+
+func TestEvaluatorQuery(t *testing.T) {
+	e := newTestEvaluator(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string             // 测试用例名称
+		query    string             // PromQL查询
+		at       time.Duration      // 查询时间相对起始时间的偏移
+		expected map[string]float64 // 预期结果
+	}{
+		{
+			name:     "Rate of counter",
+			query:    `sum by (code) (rate(http_requests_total[5m]))`,
+			at:       10 * time.Minute,
+			expected: map[string]float64{`{code="200"}`: 1, `{code="500"}`: 0.1},
+		},
+		{
+			name:     "Error ratio",
+			query:    `sum(rate(http_requests_total{code="500"}[5m])) / sum(rate(http_requests_total[5m]))`,
+			at:       10 * time.Minute,
+			expected: map[string]float64{`{}`: 0.1 / 1.1},
+		},
+		{
+			name:     "Alert condition fires",
+			query:    `up == 0`,
+			at:       4 * time.Minute,
+			expected: map[string]float64{`up{instance="a", job="api"}`: 0},
+		},
+		{
+			name:     "Omitted samples fall back to lookback",
+			query:    `up{instance="a"}`,
+			at:       6 * time.Minute,
+			expected: map[string]float64{`up{instance="a", job="api"}`: 0},
+		},
+		{
+			name:     "Stale marker ends series",
+			query:    `up{instance="b"}`,
+			at:       2 * time.Minute,
+			expected: map[string]float64{},
+		},
+		{
+			name:     "Second load block uses its own interval",
+			query:    `queue_length`,
+			at:       time.Minute,
+			expected: map[string]float64{`queue_length{job="worker"}`: 15},
+		},
+		{
+			name:     "Subquery without step",
+			query:    `max_over_time(sum(up)[10m:])`,
+			at:       10 * time.Minute,
+			expected: map[string]float64{`{}`: 2},
+		},
+		{
+			name:     "Offset and @ modifier",
+			query:    `http_requests_total{code="200"} offset 5m - http_requests_total{code="200"} @ 60`,
+			at:       10 * time.Minute,
+			expected: map[string]float64{`{code="200", job="api"}`: 240},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := e.Query(ctx, tt.query, e.Time(tt.at))
+			require.NoError(t, err)
+			values := vectorValues(t, res)
+			require.Len(t, values, len(tt.expected))
+			for k, v := range tt.expected {
+				assert.InDelta(t, v, values[k], 1e-9, k)
+			}
+		})
+	}
+
+	t.Run("Scalar result", func(t *testing.T) {
+		res, err := e.Query(ctx, `scalar(sum(up))`, e.Time(time.Minute))
+		require.NoError(t, err)
+		scalar, ok := res.Val.(*prommodel.Scalar)
+		require.True(t, ok)
+		assert.Equal(t, prommodel.SampleValue(2), scalar.Value)
+		assert.Equal(t, prommodel.TimeFromUnixNano(e.Time(time.Minute).UnixNano()), scalar.Timestamp)
+	})
+
+	t.Run("String result", func(t *testing.T) {
+		res, err := e.Query(ctx, `"hello"`, e.Time(0))
+		require.NoError(t, err)
+		str, ok := res.Val.(*prommodel.String)
+		require.True(t, ok)
+		assert.Equal(t, "hello", str.Value)
+	})
+
+	t.Run("Range selector returns matrix", func(t *testing.T) {
+		res, err := e.Query(ctx, `queue_length[1m]`, e.Time(time.Minute))
+		require.NoError(t, err)
+		values, err := res.Values()
+		require.NoError(t, err)
+		// 范围左开右闭，不包含 0s 的样本
+		assert.Len(t, values, 2)
+	})
+
+	t.Run("Works with ResPromQL helpers", func(t *testing.T) {
+		res, err := e.Query(ctx, `sum(up)`, e.Time(time.Minute))
+		require.NoError(t, err)
+		rows, err := res.Rows()
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		v, err := rows[0].GetValue()
+		require.NoError(t, err)
+		assert.Equal(t, float64(2), v)
+	})
+
+	t.Run("Invalid query", func(t *testing.T) {
+		_, err := e.Query(ctx, `sum(up`, e.Time(0))
+		assert.Error(t, err)
+	})
+}
+
+func TestEvaluatorQueryRange(t *testing.T) {
+	e := newTestEvaluator(t)
+	ctx := context.Background()
+
+	res, err := e.QueryRange(ctx, `sum(up)`, e.Time(0), e.Time(10*time.Minute), 2*time.Minute)
+	require.NoError(t, err)
+	matrix, ok := res.Val.(prommodel.Matrix)
+	require.True(t, ok)
+	require.Len(t, matrix, 1)
+
+	var got []float64
+	for _, p := range matrix[0].Values {
+		got = append(got, float64(p.Value))
+	}
+	// instance b 在 2m 过期，instance a 在 3m 到 6m 为 0
+	assert.Equal(t, []float64{2, 1, 0, 0, 1, 1}, got)
+	assert.Equal(t, prommodel.TimeFromUnixNano(e.Time(10*time.Minute).UnixNano()), matrix[0].Values[5].Timestamp)
+
+	_, err = e.QueryRange(ctx, `up`, e.Time(0), e.Time(time.Minute), 0)
+	assert.EqualError(t, err, "step must be positive")
+}
+
+func TestEvaluatorLoad(t *testing.T) {
+	tests := []struct {
+		name   string // 测试用例名称
+		input  string // 加载的数据
+		errMsg string // 预期错误信息
+	}{
+		{name: "Series before load", input: "up 1 2 3", errMsg: "line 1: series defined before load command"},
+		{name: "Invalid interval", input: "load abc\n up 1", errMsg: `line 1: invalid load interval "abc"`},
+		{name: "Missing interval", input: "load", errMsg: "line 1: invalid load command"},
+		{name: "Zero interval", input: "load 0s\n up 1", errMsg: "line 1: load interval must be positive"},
+		{name: "Invalid series", input: "load 1m\n up{ 1", errMsg: "line 2:"},
+		{name: "Empty input", input: "\n# comment\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewEvaluator()
+			require.NoError(t, err)
+			defer e.Close()
+			err = e.Load(tt.input)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+
+	t.Run("Failed load is rolled back", func(t *testing.T) {
+		e, err := NewEvaluator()
+		require.NoError(t, err)
+		defer e.Close()
+		require.Error(t, e.Load("load 1m\n up 1 1\n up{ 1"))
+		res, err := e.Query(context.Background(), `up`, e.Time(0))
+		require.NoError(t, err)
+		assert.Empty(t, vectorValues(t, res))
+	})
+
+	t.Run("Native histogram", func(t *testing.T) {
+		e, err := NewEvaluator()
+		require.NoError(t, err)
+		defer e.Close()
+		require.NoError(t, e.Load("load 1m\n latency {{schema:0 sum:5 count:4 buckets:[1 2 1]}}"))
+		res, err := e.Query(context.Background(), `latency`, e.Time(0))
+		require.NoError(t, err)
+		vec := res.Val.(prommodel.Vector)
+		require.Len(t, vec, 1)
+		require.NotNil(t, vec[0].Histogram)
+		assert.Equal(t, prommodel.FloatString(4), vec[0].Histogram.Count)
+		assert.Equal(t, prommodel.FloatString(5), vec[0].Histogram.Sum)
+		assert.Len(t, vec[0].Histogram.Buckets, 3)
+		assert.Equal(t, int32(0), vec[0].Histogram.Buckets[0].Boundaries)
+
+		res, err = e.Query(context.Background(), `histogram_count(latency)`, e.Time(0))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{`{}`: 4}, vectorValues(t, res))
+	})
+}
+
+func TestEvaluatorLoadOpenMetrics(t *testing.T) {
+	e, err := NewEvaluator(WithStartTime(time.Unix(1700000000, 0)))
+	require.NoError(t, err)
+	defer e.Close()
+	ctx := context.Background()
+
+	openMetrics := `# TYPE http_requests counter
+http_requests_total{code="200"} 100
+http_requests_total{code="500"} 5 1700000030.5
+# TYPE temperature gauge
+temperature 21.5
+# EOF
+`
+	require.NoError(t, e.LoadOpenMetrics([]byte(openMetrics), e.Time(0)))
+	// 一分钟后的第二次采集，Prometheus 文本格式
+	promText := `# TYPE http_requests_total counter
+http_requests_total{code="200"} 160
+`
+	require.NoError(t, e.LoadOpenMetrics([]byte(promText), e.Time(time.Minute)))
+
+	res, err := e.Query(ctx, `increase(http_requests_total{code="200"}[2m])`, e.Time(time.Minute))
+	require.NoError(t, err)
+	values := vectorValues(t, res)
+	require.Len(t, values, 1)
+	assert.Greater(t, values[`{code="200"}`], float64(60), "increase should be extrapolated")
+
+	res, err = e.Query(ctx, `http_requests_total{code="500"}`, e.Time(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{`http_requests_total{code="500"}`: 5}, vectorValues(t, res))
+
+	res, err = e.Query(ctx, `timestamp(http_requests_total{code="500"})`, e.Time(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{`{code="500"}`: 1700000030.5}, vectorValues(t, res))
+
+	res, err = e.Query(ctx, `temperature`, e.Time(0))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{`temperature`: 21.5}, vectorValues(t, res))
+
+	assert.ErrorContains(t, e.LoadOpenMetrics([]byte("bad metric{\n"), e.Time(0)), "parse exposition")
+}
+
+func TestEvaluatorOptions(t *testing.T) {
+	t.Run("Lookback delta", func(t *testing.T) {
+		e := newTestEvaluator(t, WithLookbackDelta(time.Minute))
+		res, err := e.Query(context.Background(), `up{instance="a"}`, e.Time(6*time.Minute))
+		require.NoError(t, err)
+		assert.Empty(t, vectorValues(t, res), "sample at 4m is outside 1m lookback")
+	})
+
+	t.Run("Max samples", func(t *testing.T) {
+		e := newTestEvaluator(t, WithMaxSamples(2))
+		_, err := e.Query(context.Background(), `http_requests_total[10m]`, e.Time(10*time.Minute))
+		assert.ErrorContains(t, err, "query processing would load too many samples")
+	})
+
+	t.Run("Invalid values keep defaults", func(t *testing.T) {
+		e, err := NewEvaluator(WithLookbackDelta(0), WithMaxSamples(-1), WithEvalTimeout(0), WithSubqueryInterval(0))
+		require.NoError(t, err)
+		defer e.Close()
+		assert.Equal(t, defaultLookbackDelta, e.lookbackDelta)
+		assert.Equal(t, defaultMaxSamples, e.maxSamples)
+		assert.Equal(t, defaultQueryTimeout, e.timeout)
+		assert.Equal(t, defaultSubqueryInterval, e.subquery)
+		assert.Equal(t, int64(0), e.Time(0).Unix())
+	})
+
+	t.Run("Subquery interval", func(t *testing.T) {
+		for interval, expected := range map[time.Duration]float64{time.Minute: 10, 5 * time.Minute: 2} {
+			e := newTestEvaluator(t, WithSubqueryInterval(interval))
+			res, err := e.Query(context.Background(), `count_over_time(vector(1)[10m:])`, e.Time(10*time.Minute))
+			require.NoError(t, err)
+			assert.Equal(t, map[string]float64{"{}": expected}, vectorValues(t, res), interval.String())
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		e := newTestEvaluator(t, WithEvalTimeout(time.Nanosecond))
+		_, err := e.Query(context.Background(), `sum(rate(http_requests_total[5m]))`, e.Time(10*time.Minute))
+		assert.Error(t, err)
+	})
+}
+
+func TestConvertHistogramBoundaries(t *testing.T) {
+	e, err := NewEvaluator()
+	require.NoError(t, err)
+	defer e.Close()
+	require.NoError(t, e.Load("load 1m\n h {{schema:0 count:3 sum:0 z_bucket:1 z_bucket_w:0.001 buckets:[1] n_buckets:[1]}}"))
+	res, err := e.Query(context.Background(), `h`, e.Time(0))
+	require.NoError(t, err)
+	buckets := res.Val.(prommodel.Vector)[0].Histogram.Buckets
+	require.Len(t, buckets, 3)
+	// 负桶左闭右开，零桶两端闭，正桶左开右闭
+	assert.Equal(t, []int32{1, 3, 0}, []int32{buckets[0].Boundaries, buckets[1].Boundaries, buckets[2].Boundaries})
+	assert.False(t, math.IsNaN(float64(buckets[1].Upper)))
+}
@@ -0,0 +1,304 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	promtheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodel "github.com/prometheus/common/model"
+)
+
+const (
+	// defaultReplicaLabel 默认的 HA 副本标签，与 Thanos 示例配置中的 external_labels 相同
+	defaultReplicaLabel = "replica"
+	// defaultClusterLabel 默认的集群标签，合并结果时添加到每个序列
+	defaultClusterLabel = "cluster"
+)
+
+// FederationTarget 一个 Prometheus 及其所属的集群
+// 同一集群的多个 Prometheus 是 HA 副本，查询结果只在集群内去重
+type FederationTarget struct {
+	// Address Prometheus 地址，Client 不为空时忽略
+	Address string
+	// Client 已创建的 PrometheusClient，用于不同集群使用不同 token 或开启缓存的场景
+	Client *PrometheusClient
+	// Cluster 所属的集群，合并结果时作为集群标签添加到序列，序列已有该标签时不覆盖；
+	// 为空时属于默认集群，不添加标签
+	Cluster string
+	// Replica 副本名称，用于在 warning 和错误中标识 Prometheus，为空时使用地址
+	Replica string
+}
+
+// federationMember 已创建客户端的 FederationTarget
+type federationMember struct {
+	client  *PrometheusClient
+	cluster prommodel.LabelValue
+	name    string
+}
+
+// FederatedClient 将查询并发发送到多个 Prometheus，合并结果并对同一集群的 HA 副本去重
+// Prometheus 查询结果不包含 external_labels，因此每个 Prometheus 需要通过 FederationTarget.Cluster 指定所属集群，
+// 合并时序列先添加集群标签、去掉副本标签，标签相同的序列只保留一个，不同集群的序列不会互相覆盖
+type FederatedClient struct {
+	targets         []federationMember
+	clientOpts      []Option
+	replicaLabel    prommodel.LabelName
+	clusterLabel    prommodel.LabelName
+	partialResponse bool
+	timeout         time.Duration
+}
+
+type FederationOption func(*FederatedClient)
+
+// WithReplicaLabel 设置 HA 副本标签，默认 replica，为空时只对标签完全相同的序列去重
+func WithReplicaLabel(label string) FederationOption {
+	return func(f *FederatedClient) {
+		f.replicaLabel = prommodel.LabelName(label)
+	}
+}
+
+// WithFederationClientOptions 设置根据地址创建 PrometheusClient 时使用的 Option，例如 WithToken
+func WithFederationClientOptions(opts ...Option) FederationOption {
+	return func(f *FederatedClient) {
+		f.clientOpts = append(f.clientOpts, opts...)
+	}
+}
+
+// WithClusterLabel 设置合并结果时添加的集群标签，默认 cluster
+func WithClusterLabel(label string) FederationOption {
+	return func(f *FederatedClient) {
+		if label == "" {
+			return
+		}
+		f.clusterLabel = prommodel.LabelName(label)
+	}
+}
+
+// WithPartialResponse 设置部分 Prometheus 查询失败时是否返回其余的结果，默认开启
+// 开启时失败的 Prometheus 作为 warning 返回，所有 Prometheus 都失败时才返回错误
+func WithPartialResponse(enabled bool) FederationOption {
+	return func(f *FederatedClient) {
+		f.partialResponse = enabled
+	}
+}
+
+// WithFederationTimeout 设置每个 Prometheus 查询的超时时间，ctx 没有超时时生效，默认 15s
+func WithFederationTimeout(timeout time.Duration) FederationOption {
+	return func(f *FederatedClient) {
+		if timeout <= 0 {
+			return
+		}
+		f.timeout = timeout
+	}
+}
+
+// NewFederatedClient 创建 FederatedClient，targets 的顺序为同一集群内去重时的优先级
+func NewFederatedClient(targets []FederationTarget, opts ...FederationOption) (*FederatedClient, error) {
+	f := &FederatedClient{
+		replicaLabel:    defaultReplicaLabel,
+		clusterLabel:    defaultClusterLabel,
+		partialResponse: true,
+		timeout:         defaultQueryTimeout,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("no prometheus targets")
+	}
+
+	f.targets = make([]federationMember, 0, len(targets))
+	for _, target := range targets {
+		client := target.Client
+		if client == nil {
+			var err error
+			if client, err = NewPrometheusClient(target.Address, f.clientOpts...); err != nil {
+				return nil, fmt.Errorf("create client for %s: %w", target.Address, err)
+			}
+		}
+		name := target.Replica
+		if name == "" {
+			name = client.address
+		}
+		f.targets = append(f.targets, federationMember{client: client, cluster: prommodel.LabelValue(target.Cluster), name: name})
+	}
+	return f, nil
+}
+
+// Targets 返回所有 Prometheus 的地址，顺序与去重时的优先级相同
+func (f *FederatedClient) Targets() []string {
+	addresses := make([]string, 0, len(f.targets))
+	for _, t := range f.targets {
+		addresses = append(addresses, t.client.address)
+	}
+	return addresses
+}
+
+// Query 在所有 Prometheus 上执行即时查询并合并结果
+// 返回的 warnings 包含各个 Prometheus 的 warning 和查询失败的 Prometheus
+func (f *FederatedClient) Query(ctx context.Context, query string, ts time.Time, opts ...promtheusv1.Option) (*ResPromQL, promtheusv1.Warnings, error) {
+	return f.fanOut(ctx, func(ctx context.Context, p *PrometheusClient) (prommodel.Value, promtheusv1.Warnings, error) {
+		return p.query(ctx, query, ts, opts...)
+	})
+}
+
+// QueryRange 在所有 Prometheus 上执行范围查询并合并结果
+// 同一集群的同一序列在多个副本中都存在时，使用样本数最多的副本，样本数相同时使用靠前的 Prometheus
+func (f *FederatedClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, opts ...promtheusv1.Option) (*ResPromQL, promtheusv1.Warnings, error) {
+	r := promtheusv1.Range{
+		Start: start,
+		End:   end,
+		Step:  step,
+	}
+	return f.fanOut(ctx, func(ctx context.Context, p *PrometheusClient) (prommodel.Value, promtheusv1.Warnings, error) {
+		return p.queryRange(ctx, query, r, opts...)
+	})
+}
+
+// federatedResponse 单个 Prometheus 的查询结果
+type federatedResponse struct {
+	value    prommodel.Value
+	warnings promtheusv1.Warnings
+	err      error
+	cluster  prommodel.LabelValue
+}
+
+func (f *FederatedClient) fanOut(ctx context.Context, do func(ctx context.Context, p *PrometheusClient) (prommodel.Value, promtheusv1.Warnings, error)) (*ResPromQL, promtheusv1.Warnings, error) {
+	// 如果传入的 ctx 没有超时，才设置默认超时
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	responses := make([]federatedResponse, len(f.targets))
+	var wg sync.WaitGroup
+	for i, target := range f.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, warnings, err := do(ctx, target.client)
+			responses[i] = federatedResponse{value: value, warnings: warnings, err: err, cluster: target.cluster}
+		}()
+	}
+	wg.Wait()
+
+	var (
+		warnings  promtheusv1.Warnings
+		succeeded []federatedResponse
+		errs      []error
+	)
+	for i, resp := range responses {
+		name := f.targets[i].name
+		for _, w := range resp.warnings {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", name, w))
+		}
+		if resp.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, resp.err))
+			warnings = append(warnings, fmt.Sprintf("%s: query failed: %s", name, resp.err))
+			continue
+		}
+		succeeded = append(succeeded, resp)
+	}
+	if len(succeeded) == 0 || (len(errs) > 0 && !f.partialResponse) {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	value, err := f.merge(succeeded)
+	if err != nil {
+		return nil, warnings, err
+	}
+	return &ResPromQL{value}, warnings, nil
+}
+
+// federatedSeries 去重时保留的序列
+type federatedSeries struct {
+	sample *prommodel.Sample
+	stream *prommodel.SampleStream
+	count  int
+}
+
+// merge 合并多个 Prometheus 的结果，responses 按 Prometheus 的顺序排列
+// 序列添加集群标签、去掉副本标签后按标签去重，因此只有同一集群的副本会互相去重
+// 标量和字符串无法合并，使用第一个结果
+func (f *FederatedClient) merge(responses []federatedResponse) (prommodel.Value, error) {
+	valueType := responses[0].value.Type()
+	for _, resp := range responses[1:] {
+		if resp.value.Type() != valueType {
+			return nil, fmt.Errorf("mismatched result types: %s and %s", valueType, resp.value.Type())
+		}
+	}
+
+	series := make(map[prommodel.Fingerprint]*federatedSeries)
+	var order []prommodel.Fingerprint
+	// keep 保留样本数最多的序列，样本数相同时保留先出现的
+	keep := func(metric prommodel.Metric, s *federatedSeries) {
+		fp := metric.Fingerprint()
+		existing, ok := series[fp]
+		if !ok {
+			order = append(order, fp)
+		}
+		if !ok || s.count > existing.count {
+			series[fp] = s
+		}
+	}
+
+	switch valueType {
+	case prommodel.ValVector:
+		for _, resp := range responses {
+			for _, sample := range resp.value.(prommodel.Vector) {
+				s := *sample
+				s.Metric = f.seriesLabels(sample.Metric, resp.cluster)
+				keep(s.Metric, &federatedSeries{sample: &s, count: 1})
+			}
+		}
+		vector := make(prommodel.Vector, 0, len(order))
+		for _, fp := range order {
+			vector = append(vector, series[fp].sample)
+		}
+		sort.Sort(vector)
+		return vector, nil
+	case prommodel.ValMatrix:
+		for _, resp := range responses {
+			for _, stream := range resp.value.(prommodel.Matrix) {
+				s := *stream
+				s.Metric = f.seriesLabels(stream.Metric, resp.cluster)
+				keep(s.Metric, &federatedSeries{stream: &s, count: len(s.Values) + len(s.Histograms)})
+			}
+		}
+		matrix := make(prommodel.Matrix, 0, len(order))
+		for _, fp := range order {
+			matrix = append(matrix, series[fp].stream)
+		}
+		sort.Sort(matrix)
+		return matrix, nil
+	case prommodel.ValScalar, prommodel.ValString:
+		return responses[0].value, nil
+	default:
+		return nil, fmt.Errorf("unsupported query result type: %s", valueType)
+	}
+}
+
+// seriesLabels 返回去掉副本标签并添加集群标签的 Metric，不修改原 Metric
+// cluster 为空或序列已有集群标签时不添加
+func (f *FederatedClient) seriesLabels(metric prommodel.Metric, cluster prommodel.LabelValue) prommodel.Metric {
+	_, hasReplica := metric[f.replicaLabel]
+	_, hasCluster := metric[f.clusterLabel]
+	dropReplica := hasReplica && f.replicaLabel != ""
+	addCluster := !hasCluster && cluster != ""
+	if !dropReplica && !addCluster {
+		return metric
+	}
+	m := metric.Clone()
+	if dropReplica {
+		delete(m, f.replicaLabel)
+	}
+	if addCluster {
+		m[f.clusterLabel] = cluster
+	}
+	return m
+}
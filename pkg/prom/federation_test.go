@@ -0,0 +1,232 @@
+package prom
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// federationTestSeries 测试 Prometheus 返回的序列，values 为 [时间戳, 值] 对
+type federationTestSeries struct {
+	metric map[string]string
+	values [][2]float64
+}
+
+// newFederationTestServer 模拟 Prometheus API，即时查询返回每个序列的最后一个样本
+// status 不为 200 时返回错误，warnings 作为响应的 warnings 返回
+func newFederationTestServer(t *testing.T, status int, warnings []string, series ...federationTestSeries) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		result := []any{}
+		resultType := "vector"
+		for _, s := range series {
+			values := [][]any{}
+			for _, v := range s.values {
+				values = append(values, []any{v[0], prommodel.SampleValue(v[1]).String()})
+			}
+			switch r.URL.Path {
+			case "/api/v1/query_range":
+				resultType = "matrix"
+				result = append(result, map[string]any{"metric": s.metric, "values": values})
+			default:
+				if len(values) > 0 {
+					result = append(result, map[string]any{"metric": s.metric, "value": values[len(values)-1]})
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":   "success",
+			"data":     map[string]any{"resultType": resultType, "result": result},
+			"warnings": warnings,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestFederatedClientQueryRange(t *testing.T) {
+	// 集群 a 有两个副本，副本 1 缺少一个样本；集群 b 只有一个副本
+	a1 := newFederationTestServer(t, http.StatusOK, nil,
+		federationTestSeries{metric: map[string]string{"__name__": "up", "cluster": "a", "replica": "1"}, values: [][2]float64{{60, 1}, {120, 1}}},
+	)
+	a2 := newFederationTestServer(t, http.StatusOK, nil,
+		federationTestSeries{metric: map[string]string{"__name__": "up", "cluster": "a", "replica": "2"}, values: [][2]float64{{0, 1}, {60, 1}, {120, 0}}},
+	)
+	b1 := newFederationTestServer(t, http.StatusOK, []string{"partial data"},
+		federationTestSeries{metric: map[string]string{"__name__": "up", "cluster": "b", "replica": "1"}, values: [][2]float64{{0, 1}}},
+	)
+	client, err := NewFederatedClient([]FederationTarget{
+		{Address: a1, Cluster: "a"},
+		{Address: a2, Cluster: "a"},
+		{Address: b1, Cluster: "b", Replica: "b-1"},
+	})
+	require.NoError(t, err)
+
+	res, warnings, err := client.QueryRange(context.Background(), "up", time.Unix(0, 0), time.Unix(120, 0), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "up{cluster=\"a\"} =>\n1 @[0]\n1 @[60]\n0 @[120]\nup{cluster=\"b\"} =>\n1 @[0]", res.String())
+	assert.Equal(t, []string{"b-1: partial data"}, []string(warnings))
+
+	data, err := res.Data()
+	require.NoError(t, err)
+	assert.Equal(t, "matrix", data.ResultType)
+	assert.Len(t, data.Result, 2)
+}
+
+func TestFederatedClientQuery(t *testing.T) {
+	a1 := newFederationTestServer(t, http.StatusOK, nil,
+		federationTestSeries{metric: map[string]string{"__name__": "up", "cluster": "a", "replica": "1"}, values: [][2]float64{{100, 1}}},
+		federationTestSeries{metric: map[string]string{"__name__": "up", "cluster": "a", "job": "db", "replica": "1"}, values: [][2]float64{{100, 1}}},
+	)
+	a2 := newFederationTestServer(t, http.StatusOK, nil,
+		federationTestSeries{metric: map[string]string{"__name__": "up", "cluster": "a", "replica": "2"}, values: [][2]float64{{100, 0}}},
+	)
+	down := newFederationTestServer(t, http.StatusServiceUnavailable, nil)
+	target := func(address string) FederationTarget { return FederationTarget{Address: address, Cluster: "a"} }
+
+	tests := []struct {
+		name     string             // 测试用例名称
+		targets  []FederationTarget // Prometheus 及其所属集群
+		opts     []FederationOption // FederatedClient 选项
+		expected string             // 期望的结果
+		warnings []string           // 期望的 warnings
+		errMsg   string             // 期望的错误信息，为空时不返回错误
+	}{
+		{
+			name:     "Dedup prefers first target on tie",
+			targets:  []FederationTarget{target(a1), target(a2)},
+			expected: "up{cluster=\"a\"} => 1 @[100]\nup{cluster=\"a\", job=\"db\"} => 1 @[100]",
+		},
+		{
+			name:     "Target order decides tie",
+			targets:  []FederationTarget{target(a2), target(a1)},
+			expected: "up{cluster=\"a\"} => 0 @[100]\nup{cluster=\"a\", job=\"db\"} => 1 @[100]",
+		},
+		{
+			name:    "Custom replica label keeps replicas",
+			targets: []FederationTarget{target(a1), target(a2)},
+			opts:    []FederationOption{WithReplicaLabel("prometheus_replica")},
+			expected: "up{cluster=\"a\", replica=\"1\"} => 1 @[100]\nup{cluster=\"a\", replica=\"2\"} => 0 @[100]\n" +
+				"up{cluster=\"a\", job=\"db\", replica=\"1\"} => 1 @[100]",
+		},
+		{
+			name:     "Partial failure",
+			targets:  []FederationTarget{target(down), target(a1)},
+			expected: "up{cluster=\"a\"} => 1 @[100]\nup{cluster=\"a\", job=\"db\"} => 1 @[100]",
+			warnings: []string{down + ": query failed: server_error: server error: 503"},
+		},
+		{
+			name:    "Partial response disabled",
+			targets: []FederationTarget{target(down), target(a1)},
+			opts:    []FederationOption{WithPartialResponse(false)},
+			errMsg:  "server error: 503",
+		},
+		{
+			name:    "All targets failed",
+			targets: []FederationTarget{target(down)},
+			errMsg:  down + ": server_error: server error: 503",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewFederatedClient(tt.targets, tt.opts...)
+			require.NoError(t, err)
+
+			res, warnings, err := client.Query(context.Background(), "up", time.Unix(100, 0))
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, res.String())
+			assert.Equal(t, tt.warnings, []string(warnings))
+		})
+	}
+}
+
+// TestFederatedClientClusters 测试查询结果没有集群和副本标签时按 FederationTarget 的集群去重
+func TestFederatedClientClusters(t *testing.T) {
+	sum := func(value float64) federationTestSeries {
+		return federationTestSeries{metric: map[string]string{}, values: [][2]float64{{100, value}}}
+	}
+	a1 := newFederationTestServer(t, http.StatusOK, nil, sum(10))
+	a2 := newFederationTestServer(t, http.StatusOK, nil, sum(11))
+	b1 := newFederationTestServer(t, http.StatusOK, nil, sum(20))
+	b2 := newFederationTestServer(t, http.StatusOK, nil, sum(21))
+
+	client, err := NewFederatedClient([]FederationTarget{
+		{Address: a1, Cluster: "a", Replica: "a-1"},
+		{Address: a2, Cluster: "a", Replica: "a-2"},
+		{Address: b1, Cluster: "b", Replica: "b-1"},
+		{Address: b2, Cluster: "b", Replica: "b-2"},
+	}, WithClusterLabel("prometheus_cluster"))
+	require.NoError(t, err)
+	res, _, err := client.Query(context.Background(), "sum(up)", time.Unix(100, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "{prometheus_cluster=\"a\"} => 10 @[100]\n{prometheus_cluster=\"b\"} => 20 @[100]", res.String())
+
+	// 没有指定集群时所有 Prometheus 属于同一集群
+	client, err = NewFederatedClient([]FederationTarget{{Address: a1}, {Address: b1}})
+	require.NoError(t, err)
+	res, _, err = client.Query(context.Background(), "sum(up)", time.Unix(100, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "{} => 10 @[100]", res.String())
+}
+
+func TestFederatedClientMerge(t *testing.T) {
+	client := &FederatedClient{replicaLabel: defaultReplicaLabel, clusterLabel: defaultClusterLabel}
+
+	// 标量无法合并，使用第一个结果
+	value, err := client.merge([]federatedResponse{
+		{value: &prommodel.Scalar{Value: 1, Timestamp: 1000}},
+		{value: &prommodel.Scalar{Value: 2, Timestamp: 1000}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &prommodel.Scalar{Value: 1, Timestamp: 1000}, value)
+
+	_, err = client.merge([]federatedResponse{{value: prommodel.Vector{}}, {value: prommodel.Matrix{}}})
+	assert.ErrorContains(t, err, "mismatched result types")
+
+	// 合并不修改原结果的标签，序列已有集群标签时不覆盖
+	metric := prommodel.Metric{"__name__": "up", "replica": "1", "cluster": "x"}
+	value, err = client.merge([]federatedResponse{{value: prommodel.Vector{{Metric: metric, Value: 1}}, cluster: "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, prommodel.LabelValue("1"), metric["replica"])
+	assert.Equal(t, "up{cluster=\"x\"} => 1 @[0]", value.String())
+}
+
+func TestNewFederatedClient(t *testing.T) {
+	_, err := NewFederatedClient(nil)
+	assert.Error(t, err)
+
+	extra, err := NewPrometheusClient("http://b:9090")
+	require.NoError(t, err)
+	client, err := NewFederatedClient([]FederationTarget{
+		{Address: "http://a:9090", Cluster: "a"},
+		{Client: extra, Cluster: "b", Replica: "b-1"},
+	},
+		WithFederationClientOptions(WithToken("secret")),
+		WithFederationTimeout(time.Second),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://a:9090", "http://b:9090"}, client.Targets())
+	assert.Equal(t, "secret", client.targets[0].client.token)
+	assert.Equal(t, "", client.targets[1].client.token, "已创建的客户端不使用 WithFederationClientOptions")
+	assert.Equal(t, []string{"http://a:9090", "b-1"}, []string{client.targets[0].name, client.targets[1].name})
+	assert.Equal(t, prommodel.LabelValue("b"), client.targets[1].cluster)
+	assert.Equal(t, time.Second, client.timeout)
+	assert.True(t, client.partialResponse)
+	assert.Equal(t, prommodel.LabelName(defaultReplicaLabel), client.replicaLabel)
+	assert.Equal(t, prommodel.LabelName(defaultClusterLabel), client.clusterLabel)
+}
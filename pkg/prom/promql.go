@@ -51,6 +51,7 @@ type PrometheusClient struct {
 	client     promtheusv1.API
 	httpClient api.Client
 	timeout    time.Duration
+	cache      *queryCache
 }
 
 func (p *PrometheusClient) Client() promtheusv1.API {
@@ -132,7 +133,7 @@ func (p *PrometheusClient) Query(ctx context.Context, query string, ts time.Time
 		ctx, cancel = context.WithTimeout(ctx, defaultQueryTimeout)
 		defer cancel()
 	}
-	result, warnings, err := p.client.Query(ctx, query, ts)
+	result, warnings, err := p.query(ctx, query, ts)
 	if err != nil {
 		return nil, err
 	}
@@ -142,9 +143,25 @@ func (p *PrometheusClient) Query(ctx context.Context, query string, ts time.Time
 	return result, nil
 }
 
+// query 执行即时查询，开启缓存时经过缓存
+func (p *PrometheusClient) query(ctx context.Context, query string, ts time.Time, opts ...promtheusv1.Option) (prommodel.Value, promtheusv1.Warnings, error) {
+	if p.cache != nil {
+		return p.cache.query(ctx, p.client, query, ts, opts...)
+	}
+	return p.client.Query(ctx, query, ts, opts...)
+}
+
+// queryRange 执行范围查询，开启缓存时经过缓存
+func (p *PrometheusClient) queryRange(ctx context.Context, query string, r promtheusv1.Range, opts ...promtheusv1.Option) (prommodel.Value, promtheusv1.Warnings, error) {
+	if p.cache != nil {
+		return p.cache.queryRange(ctx, p.client, query, r, opts...)
+	}
+	return p.client.QueryRange(ctx, query, r, opts...)
+}
+
 // QueryResPromQL 执行 Prometheus 查询并返回 ResPromQL 类型结果
 func (p *PrometheusClient) QueryResPromQL(ctx context.Context, query string, ts time.Time) (*ResPromQL, error) {
-	result, warnings, err := p.client.Query(ctx, query, ts)
+	result, warnings, err := p.query(ctx, query, ts)
 	if err != nil {
 		return nil, err
 	}
@@ -182,7 +199,7 @@ func (p *PrometheusClient) QueryVector(ctx context.Context, query string, ts tim
 		ctx, cancel = context.WithTimeout(ctx, defaultQueryTimeout)
 		defer cancel()
 	}
-	result, warnings, err := p.client.Query(ctx, query, ts, opts...)
+	result, warnings, err := p.query(ctx, query, ts, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -211,7 +228,7 @@ func (p *PrometheusClient) QueryRange(ctx context.Context, query string, start,
 		End:   end,
 		Step:  step,
 	}
-	result, warnings, err := p.client.QueryRange(ctx, query, r, opts...)
+	result, warnings, err := p.queryRange(ctx, query, r, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -235,7 +252,7 @@ func (p *PrometheusClient) QueryRangeMatrix(ctx context.Context, query string, s
 		End:   end,
 		Step:  step,
 	}
-	result, warnings, err := p.client.QueryRange(ctx, query, r, opts...)
+	result, warnings, err := p.queryRange(ctx, query, r, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,402 @@
+package prom
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	promtheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// defaultCacheMaxEntries 默认最多缓存的条目数
+	defaultCacheMaxEntries = 1000
+	// defaultCacheChunkSize 默认的范围查询分片长度
+	defaultCacheChunkSize = time.Hour
+	// defaultCacheTTL 默认的仍可能变化的结果的缓存时间
+	defaultCacheTTL = 30 * time.Second
+	// defaultCacheMaxFreshness 默认的仍可能变化的时间窗口，与默认的 lookback delta 相同
+	defaultCacheMaxFreshness = 5 * time.Minute
+)
+
+// QueryCacheConfig 查询结果缓存配置，字段为 0 时使用默认值
+type QueryCacheConfig struct {
+	// MaxEntries 最多缓存的条目数，范围查询每个分片占一条，超过时淘汰最久没有使用的条目，默认 1000
+	MaxEntries int
+	// ChunkSize 范围查询按 ChunkSize 切分为对齐的分片分别缓存，会向上取整为步长的整数倍，默认 1h
+	ChunkSize time.Duration
+	// TTL 最近的仍可能变化的分片和即时查询结果的缓存时间，默认 30s
+	TTL time.Duration
+	// MaxFreshness 最后一个评估时间在 now-MaxFreshness 之后的分片视为仍可能变化，默认 5m
+	MaxFreshness time.Duration
+}
+
+// WithQueryCache 开启查询结果缓存，Query、QueryResPromQL、QueryVector、QueryRange 和 QueryRangeMatrix 经过缓存，
+// 并发的相同请求只发送一次
+// 范围查询的开始和结束时间向下对齐到步长的整数倍，因此结果的时间戳可能与不开启缓存时不同；
+// 使用 @ start() 或 @ end() 的范围查询不经过缓存
+func WithQueryCache(cfg QueryCacheConfig) Option {
+	return func(pc *PrometheusClient) {
+		pc.cache = newQueryCache(cfg)
+	}
+}
+
+// queryCache 查询结果缓存，使用 LRU 淘汰
+type queryCache struct {
+	cfg   QueryCacheConfig
+	now   func() time.Time
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// cacheEntry 缓存的查询结果
+type cacheEntry struct {
+	key      string
+	value    prommodel.Value
+	warnings promtheusv1.Warnings
+	// end 范围查询分片实际查询到的最后一个评估时间，即时查询为查询时间
+	end time.Time
+	// expires 过期时间，零值表示不过期
+	expires time.Time
+}
+
+func newQueryCache(cfg QueryCacheConfig) *queryCache {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultCacheMaxEntries
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = defaultCacheChunkSize
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultCacheTTL
+	}
+	if cfg.MaxFreshness <= 0 {
+		cfg.MaxFreshness = defaultCacheMaxFreshness
+	}
+	return &queryCache{
+		cfg:     cfg,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// query 执行即时查询，查询时间在 now-MaxFreshness 之后时结果只缓存 TTL
+// 返回缓存结果的副本，调用方修改结果不会影响缓存
+func (c *queryCache) query(ctx context.Context, client promtheusv1.API, query string, ts time.Time, opts ...promtheusv1.Option) (prommodel.Value, promtheusv1.Warnings, error) {
+	normalized, _, ok := normalizeQuery(query)
+	if !ok || ts.IsZero() {
+		return client.Query(ctx, query, ts, opts...)
+	}
+	key := cacheKey("query", normalized, optionsKey(opts), strconv.FormatInt(ts.UnixMilli(), 10))
+	entry, err := c.fetch(ctx, key, ts, c.ttl(ts), func(ctx context.Context) (prommodel.Value, promtheusv1.Warnings, error) {
+		return client.Query(ctx, query, ts, opts...)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return cloneValue(entry.value), append(promtheusv1.Warnings(nil), entry.warnings...), nil
+}
+
+// queryRange 执行范围查询，按 ChunkSize 切分为对齐的分片，分片可以在时间窗口重叠的请求之间复用
+// 使用 @ start() 或 @ end() 的查询结果依赖完整的查询范围，无法按分片缓存，直接查询
+func (c *queryCache) queryRange(ctx context.Context, client promtheusv1.API, query string, r promtheusv1.Range, opts ...promtheusv1.Option) (prommodel.Value, promtheusv1.Warnings, error) {
+	normalized, expr, ok := normalizeQuery(query)
+	if !ok || r.Step <= 0 || r.End.Before(r.Start) || usesStartOrEnd(expr) {
+		return client.QueryRange(ctx, query, r, opts...)
+	}
+
+	step := r.Step
+	start, end := alignTime(r.Start, step), alignTime(r.End, step)
+	chunk := c.chunkSize(step)
+	prefix := cacheKey("query_range", normalized, optionsKey(opts), strconv.FormatInt(step.Milliseconds(), 10))
+
+	var (
+		parts    []prommodel.Matrix
+		warnings promtheusv1.Warnings
+	)
+	for chunkStart := alignTime(start, chunk); !chunkStart.After(end); chunkStart = chunkStart.Add(chunk) {
+		chunkEnd := chunkStart.Add(chunk - step)
+		ttl := c.ttl(chunkEnd)
+		if ttl > 0 {
+			// 仍可能变化的分片只查询到需要的结束时间
+			chunkEnd = minTime(chunkEnd, end)
+		}
+		rng := promtheusv1.Range{Start: chunkStart, End: chunkEnd, Step: step}
+		key := cacheKey(prefix, strconv.FormatInt(chunkStart.UnixMilli(), 10))
+		entry, err := c.fetch(ctx, key, chunkEnd, ttl, func(ctx context.Context) (prommodel.Value, promtheusv1.Warnings, error) {
+			return client.QueryRange(ctx, query, rng, opts...)
+		})
+		if err != nil {
+			return nil, warnings, err
+		}
+		matrix, ok := entry.value.(prommodel.Matrix)
+		if !ok {
+			return nil, warnings, fmt.Errorf("range query returned %s, not a matrix", entry.value.Type())
+		}
+		parts = append(parts, matrix)
+		warnings = append(warnings, entry.warnings...)
+	}
+	return mergeMatrix(parts, start, end), warnings, nil
+}
+
+// fetch 返回缓存中查询到 end 的结果，没有时调用 fn 查询，相同 key 和 end 的并发请求只调用一次 fn
+// fn 使用不会随调用方取消的 context，调用方取消时只是不再等待结果
+func (c *queryCache) fetch(ctx context.Context, key string, end time.Time, ttl time.Duration,
+	fn func(ctx context.Context) (prommodel.Value, promtheusv1.Warnings, error)) (*cacheEntry, error) {
+	if entry, ok := c.get(key); ok && !entry.end.Before(end) {
+		return entry, nil
+	}
+
+	flightKey := cacheKey(key, strconv.FormatInt(end.UnixMilli(), 10))
+	ch := c.group.DoChan(flightKey, func() (any, error) {
+		fctx, cancel := detachContext(ctx)
+		defer cancel()
+		value, warnings, err := fn(fctx)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, errors.New("empty query result")
+		}
+		entry := &cacheEntry{key: key, value: value, warnings: warnings, end: end}
+		if ttl > 0 {
+			entry.expires = c.now().Add(ttl)
+		}
+		c.set(entry)
+		return entry, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*cacheEntry), nil
+	}
+}
+
+// ttl 最后一个评估时间为 ts 的结果仍可能变化时返回 TTL，否则返回 0 表示不过期
+func (c *queryCache) ttl(ts time.Time) time.Duration {
+	if ts.After(c.now().Add(-c.cfg.MaxFreshness)) {
+		return c.cfg.TTL
+	}
+	return 0
+}
+
+// chunkSize 返回不小于 ChunkSize 的步长的整数倍
+func (c *queryCache) chunkSize(step time.Duration) time.Duration {
+	n := (c.cfg.ChunkSize + step - 1) / step
+	return n * step
+}
+
+func (c *queryCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+func (c *queryCache) set(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.cfg.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// len 返回缓存的条目数
+func (c *queryCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// normalizeQuery 使用 parser.Prettify 格式化查询，格式不同的相同查询使用同一个缓存，查询不合法时返回 false
+func normalizeQuery(query string) (string, parser.Expr, bool) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", nil, false
+	}
+	return parser.Prettify(expr), expr, true
+}
+
+// usesStartOrEnd 判断查询中是否有 @ start() 或 @ end()，范围查询中它们取决于查询的开始和结束时间
+func usesStartOrEnd(expr parser.Expr) bool {
+	found := false
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			found = found || n.StartOrEnd != 0
+		case *parser.SubqueryExpr:
+			found = found || n.StartOrEnd != 0
+		}
+		return nil
+	})
+	return found
+}
+
+// cloneValue 深拷贝查询结果，用于返回缓存中的结果
+func cloneValue(value prommodel.Value) prommodel.Value {
+	switch v := value.(type) {
+	case prommodel.Vector:
+		vector := make(prommodel.Vector, 0, len(v))
+		for _, sample := range v {
+			s := *sample
+			s.Metric = sample.Metric.Clone()
+			s.Histogram = cloneHistogram(sample.Histogram)
+			vector = append(vector, &s)
+		}
+		return vector
+	case prommodel.Matrix:
+		matrix := make(prommodel.Matrix, 0, len(v))
+		for _, stream := range v {
+			s := &prommodel.SampleStream{
+				Metric: stream.Metric.Clone(),
+				Values: append([]prommodel.SamplePair(nil), stream.Values...),
+			}
+			for _, h := range stream.Histograms {
+				s.Histograms = append(s.Histograms, prommodel.SampleHistogramPair{Timestamp: h.Timestamp, Histogram: cloneHistogram(h.Histogram)})
+			}
+			matrix = append(matrix, s)
+		}
+		return matrix
+	case *prommodel.Scalar:
+		s := *v
+		return &s
+	case *prommodel.String:
+		s := *v
+		return &s
+	}
+	return value
+}
+
+func cloneHistogram(h *prommodel.SampleHistogram) *prommodel.SampleHistogram {
+	if h == nil {
+		return nil
+	}
+	res := *h
+	res.Buckets = make(prommodel.HistogramBuckets, 0, len(h.Buckets))
+	for _, b := range h.Buckets {
+		bucket := *b
+		res.Buckets = append(res.Buckets, &bucket)
+	}
+	return &res
+}
+
+// optionsKey 返回 API 选项的取值，例如 {timeout:5s limit:10}
+// promtheusv1.Option 修改的结构体没有导出，只能通过反射创建并应用选项
+func optionsKey(opts []promtheusv1.Option) string {
+	if len(opts) == 0 {
+		return ""
+	}
+	target := reflect.New(reflect.TypeOf(opts[0]).In(0).Elem())
+	for _, opt := range opts {
+		reflect.ValueOf(opt).Call([]reflect.Value{target})
+	}
+	return fmt.Sprintf("%+v", target.Elem().Interface())
+}
+
+func cacheKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// alignTime 将 t 向下对齐到 Unix 零点开始的 d 的整数倍
+func alignTime(t time.Time, d time.Duration) time.Time {
+	ms, step := t.UnixMilli(), d.Milliseconds()
+	aligned := ms - ms%step
+	if ms < 0 && ms%step != 0 {
+		aligned -= step
+	}
+	return time.UnixMilli(aligned).UTC()
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// detachContext 返回不会随 ctx 取消但保留 ctx 截止时间的 context，没有截止时间时使用默认超时
+func detachContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithTimeout(detached, defaultQueryTimeout)
+}
+
+// mergeMatrix 按序列合并各分片的结果，只保留 [start, end] 之间的样本，结果按标签排序
+// 返回新的 SampleStream，不修改缓存中的结果
+func mergeMatrix(parts []prommodel.Matrix, start, end time.Time) prommodel.Matrix {
+	from, to := prommodel.TimeFromUnixNano(start.UnixNano()), prommodel.TimeFromUnixNano(end.UnixNano())
+	inRange := func(ts prommodel.Time) bool {
+		return !ts.Before(from) && !ts.After(to)
+	}
+
+	series := make(map[prommodel.Fingerprint]*prommodel.SampleStream)
+	merged := prommodel.Matrix{}
+	for _, matrix := range parts {
+		for _, s := range matrix {
+			fp := s.Metric.Fingerprint()
+			stream, ok := series[fp]
+			if !ok {
+				stream = &prommodel.SampleStream{Metric: s.Metric.Clone()}
+				series[fp] = stream
+				merged = append(merged, stream)
+			}
+			for _, v := range s.Values {
+				if inRange(v.Timestamp) {
+					stream.Values = append(stream.Values, v)
+				}
+			}
+			for _, h := range s.Histograms {
+				if inRange(h.Timestamp) {
+					stream.Histograms = append(stream.Histograms, h)
+				}
+			}
+		}
+	}
+
+	result := merged[:0]
+	for _, stream := range merged {
+		if len(stream.Values) > 0 || len(stream.Histograms) > 0 {
+			result = append(result, stream)
+		}
+	}
+	sort.Sort(result)
+	return result
+}
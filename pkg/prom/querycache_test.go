@@ -0,0 +1,440 @@
+package prom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	promtheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheTestServer 模拟 Prometheus API，序列 up{job="a"} 在每个评估时间的值为时间戳的秒数
+type cacheTestServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []cacheRequest
+	// block 不为空时请求等待 block 关闭后才返回
+	block chan struct{}
+	// fail 为 true 时返回错误
+	fail atomic.Bool
+}
+
+// cacheRequest 收到的请求参数
+type cacheRequest struct {
+	path, query, start, end, step, time, timeout string
+}
+
+func newCacheTestServer(t *testing.T) *cacheTestServer {
+	s := &cacheTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *cacheTestServer) handle(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mu.Lock()
+	s.requests = append(s.requests, cacheRequest{
+		path: r.URL.Path, query: r.Form.Get("query"), start: r.Form.Get("start"), end: r.Form.Get("end"),
+		step: r.Form.Get("step"), time: r.Form.Get("time"), timeout: r.Form.Get("timeout"),
+	})
+	block := s.block
+	s.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	if s.fail.Load() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"boom"}`))
+		return
+	}
+
+	metric := map[string]string{"__name__": "up", "job": "a"}
+	var data any
+	if r.URL.Path == "/api/v1/query_range" {
+		start, _ := strconv.ParseFloat(r.Form.Get("start"), 64)
+		end, _ := strconv.ParseFloat(r.Form.Get("end"), 64)
+		step, _ := strconv.ParseFloat(r.Form.Get("step"), 64)
+		values := [][]any{}
+		for ts := start; ts <= end; ts += step {
+			values = append(values, []any{ts, strconv.FormatFloat(ts, 'f', -1, 64)})
+		}
+		data = map[string]any{"resultType": "matrix", "result": []any{map[string]any{"metric": metric, "values": values}}}
+	} else {
+		ts, _ := strconv.ParseFloat(r.Form.Get("time"), 64)
+		data = map[string]any{"resultType": "vector", "result": []any{map[string]any{"metric": metric, "value": []any{ts, "1"}}}}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"status": "success", "data": data})
+}
+
+// requestCount 返回收到的请求数
+func (s *cacheTestServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+// ranges 返回收到的范围查询的 start-end
+func (s *cacheTestServer) ranges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ranges []string
+	for _, r := range s.requests {
+		ranges = append(ranges, r.start+"-"+r.end)
+	}
+	return ranges
+}
+
+// newCachedClient 创建开启缓存的客户端，当前时间固定为 now
+func newCachedClient(t *testing.T, server *cacheTestServer, cfg QueryCacheConfig, now *time.Time) *PrometheusClient {
+	t.Helper()
+	client, err := NewPrometheusClient(server.URL, WithQueryCache(cfg))
+	require.NoError(t, err)
+	client.cache.now = func() time.Time { return *now }
+	return client
+}
+
+// at 返回 Unix 零点之后 offset 的时间
+func at(offset time.Duration) time.Time {
+	return time.Unix(0, 0).UTC().Add(offset)
+}
+
+// matrixTimestamps 返回唯一序列的样本时间（秒），并检查值等于时间
+func matrixTimestamps(t *testing.T, matrix prommodel.Matrix) []int64 {
+	t.Helper()
+	require.Len(t, matrix, 1)
+	var timestamps []int64
+	for _, v := range matrix[0].Values {
+		assert.Equal(t, float64(v.Timestamp.Unix()), float64(v.Value))
+		timestamps = append(timestamps, v.Timestamp.Unix())
+	}
+	return timestamps
+}
+
+// secondsRange 返回从 from 到 to 间隔 step 的秒数
+func secondsRange(from, to, step time.Duration) []int64 {
+	var seconds []int64
+	for d := from; d <= to; d += step {
+		seconds = append(seconds, int64(d.Seconds()))
+	}
+	return seconds
+}
+
+func TestQueryCacheRangeChunks(t *testing.T) {
+	server := newCacheTestServer(t)
+	now := at(48 * time.Hour)
+	client := newCachedClient(t, server, QueryCacheConfig{}, &now)
+	ctx := context.Background()
+
+	// 开始时间向下对齐到步长，分片覆盖 0:00-0:59、1:00-1:59、2:00-2:59
+	matrix, err := client.QueryRangeMatrix(ctx, "up", at(30*time.Second), at(2*time.Hour+10*time.Minute+20*time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, secondsRange(0, 2*time.Hour+10*time.Minute, time.Minute), matrixTimestamps(t, matrix))
+	assert.Equal(t, []string{"0-3540", "3600-7140", "7200-10740"}, server.ranges())
+	assert.Equal(t, 3, client.cache.len())
+
+	// 重叠的时间窗口只查询没有缓存的分片，格式不同的相同查询共用缓存
+	matrix, err = client.QueryRangeMatrix(ctx, "  up{}", at(time.Hour+30*time.Minute), at(3*time.Hour+5*time.Minute), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, secondsRange(time.Hour+30*time.Minute, 3*time.Hour+5*time.Minute, time.Minute), matrixTimestamps(t, matrix))
+	assert.Equal(t, []string{"0-3540", "3600-7140", "7200-10740", "10800-14340"}, server.ranges())
+
+	// 步长不同时使用不同的缓存，分片长度取整为步长的整数倍
+	value, err := client.QueryRange(ctx, "up", at(0), at(time.Hour), 7*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, secondsRange(0, 56*time.Minute, 7*time.Minute), matrixTimestamps(t, value.(prommodel.Matrix)))
+	assert.Equal(t, []string{"0-3360"}, server.ranges()[4:])
+
+	// 缓存的结果不会被调用方修改
+	matrix[0].Values[0].Value = -1
+	matrix[0].Metric["job"] = "changed"
+	matrix, err = client.QueryRangeMatrix(ctx, "up", at(time.Hour+30*time.Minute), at(time.Hour+30*time.Minute), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, prommodel.LabelValue("a"), matrix[0].Metric["job"])
+	assert.Equal(t, []int64{5400}, matrixTimestamps(t, matrix))
+	assert.Equal(t, 5, server.requestCount())
+}
+
+func TestQueryCacheMutableChunk(t *testing.T) {
+	server := newCacheTestServer(t)
+	now := at(2*time.Hour + 5*time.Minute)
+	client := newCachedClient(t, server, QueryCacheConfig{TTL: 30 * time.Second, MaxFreshness: 5 * time.Minute}, &now)
+	ctx := context.Background()
+
+	query := func(end time.Duration) []int64 {
+		matrix, err := client.QueryRangeMatrix(ctx, "up", at(time.Hour), at(end), time.Minute)
+		require.NoError(t, err)
+		return matrixTimestamps(t, matrix)
+	}
+
+	// 最近的分片只查询到需要的结束时间
+	assert.Equal(t, secondsRange(time.Hour, 2*time.Hour+5*time.Minute, time.Minute), query(2*time.Hour+5*time.Minute))
+	assert.Equal(t, []string{"3600-7140", "7200-7500"}, server.ranges())
+
+	// TTL 内复用，结束时间更早时也复用
+	query(2*time.Hour + 5*time.Minute)
+	assert.Equal(t, secondsRange(time.Hour, 2*time.Hour+2*time.Minute, time.Minute), query(2*time.Hour+2*time.Minute))
+	assert.Equal(t, 2, server.requestCount())
+
+	// 结束时间超过缓存的结果时重新查询
+	now = now.Add(time.Minute)
+	query(2*time.Hour + 6*time.Minute)
+	assert.Equal(t, []string{"7200-7560"}, server.ranges()[2:])
+
+	// 超过 TTL 后重新查询，已经完整的分片不过期
+	now = now.Add(time.Minute)
+	query(2*time.Hour + 6*time.Minute)
+	assert.Equal(t, []string{"7200-7560"}, server.ranges()[3:])
+
+	// 分片的最后一个评估时间早于 now-MaxFreshness 后查询完整的分片且不再过期
+	now = at(3*time.Hour + 10*time.Minute)
+	query(2*time.Hour + 6*time.Minute)
+	assert.Equal(t, []string{"7200-10740"}, server.ranges()[4:])
+	now = now.Add(24 * time.Hour)
+	query(2*time.Hour + 59*time.Minute)
+	assert.Equal(t, 5, server.requestCount())
+}
+
+func TestQueryCacheInstant(t *testing.T) {
+	server := newCacheTestServer(t)
+	now := at(time.Hour)
+	client := newCachedClient(t, server, QueryCacheConfig{TTL: time.Minute}, &now)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		vector, err := client.QueryVector(ctx, "sum by (job) (up)", at(10*time.Minute))
+		require.NoError(t, err)
+		require.Len(t, vector, 1)
+		value, err := client.QueryOneValue(ctx, "sum(up) by (job)", at(10*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, prommodel.SampleValue(1), value)
+	}
+	assert.Equal(t, 1, server.requestCount(), "normalized query shares cache")
+
+	// 缓存的结果不会被调用方修改
+	vector, err := client.QueryVector(ctx, "sum by (job) (up)", at(10*time.Minute))
+	require.NoError(t, err)
+	vector[0].Value = -1
+	vector[0].Metric["job"] = "changed"
+	vector, err = client.QueryVector(ctx, "sum by (job) (up)", at(10*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, prommodel.SampleValue(1), vector[0].Value)
+	assert.Equal(t, prommodel.LabelValue("a"), vector[0].Metric["job"])
+	assert.Equal(t, 1, server.requestCount())
+
+	// 选项不同时使用不同的缓存
+	_, err = client.QueryVector(ctx, "sum by (job) (up)", at(10*time.Minute), promtheusv1.WithTimeout(5*time.Second))
+	require.NoError(t, err)
+	_, err = client.QueryVector(ctx, "sum by (job) (up)", at(10*time.Minute), promtheusv1.WithTimeout(5*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.requestCount())
+
+	// 最近的查询时间只缓存 TTL
+	_, err = client.Query(ctx, "up", now)
+	require.NoError(t, err)
+	_, err = client.Query(ctx, "up", now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, server.requestCount())
+	now = now.Add(time.Minute)
+	_, err = client.Query(ctx, "up", at(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 4, server.requestCount())
+
+	// 不合法的查询和没有指定时间的查询不经过缓存
+	_, err = client.QueryMetric(ctx, "up")
+	require.NoError(t, err)
+	_, err = client.QueryResPromQL(ctx, "sum(", at(time.Minute))
+	require.NoError(t, err)
+	_, err = client.QueryResPromQL(ctx, "sum(", at(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 7, server.requestCount())
+}
+
+func TestQueryCacheStartOrEnd(t *testing.T) {
+	server := newCacheTestServer(t)
+	now := at(48 * time.Hour)
+	client := newCachedClient(t, server, QueryCacheConfig{}, &now)
+	ctx := context.Background()
+
+	// @ start() 和 @ end() 取决于完整的查询范围，范围查询不按分片缓存
+	for _, query := range []string{"up @ start()", "rate(up[5m] @ end())", "max_over_time(up[10m:1m] @ end())"} {
+		for i := 0; i < 2; i++ {
+			_, err := client.QueryRangeMatrix(ctx, query, at(30*time.Minute), at(2*time.Hour), time.Minute)
+			require.NoError(t, err)
+		}
+	}
+	assert.Equal(t, []string{"1800-7200", "1800-7200", "1800-7200", "1800-7200", "1800-7200", "1800-7200"}, server.ranges())
+	assert.Zero(t, client.cache.len())
+
+	// 即时查询的 start() 和 end() 就是查询时间，仍然缓存
+	for i := 0; i < 2; i++ {
+		_, err := client.QueryVector(ctx, "up @ end()", at(10*time.Minute))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 7, server.requestCount())
+}
+
+func TestQueryCacheCoalescing(t *testing.T) {
+	server := newCacheTestServer(t)
+	server.block = make(chan struct{})
+	now := at(48 * time.Hour)
+	client := newCachedClient(t, server, QueryCacheConfig{}, &now)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]prommodel.Matrix, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = client.QueryRangeMatrix(context.Background(), "up", at(0), at(30*time.Minute), time.Minute)
+		}(i)
+	}
+	require.Eventually(t, func() bool { return server.requestCount() == 1 }, time.Second, time.Millisecond)
+	// 等待其他调用加入同一个请求
+	time.Sleep(50 * time.Millisecond)
+	close(server.block)
+	wg.Wait()
+
+	assert.Equal(t, 1, server.requestCount())
+	for i := 0; i < callers; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, secondsRange(0, 30*time.Minute, time.Minute), matrixTimestamps(t, results[i]))
+	}
+}
+
+func TestQueryCacheCancelAndErrors(t *testing.T) {
+	server := newCacheTestServer(t)
+	now := at(48 * time.Hour)
+	client := newCachedClient(t, server, QueryCacheConfig{}, &now)
+
+	t.Run("Errors are not cached", func(t *testing.T) {
+		server.fail.Store(true)
+		_, err := client.QueryVector(context.Background(), "up", at(time.Minute))
+		assert.ErrorContains(t, err, "boom")
+		server.fail.Store(false)
+		_, err = client.QueryVector(context.Background(), "up", at(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, server.requestCount())
+	})
+
+	t.Run("Canceled caller does not cancel the shared request", func(t *testing.T) {
+		server.mu.Lock()
+		server.block = make(chan struct{})
+		server.mu.Unlock()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			_, err := client.QueryVector(ctx, "up", at(2*time.Minute))
+			done <- err
+		}()
+		require.Eventually(t, func() bool { return server.requestCount() == 3 }, time.Second, time.Millisecond)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+
+		close(server.block)
+		require.Eventually(t, func() bool {
+			_, ok := client.cache.get(cacheKey("query", "up", "", strconv.FormatInt(at(2*time.Minute).UnixMilli(), 10)))
+			return ok
+		}, time.Second, time.Millisecond)
+		_, err := client.QueryVector(context.Background(), "up", at(2*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, server.requestCount())
+	})
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	server := newCacheTestServer(t)
+	now := at(48 * time.Hour)
+	client := newCachedClient(t, server, QueryCacheConfig{MaxEntries: 2}, &now)
+	ctx := context.Background()
+
+	for _, minute := range []time.Duration{1, 2, 1, 3, 1, 2} {
+		_, err := client.QueryVector(ctx, "up", at(minute*time.Minute))
+		require.NoError(t, err)
+	}
+	// 1 一直在使用不会被淘汰，2 在 3 加入时被淘汰
+	var times []string
+	server.mu.Lock()
+	for _, r := range server.requests {
+		times = append(times, r.time)
+	}
+	server.mu.Unlock()
+	assert.Equal(t, []string{"60", "120", "180", "120"}, times)
+	assert.Equal(t, 2, client.cache.len())
+}
+
+func TestQueryCacheConfigDefaults(t *testing.T) {
+	c := newQueryCache(QueryCacheConfig{MaxEntries: -1, TTL: -1})
+	assert.Equal(t, QueryCacheConfig{
+		MaxEntries:   defaultCacheMaxEntries,
+		ChunkSize:    defaultCacheChunkSize,
+		TTL:          defaultCacheTTL,
+		MaxFreshness: defaultCacheMaxFreshness,
+	}, c.cfg)
+	assert.Equal(t, time.Hour, c.chunkSize(time.Minute))
+	assert.Equal(t, 63*time.Minute, c.chunkSize(7*time.Minute))
+	assert.Equal(t, 2*time.Hour, c.chunkSize(2*time.Hour))
+}
+
+func TestOptionsKey(t *testing.T) {
+	assert.Equal(t, "", optionsKey(nil))
+	assert.Equal(t,
+		optionsKey([]promtheusv1.Option{promtheusv1.WithTimeout(time.Second), promtheusv1.WithLimit(10)}),
+		optionsKey([]promtheusv1.Option{promtheusv1.WithLimit(10), promtheusv1.WithTimeout(time.Second)}))
+	assert.NotEqual(t,
+		optionsKey([]promtheusv1.Option{promtheusv1.WithLimit(10)}),
+		optionsKey([]promtheusv1.Option{promtheusv1.WithLimit(20)}))
+}
+
+func TestAlignTime(t *testing.T) {
+	tests := []struct {
+		name     string        // 测试用例名称
+		t        time.Time     // 对齐前的时间
+		d        time.Duration // 对齐间隔
+		expected time.Time     // 期望的时间
+	}{
+		{name: "Aligned", t: at(2 * time.Minute), d: time.Minute, expected: at(2 * time.Minute)},
+		{name: "Round down", t: at(2*time.Minute + 59*time.Second), d: time.Minute, expected: at(2 * time.Minute)},
+		{name: "Sub-second", t: at(1500 * time.Millisecond), d: time.Second, expected: at(time.Second)},
+		{name: "Before epoch", t: at(-90 * time.Second), d: time.Minute, expected: at(-2 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, alignTime(tt.t, tt.d))
+		})
+	}
+}
+
+func TestMergeMatrix(t *testing.T) {
+	a := prommodel.Metric{"job": "a"}
+	b := prommodel.Metric{"job": "b"}
+	pairs := func(seconds ...int64) []prommodel.SamplePair {
+		var values []prommodel.SamplePair
+		for _, s := range seconds {
+			values = append(values, prommodel.SamplePair{Timestamp: prommodel.TimeFromUnix(s), Value: prommodel.SampleValue(s)})
+		}
+		return values
+	}
+	parts := []prommodel.Matrix{
+		{{Metric: b, Values: pairs(0, 60)}, {Metric: a, Values: pairs(0, 60)}},
+		{{Metric: a, Values: pairs(120, 180)}, {Metric: prommodel.Metric{"job": "c"}, Values: pairs(180)}},
+	}
+	merged := mergeMatrix(parts, at(time.Minute), at(2*time.Minute))
+	assert.Equal(t, prommodel.Matrix{
+		{Metric: a, Values: pairs(60, 120)},
+		{Metric: b, Values: pairs(60)},
+	}, merged)
+	assert.Equal(t, fmt.Sprint(pairs(0, 60)), fmt.Sprint(parts[0][0].Values), "parts are not modified")
+}
@@ -0,0 +1,549 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	prommodel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	httputil "github.piwriw.go-tools/pkg/httputil"
+)
+
+const (
+	// defaultRemoteWriteShards 默认并发发送的分片数
+	defaultRemoteWriteShards = 4
+	// defaultRemoteWriteBatchSize 每个请求最多的样本数，与 Prometheus 默认的 max_samples_per_send 相同
+	defaultRemoteWriteBatchSize = 2000
+	// defaultRemoteWriteMaxRetries 可重试的错误最多重试的次数
+	defaultRemoteWriteMaxRetries = 5
+	// defaultRemoteWriteMinBackoff 第一次重试前的等待时间，与 Prometheus 默认的 min_backoff 相同
+	defaultRemoteWriteMinBackoff = 30 * time.Millisecond
+	// defaultRemoteWriteMaxBackoff 重试的最长等待时间，与 Prometheus 默认的 max_backoff 相同
+	defaultRemoteWriteMaxBackoff = 5 * time.Second
+	// defaultRemoteWriteMaxBodySize 接收的请求体解压前的最大长度
+	defaultRemoteWriteMaxBodySize = 32 << 20
+	// remoteWriteMaxDecodedSize 接收的请求体解压后的最大长度，解压前按 snappy 头部记录的长度检查
+	remoteWriteMaxDecodedSize = 128 << 20
+
+	// remoteWriteVersion remote write 协议版本
+	remoteWriteVersion = "0.1.0"
+	// remoteWriteUserAgent 发送请求使用的 User-Agent
+	remoteWriteUserAgent = "go-tools-remote-write/" + remoteWriteVersion
+)
+
+// RemoteWriter 按 remote write v1 协议将样本发送到兼容 Prometheus 的存储，例如 Prometheus、Mimir、VictoriaMetrics
+// 样本按标签哈希分片，同一序列的样本总是在同一个分片中按顺序发送
+type RemoteWriter struct {
+	url            string
+	token          string
+	client         *http.Client
+	headers        map[string]string
+	externalLabels map[string]string
+	shards         int
+	batchSize      int
+	maxRetries     int
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+}
+
+type RemoteWriteOption func(*RemoteWriter)
+
+// WithRemoteWriteToken 设置认证 token，与 WithToken 相同使用 Authorization 请求头
+func WithRemoteWriteToken(token string) RemoteWriteOption {
+	return func(w *RemoteWriter) {
+		w.token = token
+	}
+}
+
+// WithRemoteWriteHTTPClient 设置发送请求的 http.Client，设置后 WithRemoteWriteToken 和 WithRemoteWriteTimeout 不生效
+func WithRemoteWriteHTTPClient(client *http.Client) RemoteWriteOption {
+	return func(w *RemoteWriter) {
+		if client == nil {
+			return
+		}
+		w.client = client
+	}
+}
+
+// WithRemoteWriteHeaders 设置额外的请求头，例如多租户存储的 X-Scope-OrgID
+func WithRemoteWriteHeaders(headers map[string]string) RemoteWriteOption {
+	return func(w *RemoteWriter) {
+		w.headers = headers
+	}
+}
+
+// WithExternalLabels 设置添加到每个序列的标签，序列中已有同名标签时不覆盖，与 Prometheus 的 external_labels 相同
+func WithExternalLabels(labels map[string]string) RemoteWriteOption {
+	return func(w *RemoteWriter) {
+		w.externalLabels = labels
+	}
+}
+
+// WithRemoteWriteShards 设置并发发送的分片数，默认 4
+func WithRemoteWriteShards(shards int) RemoteWriteOption {
+	return func(w *RemoteWriter) {
+		if shards <= 0 {
+			return
+		}
+		w.shards = shards
+	}
+}
+
+// WithRemoteWriteBatchSize 设置每个请求最多的样本数，默认 2000
+func WithRemoteWriteBatchSize(size int) RemoteWriteOption {
+	return func(w *RemoteWriter) {
+		if size <= 0 {
+			return
+		}
+		w.batchSize = size
+	}
+}
+
+// WithRemoteWriteRetry 设置最多重试次数和指数退避的等待时间，默认重试 5 次，等待 30ms 到 5s
+// maxRetries 为 0 时不重试
+func WithRemoteWriteRetry(maxRetries int, minBackoff, maxBackoff time.Duration) RemoteWriteOption {
+	return func(w *RemoteWriter) {
+		if maxRetries < 0 || minBackoff <= 0 || maxBackoff < minBackoff {
+			return
+		}
+		w.maxRetries = maxRetries
+		w.minBackoff = minBackoff
+		w.maxBackoff = maxBackoff
+	}
+}
+
+// WithRemoteWriteTimeout 设置每个请求的超时时间，默认 15s
+func WithRemoteWriteTimeout(timeout time.Duration) RemoteWriteOption {
+	return func(w *RemoteWriter) {
+		if timeout <= 0 {
+			return
+		}
+		w.timeout = timeout
+	}
+}
+
+// NewRemoteWriter 创建 RemoteWriter，url 为接收端地址，例如 http://localhost:9090/api/v1/write
+func NewRemoteWriter(url string, opts ...RemoteWriteOption) (*RemoteWriter, error) {
+	if url == "" {
+		return nil, errors.New("remote write url is empty")
+	}
+	w := &RemoteWriter{
+		url:        url,
+		shards:     defaultRemoteWriteShards,
+		batchSize:  defaultRemoteWriteBatchSize,
+		maxRetries: defaultRemoteWriteMaxRetries,
+		minBackoff: defaultRemoteWriteMinBackoff,
+		maxBackoff: defaultRemoteWriteMaxBackoff,
+		timeout:    defaultQueryTimeout,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.client == nil {
+		transport := http.DefaultTransport
+		if w.token != "" {
+			transport = &authTransport{base: http.DefaultTransport, token: w.token}
+		}
+		w.client = &http.Client{Transport: transport, Timeout: w.timeout}
+	}
+	return w, nil
+}
+
+// RemoteWriteError 接收端返回的错误
+type RemoteWriteError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter 429 响应的 Retry-After，没有时为 0
+	RetryAfter time.Duration
+}
+
+func (e *RemoteWriteError) Error() string {
+	return fmt.Sprintf("remote write returned HTTP status %d: %s", e.StatusCode, e.Body)
+}
+
+// Recoverable 5xx 和 429 可以重试，其他错误重试也不会成功
+func (e *RemoteWriteError) Recoverable() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Write 分片、分批发送序列，标签会按名称排序，返回所有分片的错误
+func (w *RemoteWriter) Write(ctx context.Context, series []prompb.TimeSeries) error {
+	shards := make([][]prompb.TimeSeries, w.shards)
+	for _, ts := range series {
+		ts.Labels = w.withExternalLabels(ts.Labels)
+		i := shardOf(ts.Labels, w.shards)
+		shards[i] = append(shards[i], ts)
+	}
+
+	// 一个分片失败时其他分片继续发送，失败的分片停止发送剩余批次以保证序列内样本有序
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, batch := range splitBatches(shard, w.batchSize) {
+				if err := w.send(ctx, batch); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// WriteMatrix 发送 Matrix 中的样本，API 返回的原生直方图无法还原桶的 schema，包含原生直方图时返回错误
+func (w *RemoteWriter) WriteMatrix(ctx context.Context, matrix prommodel.Matrix) error {
+	series := make([]prompb.TimeSeries, 0, len(matrix))
+	for _, stream := range matrix {
+		if len(stream.Histograms) > 0 {
+			return fmt.Errorf("series %s: native histogram samples are not supported", stream.Metric)
+		}
+		ts := prompb.TimeSeries{Labels: labelsFromMetric(stream.Metric)}
+		for _, v := range stream.Values {
+			ts.Samples = append(ts.Samples, prompb.Sample{Value: float64(v.Value), Timestamp: int64(v.Timestamp)})
+		}
+		series = append(series, ts)
+	}
+	return w.Write(ctx, series)
+}
+
+// WriteGatherer 采集 gatherer 中的指标并发送，没有时间戳的样本使用 ts
+// 用于在没有 Pushgateway 时推送服务自身的指标，通常与 WithExternalLabels 一起设置 job 和 instance
+func (w *RemoteWriter) WriteGatherer(ctx context.Context, gatherer prometheus.Gatherer, ts time.Time) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics: %w", err)
+	}
+	vector, err := expfmt.ExtractSamples(&expfmt.DecodeOptions{Timestamp: prommodel.TimeFromUnixNano(ts.UnixNano())}, families...)
+	if err != nil {
+		return fmt.Errorf("extract samples: %w", err)
+	}
+	series := make([]prompb.TimeSeries, 0, len(vector))
+	for _, s := range vector {
+		series = append(series, prompb.TimeSeries{
+			Labels:  labelsFromMetric(s.Metric),
+			Samples: []prompb.Sample{{Value: float64(s.Value), Timestamp: int64(s.Timestamp)}},
+		})
+	}
+	return w.Write(ctx, series)
+}
+
+// send 发送一个批次，可重试的错误按指数退避重试
+func (w *RemoteWriter) send(ctx context.Context, series []prompb.TimeSeries) error {
+	req := &prompb.WriteRequest{Timeseries: series}
+	data, err := req.Marshal()
+	if err != nil {
+		return fmt.Errorf("marshal write request: %w", err)
+	}
+	body := snappy.Encode(nil, data)
+
+	backoff := w.minBackoff
+	for attempt := 0; ; attempt++ {
+		err = w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		var rwErr *RemoteWriteError
+		if errors.As(err, &rwErr) && !rwErr.Recoverable() {
+			return err
+		}
+		if ctx.Err() != nil || attempt >= w.maxRetries {
+			return err
+		}
+
+		wait := backoff
+		if rwErr != nil && rwErr.RetryAfter > wait {
+			wait = min(rwErr.RetryAfter, w.maxBackoff)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, w.maxBackoff)
+	}
+}
+
+func (w *RemoteWriter) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", remoteWriteUserAgent)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	rwErr := &RemoteWriteError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(msg))}
+	if delay, ok := httputil.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		rwErr.RetryAfter = delay
+	}
+	return rwErr
+}
+
+// withExternalLabels 添加外部标签并按名称排序，返回新的切片
+func (w *RemoteWriter) withExternalLabels(lbls []prompb.Label) []prompb.Label {
+	result := make([]prompb.Label, 0, len(lbls)+len(w.externalLabels))
+	seen := make(map[string]struct{}, len(lbls))
+	for _, l := range lbls {
+		seen[l.Name] = struct{}{}
+		result = append(result, l)
+	}
+	for name, value := range w.externalLabels {
+		if _, ok := seen[name]; !ok {
+			result = append(result, prompb.Label{Name: name, Value: value})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// shardOf 按标签哈希返回分片序号
+func shardOf(lbls []prompb.Label, shards int) int {
+	h := fnv.New64a()
+	for _, l := range lbls {
+		h.Write([]byte(l.Name))
+		h.Write([]byte{0xff})
+		h.Write([]byte(l.Value))
+		h.Write([]byte{0xff})
+	}
+	return int(h.Sum64() % uint64(shards))
+}
+
+// splitBatches 按样本数切分批次，样本数超过 size 的序列拆分到多个批次
+func splitBatches(series []prompb.TimeSeries, size int) [][]prompb.TimeSeries {
+	var (
+		batches [][]prompb.TimeSeries
+		batch   []prompb.TimeSeries
+		count   int
+	)
+	flush := func() {
+		if len(batch) > 0 {
+			batches = append(batches, batch)
+		}
+		batch, count = nil, 0
+	}
+	for _, ts := range series {
+		samples, histograms := ts.Samples, ts.Histograms
+		for {
+			n := min(len(samples), size-count)
+			m := min(len(histograms), size-count-n)
+			part := prompb.TimeSeries{Labels: ts.Labels, Samples: samples[:n], Histograms: histograms[:m]}
+			samples, histograms = samples[n:], histograms[m:]
+			if n+m > 0 || len(ts.Samples)+len(ts.Histograms) == 0 {
+				batch = append(batch, part)
+				count += n + m
+			}
+			if count >= size {
+				flush()
+			}
+			if len(samples) == 0 && len(histograms) == 0 {
+				break
+			}
+		}
+	}
+	flush()
+	return batches
+}
+
+func labelsFromMetric(metric prommodel.Metric) []prompb.Label {
+	lbls := make([]prompb.Label, 0, len(metric))
+	for name, value := range metric {
+		lbls = append(lbls, prompb.Label{Name: string(name), Value: string(value)})
+	}
+	return lbls
+}
+
+// RemoteWriteHandler 接收 remote write v1 请求，将样本转换为 Matrix 后交给 appendFn 处理
+// 解码失败返回 400，appendFn 返回错误时返回 500，成功时返回 204
+type RemoteWriteHandler struct {
+	appendFn    func(ctx context.Context, matrix prommodel.Matrix) error
+	maxBodySize int64
+}
+
+// NewRemoteWriteHandler 创建 RemoteWriteHandler，可以注册到 /api/v1/write
+func NewRemoteWriteHandler(appendFn func(ctx context.Context, matrix prommodel.Matrix) error) *RemoteWriteHandler {
+	return &RemoteWriteHandler{appendFn: appendFn, maxBodySize: defaultRemoteWriteMaxBodySize}
+}
+
+func (h *RemoteWriteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if enc := r.Header.Get("Content-Encoding"); enc != "" && enc != "snappy" {
+		http.Error(w, fmt.Sprintf("unsupported content encoding %q", enc), http.StatusUnsupportedMediaType)
+		return
+	}
+	matrix, err := DecodeRemoteWrite(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.appendFn(r.Context(), matrix); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DecodeRemoteWrite 解码 snappy 压缩的 WriteRequest，相同标签的序列合并为一个 SampleStream
+// 解压后超过 128MiB 的请求返回错误，不会分配解压所需的内存
+func DecodeRemoteWrite(r io.Reader) (prommodel.Matrix, error) {
+	compressed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("decode snappy: %w", err)
+	}
+	if size > remoteWriteMaxDecodedSize {
+		return nil, fmt.Errorf("decoded size %d exceeds limit %d", size, remoteWriteMaxDecodedSize)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("decode snappy: %w", err)
+	}
+	var req prompb.WriteRequest
+	if err := req.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("unmarshal write request: %w", err)
+	}
+
+	series := make(map[prommodel.Fingerprint]*prommodel.SampleStream, len(req.Timeseries))
+	matrix := make(prommodel.Matrix, 0, len(req.Timeseries))
+	for _, ts := range req.Timeseries {
+		metric := make(prommodel.Metric, len(ts.Labels))
+		for _, l := range ts.Labels {
+			metric[prommodel.LabelName(l.Name)] = prommodel.LabelValue(l.Value)
+		}
+		fp := metric.Fingerprint()
+		stream, ok := series[fp]
+		if !ok {
+			stream = &prommodel.SampleStream{Metric: metric}
+			series[fp] = stream
+			matrix = append(matrix, stream)
+		}
+		for _, s := range ts.Samples {
+			stream.Values = append(stream.Values, prommodel.SamplePair{
+				Timestamp: prommodel.Time(s.Timestamp),
+				Value:     prommodel.SampleValue(s.Value),
+			})
+		}
+		for _, h := range ts.Histograms {
+			stream.Histograms = append(stream.Histograms, prommodel.SampleHistogramPair{
+				Timestamp: prommodel.Time(h.Timestamp),
+				Histogram: convertHistogram(h.ToFloatHistogram()),
+			})
+		}
+	}
+	return matrix, nil
+}
+
+// RemoteWriteRecorder 记录收到的样本，用于在本地测试 exporter 推送的指标
+//
+//	recorder := &RemoteWriteRecorder{}
+//	server := httptest.NewServer(recorder.Handler())
+//	writer, _ := NewRemoteWriter(server.URL)
+//	_ = writer.WriteGatherer(ctx, registry, time.Now())
+//	rows, _ := recorder.Result().Rows()
+type RemoteWriteRecorder struct {
+	mu     sync.Mutex
+	series map[prommodel.Fingerprint]*prommodel.SampleStream
+}
+
+// Append 合并收到的样本，可以作为 NewRemoteWriteHandler 的参数
+func (r *RemoteWriteRecorder) Append(_ context.Context, matrix prommodel.Matrix) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.series == nil {
+		r.series = make(map[prommodel.Fingerprint]*prommodel.SampleStream)
+	}
+	for _, s := range matrix {
+		fp := s.Metric.Fingerprint()
+		stream, ok := r.series[fp]
+		if !ok {
+			stream = &prommodel.SampleStream{Metric: s.Metric.Clone()}
+			r.series[fp] = stream
+		}
+		stream.Values = append(stream.Values, s.Values...)
+		stream.Histograms = append(stream.Histograms, s.Histograms...)
+	}
+	return nil
+}
+
+// Handler 返回写入 RemoteWriteRecorder 的 RemoteWriteHandler
+func (r *RemoteWriteRecorder) Handler() http.Handler {
+	return NewRemoteWriteHandler(r.Append)
+}
+
+// Result 返回收到的所有序列，序列按标签排序，样本按时间排序
+func (r *RemoteWriteRecorder) Result() *ResPromQL {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matrix := make(prommodel.Matrix, 0, len(r.series))
+	for _, s := range r.series {
+		stream := &prommodel.SampleStream{
+			Metric:     s.Metric.Clone(),
+			Values:     append([]prommodel.SamplePair(nil), s.Values...),
+			Histograms: append([]prommodel.SampleHistogramPair(nil), s.Histograms...),
+		}
+		sort.SliceStable(stream.Values, func(i, j int) bool {
+			return stream.Values[i].Timestamp < stream.Values[j].Timestamp
+		})
+		sort.SliceStable(stream.Histograms, func(i, j int) bool {
+			return stream.Histograms[i].Timestamp < stream.Histograms[j].Timestamp
+		})
+		matrix = append(matrix, stream)
+	}
+	sort.Sort(matrix)
+	return &ResPromQL{matrix}
+}
+
+// Reset 清空收到的样本
+func (r *RemoteWriteRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series = nil
+}
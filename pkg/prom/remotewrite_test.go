@@ -0,0 +1,372 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	prommodel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// remoteWriteTestServer 记录每个请求解码后的序列，前 failures 个请求返回 status
+type remoteWriteTestServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []prommodel.Matrix
+	headers  []http.Header
+	failures atomic.Int32
+	status   int
+	recorder RemoteWriteRecorder
+}
+
+func newRemoteWriteTestServer(t *testing.T) *remoteWriteTestServer {
+	s := &remoteWriteTestServer{status: http.StatusInternalServerError}
+	handler := NewRemoteWriteHandler(func(ctx context.Context, matrix prommodel.Matrix) error {
+		s.mu.Lock()
+		s.requests = append(s.requests, matrix)
+		s.mu.Unlock()
+		return s.recorder.Append(ctx, matrix)
+	})
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.headers = append(s.headers, r.Header.Clone())
+		s.mu.Unlock()
+		if s.failures.Add(-1) >= 0 {
+			w.WriteHeader(s.status)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *remoteWriteTestServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.headers)
+}
+
+func TestRemoteWriterWriteMatrix(t *testing.T) {
+	server := newRemoteWriteTestServer(t)
+	writer, err := NewRemoteWriter(server.URL,
+		WithRemoteWriteToken("secret"),
+		WithRemoteWriteHeaders(map[string]string{"X-Scope-OrgID": "tenant-a"}),
+		WithExternalLabels(map[string]string{"cluster": "dev", "job": "ignored"}),
+	)
+	require.NoError(t, err)
+
+	matrix := prommodel.Matrix{
+		{
+			Metric: prommodel.Metric{"__name__": "up", "job": "api"},
+			Values: []prommodel.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}},
+		},
+		{
+			Metric: prommodel.Metric{"__name__": "up", "job": "db"},
+			Values: []prommodel.SamplePair{{Timestamp: 1000, Value: 1}},
+		},
+	}
+	require.NoError(t, writer.WriteMatrix(context.Background(), matrix))
+
+	result := server.recorder.Result()
+	assert.Equal(t, "up{cluster=\"dev\", job=\"api\"} =>\n1 @[1]\n0 @[2]\n"+
+		"up{cluster=\"dev\", job=\"db\"} =>\n1 @[1]", result.String())
+	metrics, err := result.Metric()
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+
+	header := server.headers[0]
+	assert.Equal(t, "snappy", header.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", header.Get("Content-Type"))
+	assert.Equal(t, "0.1.0", header.Get("X-Prometheus-Remote-Write-Version"))
+	assert.Equal(t, "Basic secret", header.Get("Authorization"))
+	assert.Equal(t, "tenant-a", header.Get("X-Scope-OrgID"))
+
+	histograms := prommodel.Matrix{{
+		Metric:     prommodel.Metric{"__name__": "latency"},
+		Histograms: []prommodel.SampleHistogramPair{{Timestamp: 1000, Histogram: &prommodel.SampleHistogram{}}},
+	}}
+	assert.ErrorContains(t, writer.WriteMatrix(context.Background(), histograms), "native histogram")
+}
+
+func TestRemoteWriterBatching(t *testing.T) {
+	tests := []struct {
+		name      string // 测试用例名称
+		shards    int    // 分片数
+		batchSize int    // 每个请求最多的样本数
+		series    int    // 序列数
+		samples   int    // 每个序列的样本数
+		requests  int    // 期望的请求数
+	}{
+		{name: "Single batch", shards: 1, batchSize: 100, series: 3, samples: 10, requests: 1},
+		{name: "Split series", shards: 1, batchSize: 4, series: 1, samples: 10, requests: 3},
+		{name: "Multiple batches", shards: 1, batchSize: 5, series: 4, samples: 5, requests: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRemoteWriteTestServer(t)
+			writer, err := NewRemoteWriter(server.URL, WithRemoteWriteShards(tt.shards), WithRemoteWriteBatchSize(tt.batchSize))
+			require.NoError(t, err)
+
+			var series []prompb.TimeSeries
+			for i := 0; i < tt.series; i++ {
+				ts := prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: "m"}, {Name: "i", Value: string(rune('a' + i))}}}
+				for j := 0; j < tt.samples; j++ {
+					ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(j * 1000), Value: float64(j)})
+				}
+				series = append(series, ts)
+			}
+			require.NoError(t, writer.Write(context.Background(), series))
+			assert.Equal(t, tt.requests, server.requestCount())
+
+			for _, req := range server.requests {
+				count := 0
+				for _, s := range req {
+					count += len(s.Values)
+				}
+				assert.LessOrEqual(t, count, tt.batchSize)
+			}
+			values, err := server.recorder.Result().Values()
+			require.NoError(t, err)
+			assert.Len(t, values, tt.series*tt.samples)
+		})
+	}
+}
+
+func TestRemoteWriterSharding(t *testing.T) {
+	server := newRemoteWriteTestServer(t)
+	writer, err := NewRemoteWriter(server.URL, WithRemoteWriteShards(4), WithRemoteWriteBatchSize(1))
+	require.NoError(t, err)
+
+	// 同一序列的样本总是在同一个分片中按顺序发送
+	var series []prompb.TimeSeries
+	for i := 0; i < 20; i++ {
+		series = append(series, prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "m"}, {Name: "i", Value: string(rune('a' + i%5))}},
+			Samples: []prompb.Sample{{Timestamp: int64(i * 1000), Value: float64(i)}},
+		})
+	}
+	require.NoError(t, writer.Write(context.Background(), series))
+	assert.Equal(t, 20, server.requestCount())
+
+	received := map[prommodel.Fingerprint][]prommodel.Time{}
+	for _, req := range server.requests {
+		for _, s := range req {
+			fp := s.Metric.Fingerprint()
+			received[fp] = append(received[fp], s.Values[0].Timestamp)
+		}
+	}
+	assert.Len(t, received, 5)
+	for _, timestamps := range received {
+		assert.IsIncreasing(t, timestamps)
+	}
+	assert.Equal(t, shardOf(writer.withExternalLabels(series[0].Labels), 4), shardOf(writer.withExternalLabels(series[5].Labels), 4))
+}
+
+func TestRemoteWriterRetry(t *testing.T) {
+	tests := []struct {
+		name     string // 测试用例名称
+		status   int    // 失败请求返回的状态码
+		failures int32  // 失败的请求数
+		requests int    // 期望的请求数
+		errMsg   string // 期望的错误信息，为空时不返回错误
+	}{
+		{name: "Recover after 5xx", status: http.StatusServiceUnavailable, failures: 2, requests: 3},
+		{name: "Recover after 429", status: http.StatusTooManyRequests, failures: 1, requests: 2},
+		{name: "Retries exhausted", status: http.StatusInternalServerError, failures: 10, requests: 4, errMsg: "HTTP status 500"},
+		{name: "No retry on 4xx", status: http.StatusBadRequest, failures: 10, requests: 1, errMsg: "HTTP status 400"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRemoteWriteTestServer(t)
+			server.status = tt.status
+			server.failures.Store(tt.failures)
+			writer, err := NewRemoteWriter(server.URL, WithRemoteWriteRetry(3, time.Millisecond, 5*time.Millisecond))
+			require.NoError(t, err)
+
+			err = writer.Write(context.Background(), []prompb.TimeSeries{{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "m"}},
+				Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+			}})
+			assert.Equal(t, tt.requests, server.requestCount())
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestRemoteWriterWriteGatherer(t *testing.T) {
+	server := newRemoteWriteTestServer(t)
+	writer, err := NewRemoteWriter(server.URL, WithExternalLabels(map[string]string{"job": "svc", "instance": "host:8080"}))
+	require.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "requests"}, []string{"code"})
+	registry.MustRegister(counter)
+	counter.WithLabelValues("200").Add(3)
+
+	ts := time.Unix(100, 0)
+	require.NoError(t, writer.WriteGatherer(context.Background(), registry, ts))
+	rows, err := server.recorder.Result().Rows()
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+
+	values, err := server.recorder.Result().Values()
+	require.NoError(t, err)
+	assert.Equal(t, []prommodel.SamplePair{{Timestamp: 100000, Value: 3}}, values)
+	assert.Contains(t, server.recorder.Result().String(), `requests_total{code="200", instance="host:8080", job="svc"}`)
+}
+
+func TestRemoteWriteHandler(t *testing.T) {
+	encode := func(req *prompb.WriteRequest) []byte {
+		data, err := req.Marshal()
+		require.NoError(t, err)
+		return snappy.Encode(nil, data)
+	}
+	valid := encode(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "m"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}}})
+
+	tests := []struct {
+		name     string // 测试用例名称
+		method   string // 请求方法
+		body     []byte // 请求体
+		fail     bool   // appendFn 是否返回错误
+		expected int    // 期望的状态码
+	}{
+		{name: "Success", method: http.MethodPost, body: valid, expected: http.StatusNoContent},
+		{name: "Method not allowed", method: http.MethodGet, expected: http.StatusMethodNotAllowed},
+		{name: "Invalid snappy", method: http.MethodPost, body: []byte("not snappy"), expected: http.StatusBadRequest},
+		{name: "Invalid protobuf", method: http.MethodPost, body: snappy.Encode(nil, []byte{0xff, 0xff}), expected: http.StatusBadRequest},
+		{name: "Append error", method: http.MethodPost, body: valid, fail: true, expected: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewRemoteWriteHandler(func(ctx context.Context, matrix prommodel.Matrix) error {
+				if tt.fail {
+					return assert.AnError
+				}
+				return nil
+			})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "/api/v1/write", bytes.NewReader(tt.body)))
+			assert.Equal(t, tt.expected, rec.Code)
+		})
+	}
+}
+
+func TestDecodeRemoteWrite(t *testing.T) {
+	h := &histogram.Histogram{
+		Schema:          0,
+		Count:           3,
+		Sum:             4,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}},
+		PositiveBuckets: []int64{1, 1},
+	}
+	req := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "m"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+		},
+		{
+			Labels:     []prompb.Label{{Name: "__name__", Value: "latency"}},
+			Histograms: []prompb.Histogram{prompb.FromIntHistogram(2000, h)},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "m"}},
+			Samples: []prompb.Sample{{Timestamp: 2000, Value: 2}},
+		},
+	}}
+	data, err := req.Marshal()
+	require.NoError(t, err)
+
+	matrix, err := DecodeRemoteWrite(bytes.NewReader(snappy.Encode(nil, data)))
+	require.NoError(t, err)
+	require.Len(t, matrix, 2)
+	assert.Equal(t, []prommodel.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}}, matrix[0].Values)
+	require.Len(t, matrix[1].Histograms, 1)
+	assert.Equal(t, prommodel.Time(2000), matrix[1].Histograms[0].Timestamp)
+	assert.Equal(t, prommodel.FloatString(3), matrix[1].Histograms[0].Histogram.Count)
+	assert.Len(t, matrix[1].Histograms[0].Histogram.Buckets, 2)
+
+	// 解压后的长度超过限制时不解压
+	_, err = DecodeRemoteWrite(bytes.NewReader(binary.AppendUvarint(nil, remoteWriteMaxDecodedSize+1)))
+	assert.ErrorContains(t, err, "exceeds limit")
+	_, err = DecodeRemoteWrite(bytes.NewReader([]byte{0xff}))
+	assert.ErrorContains(t, err, "decode snappy")
+}
+
+func TestRemoteWriterRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string        // 测试用例名称
+		retryAfter string        // 响应的 Retry-After
+		expected   time.Duration // 期望的 RetryAfter，允许 1s 误差
+	}{
+		{name: "Seconds", retryAfter: "3", expected: 3 * time.Second},
+		{name: "HTTP date", retryAfter: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), expected: 10 * time.Second},
+		{name: "Past HTTP date", retryAfter: "Mon, 02 Jan 2006 15:04:05 GMT"},
+		{name: "Invalid", retryAfter: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", tt.retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+			}))
+			t.Cleanup(server.Close)
+			writer, err := NewRemoteWriter(server.URL)
+			require.NoError(t, err)
+
+			var rwErr *RemoteWriteError
+			require.ErrorAs(t, writer.post(context.Background(), nil), &rwErr)
+			assert.InDelta(t, tt.expected, rwErr.RetryAfter, float64(time.Second))
+		})
+	}
+}
+
+func TestRemoteWriteRecorderReset(t *testing.T) {
+	var recorder RemoteWriteRecorder
+	require.NoError(t, recorder.Append(context.Background(), prommodel.Matrix{{
+		Metric: prommodel.Metric{"__name__": "m"},
+		Values: []prommodel.SamplePair{{Timestamp: 2000, Value: 2}, {Timestamp: 1000, Value: 1}},
+	}}))
+	values, err := recorder.Result().Values()
+	require.NoError(t, err)
+	assert.Equal(t, []prommodel.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}}, values)
+
+	recorder.Reset()
+	n, err := recorder.Result().Len()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestNewRemoteWriter(t *testing.T) {
+	_, err := NewRemoteWriter("")
+	assert.Error(t, err)
+
+	writer, err := NewRemoteWriter("http://localhost:9090/api/v1/write")
+	require.NoError(t, err)
+	assert.Equal(t, defaultRemoteWriteShards, writer.shards)
+	assert.Equal(t, defaultRemoteWriteBatchSize, writer.batchSize)
+	assert.Equal(t, defaultRemoteWriteMaxRetries, writer.maxRetries)
+	assert.Equal(t, defaultQueryTimeout, writer.client.Timeout)
+}
@@ -0,0 +1,615 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultEvaluationInterval 测试文件没有指定 evaluation_interval 时的规则评估间隔
+	defaultEvaluationInterval = time.Minute
+	// inlineRuleFile RuleTestFile.Groups 中的规则组使用的文件名
+	inlineRuleFile = "<inline>"
+)
+
+// RuleTestFile 规则单元测试文件，格式与 promtool test rules 相同
+//
+//	rule_files:
+//	  - alerts.yml
+//	evaluation_interval: 1m
+//	tests:
+//	  - interval: 1m
+//	    input_series:
+//	      - series: 'up{job="api"}'
+//	        values: '1 1 0 0 0'
+//	    alert_rule_test:
+//	      - eval_time: 4m
+//	        alertname: InstanceDown
+//	        exp_alerts:
+//	          - exp_labels: {job: api, severity: page}
+//	            exp_annotations: {summary: api is down}
+//	    promql_expr_test:
+//	      - expr: job:up:sum
+//	        eval_time: 4m
+//	        exp_samples:
+//	          - labels: 'job:up:sum{job="api"}'
+//	            value: 0
+type RuleTestFile struct {
+	// RuleFiles 规则文件，支持通配符，RunRuleTestFile 按测试文件所在目录解析相对路径
+	RuleFiles []string `yaml:"rule_files"`
+	// EvaluationInterval 规则评估间隔，默认 1m
+	EvaluationInterval prommodel.Duration `yaml:"evaluation_interval,omitempty"`
+	// GroupEvalOrder 规则组的评估顺序，没有列出的规则组最先评估
+	GroupEvalOrder []string `yaml:"group_eval_order,omitempty"`
+	// Tests 测试组，每个测试组使用独立的存储
+	Tests []RuleTestGroup `yaml:"tests"`
+	// Groups 直接在代码中定义的规则组，例如准备通过 AddAlertRule 写入规则文件的规则组
+	Groups []rulefmt.RuleGroup `yaml:"-"`
+}
+
+// RuleTestGroup 一组输入序列和基于这些序列的测试
+type RuleTestGroup struct {
+	// Name 测试组名称
+	Name string `yaml:"name,omitempty"`
+	// Interval 输入序列中相邻两个值的间隔，默认与 evaluation_interval 相同
+	Interval prommodel.Duration `yaml:"interval,omitempty"`
+	// InputSeries 输入序列
+	InputSeries []InputSeries `yaml:"input_series"`
+	// AlertRuleTests 告警规则测试
+	AlertRuleTests []AlertTestCase `yaml:"alert_rule_test,omitempty"`
+	// PromQLExprTests 表达式测试，用于检查记录规则的结果
+	PromQLExprTests []PromQLTestCase `yaml:"promql_expr_test,omitempty"`
+	// ExternalLabels 告警模板中 $externalLabels 的值
+	ExternalLabels map[string]string `yaml:"external_labels,omitempty"`
+	// ExternalURL 告警模板中 $externalURL 的值
+	ExternalURL string `yaml:"external_url,omitempty"`
+}
+
+// InputSeries 输入序列，Values 使用 Evaluator.Load 的展开写法，例如 0+10x10
+type InputSeries struct {
+	Series string `yaml:"series"`
+	Values string `yaml:"values"`
+}
+
+// AlertTestCase 检查 EvalTime 时名为 Alertname 的告警规则正在触发的告警
+type AlertTestCase struct {
+	EvalTime  prommodel.Duration `yaml:"eval_time"`
+	Alertname string             `yaml:"alertname"`
+	// ExpAlerts 期望触发的告警，为空时期望没有告警
+	ExpAlerts []ExpectedAlert `yaml:"exp_alerts"`
+}
+
+// ExpectedAlert 期望的告警，ExpLabels 不需要包含 alertname
+type ExpectedAlert struct {
+	ExpLabels      map[string]string `yaml:"exp_labels"`
+	ExpAnnotations map[string]string `yaml:"exp_annotations"`
+}
+
+// PromQLTestCase 检查 EvalTime 时表达式的结果
+type PromQLTestCase struct {
+	Expr       string             `yaml:"expr"`
+	EvalTime   prommodel.Duration `yaml:"eval_time"`
+	ExpSamples []ExpectedSample   `yaml:"exp_samples"`
+}
+
+// ExpectedSample 期望的样本，Histogram 不为空时忽略 Value
+type ExpectedSample struct {
+	Labels    string  `yaml:"labels"`
+	Value     float64 `yaml:"value"`
+	Histogram string  `yaml:"histogram,omitempty"`
+}
+
+// RuleTestReport 规则单元测试结果
+type RuleTestReport struct {
+	Results []RuleTestResult
+}
+
+// Failed 存在失败的测试组时返回 true
+func (r *RuleTestReport) Failed() bool {
+	for _, res := range r.Results {
+		if res.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleTestResult 测试组的结果
+type RuleTestResult struct {
+	// Name 测试组名称，没有名称时为 unnamed#<序号>
+	Name string
+	// Err 加载输入序列或评估规则失败，此时不再检查后面的测试
+	Err error
+	// Failures 没有通过的测试
+	Failures []RuleTestFailure
+}
+
+// Failed 测试组出错或存在没有通过的测试时返回 true
+func (r RuleTestResult) Failed() bool {
+	return r.Err != nil || len(r.Failures) > 0
+}
+
+// RuleTestFailure 没有通过的测试，Alertname 和 Expr 只有一个不为空
+type RuleTestFailure struct {
+	Alertname string
+	Expr      string
+	EvalTime  time.Duration
+	// Err 表达式执行失败或期望的样本无法解析
+	Err error
+	// Missing 期望但没有得到的告警或样本
+	Missing []string
+	// Unexpected 得到但没有期望的告警或样本
+	Unexpected []string
+}
+
+// Diff 按行返回差异，- 开头为期望但没有得到，+ 开头为得到但没有期望
+func (f RuleTestFailure) Diff() string {
+	var sb strings.Builder
+	for _, line := range f.Missing {
+		sb.WriteString("- " + line + "\n")
+	}
+	for _, line := range f.Unexpected {
+		sb.WriteString("+ " + line + "\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (f RuleTestFailure) String() string {
+	var head string
+	if f.Alertname != "" {
+		head = fmt.Sprintf("alertname: %s, time: %s", f.Alertname, prommodel.Duration(f.EvalTime))
+	} else {
+		head = fmt.Sprintf("expr: %q, time: %s", f.Expr, prommodel.Duration(f.EvalTime))
+	}
+	if f.Err != nil {
+		return head + ", err: " + f.Err.Error()
+	}
+	return head + "\n" + f.Diff()
+}
+
+// ruleTester 执行规则单元测试的配置
+type ruleTester struct {
+	run      *regexp.Regexp
+	evalOpts []EvaluatorOption
+}
+
+type RuleTestOption func(*ruleTester)
+
+// WithRunPattern 只执行名称匹配 pattern 的测试组
+func WithRunPattern(pattern *regexp.Regexp) RuleTestOption {
+	return func(t *ruleTester) {
+		t.run = pattern
+	}
+}
+
+// WithRuleTestEvaluatorOptions 设置每个测试组使用的 Evaluator 的选项，起始时间和子查询间隔由测试文件决定
+func WithRuleTestEvaluatorOptions(opts ...EvaluatorOption) RuleTestOption {
+	return func(t *ruleTester) {
+		t.evalOpts = append(t.evalOpts, opts...)
+	}
+}
+
+// LoadRuleTestFile 读取测试文件，rule_files 中的相对路径按测试文件所在目录解析并展开通配符
+func LoadRuleTestFile(path string) (*RuleTestFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := ParseRuleTestFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var ruleFiles []string
+	for _, pattern := range file.RuleFiles {
+		if pattern != "" && !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no rule file matches %s", path, pattern)
+		}
+		ruleFiles = append(ruleFiles, matches...)
+	}
+	file.RuleFiles = ruleFiles
+	return file, nil
+}
+
+// ParseRuleTestFile 解析测试文件，不认识的字段视为错误
+func ParseRuleTestFile(data []byte) (*RuleTestFile, error) {
+	file := &RuleTestFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(file); err != nil {
+		return nil, fmt.Errorf("parse rule test file: %w", err)
+	}
+	return file, nil
+}
+
+// RunRuleTestFile 读取并执行测试文件
+func RunRuleTestFile(ctx context.Context, path string, opts ...RuleTestOption) (*RuleTestReport, error) {
+	file, err := LoadRuleTestFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return RunRuleTests(ctx, file, opts...)
+}
+
+// RunRuleTests 在本地存储上评估规则并检查告警和表达式结果，与 promtool test rules 的行为相同
+// 规则文件或测试文件有误时返回错误，测试没有通过时记录在 RuleTestReport 中
+func RunRuleTests(ctx context.Context, file *RuleTestFile, opts ...RuleTestOption) (*RuleTestReport, error) {
+	tester := &ruleTester{}
+	for _, opt := range opts {
+		opt(tester)
+	}
+
+	loader, names, err := newRuleGroupLoader(file)
+	if err != nil {
+		return nil, err
+	}
+	evalInterval := time.Duration(file.EvaluationInterval)
+	if evalInterval <= 0 {
+		evalInterval = defaultEvaluationInterval
+	}
+	order := make(map[string]int, len(file.GroupEvalOrder))
+	for i, name := range file.GroupEvalOrder {
+		if _, ok := order[name]; ok {
+			return nil, fmt.Errorf("group name repeated in evaluation order: %s", name)
+		}
+		// 没有列出的规则组为 0，排在列出的规则组之前
+		order[name] = i + 1
+	}
+
+	report := &RuleTestReport{}
+	for i, tg := range file.Tests {
+		name := tg.Name
+		if name == "" {
+			name = fmt.Sprintf("unnamed#%d", i)
+		}
+		if tester.run != nil && !tester.run.MatchString(tg.Name) {
+			continue
+		}
+		if tg.Interval <= 0 {
+			tg.Interval = prommodel.Duration(evalInterval)
+		}
+		result := RuleTestResult{Name: name}
+		result.Failures, result.Err = tester.test(ctx, tg, evalInterval, loader, names, order)
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// test 执行一个测试组
+func (t *ruleTester) test(ctx context.Context, tg RuleTestGroup, evalInterval time.Duration, loader *ruleGroupLoader, names []string, order map[string]int) (failures []RuleTestFailure, err error) {
+	// 测试文件决定的选项放在最后，不会被调用方的选项覆盖
+	opts := append([]EvaluatorOption{}, t.evalOpts...)
+	opts = append(opts, WithSubqueryInterval(evalInterval), WithStartTime(time.Unix(0, 0).UTC()))
+	e, err := NewEvaluator(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, e.Close())
+	}()
+	if err := e.Load(tg.loadInput()); err != nil {
+		return nil, err
+	}
+
+	groups, err := loadRuleGroups(ctx, e, loader, names, tg, order)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按评估时间排序告警测试，在覆盖 eval_time 的那次评估之后检查
+	alertTests := make([]AlertTestCase, len(tg.AlertRuleTests))
+	copy(alertTests, tg.AlertRuleTests)
+	for _, tc := range alertTests {
+		if tc.Alertname == "" {
+			return nil, fmt.Errorf("alert_rule_test at eval_time %s misses alertname", tc.EvalTime)
+		}
+	}
+	sort.SliceStable(alertTests, func(i, j int) bool {
+		return alertTests[i].EvalTime < alertTests[j].EvalTime
+	})
+
+	curr := 0
+	maxt := tg.maxEvalTime()
+	for offset := time.Duration(0); offset <= maxt; offset += evalInterval {
+		ts := e.Time(offset)
+		for _, g := range groups {
+			g.Eval(ctx, ts)
+			for _, r := range g.Rules() {
+				if r.LastError() != nil {
+					return failures, fmt.Errorf("rule: %s, time: %s, err: %w", r.Name(), prommodel.Duration(offset), r.LastError())
+				}
+			}
+		}
+		for ; curr < len(alertTests) && time.Duration(alertTests[curr].EvalTime) < offset+evalInterval; curr++ {
+			if f, ok := checkAlerts(groups, alertTests[curr]); !ok {
+				failures = append(failures, f)
+			}
+		}
+	}
+
+	for _, tc := range tg.PromQLExprTests {
+		if f, ok := checkSamples(ctx, e, tc); !ok {
+			failures = append(failures, f)
+		}
+	}
+	return failures, nil
+}
+
+// loadInput 按 Evaluator.Load 的格式返回输入序列
+func (tg RuleTestGroup) loadInput() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n", loadCommand, tg.Interval)
+	for _, s := range tg.InputSeries {
+		fmt.Fprintf(&sb, "  %s %s\n", s.Series, s.Values)
+	}
+	return sb.String()
+}
+
+// maxEvalTime 返回所有测试中最大的 eval_time
+func (tg RuleTestGroup) maxEvalTime() time.Duration {
+	var maxt prommodel.Duration
+	for _, tc := range tg.AlertRuleTests {
+		maxt = max(maxt, tc.EvalTime)
+	}
+	for _, tc := range tg.PromQLExprTests {
+		maxt = max(maxt, tc.EvalTime)
+	}
+	return time.Duration(maxt)
+}
+
+// ruleGroupLoader 从内存中加载规则组，规则文件在执行测试前已经解析和校验
+type ruleGroupLoader struct {
+	groups map[string]*rulefmt.RuleGroups
+}
+
+// newRuleGroupLoader 解析规则文件并校验代码中定义的规则组，返回按顺序排列的文件名
+func newRuleGroupLoader(file *RuleTestFile) (*ruleGroupLoader, []string, error) {
+	loader := &ruleGroupLoader{groups: make(map[string]*rulefmt.RuleGroups)}
+	var names []string
+	for _, fn := range file.RuleFiles {
+		if _, ok := loader.groups[fn]; ok {
+			continue
+		}
+		rgs, errs := rulefmt.ParseFile(fn)
+		if len(errs) > 0 {
+			return nil, nil, fmt.Errorf("%s: %w", fn, errors.Join(errs...))
+		}
+		loader.groups[fn] = rgs
+		names = append(names, fn)
+	}
+	if len(file.Groups) > 0 {
+		if err := validateRuleGroups(file.Groups); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", inlineRuleFile, err)
+		}
+		loader.groups[inlineRuleFile] = &rulefmt.RuleGroups{Groups: file.Groups}
+		names = append(names, inlineRuleFile)
+	}
+	if len(names) == 0 {
+		return nil, nil, errors.New("no rule files or rule groups to test")
+	}
+	return loader, names, nil
+}
+
+// validateRuleGroups 校验规则组名称和规则，与 rulefmt.ParseFile 的校验相同
+func validateRuleGroups(groups []rulefmt.RuleGroup) error {
+	var errs []error
+	seen := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		if g.Name == "" {
+			errs = append(errs, errors.New("group name must not be empty"))
+		}
+		if _, ok := seen[g.Name]; ok {
+			errs = append(errs, fmt.Errorf("group name %q is repeated", g.Name))
+		}
+		seen[g.Name] = struct{}{}
+		for _, r := range g.Rules {
+			for _, err := range r.Validate() {
+				errs = append(errs, fmt.Errorf("group %q: %s", g.Name, err.Error()))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *ruleGroupLoader) Load(identifier string) (*rulefmt.RuleGroups, []error) {
+	rgs, ok := l.groups[identifier]
+	if !ok {
+		return nil, []error{fmt.Errorf("unknown rule file %s", identifier)}
+	}
+	return rgs, nil
+}
+
+func (l *ruleGroupLoader) Parse(query string) (parser.Expr, error) {
+	return parser.ParseExpr(query)
+}
+
+// loadRuleGroups 创建使用 Evaluator 存储的规则组，按 order 排序
+func loadRuleGroups(ctx context.Context, e *Evaluator, loader *ruleGroupLoader, names []string, tg RuleTestGroup, order map[string]int) ([]*rules.Group, error) {
+	m := rules.NewManager(&rules.ManagerOptions{
+		QueryFunc:   rules.EngineQueryFunc(e.engine, e.storage),
+		Appendable:  e.storage,
+		Queryable:   e.storage,
+		Context:     ctx,
+		NotifyFunc:  func(context.Context, string, ...*rules.Alert) {},
+		Logger:      promslog.NewNopLogger(),
+		GroupLoader: loader,
+	})
+	groupsMap, errs := m.LoadGroups(time.Duration(tg.Interval), labels.FromMap(tg.ExternalLabels), tg.ExternalURL, nil, names...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	groups := make([]*rules.Group, 0, len(groupsMap))
+	for _, g := range groupsMap {
+		// 标记告警规则已经恢复状态，评估时才会写入 ALERTS 序列
+		for _, ar := range g.AlertingRules() {
+			ar.SetRestored(true)
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if oi, oj := order[groups[i].Name()], order[groups[j].Name()]; oi != oj {
+			return oi < oj
+		}
+		return groups[i].Name() < groups[j].Name()
+	})
+	return groups, nil
+}
+
+// checkAlerts 比较名为 tc.Alertname 的告警规则正在触发的告警，同名的告警规则可以在不同的规则组中
+func checkAlerts(groups []*rules.Group, tc AlertTestCase) (RuleTestFailure, bool) {
+	var got []string
+	for _, g := range groups {
+		for _, ar := range g.AlertingRules() {
+			if ar.Name() != tc.Alertname {
+				continue
+			}
+			for _, a := range ar.ActiveAlerts() {
+				if a.State == rules.StateFiring {
+					got = append(got, alertString(a.Labels, a.Annotations))
+				}
+			}
+		}
+	}
+
+	expected := make([]string, 0, len(tc.ExpAlerts))
+	for _, a := range tc.ExpAlerts {
+		b := labels.NewBuilder(labels.FromMap(a.ExpLabels))
+		b.Set(labels.AlertName, tc.Alertname)
+		expected = append(expected, alertString(b.Labels(), labels.FromMap(a.ExpAnnotations)))
+	}
+
+	f := RuleTestFailure{Alertname: tc.Alertname, EvalTime: time.Duration(tc.EvalTime)}
+	f.Missing, f.Unexpected = diffLines(expected, got)
+	return f, len(f.Missing) == 0 && len(f.Unexpected) == 0
+}
+
+func alertString(lset, annotations labels.Labels) string {
+	return convertLabels(lset).String() + " annotations=" + convertLabels(annotations).String()
+}
+
+// checkSamples 比较 tc.Expr 在 tc.EvalTime 的结果，标量按没有标签的样本比较
+func checkSamples(ctx context.Context, e *Evaluator, tc PromQLTestCase) (RuleTestFailure, bool) {
+	f := RuleTestFailure{Expr: tc.Expr, EvalTime: time.Duration(tc.EvalTime)}
+
+	expected := make([]string, 0, len(tc.ExpSamples))
+	for _, s := range tc.ExpSamples {
+		line, err := expectedSampleString(s)
+		if err != nil {
+			f.Err = fmt.Errorf("labels %q: %w", s.Labels, err)
+			return f, false
+		}
+		expected = append(expected, line)
+	}
+
+	got, err := e.instantSamples(ctx, tc.Expr, e.Time(time.Duration(tc.EvalTime)))
+	if err != nil {
+		f.Err = err
+		return f, false
+	}
+	f.Missing, f.Unexpected = diffLines(expected, got)
+	return f, len(f.Missing) == 0 && len(f.Unexpected) == 0
+}
+
+// instantSamples 执行即时查询并按 sampleString 返回样本
+func (e *Evaluator) instantSamples(ctx context.Context, query string, ts time.Time) ([]string, error) {
+	q, err := e.engine.NewInstantQuery(ctx, e.storage, nil, query, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := q.Exec(ctx)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	switch v := res.Value.(type) {
+	case promql.Vector:
+		samples := make([]string, 0, len(v))
+		for _, s := range v {
+			var histogram string
+			if s.H != nil {
+				histogram = s.H.TestExpression()
+			}
+			samples = append(samples, sampleString(s.Metric, s.F, histogram))
+		}
+		return samples, nil
+	case promql.Scalar:
+		return []string{sampleString(labels.EmptyLabels(), v.V, "")}, nil
+	}
+	return nil, fmt.Errorf("rule result is not a vector or scalar, got %s", res.Value.Type())
+}
+
+// expectedSampleString 解析期望的样本
+func expectedSampleString(s ExpectedSample) (string, error) {
+	lset, err := parser.ParseMetric(s.Labels)
+	if err != nil {
+		return "", err
+	}
+	if s.Histogram == "" {
+		return sampleString(lset, s.Value, ""), nil
+	}
+	_, values, err := parser.ParseSeriesDesc("{} " + s.Histogram)
+	if err != nil {
+		return "", err
+	}
+	if len(values) != 1 || values[0].Histogram == nil {
+		return "", fmt.Errorf("expected one histogram, got %q", s.Histogram)
+	}
+	return sampleString(lset, 0, values[0].Histogram.TestExpression()), nil
+}
+
+// sampleString 按 指标名{标签} 值 的格式返回样本
+func sampleString(lset labels.Labels, v float64, histogram string) string {
+	if histogram != "" {
+		return convertLabels(lset).String() + " " + histogram
+	}
+	return convertLabels(lset).String() + " " + strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// diffLines 按多重集合比较，返回 expected 中多出的行和 got 中多出的行，结果已排序
+func diffLines(expected, got []string) (missing, unexpected []string) {
+	counts := make(map[string]int, len(expected))
+	for _, line := range expected {
+		counts[line]++
+	}
+	for _, line := range got {
+		if counts[line] > 0 {
+			counts[line]--
+			continue
+		}
+		unexpected = append(unexpected, line)
+	}
+	for _, line := range expected {
+		if counts[line] > 0 {
+			counts[line]--
+			missing = append(missing, line)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+	return missing, unexpected
+}
@@ -0,0 +1,350 @@
+package prom
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const testRules = `
+groups:
+  - name: api
+    rules:
+      - record: job:http_requests:rate5m
+        expr: sum by (job) (rate(http_requests_total[5m]))
+      - alert: InstanceDown
+        expr: up == 0
+        for: 2m
+        labels:
+          severity: page
+        annotations:
+          summary: "{{ $labels.instance }} of {{ $labels.job }} is down"
+`
+
+const testRuleTests = `
+rule_files:
+  - rules/*.yml
+evaluation_interval: 1m
+tests:
+  - name: instance down
+    interval: 1m
+    input_series:
+      - series: 'up{job="api", instance="a"}'
+        values: '1 1 0 0 0 0 0'
+      - series: 'up{job="api", instance="b"}'
+        values: '1x6'
+    alert_rule_test:
+      - eval_time: 2m
+        alertname: InstanceDown
+      - eval_time: 5m
+        alertname: InstanceDown
+        exp_alerts:
+          - exp_labels: {job: api, instance: a, severity: page}
+            exp_annotations: {summary: a of api is down}
+  - name: request rate
+    input_series:
+      - series: 'http_requests_total{job="api"}'
+        values: '0+60x10'
+    promql_expr_test:
+      - expr: job:http_requests:rate5m
+        eval_time: 10m
+        exp_samples:
+          - labels: 'job:http_requests:rate5m{job="api"}'
+            value: 1
+      - expr: scalar(job:http_requests:rate5m) * 2
+        eval_time: 10m
+        exp_samples:
+          - labels: '{}'
+            value: 2
+`
+
+// writeRuleTestFiles 在临时目录中写入规则文件和测试文件，返回测试文件路径
+func writeRuleTestFiles(t *testing.T, tests string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "rules"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rules", "api.yml"), []byte(testRules), 0o600))
+	path := filepath.Join(dir, "tests.yml")
+	require.NoError(t, os.WriteFile(path, []byte(tests), 0o600))
+	return path
+}
+
+func TestRunRuleTestFile(t *testing.T) {
+	report, err := RunRuleTestFile(context.Background(), writeRuleTestFiles(t, testRuleTests))
+	require.NoError(t, err)
+	require.Len(t, report.Results, 2)
+	for _, res := range report.Results {
+		assert.False(t, res.Failed(), "%s: %v %v", res.Name, res.Err, res.Failures)
+	}
+	assert.False(t, report.Failed())
+}
+
+func TestRunRuleTestsFailures(t *testing.T) {
+	file, err := ParseRuleTestFile([]byte(`
+tests:
+  - input_series:
+      - series: 'up{job="api", instance="a"}'
+        values: '0x5'
+      - series: 'http_requests_total{job="api"}'
+        values: '0+60x10'
+    alert_rule_test:
+      - eval_time: 1m
+        alertname: InstanceDown
+        exp_alerts:
+          - exp_labels: {job: api, instance: a, severity: page}
+            exp_annotations: {summary: a of api is down}
+      - eval_time: 3m
+        alertname: InstanceDown
+        exp_alerts:
+          - exp_labels: {job: api, instance: a, severity: critical}
+            exp_annotations: {summary: a of api is down}
+    promql_expr_test:
+      - expr: job:http_requests:rate5m
+        eval_time: 5m
+        exp_samples:
+          - labels: 'job:http_requests:rate5m{job="api"}'
+            value: 2
+      - expr: sum(
+        eval_time: 5m
+      - expr: up
+        eval_time: 5m
+        exp_samples:
+          - labels: 'up{'
+`))
+	require.NoError(t, err)
+	file.Groups = parseTestRuleGroups(t)
+
+	report, err := RunRuleTests(context.Background(), file)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 1)
+	res := report.Results[0]
+	assert.Equal(t, "unnamed#0", res.Name)
+	assert.NoError(t, res.Err)
+	assert.True(t, report.Failed())
+	require.Len(t, res.Failures, 5)
+
+	// 1m 时告警还在 pending，不算触发
+	assert.Equal(t, RuleTestFailure{
+		Alertname: "InstanceDown",
+		EvalTime:  time.Minute,
+		Missing:   []string{`{alertname="InstanceDown", instance="a", job="api", severity="page"} annotations={summary="a of api is down"}`},
+	}, res.Failures[0])
+
+	// 标签不同时同时输出期望和得到的告警
+	assert.Equal(t, `alertname: InstanceDown, time: 3m
+- {alertname="InstanceDown", instance="a", job="api", severity="critical"} annotations={summary="a of api is down"}
++ {alertname="InstanceDown", instance="a", job="api", severity="page"} annotations={summary="a of api is down"}`, res.Failures[1].String())
+
+	assert.Equal(t, `expr: "job:http_requests:rate5m", time: 5m
+- job:http_requests:rate5m{job="api"} 2
++ job:http_requests:rate5m{job="api"} 1`, res.Failures[2].String())
+
+	assert.Equal(t, "sum(", res.Failures[3].Expr)
+	assert.ErrorContains(t, res.Failures[3].Err, "unclosed left parenthesis")
+	assert.Contains(t, res.Failures[4].String(), `expr: "up", time: 5m, err: labels "up{"`)
+}
+
+// parseTestRuleGroups 解析 testRules 中的规则组
+func parseTestRuleGroups(t *testing.T) []rulefmt.RuleGroup {
+	t.Helper()
+	rgs, errs := rulefmt.Parse([]byte(testRules))
+	require.Empty(t, errs)
+	return rgs.Groups
+}
+
+func TestRunRuleTestsOptions(t *testing.T) {
+	file, err := LoadRuleTestFile(writeRuleTestFiles(t, testRuleTests))
+	require.NoError(t, err)
+
+	t.Run("Run pattern", func(t *testing.T) {
+		report, err := RunRuleTests(context.Background(), file, WithRunPattern(regexp.MustCompile("^request")))
+		require.NoError(t, err)
+		require.Len(t, report.Results, 1)
+		assert.Equal(t, "request rate", report.Results[0].Name)
+	})
+
+	t.Run("Evaluator options", func(t *testing.T) {
+		// 回溯时间小于输入序列的间隔时，两次采样之间没有结果
+		file := *file
+		file.Tests = []RuleTestGroup{{
+			Interval:    prommodel.Duration(2 * time.Minute),
+			InputSeries: []InputSeries{{Series: `http_requests_total{job="api"}`, Values: "0+120x5"}},
+			PromQLExprTests: []PromQLTestCase{{
+				Expr:     "http_requests_total",
+				EvalTime: prommodel.Duration(9 * time.Minute),
+			}},
+		}}
+		report, err := RunRuleTests(context.Background(), &file, WithRuleTestEvaluatorOptions(WithLookbackDelta(30*time.Second)))
+		require.NoError(t, err)
+		assert.False(t, report.Failed(), "%v", report.Results)
+
+		report, err = RunRuleTests(context.Background(), &file)
+		require.NoError(t, err)
+		assert.True(t, report.Failed(), "default lookback delta returns the sample at 8m")
+	})
+
+	t.Run("File settings override evaluator options", func(t *testing.T) {
+		// 起始时间和子查询间隔由测试文件决定，调用方的选项不生效
+		file := *file
+		file.Tests = []RuleTestGroup{{
+			Interval:    prommodel.Duration(time.Minute),
+			InputSeries: []InputSeries{{Series: `http_requests_total{job="api"}`, Values: "0+60x10"}},
+			PromQLExprTests: []PromQLTestCase{{
+				Expr:       "max_over_time(http_requests_total[5m:])",
+				EvalTime:   prommodel.Duration(5 * time.Minute),
+				ExpSamples: []ExpectedSample{{Labels: `{job="api"}`, Value: 300}},
+			}},
+		}}
+		report, err := RunRuleTests(context.Background(), &file, WithRuleTestEvaluatorOptions(
+			WithStartTime(time.Unix(3600, 0)),
+			WithSubqueryInterval(time.Hour),
+		))
+		require.NoError(t, err)
+		assert.False(t, report.Failed(), "%v", report.Results)
+	})
+}
+
+func TestRunRuleTestsGroupEvalOrder(t *testing.T) {
+	// ratio 依赖同一时刻 value 组的结果，按顺序评估时才能在第一次评估得到结果
+	groups := []rulefmt.RuleGroup{
+		{Name: "ratio", Rules: []rulefmt.RuleNode{recordingRule("job:ratio", "job:value * 2")}},
+		{Name: "value", Rules: []rulefmt.RuleNode{recordingRule("job:value", "sum by (job) (input)")}},
+	}
+	newFile := func(order ...string) *RuleTestFile {
+		return &RuleTestFile{
+			GroupEvalOrder: order,
+			Groups:         groups,
+			Tests: []RuleTestGroup{{
+				InputSeries: []InputSeries{{Series: `input{job="a"}`, Values: "1"}},
+				PromQLExprTests: []PromQLTestCase{{
+					Expr:       "job:ratio",
+					ExpSamples: []ExpectedSample{{Labels: `job:ratio{job="a"}`, Value: 2}},
+				}},
+			}},
+		}
+	}
+
+	report, err := RunRuleTests(context.Background(), newFile("value", "ratio"))
+	require.NoError(t, err)
+	assert.False(t, report.Failed(), "%v", report.Results)
+
+	report, err = RunRuleTests(context.Background(), newFile("ratio", "value"))
+	require.NoError(t, err)
+	assert.True(t, report.Failed())
+
+	_, err = RunRuleTests(context.Background(), newFile("value", "value"))
+	assert.EqualError(t, err, "group name repeated in evaluation order: value")
+}
+
+func recordingRule(record, expr string) rulefmt.RuleNode {
+	return rulefmt.RuleNode{
+		Record: yaml.Node{Kind: yaml.ScalarNode, Value: record},
+		Expr:   yaml.Node{Kind: yaml.ScalarNode, Value: expr},
+	}
+}
+
+func TestRunRuleTestsHistogram(t *testing.T) {
+	file := &RuleTestFile{
+		Groups: []rulefmt.RuleGroup{{Name: "h", Rules: []rulefmt.RuleNode{recordingRule("job:h:sum", "sum by (job) (h)")}}},
+		Tests: []RuleTestGroup{{
+			InputSeries: []InputSeries{
+				{Series: `h{job="a", instance="1"}`, Values: "{{schema:0 count:1 sum:2 buckets:[1]}}"},
+				{Series: `h{job="a", instance="2"}`, Values: "{{schema:0 count:2 sum:3 buckets:[2]}}"},
+			},
+			PromQLExprTests: []PromQLTestCase{{
+				Expr:       "job:h:sum",
+				ExpSamples: []ExpectedSample{{Labels: `job:h:sum{job="a"}`, Histogram: "{{schema:0 count:3 sum:5 buckets:[3]}}"}},
+			}},
+		}},
+	}
+	report, err := RunRuleTests(context.Background(), file)
+	require.NoError(t, err)
+	assert.False(t, report.Failed(), "%v", report.Results)
+}
+
+func TestRunRuleTestsErrors(t *testing.T) {
+	tests := []struct {
+		name     string // 测试用例名称
+		file     *RuleTestFile
+		expected string // 期望的错误
+	}{
+		{
+			name:     "No rules",
+			file:     &RuleTestFile{},
+			expected: "no rule files or rule groups to test",
+		},
+		{
+			name:     "Missing rule file",
+			file:     &RuleTestFile{RuleFiles: []string{"missing.yml"}},
+			expected: "missing.yml",
+		},
+		{
+			name:     "Invalid inline rule",
+			file:     &RuleTestFile{Groups: []rulefmt.RuleGroup{{Name: "g", Rules: []rulefmt.RuleNode{recordingRule("bad name", "up")}}}},
+			expected: `<inline>: group "g": `,
+		},
+		{
+			name:     "Empty group name",
+			file:     &RuleTestFile{Groups: []rulefmt.RuleGroup{{Rules: []rulefmt.RuleNode{recordingRule("a", "up")}}}},
+			expected: "group name must not be empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RunRuleTests(context.Background(), tt.file)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+
+	t.Run("Test group errors", func(t *testing.T) {
+		groups := []rulefmt.RuleGroup{{Name: "g", Rules: []rulefmt.RuleNode{recordingRule("a", `label_replace(up, "job", "same", "", "")`)}}}
+		report, err := RunRuleTests(context.Background(), &RuleTestFile{
+			Groups: groups,
+			Tests: []RuleTestGroup{
+				{Name: "bad series", InputSeries: []InputSeries{{Series: "up{", Values: "1"}}},
+				{Name: "missing alertname", AlertRuleTests: []AlertTestCase{{}}},
+				{
+					Name:            "eval error",
+					InputSeries:     []InputSeries{{Series: `up{job="a"}`, Values: "1"}, {Series: `up{job="b"}`, Values: "1"}},
+					PromQLExprTests: []PromQLTestCase{{Expr: "a"}},
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, report.Results, 3)
+		assert.ErrorContains(t, report.Results[0].Err, "line 2")
+		assert.EqualError(t, report.Results[1].Err, "alert_rule_test at eval_time 0s misses alertname")
+		assert.ErrorContains(t, report.Results[2].Err, "rule: a, time: 0s, err: vector cannot contain metrics with the same labelset")
+	})
+
+	t.Run("Unknown field", func(t *testing.T) {
+		_, err := ParseRuleTestFile([]byte("tests:\n  - input: []\n"))
+		assert.ErrorContains(t, err, "field input not found")
+	})
+
+	t.Run("Rule file glob without matches", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tests.yml")
+		require.NoError(t, os.WriteFile(path, []byte("rule_files: [missing/*.yml]\n"), 0o600))
+		_, err := LoadRuleTestFile(path)
+		assert.ErrorContains(t, err, "no rule file matches")
+	})
+}
+
+func TestDiffLines(t *testing.T) {
+	missing, unexpected := diffLines([]string{"b", "a", "a"}, []string{"a", "c", "c"})
+	assert.Equal(t, []string{"a", "b"}, missing)
+	assert.Equal(t, []string{"c", "c"}, unexpected)
+
+	missing, unexpected = diffLines(nil, nil)
+	assert.Empty(t, missing)
+	assert.Empty(t, unexpected)
+}
@@ -0,0 +1,157 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// exprKey 规则文件和 Grafana 面板中保存 PromQL 的字段
+	exprKey = "expr"
+	// grafanaTargetsKey Grafana 面板中保存查询的字段
+	grafanaTargetsKey = "targets"
+)
+
+// source 一条待校验的查询及其在文件中的位置
+type source struct {
+	file  string
+	query string
+	// line、column 为查询第一个字符在文件中的位置，从 1 开始
+	line   int
+	column int
+	// indent 查询第二行起每行在文件中的缩进，multiline 为 false 时查询中的换行无法映射到文件，
+	// 查询内的位置都对应到查询的开头
+	indent    int
+	multiline bool
+	// expanded Grafana 查询替换变量后实际校验的查询，subs 为替换的位置，查询中没有变量时为空
+	expanded string
+	subs     []substitution
+	// unsupported 无法替换的 Grafana 变量，不为空时跳过该查询，unsupportedAt 为变量在查询中的偏移
+	unsupported   string
+	unsupportedAt int
+}
+
+// expr 返回实际校验的查询
+func (s source) expr() string {
+	if s.expanded != "" {
+		return s.expanded
+	}
+	return s.query
+}
+
+// position 将实际校验的查询中的字节偏移转换为文件中的行号和列号
+func (s source) position(offset int) (int, int) {
+	offset = rawOffset(s.subs, offset)
+	if offset < 0 || offset > len(s.query) {
+		return s.line, s.column
+	}
+	before := s.query[:offset]
+	newlines := strings.Count(before, "\n")
+	if newlines == 0 {
+		return s.line, s.column + len([]rune(before))
+	}
+	if !s.multiline {
+		return s.line, s.column
+	}
+	lastLine := before[strings.LastIndexByte(before, '\n')+1:]
+	return s.line + newlines, s.indent + 1 + len([]rune(lastLine))
+}
+
+// textSource 从参数或标准输入读取的单条查询
+func textSource(file, query string) source {
+	return source{file: file, query: query, line: 1, column: 1, multiline: true}
+}
+
+// extractQueries 从 Prometheus 规则文件或 Grafana 面板 JSON 中提取所有 expr 字段
+// JSON 是 YAML 的子集，两种文件都按 YAML 解析以获得字段的行号和列号；
+// targets 下的查询是 Grafana 面板查询，校验前替换其中的 Grafana 变量
+func extractQueries(file string, data []byte) ([]source, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	var sources []source
+	var walk func(node *yaml.Node, grafana bool)
+	walk = func(node *yaml.Node, grafana bool) {
+		if node.Kind == yaml.MappingNode && !isPrometheusTarget(node) {
+			return
+		}
+		for i, child := range node.Content {
+			inTargets := grafana
+			if node.Kind == yaml.MappingNode && i%2 == 1 {
+				key := node.Content[i-1]
+				if key.Value == exprKey && child.Kind == yaml.ScalarNode && child.Tag == "!!str" {
+					if src, ok := scalarSource(file, child, lines); ok {
+						if grafana {
+							src = expandGrafana(src)
+						}
+						sources = append(sources, src)
+					}
+					continue
+				}
+				inTargets = inTargets || key.Value == grafanaTargetsKey
+			}
+			walk(child, inTargets)
+		}
+	}
+	walk(&root, false)
+	return sources, nil
+}
+
+// isPrometheusTarget 判断 Grafana 查询是否使用 Prometheus 数据源，没有数据源类型时视为 Prometheus
+// Loki 等数据源的查询同样保存在 expr 字段，但不是 PromQL；面板的 Mixed 数据源类型为 datasource，继续检查其中的查询
+func isPrometheusTarget(node *yaml.Node) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != "datasource" || node.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+		ds := node.Content[i+1]
+		for j := 0; j+1 < len(ds.Content); j += 2 {
+			if ds.Content[j].Value == "type" && ds.Content[j+1].Value != "prometheus" && ds.Content[j+1].Value != "datasource" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// scalarSource 根据 YAML 字符串的样式计算查询在文件中的位置，空查询返回 false
+func scalarSource(file string, node *yaml.Node, lines [][]byte) (source, bool) {
+	if strings.TrimSpace(node.Value) == "" {
+		return source{}, false
+	}
+	src := source{file: file, query: node.Value, line: node.Line, column: node.Column}
+	switch node.Style {
+	case yaml.LiteralStyle:
+		// 块字符串的内容从下一行开始，每行的缩进相同
+		src.line++
+		if src.line-1 < len(lines) {
+			line := lines[src.line-1]
+			src.indent = len(line) - len(bytes.TrimLeft(line, " \t"))
+		}
+		src.column = src.indent + 1
+		src.multiline = true
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		// 跳过引号，字符串中有转义字符时之后的列号会有偏差
+		src.column++
+	}
+	return src, true
+}
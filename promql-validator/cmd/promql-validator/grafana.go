@@ -0,0 +1,130 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ruleGrafanaVariable 无法替换 Grafana 变量而跳过查询时的规则 ID
+const ruleGrafanaVariable = "grafana-variable"
+
+// grafanaVariable 匹配 Grafana 的变量：$var、${var}、${var:format} 和 [[var]]、[[var:format]]
+var grafanaVariable = regexp.MustCompile(`\$\{(\w+)(?::[^}]*)?\}|\[\[(\w+)(?::\w+)?\]\]|\$(\w+)`)
+
+// grafanaPlaceholders Grafana 内置变量在字符串外使用时替换的值，时长变量使用 5m，数值变量使用对应的秒或毫秒
+var grafanaPlaceholders = map[string]string{
+	"__interval":         "5m",
+	"__rate_interval":    "5m",
+	"__range":            "5m",
+	"__interval_ms":      "300000",
+	"__rate_interval_ms": "300000",
+	"__range_ms":         "300000",
+	"__range_s":          "300",
+	"__from":             "1700000000",
+	"__to":               "1700000000",
+}
+
+// durationPlaceholder 范围选择器和子查询的 [] 中的自定义变量替换的时长
+const durationPlaceholder = "5m"
+
+// substitution 一次变量替换，at 为占位符在替换后的查询中的偏移，rawAt 为变量在原查询中的偏移
+type substitution struct {
+	at, size       int
+	rawAt, rawSize int
+}
+
+// expandGrafana 将 Grafana 面板查询中的变量替换为占位符，设置 src.expanded 和 src.subs
+// 字符串中的变量替换为变量名；字符串外的内置变量替换为 grafanaPlaceholders 中的值，自定义变量只在 [] 中替换为时长。
+// 其余位置的变量无法确定替换后的类型，设置 src.unsupported，不校验该查询
+func expandGrafana(src source) source {
+	query := src.query
+	matches := grafanaVariable.FindAllStringSubmatchIndex(query, -1)
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		var name string
+		for i := 2; i < len(m); i += 2 {
+			if m[i] >= 0 {
+				name = query[m[i]:m[i+1]]
+				break
+			}
+		}
+		if strings.Trim(name, "0123456789") == "" {
+			// label_replace 等函数的替换字符串中的 $1 不是变量
+			continue
+		}
+		placeholder := name
+		if inString, inBrackets := grafanaContext(query[:m[0]]); !inString {
+			var found bool
+			if placeholder, found = grafanaPlaceholders[name]; !found {
+				if !inBrackets || strings.HasPrefix(name, "__") {
+					src.subs = nil
+					src.unsupported, src.unsupportedAt = query[m[0]:m[1]], m[0]
+					return src
+				}
+				placeholder = durationPlaceholder
+			}
+		}
+		b.WriteString(query[last:m[0]])
+		src.subs = append(src.subs, substitution{at: b.Len(), size: len(placeholder), rawAt: m[0], rawSize: m[1] - m[0]})
+		b.WriteString(placeholder)
+		last = m[1]
+	}
+	if len(src.subs) > 0 {
+		b.WriteString(query[last:])
+		src.expanded = b.String()
+	}
+	return src
+}
+
+// grafanaContext 判断 before 之后的位置是否在字符串中，以及是否在范围选择器或子查询的 [] 中
+func grafanaContext(before string) (inString, inBrackets bool) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(before); i++ {
+		c := before[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		}
+	}
+	return quote != 0, depth > 0
+}
+
+// rawOffset 将替换后的查询中的偏移转换为原查询中的偏移，占位符内的偏移对应到变量的开头
+func rawOffset(subs []substitution, offset int) int {
+	for i := len(subs) - 1; i >= 0; i-- {
+		s := subs[i]
+		if offset >= s.at+s.size {
+			return offset - s.at - s.size + s.rawAt + s.rawSize
+		}
+		if offset >= s.at {
+			return s.rawAt
+		}
+	}
+	return offset
+}
@@ -0,0 +1,278 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// promql-validator 校验命令行参数、标准输入、Prometheus 规则文件和 Grafana 面板中的 PromQL
+//
+// 用法：
+//
+//	promql-validator [flags] [file ...]
+//
+// 没有文件和 -query 时从标准输入读取一条查询。文件中所有 expr 字段都按查询校验，
+// 包括规则文件中的 expr 和 Grafana 面板中 Prometheus 数据源的 targets[].expr；文件名为 - 时从标准输入读取文件。
+// Grafana 查询中的 $__rate_interval 等内置变量和 $job、${var}、[[var]] 等模板变量先替换为占位符再校验，
+// 无法替换的变量（例如作为指标名或数值使用）会跳过该查询并输出 grafana-variable 提示。
+//
+// 退出码：0 没有问题，1 存在不低于 -fail-on 的问题，2 参数或读取文件错误。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/promql-validator/validator"
+)
+
+// 退出码
+const (
+	exitOK     = 0
+	exitIssues = 1
+	exitUsage  = 2
+)
+
+// stdinName 标准输入在输出中显示的文件名
+const stdinName = "<stdin>"
+
+// config 命令行参数
+type config struct {
+	query             string
+	format            string
+	catalog           string
+	catalogMetadata   string
+	catalogLabels     string
+	catalogExposition string
+	tsdbStats         string
+	disable           string
+	failOn            string
+	listRules         bool
+	lint              validator.LintConfig
+	cost              validator.CostConfig
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run 执行命令并返回退出码
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg := config{lint: validator.DefaultLintConfig(), cost: validator.DefaultCostConfig()}
+	fs := flag.NewFlagSet("promql-validator", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: promql-validator [flags] [file ...]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Validates PromQL in Prometheus rule files (.yml, .yaml), Grafana dashboards (.json),")
+		fmt.Fprintln(stderr, "the -query flag or, without files, a query read from stdin.")
+		fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cfg.query, "query", "", "validate this query instead of files")
+	fs.StringVar(&cfg.query, "q", "", "shorthand for -query")
+	fs.StringVar(&cfg.format, "format", formatText, "output format: text, json, github or gitlab")
+	fs.StringVar(&cfg.catalog, "catalog", "", "metric catalog file (YAML or JSON)")
+	fs.StringVar(&cfg.catalogMetadata, "catalog-metadata", "", "saved /api/v1/metadata response used as metric catalog")
+	fs.StringVar(&cfg.catalogLabels, "catalog-labels", "", "saved /api/v1/labels response, used with -catalog-metadata")
+	fs.StringVar(&cfg.catalogExposition, "catalog-exposition", "", "saved /metrics scrape used as metric catalog")
+	fs.StringVar(&cfg.tsdbStats, "tsdb-stats", "", "saved /api/v1/status/tsdb response used to check query cost")
+	fs.Uint64Var(&cfg.cost.Budget.MaxSeries, "max-series", cfg.cost.Budget.MaxSeries, "series budget for -tsdb-stats, 0 disables the check")
+	fs.Uint64Var(&cfg.cost.Budget.MaxSamples, "max-samples", cfg.cost.Budget.MaxSamples, "samples budget for -tsdb-stats, 0 disables the check")
+	fs.DurationVar(&cfg.cost.Range, "range", 0, "estimate cost as a range query over this duration")
+	fs.DurationVar(&cfg.cost.Step, "step", time.Minute, "evaluation step of the range query")
+	fs.DurationVar(&cfg.lint.ScrapeInterval, "scrape-interval", cfg.lint.ScrapeInterval, "scrape interval for the range-shorter-than-scrape-interval rule")
+	fs.StringVar(&cfg.disable, "disable", "", "comma separated lint rules to disable")
+	fs.StringVar(&cfg.failOn, "fail-on", string(validator.SeverityError), "lowest severity that makes the exit code non-zero: error, warning or info")
+	fs.BoolVar(&cfg.listRules, "list-rules", false, "list lint rules and exit")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if cfg.listRules {
+		listRules(stdout)
+		return exitOK
+	}
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintf(stderr, "promql-validator: %v\n", err)
+		return exitUsage
+	}
+	catalog, err := cfg.loadCatalog()
+	if err != nil {
+		fmt.Fprintf(stderr, "promql-validator: load catalog: %v\n", err)
+		return exitUsage
+	}
+	var checks []validator.Check
+	if catalog != nil {
+		checks = append(checks, validator.SchemaCheck(catalog))
+	}
+	if cfg.tsdbStats != "" {
+		stats, err := validator.LoadTSDBStats(cfg.tsdbStats)
+		if err != nil {
+			fmt.Fprintf(stderr, "promql-validator: load tsdb stats: %v\n", err)
+			return exitUsage
+		}
+		stats.ScrapeInterval = cfg.lint.ScrapeInterval
+		checks = append(checks, validator.CostCheck(stats, cfg.cost))
+	}
+	sources, err := cfg.sources(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "promql-validator: %v\n", err)
+		return exitUsage
+	}
+
+	var issues []issue
+	checked := 0
+	for _, src := range sources {
+		if src.unsupported != "" {
+			issues = append(issues, skippedIssue(src))
+			continue
+		}
+		checked++
+		issues = append(issues, collectIssues(src, validator.ValidateWith(src.expr(), cfg.lint, checks...))...)
+	}
+	if err := writeIssues(stdout, cfg.format, issues, checked); err != nil {
+		fmt.Fprintf(stderr, "promql-validator: %v\n", err)
+		return exitUsage
+	}
+	threshold := severityRank[validator.Severity(cfg.failOn)]
+	for _, i := range issues {
+		if severityRank[i.Severity] >= threshold {
+			return exitIssues
+		}
+	}
+	return exitOK
+}
+
+// validate 检查参数并应用 -disable
+func (c *config) validate() error {
+	switch c.format {
+	case formatText, formatJSON, formatGitHub, formatGitLab:
+	default:
+		return fmt.Errorf("unknown format %q", c.format)
+	}
+	if _, ok := severityRank[validator.Severity(c.failOn)]; !ok {
+		return fmt.Errorf("unknown severity %q for -fail-on", c.failOn)
+	}
+	if c.cost.Range > 0 && c.cost.Step <= 0 {
+		return errors.New("-step must be positive")
+	}
+	if c.catalogLabels != "" && c.catalogMetadata == "" {
+		return errors.New("-catalog-labels requires -catalog-metadata")
+	}
+	known := make(map[string]struct{})
+	for _, r := range validator.LintRules() {
+		known[r.ID] = struct{}{}
+	}
+	for _, id := range strings.Split(c.disable, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if _, ok := known[id]; !ok {
+			return fmt.Errorf("unknown lint rule %q", id)
+		}
+		c.lint = c.lint.WithRule(id, false)
+	}
+	return nil
+}
+
+// loadCatalog 按参数加载指标目录，多个来源合并为一个目录，没有来源时返回 nil
+func (c *config) loadCatalog() (*validator.Catalog, error) {
+	var catalogs []*validator.Catalog
+	if c.catalog != "" {
+		catalog, err := validator.LoadCatalog(c.catalog)
+		if err != nil {
+			return nil, err
+		}
+		catalogs = append(catalogs, catalog)
+	}
+	if c.catalogMetadata != "" {
+		catalog, err := validator.LoadCatalogFromAPI(c.catalogMetadata, c.catalogLabels)
+		if err != nil {
+			return nil, err
+		}
+		catalogs = append(catalogs, catalog)
+	}
+	if c.catalogExposition != "" {
+		catalog, err := validator.LoadCatalogFromExposition(c.catalogExposition)
+		if err != nil {
+			return nil, err
+		}
+		catalogs = append(catalogs, catalog)
+	}
+	if len(catalogs) == 0 {
+		return nil, nil
+	}
+	var labels []string
+	var metrics []validator.MetricSchema
+	for _, catalog := range catalogs {
+		labels = append(labels, catalog.Labels...)
+		metrics = append(metrics, catalog.Metrics...)
+	}
+	return validator.NewCatalog(labels, metrics...), nil
+}
+
+// sources 按参数收集待校验的查询
+func (c *config) sources(files []string, stdin io.Reader) ([]source, error) {
+	if c.query != "" {
+		if len(files) > 0 {
+			return nil, errors.New("-query cannot be used with files")
+		}
+		return []source{textSource("<query>", c.query)}, nil
+	}
+	if len(files) == 0 {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read stdin: %w", err)
+		}
+		return []source{textSource(stdinName, string(data))}, nil
+	}
+	var sources []source
+	for _, file := range files {
+		var data []byte
+		var err error
+		name := file
+		if file == "-" {
+			name = stdinName
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return nil, err
+		}
+		extracted, err := extractQueries(name, data)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, extracted...)
+	}
+	return sources, nil
+}
+
+// listRules 输出所有 lint 规则
+func listRules(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tSEVERITY\tDESCRIPTION")
+	for _, r := range validator.LintRules() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.ID, r.Severity, r.Description)
+	}
+	tw.Flush()
+}
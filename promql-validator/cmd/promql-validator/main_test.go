@@ -0,0 +1,367 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `groups:
+  - name: example
+    rules:
+      - alert: HighErrorRate
+        expr: sum(rate(http_requests_total{code=~"5.."}[5m])) > 1
+      - record: job:errors:rate5m
+        expr: |
+          sum by (job) (
+            rate(http_requests_total)
+          )
+      - alert: Quoted
+        expr: "rate(node_memory_free_bytes[5m])"
+`
+
+const testDashboard = `{
+  "panels": [
+    {
+      "datasource": {"type": "prometheus", "uid": "prom"},
+      "targets": [
+        {"expr": "up == NaN", "refId": "A"},
+        {"expr": "", "refId": "B"}
+      ]
+    },
+    {
+      "datasource": {"type": "loki", "uid": "logs"},
+      "targets": [{"expr": "{app=\"api\"} |= \"error\"", "refId": "A"}]
+    }
+  ]
+}`
+
+const testGrafanaDashboard = `{
+  "panels": [
+    {
+      "targets": [
+        {"expr": "rate(http_requests_total{job=~\"$job\"}[$__rate_interval])", "refId": "A"},
+        {"expr": "sum by (job) (rate(http_requests_total[${window}])) > $threshold", "refId": "B"},
+        {"expr": "rate(node_memory_free_bytes{instance=\"[[instance]]\"}[$__interval])", "refId": "C"}
+      ]
+    }
+  ]
+}`
+
+// writeFile 在临时目录中写入测试文件
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// runCLI 执行命令并返回退出码、标准输出和标准错误
+func runCLI(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// TestRun 测试查询来源、退出码和文本输出
+func TestRun(t *testing.T) {
+	rules := writeFile(t, "rules.yml", testRules)
+	dashboard := writeFile(t, "dashboard.json", testDashboard)
+	grafana := writeFile(t, "grafana.json", testGrafanaDashboard)
+
+	tests := []struct {
+		name     string
+		stdin    string
+		args     []string
+		code     int
+		expected []string
+	}{
+		{
+			name:     "参数中的有效查询",
+			args:     []string{"-query", `sum by (job) (rate(http_requests_total[5m]))`},
+			code:     exitOK,
+			expected: []string{"1 queries checked: 0 errors, 0 warnings, 0 info"},
+		},
+		{
+			name:  "标准输入中的无效查询",
+			stdin: "\n  sum(rate(foo[5m])) by",
+			code:  exitIssues,
+			expected: []string{
+				"<stdin>:2:",
+				"error:",
+				"[syntax]",
+				"1 queries checked: 1 errors, 0 warnings, 0 info",
+			},
+		},
+		{
+			name: "规则文件",
+			args: []string{rules},
+			code: exitIssues,
+			expected: []string{
+				rules + ":5:15: info: sum without by drops all labels [sum-without-by]",
+				rules + ":9:18: error: expected type range vector in call to function \"rate\", got instant vector [syntax]",
+				rules + ":12:16: warning: rate() on node_memory_free_bytes",
+				"3 queries checked: 1 errors, 1 warnings, 1 info",
+			},
+		},
+		{
+			name: "Grafana 面板只检查 Prometheus 查询",
+			args: []string{dashboard},
+			code: exitOK,
+			expected: []string{
+				dashboard + ":6:19: warning:",
+				"[nan-comparison]",
+				"1 queries checked: 0 errors, 1 warnings, 0 info",
+			},
+		},
+		{
+			name: "Grafana 变量替换为占位符",
+			args: []string{grafana},
+			code: exitOK,
+			expected: []string{
+				grafana + ":6:73: info: query skipped: cannot substitute Grafana variable $threshold outside a string or range [grafana-variable]",
+				grafana + ":7:19: warning: rate() on node_memory_free_bytes",
+				"2 queries checked: 0 errors, 1 warnings, 1 info",
+			},
+		},
+		{
+			name:     "按警告判断退出码",
+			args:     []string{"-fail-on", "warning", dashboard},
+			code:     exitIssues,
+			expected: []string{"[nan-comparison]"},
+		},
+		{
+			name:     "禁用规则",
+			args:     []string{"-disable", "nan-comparison, sum-without-by", "-fail-on", "info", dashboard},
+			code:     exitOK,
+			expected: []string{"1 queries checked: 0 errors, 0 warnings, 0 info"},
+		},
+		{
+			name:     "采集间隔",
+			args:     []string{"-scrape-interval", "1m", "-q", `rate(http_requests_total[30s])`},
+			code:     exitOK,
+			expected: []string{"<query>:1:6: warning: range window 30s is shorter than scrape interval 1m [range-shorter-than-scrape-interval]"},
+		},
+		{
+			name:     "列出规则",
+			args:     []string{"-list-rules"},
+			code:     exitOK,
+			expected: []string{"RULE", "rate-on-gauge", "nan-comparison"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(tt.stdin, tt.args...)
+			assert.Equal(t, tt.code, code, stderr)
+			for _, s := range tt.expected {
+				assert.Contains(t, stdout, s)
+			}
+		})
+	}
+}
+
+// TestRun_Usage 测试参数和文件错误
+func TestRun_Usage(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "未知格式", args: []string{"-format", "xml", "-q", "up"}, expected: `unknown format "xml"`},
+		{name: "未知严重程度", args: []string{"-fail-on", "fatal", "-q", "up"}, expected: `unknown severity "fatal"`},
+		{name: "未知规则", args: []string{"-disable", "foo", "-q", "up"}, expected: `unknown lint rule "foo"`},
+		{name: "查询和文件同时使用", args: []string{"-q", "up", "rules.yml"}, expected: "-query cannot be used with files"},
+		{name: "文件不存在", args: []string{filepath.Join(t.TempDir(), "missing.yml")}, expected: "no such file"},
+		{name: "文件无法解析", args: []string{writeFile(t, "bad.yml", "groups: [")}, expected: "bad.yml"},
+		{name: "标签响应缺少元数据", args: []string{"-catalog-labels", "labels.json", "-q", "up"}, expected: "-catalog-labels requires -catalog-metadata"},
+		{name: "范围查询步长", args: []string{"-range", "1h", "-step", "0s", "-q", "up"}, expected: "-step must be positive"},
+		{name: "未知参数", args: []string{"-foo"}, expected: "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCLI("", tt.args...)
+			assert.Equal(t, exitUsage, code)
+			assert.Contains(t, stderr, tt.expected)
+		})
+	}
+}
+
+// TestRun_Catalog 测试按指标目录检查
+func TestRun_Catalog(t *testing.T) {
+	catalog := writeFile(t, "catalog.yaml", `
+labels: [job]
+metrics:
+  - name: http_requests_total
+    type: counter
+`)
+	exposition := writeFile(t, "metrics.txt", "# TYPE node_load1 gauge\nnode_load1{instance=\"a\"} 1\n")
+
+	code, stdout, _ := runCLI("", "-catalog", catalog, "-catalog-exposition", exposition, "-q",
+		`rate(http_request_total[5m]) + node_load1{instance="a"}`)
+	assert.Equal(t, exitIssues, code)
+	assert.Contains(t, stdout, `<query>:1:6: error: unknown metric "http_request_total", did you mean "http_requests_total"? [unknown-metric]`)
+	assert.Contains(t, stdout, "1 queries checked: 1 errors, 0 warnings, 0 info")
+
+	code, _, stderr := runCLI("", "-catalog", filepath.Join(t.TempDir(), "missing.yaml"), "-q", "up")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "load catalog")
+}
+
+// TestRun_Cost 测试按 TSDB 统计信息检查查询成本
+func TestRun_Cost(t *testing.T) {
+	stats := writeFile(t, "tsdb.json", `{"status":"success","data":{
+		"headStats":{"numSeries":100000},
+		"seriesCountByMetricName":[{"name":"http_requests_total","value":50000},{"name":"up","value":100}]
+	}}`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		expected string
+	}{
+		{name: "没有超出预算", args: []string{"-tsdb-stats", stats, "-q", `sum(rate(http_requests_total[5m]))`}, code: exitOK, expected: "0 warnings"},
+		{
+			name:     "范围查询超出样本预算",
+			args:     []string{"-tsdb-stats", stats, "-range", "24h", "-step", "15s", "-fail-on", "warning", "-q", `sum(rate(http_requests_total[5m]))`},
+			code:     exitIssues,
+			expected: "<query>:1:5: warning: query scans about 5761000000 samples, over budget of 50000000; rate(http_requests_total[5m]) scans 5761000000 (100%) [samples-budget]",
+		},
+		{
+			name:     "序列预算",
+			args:     []string{"-tsdb-stats", stats, "-max-series", "1000", "-max-samples", "0", "-fail-on", "warning", "-q", `http_requests_total`},
+			code:     exitIssues,
+			expected: "[series-budget]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI("", tt.args...)
+			assert.Equal(t, tt.code, code, stderr)
+			assert.Contains(t, stdout, tt.expected)
+		})
+	}
+
+	code, _, stderr := runCLI("", "-tsdb-stats", filepath.Join(t.TempDir(), "missing.json"), "-q", "up")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "load tsdb stats")
+}
+
+// TestRun_Formats 测试 JSON、GitHub 和 GitLab 输出
+func TestRun_Formats(t *testing.T) {
+	rules := writeFile(t, "rules.yml", testRules)
+
+	t.Run("JSON", func(t *testing.T) {
+		code, stdout, _ := runCLI("", "-format", "json", rules)
+		assert.Equal(t, exitIssues, code)
+		var issues []issue
+		require.NoError(t, json.Unmarshal([]byte(stdout), &issues))
+		require.Len(t, issues, 3)
+		assert.Equal(t, ruleSyntax, issues[1].Rule)
+		assert.Equal(t, 9, issues[1].Line)
+		assert.Equal(t, 18, issues[1].Column)
+		assert.Equal(t, "rate(node_memory_free_bytes[5m])", issues[2].Query)
+	})
+
+	t.Run("JSON 没有问题时输出空数组", func(t *testing.T) {
+		code, stdout, _ := runCLI("", "-format", "json", "-q", "up")
+		assert.Equal(t, exitOK, code)
+		assert.Equal(t, "[]\n", stdout)
+	})
+
+	t.Run("GitHub", func(t *testing.T) {
+		_, stdout, _ := runCLI("", "-format", "github", rules)
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		require.Len(t, lines, 3)
+		assert.Equal(t, "::notice file="+githubProperty(rules)+",line=5,col=15,title=sum-without-by::sum without by drops all labels", lines[0])
+		assert.True(t, strings.HasPrefix(lines[1], "::error file="), lines[1])
+		assert.True(t, strings.HasPrefix(lines[2], "::warning file="), lines[2])
+	})
+
+	t.Run("GitLab", func(t *testing.T) {
+		_, stdout, _ := runCLI("", "-format", "gitlab", rules)
+		var report []gitlabIssue
+		require.NoError(t, json.Unmarshal([]byte(stdout), &report))
+		require.Len(t, report, 3)
+		assert.Equal(t, []string{"info", "major", "minor"}, []string{report[0].Severity, report[1].Severity, report[2].Severity})
+		assert.Equal(t, rules, report[0].Location.Path)
+		assert.Equal(t, gitlabPosition{Line: 5, Column: 15}, report[0].Location.Positions.Begin)
+		assert.Len(t, report[0].Fingerprint, 32)
+		assert.NotEqual(t, report[0].Fingerprint, report[1].Fingerprint)
+	})
+}
+
+// TestExpandGrafana 测试 Grafana 变量的替换
+func TestExpandGrafana(t *testing.T) {
+	tests := []struct {
+		name        string // 测试用例名称
+		query       string // Grafana 面板中的查询
+		expanded    string // 期望替换后的查询，为空时查询没有变量
+		unsupported string // 期望无法替换的变量
+	}{
+		{name: "内置变量和字符串中的变量", query: `rate(x{job=~"$job"}[$__rate_interval])`, expanded: `rate(x{job=~"job"}[5m])`},
+		{name: "各种变量语法", query: `x{a="${a:regex}",b='[[b]]'}[${window}:$__interval] @ ${__to:date:seconds}`, expanded: `x{a="a",b='b'}[5m:5m] @ 1700000000`},
+		{name: "没有变量", query: `label_replace(up, "a", "$1", "job", "(.*)")`},
+		{name: "作为数值的变量", query: `up > $threshold`, unsupported: "$threshold"},
+		{name: "作为指标名的变量", query: `${metric}{job="a"}`, unsupported: "${metric}"},
+		{name: "字符串外的其他内置变量", query: `x[$__user]`, unsupported: "$__user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := expandGrafana(textSource("q", tt.query))
+			assert.Equal(t, tt.expanded, src.expanded)
+			assert.Equal(t, tt.unsupported, src.unsupported)
+		})
+	}
+}
+
+// TestSourcePosition 测试查询中的偏移到文件位置的转换
+func TestSourcePosition(t *testing.T) {
+	block := source{query: "sum(\n  rate(x[5m])\n)", line: 10, column: 7, indent: 6, multiline: true}
+	folded := source{query: "sum(\n  rate(x[5m])\n)", line: 10, column: 7}
+	grafana := expandGrafana(textSource("q", `x[$__rate_interval] > 1`))
+
+	tests := []struct {
+		name   string
+		src    source
+		offset int
+		line   int
+		column int
+	}{
+		{name: "第一行", src: block, offset: 2, line: 10, column: 9},
+		{name: "块字符串的后续行", src: block, offset: 7, line: 11, column: 9},
+		{name: "无法映射的换行", src: folded, offset: 7, line: 10, column: 7},
+		{name: "越界偏移", src: block, offset: 100, line: 10, column: 7},
+		{name: "多字节字符按字符计算列号", src: textSource("q", `{a="标签"} + b`), offset: len(`{a="标签"} `), line: 1, column: 10},
+		{name: "占位符之后的偏移", src: grafana, offset: len(`x[5m]`), line: 1, column: len(`x[$__rate_interval]`) + 1},
+		{name: "占位符内的偏移对应到变量开头", src: grafana, offset: len(`x[5`), line: 1, column: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, column := tt.src.position(tt.offset)
+			assert.Equal(t, tt.line, line)
+			assert.Equal(t, tt.column, column)
+		})
+	}
+}
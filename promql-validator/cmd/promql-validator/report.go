@@ -0,0 +1,216 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/prometheus/promql-validator/validator"
+)
+
+// 输出格式
+const (
+	formatText   = "text"
+	formatJSON   = "json"
+	formatGitHub = "github"
+	formatGitLab = "gitlab"
+)
+
+// ruleSyntax 解析错误的规则 ID
+const ruleSyntax = "syntax"
+
+// issue 一条校验问题，位置为文件中的行号和列号
+type issue struct {
+	File        string             `json:"file"`
+	Line        int                `json:"line"`
+	Column      int                `json:"column"`
+	Severity    validator.Severity `json:"severity"`
+	Rule        string             `json:"rule"`
+	Message     string             `json:"message"`
+	Query       string             `json:"query"`
+	Suggestions []string           `json:"suggestions,omitempty"`
+}
+
+// severityRank 严重程度的排序，用于判断退出码
+var severityRank = map[validator.Severity]int{
+	validator.SeverityInfo:    1,
+	validator.SeverityWarning: 2,
+	validator.SeverityError:   3,
+}
+
+// collectIssues 将校验结果转换为带文件位置的问题
+// 校验前查询会去掉首尾空白，位置需要加上去掉的前缀长度
+func collectIssues(src source, result *validator.ValidationResult) []issue {
+	lead := len(src.expr()) - len(strings.TrimLeft(src.expr(), " \t\r\n"))
+	query := strings.TrimSpace(src.query)
+	var issues []issue
+	for _, e := range result.Errors {
+		line, column := src.position(lead + e.Pos)
+		issues = append(issues, issue{
+			File: src.file, Line: line, Column: column,
+			Severity: validator.SeverityError,
+			Rule:     ruleSyntax,
+			Message:  e.Message,
+			Query:    query,
+		})
+	}
+	for _, w := range result.Warnings {
+		line, column := src.position(lead + w.Pos)
+		issues = append(issues, issue{
+			File: src.file, Line: line, Column: column,
+			Severity:    w.Severity,
+			Rule:        w.RuleID,
+			Message:     w.Message,
+			Query:       query,
+			Suggestions: w.Suggestions,
+		})
+	}
+	return issues
+}
+
+// skippedIssue 查询中有无法替换的 Grafana 变量时，提示该查询没有校验
+func skippedIssue(src source) issue {
+	line, column := src.position(src.unsupportedAt)
+	return issue{
+		File: src.file, Line: line, Column: column,
+		Severity: validator.SeverityInfo,
+		Rule:     ruleGrafanaVariable,
+		Message:  fmt.Sprintf("query skipped: cannot substitute Grafana variable %s outside a string or range", src.unsupported),
+		Query:    strings.TrimSpace(src.query),
+	}
+}
+
+// writeIssues 按格式输出问题
+func writeIssues(w io.Writer, format string, issues []issue, queries int) error {
+	switch format {
+	case formatText:
+		return writeText(w, issues, queries)
+	case formatJSON:
+		return writeJSON(w, issues)
+	case formatGitHub:
+		return writeGitHub(w, issues)
+	case formatGitLab:
+		return writeGitLab(w, issues)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// writeText 输出 file:line:column: severity: message [rule]，最后输出汇总
+func writeText(w io.Writer, issues []issue, queries int) error {
+	counts := make(map[validator.Severity]int)
+	for _, i := range issues {
+		counts[i.Severity]++
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: %s: %s [%s]\n", i.File, i.Line, i.Column, i.Severity, i.Message, i.Rule); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d queries checked: %d errors, %d warnings, %d info\n",
+		queries, counts[validator.SeverityError], counts[validator.SeverityWarning], counts[validator.SeverityInfo])
+	return err
+}
+
+func writeJSON(w io.Writer, issues []issue) error {
+	if issues == nil {
+		issues = []issue{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(issues)
+}
+
+// githubLevels GitHub Actions 注释的级别
+var githubLevels = map[validator.Severity]string{
+	validator.SeverityInfo:    "notice",
+	validator.SeverityWarning: "warning",
+	validator.SeverityError:   "error",
+}
+
+// writeGitHub 输出 GitHub Actions 的 workflow 命令，在 PR 中显示为代码注释
+func writeGitHub(w io.Writer, issues []issue) error {
+	for _, i := range issues {
+		_, err := fmt.Fprintf(w, "::%s file=%s,line=%d,col=%d,title=%s::%s\n",
+			githubLevels[i.Severity], githubProperty(i.File), i.Line, i.Column, githubProperty(i.Rule), githubData(i.Message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// githubData 转义 workflow 命令的消息
+func githubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// githubProperty 转义 workflow 命令的属性
+func githubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(githubData(s))
+}
+
+// gitlabSeverities GitLab Code Quality 报告的严重程度
+var gitlabSeverities = map[validator.Severity]string{
+	validator.SeverityInfo:    "info",
+	validator.SeverityWarning: "minor",
+	validator.SeverityError:   "major",
+}
+
+// gitlabIssue GitLab Code Quality 报告中的一条问题
+type gitlabIssue struct {
+	Description string         `json:"description"`
+	CheckName   string         `json:"check_name"`
+	Fingerprint string         `json:"fingerprint"`
+	Severity    string         `json:"severity"`
+	Location    gitlabLocation `json:"location"`
+}
+
+type gitlabLocation struct {
+	Path      string          `json:"path"`
+	Positions gitlabPositions `json:"positions"`
+}
+
+type gitlabPositions struct {
+	Begin gitlabPosition `json:"begin"`
+}
+
+type gitlabPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// writeGitLab 输出 GitLab Code Quality 报告，fingerprint 由文件、规则、查询和消息计算，不随行号变化
+func writeGitLab(w io.Writer, issues []issue) error {
+	report := make([]gitlabIssue, 0, len(issues))
+	for _, i := range issues {
+		sum := sha256.Sum256([]byte(strings.Join([]string{i.File, i.Rule, i.Query, i.Message}, "\x00")))
+		report = append(report, gitlabIssue{
+			Description: i.Message,
+			CheckName:   i.Rule,
+			Fingerprint: hex.EncodeToString(sum[:16]),
+			Severity:    gitlabSeverities[i.Severity],
+			Location: gitlabLocation{
+				Path:      i.File,
+				Positions: gitlabPositions{Begin: gitlabPosition{Line: i.Line, Column: i.Column}},
+			},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,341 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// MetricSchema 描述一个指标的类型和标签
+type MetricSchema struct {
+	Name string           `yaml:"name" json:"name"`
+	Type model.MetricType `yaml:"type,omitempty" json:"type,omitempty"`
+	Help string           `yaml:"help,omitempty" json:"help,omitempty"`
+	Unit string           `yaml:"unit,omitempty" json:"unit,omitempty"`
+	// Labels 指标的标签名，为空时只按 Catalog.Labels 检查
+	Labels []string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// Catalog 指标目录，用于检查查询中的指标和标签是否存在
+//
+// YAML 或 JSON 格式：
+//
+//	labels: [job, instance]
+//	metrics:
+//	  - name: http_requests_total
+//	    type: counter
+//	    labels: [method, code]
+type Catalog struct {
+	// Labels 所有指标都可能有的标签，例如 job、instance
+	Labels  []string       `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Metrics []MetricSchema `yaml:"metrics" json:"metrics"`
+
+	// index 指标名到 Metrics 下标的索引，由构造函数和 AddMetric 维护，查询时只读
+	index map[string]int
+}
+
+// NewCatalog 创建指标目录，同名的指标会合并标签
+// 构建完成后的 Catalog 可以被多个 goroutine 并发查询，AddMetric 不能与查询并发调用
+func NewCatalog(labels []string, metrics ...MetricSchema) *Catalog {
+	c := &Catalog{Labels: uniqueStrings(append([]string(nil), labels...)), index: map[string]int{}}
+	for _, m := range metrics {
+		c.AddMetric(m)
+	}
+	return c
+}
+
+// AddMetric 添加指标，指标已存在时合并标签，并在原类型未知时更新类型和说明
+func (c *Catalog) AddMetric(m MetricSchema) {
+	c.buildIndex()
+	if i, ok := c.index[m.Name]; ok {
+		existing := &c.Metrics[i]
+		existing.Labels = mergeLabels(existing.Labels, m.Labels)
+		if existing.Type == "" || existing.Type == model.MetricTypeUnknown {
+			existing.Type = m.Type
+		}
+		if existing.Help == "" {
+			existing.Help = m.Help
+		}
+		if existing.Unit == "" {
+			existing.Unit = m.Unit
+		}
+		return
+	}
+	m.Labels = mergeLabels(nil, m.Labels)
+	c.index[m.Name] = len(c.Metrics)
+	c.Metrics = append(c.Metrics, m)
+}
+
+// Metric 按名称查找指标，只读取 Catalog，可以并发调用
+// 不是通过构造函数创建的 Catalog 没有索引，按顺序查找
+func (c *Catalog) Metric(name string) (MetricSchema, bool) {
+	if c.index != nil {
+		i, ok := c.index[name]
+		if !ok {
+			return MetricSchema{}, false
+		}
+		return c.Metrics[i], true
+	}
+	for _, m := range c.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return MetricSchema{}, false
+}
+
+// MetricNames 返回所有指标名，按字母排序
+func (c *Catalog) MetricNames() []string {
+	names := make([]string, 0, len(c.Metrics))
+	for _, m := range c.Metrics {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LabelNames 返回 Catalog.Labels 和所有指标的标签名，按字母排序
+func (c *Catalog) LabelNames() []string {
+	names := mergeLabels(nil, c.Labels)
+	for _, m := range c.Metrics {
+		names = mergeLabels(names, m.Labels)
+	}
+	return names
+}
+
+// buildIndex 为不是通过构造函数创建的 Catalog 建立指标名索引，只在 AddMetric 中调用
+func (c *Catalog) buildIndex() {
+	if c.index != nil {
+		return
+	}
+	c.index = make(map[string]int, len(c.Metrics))
+	for i, m := range c.Metrics {
+		if _, ok := c.index[m.Name]; !ok {
+			c.index[m.Name] = i
+		}
+	}
+}
+
+// LoadCatalog 从 YAML 或 JSON 文件加载指标目录
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCatalog(data)
+}
+
+// ParseCatalog 解析 YAML 或 JSON 格式的指标目录
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var raw Catalog
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&raw); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("parse catalog: %w", err)
+	}
+	for i, m := range raw.Metrics {
+		if m.Name == "" {
+			return nil, fmt.Errorf("parse catalog: metric %d has no name", i)
+		}
+	}
+	return NewCatalog(raw.Labels, raw.Metrics...), nil
+}
+
+// apiResponse Prometheus HTTP API 的响应
+type apiResponse[T any] struct {
+	Status string `json:"status"`
+	Data   T      `json:"data"`
+	Error  string `json:"error,omitempty"`
+}
+
+// apiMetadata /api/v1/metadata 中一个指标的元数据
+type apiMetadata struct {
+	Type model.MetricType `json:"type"`
+	Help string           `json:"help"`
+	Unit string           `json:"unit"`
+}
+
+// ParseCatalogFromAPI 从 Prometheus /api/v1/metadata 和 /api/v1/labels 的响应构建指标目录
+// metadata 只包含指标类型，labels 中的标签作为所有指标都可能有的标签；labels 可以为空
+func ParseCatalogFromAPI(metadata, labels []byte) (*Catalog, error) {
+	var meta apiResponse[map[string][]apiMetadata]
+	if err := json.Unmarshal(metadata, &meta); err != nil {
+		return nil, fmt.Errorf("parse metadata response: %w", err)
+	}
+	if meta.Status != "success" {
+		return nil, fmt.Errorf("metadata response status %q: %s", meta.Status, meta.Error)
+	}
+	c := NewCatalog(nil)
+	if len(labels) > 0 {
+		var names apiResponse[[]string]
+		if err := json.Unmarshal(labels, &names); err != nil {
+			return nil, fmt.Errorf("parse labels response: %w", err)
+		}
+		if names.Status != "success" {
+			return nil, fmt.Errorf("labels response status %q: %s", names.Status, names.Error)
+		}
+		for _, name := range names.Data {
+			if name != model.MetricNameLabel {
+				c.Labels = append(c.Labels, name)
+			}
+		}
+		c.Labels = mergeLabels(nil, c.Labels)
+	}
+	names := make([]string, 0, len(meta.Data))
+	for name := range meta.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, m := range meta.Data[name] {
+			c.addFamily(MetricSchema{Name: name, Type: m.Type, Help: m.Help, Unit: m.Unit})
+		}
+	}
+	return c, nil
+}
+
+// LoadCatalogFromAPI 从保存的 /api/v1/metadata 和 /api/v1/labels 响应文件构建指标目录，labelsPath 可以为空
+func LoadCatalogFromAPI(metadataPath, labelsPath string) (*Catalog, error) {
+	metadata, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	var labels []byte
+	if labelsPath != "" {
+		if labels, err = os.ReadFile(labelsPath); err != nil {
+			return nil, err
+		}
+	}
+	return ParseCatalogFromAPI(metadata, labels)
+}
+
+// ParseCatalogFromExposition 从 Prometheus 文本格式的采集结果构建指标目录，标签取自样本
+func ParseCatalogFromExposition(r io.Reader) (*Catalog, error) {
+	var p expfmt.TextParser
+	families, err := p.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse exposition: %w", err)
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c := NewCatalog(nil)
+	for _, name := range names {
+		family := families[name]
+		var labels []string
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName())
+			}
+		}
+		c.addFamily(MetricSchema{
+			Name:   name,
+			Type:   exposedType(family.GetType()),
+			Help:   family.GetHelp(),
+			Labels: labels,
+		})
+	}
+	return c, nil
+}
+
+// LoadCatalogFromExposition 从保存的采集结果文件构建指标目录
+func LoadCatalogFromExposition(path string) (*Catalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCatalogFromExposition(f)
+}
+
+// exposedType 转换文本格式中的指标类型
+func exposedType(t dto.MetricType) model.MetricType {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return model.MetricTypeCounter
+	case dto.MetricType_GAUGE:
+		return model.MetricTypeGauge
+	case dto.MetricType_HISTOGRAM:
+		return model.MetricTypeHistogram
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		return model.MetricTypeGaugeHistogram
+	case dto.MetricType_SUMMARY:
+		return model.MetricTypeSummary
+	}
+	return model.MetricTypeUnknown
+}
+
+// addFamily 添加指标族，直方图和摘要展开为查询中实际使用的序列名
+func (c *Catalog) addFamily(m MetricSchema) {
+	switch m.Type {
+	case model.MetricTypeHistogram, model.MetricTypeGaugeHistogram:
+		// 原生直方图直接使用指标名查询
+		c.AddMetric(m)
+		bucket := m
+		bucket.Name = m.Name + "_bucket"
+		bucket.Labels = append(append([]string(nil), m.Labels...), model.BucketLabel)
+		c.AddMetric(bucket)
+		c.addComponents(m, "_sum", "_count")
+	case model.MetricTypeSummary:
+		m.Labels = append(append([]string(nil), m.Labels...), model.QuantileLabel)
+		c.AddMetric(m)
+		m.Labels = m.Labels[:len(m.Labels)-1]
+		c.addComponents(m, "_sum", "_count")
+	case model.MetricTypeCounter:
+		// OpenMetrics 的元数据中计数器名没有 _total 后缀
+		if !strings.HasSuffix(m.Name, "_total") {
+			total := m
+			total.Name += "_total"
+			c.AddMetric(total)
+		}
+		c.AddMetric(m)
+	default:
+		c.AddMetric(m)
+	}
+}
+
+func (c *Catalog) addComponents(m MetricSchema, suffixes ...string) {
+	for _, suffix := range suffixes {
+		component := m
+		component.Name = m.Name + suffix
+		c.AddMetric(component)
+	}
+}
+
+// mergeLabels 合并标签名，去重并排序，忽略 __name__
+func mergeLabels(labels []string, add []string) []string {
+	res := make([]string, 0, len(labels)+len(add))
+	for _, l := range append(append([]string(nil), labels...), add...) {
+		if l != model.MetricNameLabel {
+			res = append(res, l)
+		}
+	}
+	res = uniqueStrings(res)
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,404 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// 查询成本检查的规则 ID
+const (
+	RuleSeriesBudget  = "series-budget"
+	RuleSamplesBudget = "samples-budget"
+)
+
+const (
+	// defaultSubqueryStep 子查询没有指定步长时使用的步长，对应 Prometheus 默认的 evaluation_interval
+	defaultSubqueryStep = time.Minute
+	// defaultMaxSeries 默认的序列数预算
+	defaultMaxSeries = 100000
+	// defaultMaxSamples 默认的样本数预算，对应 Prometheus 默认的 --query.max-samples
+	defaultMaxSamples = 50000000
+)
+
+// Stats 估算查询成本使用的 TSDB 统计信息
+type Stats struct {
+	// TotalSeries TSDB 中的序列总数，用于估算没有指标名的选择器
+	TotalSeries uint64
+	// SeriesByMetric 每个指标的序列数
+	SeriesByMetric map[string]uint64
+	// DefaultSeries 不在 SeriesByMetric 中的指标的序列数
+	DefaultSeries uint64
+	// LabelValueCounts 每个标签的取值数，用于估算等值匹配的选择性
+	LabelValueCounts map[string]uint64
+	// SeriesByLabelPair 每个 name=value 标签对的序列数，优先于 LabelValueCounts 估算选择性
+	SeriesByLabelPair map[string]uint64
+	// ScrapeInterval 采集间隔，用于估算范围选择器的样本数，默认 15s
+	ScrapeInterval time.Duration
+}
+
+// tsdbStatus /api/v1/status/tsdb 响应中的 data
+type tsdbStatus struct {
+	HeadStats struct {
+		NumSeries uint64 `json:"numSeries"`
+	} `json:"headStats"`
+	SeriesCountByMetricName     []tsdbStat `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []tsdbStat `json:"labelValueCountByLabelName"`
+	SeriesCountByLabelValuePair []tsdbStat `json:"seriesCountByLabelValuePair"`
+}
+
+type tsdbStat struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// ParseTSDBStats 解析 Prometheus /api/v1/status/tsdb 的响应，也接受只包含 data 部分的 JSON
+//
+// 响应只列出序列数最多的指标（默认 10 个，可以用 limit 参数调整），
+// 未列出的指标的序列数不超过列表中的最小值，以此作为 DefaultSeries
+func ParseTSDBStats(data []byte) (*Stats, error) {
+	var resp apiResponse[tsdbStatus]
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("parse tsdb status: %w", err)
+	}
+	status := resp.Data
+	switch resp.Status {
+	case "success":
+	case "":
+		if err := json.Unmarshal(data, &status); err != nil {
+			return nil, fmt.Errorf("parse tsdb status: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("tsdb status response status %q: %s", resp.Status, resp.Error)
+	}
+
+	stats := &Stats{
+		TotalSeries:       status.HeadStats.NumSeries,
+		SeriesByMetric:    make(map[string]uint64, len(status.SeriesCountByMetricName)),
+		LabelValueCounts:  make(map[string]uint64, len(status.LabelValueCountByLabelName)),
+		SeriesByLabelPair: make(map[string]uint64, len(status.SeriesCountByLabelValuePair)),
+	}
+	for i, s := range status.SeriesCountByMetricName {
+		stats.SeriesByMetric[s.Name] = s.Value
+		if i == 0 || s.Value < stats.DefaultSeries {
+			stats.DefaultSeries = s.Value
+		}
+	}
+	for _, s := range status.LabelValueCountByLabelName {
+		stats.LabelValueCounts[s.Name] = s.Value
+	}
+	for _, s := range status.SeriesCountByLabelValuePair {
+		stats.SeriesByLabelPair[s.Name] = s.Value
+	}
+	return stats, nil
+}
+
+// LoadTSDBStats 从保存的 /api/v1/status/tsdb 响应文件加载统计信息
+func LoadTSDBStats(path string) (*Stats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTSDBStats(data)
+}
+
+// CostBudget 查询成本的预算，为 0 时不限制
+type CostBudget struct {
+	// MaxSeries 查询触及的最大序列数
+	MaxSeries uint64
+	// MaxSamples 查询扫描的最大样本数
+	MaxSamples uint64
+}
+
+// CostConfig 估算查询成本的参数
+type CostConfig struct {
+	// Range 范围查询的时间范围，为 0 时按即时查询估算
+	Range time.Duration
+	// Step 范围查询的步长，Range 不为 0 时必须设置
+	Step time.Duration
+	// SubqueryStep 子查询没有指定步长时使用的步长，默认 1m
+	SubqueryStep time.Duration
+	// Budget 成本预算
+	Budget CostBudget
+}
+
+// DefaultCostConfig 返回默认的成本估算配置：即时查询，100000 个序列和 50000000 个样本的预算
+func DefaultCostConfig() CostConfig {
+	return CostConfig{
+		SubqueryStep: defaultSubqueryStep,
+		Budget: CostBudget{
+			MaxSeries:  defaultMaxSeries,
+			MaxSamples: defaultMaxSamples,
+		},
+	}
+}
+
+// CostNode 一个选择器的成本，Expr 为使用选择器的函数调用或选择器本身
+type CostNode struct {
+	Expr    string
+	Pos     int
+	End     int
+	Series  uint64
+	Samples uint64
+}
+
+// Cost 查询成本的估算结果
+type Cost struct {
+	// Series 查询触及的序列数，同一个选择器在子查询和范围查询的每一步中只计算一次
+	Series uint64
+	// Samples 查询在所有评估步骤中扫描的样本数
+	Samples uint64
+	// Steps 范围查询的评估次数，即时查询为 1
+	Steps uint64
+	// Nodes 每个选择器的成本，按样本数从大到小排序
+	Nodes []CostNode
+}
+
+// EstimateCost 按默认配置估算即时查询的成本
+func EstimateCost(expr parser.Expr, stats *Stats) *Cost {
+	return EstimateCostWithConfig(expr, stats, DefaultCostConfig())
+}
+
+// EstimateCostWithConfig 按 cfg 估算查询的成本
+//
+// 每个选择器触及的序列数由指标的序列数和标签匹配的选择性估算；
+// 瞬时选择器每次评估读取每个序列的一个样本，范围选择器读取窗口除以采集间隔个样本；
+// 子查询和范围查询按评估次数放大样本数
+func EstimateCostWithConfig(expr parser.Expr, stats *Stats, cfg CostConfig) *Cost {
+	if stats == nil {
+		stats = &Stats{}
+	}
+	e := costEstimator{stats: stats, cfg: cfg}
+	steps := 1.0
+	if cfg.Range > 0 && cfg.Step > 0 {
+		steps = math.Floor(float64(cfg.Range)/float64(cfg.Step)) + 1
+	}
+	e.walk(expr, nil, steps)
+
+	cost := &Cost{Steps: uint64(steps), Nodes: e.nodes}
+	for _, n := range e.nodes {
+		cost.Series = saturatingAdd(cost.Series, n.Series)
+		cost.Samples = saturatingAdd(cost.Samples, n.Samples)
+	}
+	sort.SliceStable(cost.Nodes, func(i, j int) bool {
+		return cost.Nodes[i].Samples > cost.Nodes[j].Samples
+	})
+	return cost
+}
+
+// Dominant 返回样本数最多的选择器
+func (c *Cost) Dominant() (CostNode, bool) {
+	if len(c.Nodes) == 0 {
+		return CostNode{}, false
+	}
+	return c.Nodes[0], true
+}
+
+// Check 检查成本是否超出预算，超出时返回 warning 级别的警告，位置为占比最大的选择器
+func (c *Cost) Check(budget CostBudget) []Warning {
+	warnings := make([]Warning, 0)
+	if budget.MaxSeries > 0 && c.Series > budget.MaxSeries {
+		top := c.Nodes[0]
+		for _, n := range c.Nodes[1:] {
+			if n.Series > top.Series {
+				top = n
+			}
+		}
+		warnings = append(warnings, Warning{
+			Pos: top.Pos, End: top.End,
+			RuleID:   RuleSeriesBudget,
+			Severity: SeverityWarning,
+			Message: fmt.Sprintf("query touches about %d series, over budget of %d; %s touches %d (%d%%)",
+				c.Series, budget.MaxSeries, top.Expr, top.Series, percent(top.Series, c.Series)),
+		})
+	}
+	if budget.MaxSamples > 0 && c.Samples > budget.MaxSamples {
+		top := c.Nodes[0]
+		warnings = append(warnings, Warning{
+			Pos: top.Pos, End: top.End,
+			RuleID:   RuleSamplesBudget,
+			Severity: SeverityWarning,
+			Message: fmt.Sprintf("query scans about %d samples, over budget of %d; %s scans %d (%d%%)",
+				c.Samples, budget.MaxSamples, top.Expr, top.Samples, percent(top.Samples, c.Samples)),
+		})
+	}
+	return warnings
+}
+
+// CostCheck 返回按 cfg 估算成本并检查预算的 Check，用于 ValidateWith
+func CostCheck(stats *Stats, cfg CostConfig) Check {
+	return func(expr parser.Expr) []Warning {
+		return EstimateCostWithConfig(expr, stats, cfg).Check(cfg.Budget)
+	}
+}
+
+// costEstimator 遍历表达式并记录每个选择器的成本
+type costEstimator struct {
+	stats *Stats
+	cfg   CostConfig
+	nodes []CostNode
+}
+
+// walk 遍历表达式，steps 为节点的评估次数，parent 为直接使用节点的函数调用
+func (e *costEstimator) walk(node parser.Node, parent *parser.Call, steps float64) {
+	switch n := node.(type) {
+	case *parser.VectorSelector:
+		series := e.series(n)
+		e.record(n, parent, series, series*steps)
+		return
+	case *parser.MatrixSelector:
+		vs, ok := n.VectorSelector.(*parser.VectorSelector)
+		if !ok {
+			return
+		}
+		series := e.series(vs)
+		e.record(n, parent, series, series*e.samplesPerSeries(n.Range)*steps)
+		return
+	case *parser.SubqueryExpr:
+		step := n.Step
+		if step <= 0 {
+			step = e.cfg.SubqueryStep
+		}
+		if step <= 0 {
+			step = defaultSubqueryStep
+		}
+		steps *= math.Max(1, math.Floor(float64(n.Range)/float64(step)))
+	case *parser.Call:
+		for _, arg := range n.Args {
+			e.walk(arg, n, steps)
+		}
+		return
+	}
+	for _, child := range parser.Children(node) {
+		e.walk(child, nil, steps)
+	}
+}
+
+// record 记录选择器的成本，直接被函数调用使用时以函数调用作为子表达式
+func (e *costEstimator) record(node parser.Expr, parent *parser.Call, series, samples float64) {
+	report := node
+	if parent != nil {
+		report = parent
+	}
+	pos := report.PositionRange()
+	e.nodes = append(e.nodes, CostNode{
+		Expr:    report.String(),
+		Pos:     int(pos.Start),
+		End:     int(pos.End),
+		Series:  toCount(series),
+		Samples: toCount(samples),
+	})
+}
+
+// series 估算选择器触及的序列数
+func (e *costEstimator) series(vs *parser.VectorSelector) float64 {
+	var base float64
+	var nameMatcher *labels.Matcher
+	for _, m := range vs.LabelMatchers {
+		if m.Name == model.MetricNameLabel {
+			nameMatcher = m
+		}
+	}
+	switch {
+	case vs.Name != "":
+		base = float64(e.metricSeries(vs.Name))
+	case nameMatcher != nil && nameMatcher.Type != labels.MatchEqual:
+		// 按统计中的指标名匹配正则，没有匹配时按一个未列出的指标估算
+		for name, count := range e.stats.SeriesByMetric {
+			if nameMatcher.Matches(name) {
+				base += float64(count)
+			}
+		}
+		if base == 0 {
+			base = float64(e.stats.DefaultSeries)
+		}
+	case nameMatcher != nil:
+		base = float64(e.metricSeries(nameMatcher.Value))
+	default:
+		base = float64(e.stats.TotalSeries)
+	}
+	if base == 0 {
+		return 0
+	}
+
+	// 只有等值匹配缩小范围，多个标签按相互独立估算
+	series := base
+	for _, m := range vs.LabelMatchers {
+		if m.Name == model.MetricNameLabel || m.Type != labels.MatchEqual || m.Value == "" {
+			continue
+		}
+		series *= e.selectivity(m)
+	}
+	return math.Max(1, series)
+}
+
+// metricSeries 返回指标的序列数，没有统计时使用 DefaultSeries
+func (e *costEstimator) metricSeries(name string) uint64 {
+	if count, ok := e.stats.SeriesByMetric[name]; ok {
+		return count
+	}
+	return e.stats.DefaultSeries
+}
+
+// selectivity 估算等值匹配保留的序列比例
+func (e *costEstimator) selectivity(m *labels.Matcher) float64 {
+	if count, ok := e.stats.SeriesByLabelPair[m.Name+"="+m.Value]; ok && e.stats.TotalSeries > 0 {
+		return math.Min(1, float64(count)/float64(e.stats.TotalSeries))
+	}
+	if count := e.stats.LabelValueCounts[m.Name]; count > 0 {
+		return 1 / float64(count)
+	}
+	return 1
+}
+
+// samplesPerSeries 估算范围窗口内每个序列的样本数
+func (e *costEstimator) samplesPerSeries(window time.Duration) float64 {
+	interval := e.stats.ScrapeInterval
+	if interval <= 0 {
+		interval = defaultScrapeInterval
+	}
+	return math.Max(1, math.Floor(float64(window)/float64(interval)))
+}
+
+// toCount 将估算值转换为整数，超出范围时取最大值
+func toCount(v float64) uint64 {
+	if v >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(math.Round(v))
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+func percent(part, total uint64) uint64 {
+	if total == 0 {
+		return 0
+	}
+	return uint64(math.Round(float64(part) / float64(total) * 100))
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTSDBStatus = `{"status":"success","data":{
+	"headStats":{"numSeries":10000,"chunkCount":20000,"minTime":0,"maxTime":0},
+	"seriesCountByMetricName":[
+		{"name":"http_requests_total","value":2000},
+		{"name":"node_cpu_seconds_total","value":800},
+		{"name":"up","value":100}
+	],
+	"labelValueCountByLabelName":[{"name":"instance","value":50},{"name":"job","value":10}],
+	"seriesCountByLabelValuePair":[{"name":"job=api","value":5000}]
+}}`
+
+// testStats 返回测试用的统计信息
+func testStats(t *testing.T) *Stats {
+	t.Helper()
+	stats, err := ParseTSDBStats([]byte(testTSDBStatus))
+	require.NoError(t, err)
+	return stats
+}
+
+// TestEstimateCost 测试序列数和样本数的估算
+func TestEstimateCost(t *testing.T) {
+	stats := testStats(t)
+
+	tests := []struct {
+		name    string
+		query   string
+		cfg     CostConfig
+		series  uint64
+		samples uint64
+		steps   uint64
+	}{
+		{name: "瞬时选择器", query: `up`, series: 100, samples: 100, steps: 1},
+		{name: "范围选择器按采集间隔计算样本", query: `rate(http_requests_total[5m])`, series: 2000, samples: 2000 * 20, steps: 1},
+		{name: "按标签取值数估算选择性", query: `up{instance="a:9100"}`, series: 2, samples: 2, steps: 1},
+		{name: "按标签对的序列数估算选择性", query: `http_requests_total{job="api"}`, series: 1000, samples: 1000, steps: 1},
+		{name: "正则匹配不缩小范围", query: `up{instance=~"a.*"}`, series: 100, samples: 100, steps: 1},
+		{name: "选择性至少保留一个序列", query: `up{instance="a", job="b"}`, series: 1, samples: 1, steps: 1},
+		{name: "未列出的指标使用最小值", query: `process_open_fds`, series: 100, samples: 100, steps: 1},
+		{name: "按指标名正则汇总", query: `{__name__=~"http_.*|up"}`, series: 2100, samples: 2100, steps: 1},
+		{name: "没有指标名时使用序列总数", query: `{job="web"}`, series: 1000, samples: 1000, steps: 1},
+		{name: "子查询按步数放大", query: `max_over_time(rate(http_requests_total[5m])[1h:1m])`, series: 2000, samples: 2000 * 20 * 60, steps: 1},
+		{
+			name:   "子查询使用默认步长",
+			query:  `max_over_time(up[30m:])`,
+			cfg:    CostConfig{SubqueryStep: 5 * time.Minute},
+			series: 100, samples: 100 * 6, steps: 1,
+		},
+		{
+			name:   "范围查询按评估次数放大",
+			query:  `sum(rate(http_requests_total[1m])) / sum(up)`,
+			cfg:    CostConfig{Range: time.Hour, Step: time.Minute},
+			series: 2100, samples: (2000*4 + 100) * 61, steps: 61,
+		},
+		{name: "标量没有成本", query: `1 + 1`, series: 0, samples: 0, steps: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.query)
+			require.NoError(t, err)
+			cost := EstimateCostWithConfig(expr, stats, tt.cfg)
+			assert.Equal(t, tt.series, cost.Series, "序列数")
+			assert.Equal(t, tt.samples, cost.Samples, "样本数")
+			assert.Equal(t, tt.steps, cost.Steps, "评估次数")
+		})
+	}
+}
+
+// TestCost_Check 测试预算检查和占比最大的子表达式
+func TestCost_Check(t *testing.T) {
+	stats := testStats(t)
+	expr, err := parser.ParseExpr(`sum(rate(http_requests_total[5m])) / sum(up)`)
+	require.NoError(t, err)
+	cost := EstimateCost(expr, stats)
+
+	dominant, ok := cost.Dominant()
+	require.True(t, ok)
+	assert.Equal(t, "rate(http_requests_total[5m])", dominant.Expr)
+	assert.Equal(t, 4, dominant.Pos)
+	assert.Len(t, cost.Nodes, 2)
+
+	t.Run("没有超出预算", func(t *testing.T) {
+		assert.Empty(t, cost.Check(DefaultCostConfig().Budget))
+		assert.Empty(t, cost.Check(CostBudget{}), "预算为 0 时不限制")
+	})
+
+	t.Run("超出序列和样本预算", func(t *testing.T) {
+		warnings := cost.Check(CostBudget{MaxSeries: 1000, MaxSamples: 10000})
+		require.Len(t, warnings, 2)
+		assert.Equal(t, RuleSeriesBudget, warnings[0].RuleID)
+		assert.Equal(t, SeverityWarning, warnings[0].Severity)
+		assert.Equal(t, "query touches about 2100 series, over budget of 1000; rate(http_requests_total[5m]) touches 2000 (95%)", warnings[0].Message)
+		assert.Equal(t, RuleSamplesBudget, warnings[1].RuleID)
+		assert.Equal(t, "query scans about 40100 samples, over budget of 10000; rate(http_requests_total[5m]) scans 40000 (100%)", warnings[1].Message)
+		assert.Equal(t, 4, warnings[1].Pos)
+	})
+
+	t.Run("没有统计信息", func(t *testing.T) {
+		cost := EstimateCost(expr, nil)
+		assert.Zero(t, cost.Samples)
+		assert.Empty(t, cost.Check(CostBudget{MaxSeries: 1, MaxSamples: 1}))
+	})
+}
+
+// TestValidateWith_CostCheck 测试校验时检查成本
+func TestValidateWith_CostCheck(t *testing.T) {
+	cfg := DefaultCostConfig()
+	cfg.Range, cfg.Step = 24*time.Hour, 15*time.Second
+	result := ValidateWith(`sum by (job) (rate(http_requests_total[5m]))`, DefaultLintConfig(), CostCheck(testStats(t), cfg))
+	require.True(t, result.Valid)
+	assert.Equal(t, []string{RuleSamplesBudget}, ruleIDs(result.Warnings))
+	assert.Equal(t, 14, result.Warnings[0].Pos)
+}
+
+// TestParseTSDBStats 测试解析 TSDB 状态
+func TestParseTSDBStats(t *testing.T) {
+	stats := testStats(t)
+	assert.Equal(t, uint64(10000), stats.TotalSeries)
+	assert.Equal(t, uint64(100), stats.DefaultSeries)
+	assert.Equal(t, uint64(800), stats.SeriesByMetric["node_cpu_seconds_total"])
+	assert.Equal(t, uint64(10), stats.LabelValueCounts["job"])
+	assert.Equal(t, uint64(5000), stats.SeriesByLabelPair["job=api"])
+
+	t.Run("只包含 data", func(t *testing.T) {
+		stats, err := ParseTSDBStats([]byte(`{"headStats":{"numSeries":5},"seriesCountByMetricName":[{"name":"up","value":5}]}`))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), stats.TotalSeries)
+		assert.Equal(t, uint64(5), stats.SeriesByMetric["up"])
+	})
+
+	t.Run("错误响应", func(t *testing.T) {
+		_, err := ParseTSDBStats([]byte(`{"status":"error","error":"unavailable"}`))
+		assert.ErrorContains(t, err, "unavailable")
+		_, err = ParseTSDBStats([]byte(`{`))
+		assert.ErrorContains(t, err, "parse tsdb status")
+	})
+
+	t.Run("从文件加载", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tsdb.json")
+		require.NoError(t, os.WriteFile(path, []byte(testTSDBStatus), 0o600))
+		stats, err := LoadTSDBStats(path)
+		require.NoError(t, err)
+		assert.Len(t, stats.SeriesByMetric, 3)
+	})
+}
@@ -59,3 +59,14 @@ func ExampleValidate_aggregation() {
 	// true
 	// [rate]
 }
+
+func ExampleValidateWithLint() {
+	cfg := validator.DefaultLintConfig().WithRule(validator.RuleSumWithoutBy, false)
+	result := validator.ValidateWithLint(`sum(rate(node_memory_free_bytes[5m]))`, cfg)
+
+	for _, w := range result.Warnings {
+		fmt.Println(w.Severity, w.RuleID)
+	}
+	// Output:
+	// warning rate-on-gauge
+}
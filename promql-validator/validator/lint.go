@@ -0,0 +1,344 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Severity 表示警告的严重程度
+type Severity string
+
+const (
+	// SeverityInfo 提示，查询可能符合预期，但值得确认
+	SeverityInfo Severity = "info"
+	// SeverityWarning 警告，查询很可能有问题
+	SeverityWarning Severity = "warning"
+	// SeverityError 错误，查询可以解析但一定有问题，例如引用了不存在的指标
+	SeverityError Severity = "error"
+)
+
+// 内置 lint 规则的 ID
+const (
+	RuleRateOnGauge                = "rate-on-gauge"
+	RuleHistogramQuantileWithoutLe = "histogram-quantile-without-le"
+	RuleRangeShorterThanScrape     = "range-shorter-than-scrape-interval"
+	RuleUnanchoredRegex            = "unanchored-regex"
+	RuleSumWithoutBy               = "sum-without-by"
+	RuleNaNComparison              = "nan-comparison"
+)
+
+// defaultScrapeInterval 默认的采集间隔
+const defaultScrapeInterval = 15 * time.Second
+
+// counterSuffixes 计数器类型指标的常见后缀
+var counterSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+// rangeFunctions 只适用于计数器的范围函数
+var rangeFunctions = map[string]struct{}{
+	"rate":     {},
+	"irate":    {},
+	"increase": {},
+}
+
+// defaultHighCardinalityLabels 默认认为高基数的标签
+var defaultHighCardinalityLabels = []string{
+	model.MetricNameLabel, "instance", "pod", "container", "path", "url", "uri", "handler", "endpoint", "id", "user_id",
+}
+
+// LintConfig lint 配置
+type LintConfig struct {
+	// ScrapeInterval 采集间隔，范围窗口小于该值时告警，默认 15s
+	ScrapeInterval time.Duration
+	// HighCardinalityLabels 检查前缀不固定的正则匹配的标签，为空时检查所有标签
+	HighCardinalityLabels []string
+	// Rules 规则开关，key 为规则 ID，未设置的规则默认启用
+	Rules map[string]bool
+}
+
+// DefaultLintConfig 返回默认的 lint 配置，启用所有规则
+func DefaultLintConfig() LintConfig {
+	return LintConfig{
+		ScrapeInterval:        defaultScrapeInterval,
+		HighCardinalityLabels: append([]string(nil), defaultHighCardinalityLabels...),
+	}
+}
+
+// Enabled 判断规则是否启用
+func (c LintConfig) Enabled(id string) bool {
+	enabled, ok := c.Rules[id]
+	return !ok || enabled
+}
+
+// WithRule 返回启用或禁用规则后的配置，不修改原配置
+func (c LintConfig) WithRule(id string, enabled bool) LintConfig {
+	rules := make(map[string]bool, len(c.Rules)+1)
+	for k, v := range c.Rules {
+		rules[k] = v
+	}
+	rules[id] = enabled
+	c.Rules = rules
+	return c
+}
+
+// LintRule 描述一条 lint 规则
+type LintRule struct {
+	ID          string
+	Severity    Severity
+	Description string
+	check       func(node parser.Node, path []parser.Node, cfg LintConfig) []Warning
+}
+
+// lintRules 内置的 lint 规则，同一节点按顺序执行
+var lintRules = []LintRule{
+	{
+		ID:          RuleRateOnGauge,
+		Severity:    SeverityWarning,
+		Description: "rate()、irate()、increase() 只适用于计数器，指标名没有 _total、_count、_sum、_bucket 后缀时可能是 gauge",
+		check:       checkRateOnGauge,
+	},
+	{
+		ID:          RuleHistogramQuantileWithoutLe,
+		Severity:    SeverityWarning,
+		Description: "histogram_quantile() 的聚合必须保留 le 标签",
+		check:       checkHistogramQuantileWithoutLe,
+	},
+	{
+		ID:          RuleRangeShorterThanScrape,
+		Severity:    SeverityWarning,
+		Description: "范围窗口小于采集间隔时窗口内可能没有样本",
+		check:       checkRangeShorterThanScrape,
+	},
+	{
+		ID:          RuleUnanchoredRegex,
+		Severity:    SeverityWarning,
+		Description: "高基数标签上以 .* 或 .+ 开头的正则匹配需要扫描所有标签值",
+		check:       checkUnanchoredRegex,
+	},
+	{
+		ID:          RuleSumWithoutBy,
+		Severity:    SeverityInfo,
+		Description: "sum 没有 by 或 without 时会丢弃所有标签",
+		check:       checkSumWithoutBy,
+	},
+	{
+		ID:          RuleNaNComparison,
+		Severity:    SeverityWarning,
+		Description: "与 NaN 比较的结果总是 false（!= 总是 true）",
+		check:       checkNaNComparison,
+	},
+}
+
+// LintRules 返回所有内置的 lint 规则
+func LintRules() []LintRule {
+	return append([]LintRule(nil), lintRules...)
+}
+
+// Lint 检查已解析的表达式中的常见反模式，按表达式遍历顺序返回警告
+func Lint(expr parser.Expr, cfg LintConfig) []Warning {
+	if cfg.ScrapeInterval <= 0 {
+		cfg.ScrapeInterval = defaultScrapeInterval
+	}
+	var enabled []LintRule
+	for _, rule := range lintRules {
+		if cfg.Enabled(rule.ID) {
+			enabled = append(enabled, rule)
+		}
+	}
+	warnings := make([]Warning, 0)
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		for _, rule := range enabled {
+			for _, w := range rule.check(node, path, cfg) {
+				w.RuleID = rule.ID
+				w.Severity = rule.Severity
+				warnings = append(warnings, w)
+			}
+		}
+		return nil
+	})
+	return warnings
+}
+
+// newWarning 创建位于 node 的警告，规则 ID 和严重程度由 Lint 填充
+func newWarning(node parser.Node, format string, args ...any) Warning {
+	pos := node.PositionRange()
+	return Warning{
+		Pos:     int(pos.Start),
+		End:     int(pos.End),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// checkRateOnGauge 检查 rate() 等函数是否作用于非计数器指标
+// 在 histogram_* 函数中的原生直方图指标没有后缀，不告警
+func checkRateOnGauge(node parser.Node, path []parser.Node, _ LintConfig) []Warning {
+	call, ok := node.(*parser.Call)
+	if !ok || call.Func == nil || len(call.Args) == 0 {
+		return nil
+	}
+	if _, ok := rangeFunctions[call.Func.Name]; !ok {
+		return nil
+	}
+	for _, parent := range path {
+		if c, ok := parent.(*parser.Call); ok && c.Func != nil && strings.HasPrefix(c.Func.Name, "histogram_") {
+			return nil
+		}
+	}
+	ms, ok := unwrapParens(call.Args[0]).(*parser.MatrixSelector)
+	if !ok {
+		return nil
+	}
+	vs, ok := ms.VectorSelector.(*parser.VectorSelector)
+	if !ok || vs.Name == "" || hasSuffix(vs.Name, counterSuffixes) {
+		return nil
+	}
+	return []Warning{newWarning(call, "%s() on %s, which does not look like a counter", call.Func.Name, vs.Name)}
+}
+
+// checkHistogramQuantileWithoutLe 检查 histogram_quantile() 内的聚合是否丢弃了 le 标签
+// 只检查经典直方图（指标名以 _bucket 结尾），原生直方图不需要 le
+func checkHistogramQuantileWithoutLe(node parser.Node, _ []parser.Node, _ LintConfig) []Warning {
+	call, ok := node.(*parser.Call)
+	if !ok || call.Func == nil || call.Func.Name != "histogram_quantile" || len(call.Args) < 2 {
+		return nil
+	}
+	agg, ok := unwrapParens(call.Args[1]).(*parser.AggregateExpr)
+	if !ok {
+		return nil
+	}
+	keepsLe := containsString(agg.Grouping, model.BucketLabel) != agg.Without
+	if keepsLe || !hasBucketSelector(agg.Expr) {
+		return nil
+	}
+	if agg.Without {
+		return []Warning{newWarning(agg, "histogram_quantile() over %s without (le) drops the le label", agg.Op)}
+	}
+	return []Warning{newWarning(agg, "histogram_quantile() over %s without le in by clause", agg.Op)}
+}
+
+// checkRangeShorterThanScrape 检查范围窗口是否小于采集间隔
+func checkRangeShorterThanScrape(node parser.Node, _ []parser.Node, cfg LintConfig) []Warning {
+	ms, ok := node.(*parser.MatrixSelector)
+	if !ok || ms.Range >= cfg.ScrapeInterval {
+		return nil
+	}
+	return []Warning{newWarning(ms, "range window %s is shorter than scrape interval %s",
+		model.Duration(ms.Range), model.Duration(cfg.ScrapeInterval))}
+}
+
+// checkUnanchoredRegex 检查高基数标签上以通配符开头的正则匹配
+// .* 和 .+ 本身分别表示任意值和标签存在，不告警
+func checkUnanchoredRegex(node parser.Node, _ []parser.Node, cfg LintConfig) []Warning {
+	vs, ok := node.(*parser.VectorSelector)
+	if !ok {
+		return nil
+	}
+	var warnings []Warning
+	for _, m := range vs.LabelMatchers {
+		if (m.Type != labels.MatchRegexp && m.Type != labels.MatchNotRegexp) || m.Value == ".*" || m.Value == ".+" {
+			continue
+		}
+		if !strings.HasPrefix(m.Value, ".*") && !strings.HasPrefix(m.Value, ".+") {
+			continue
+		}
+		if len(cfg.HighCardinalityLabels) > 0 && !containsString(cfg.HighCardinalityLabels, m.Name) {
+			continue
+		}
+		warnings = append(warnings, newWarning(vs, "regex matcher %s is not anchored to a prefix and scans all values of %s", m, m.Name))
+	}
+	return warnings
+}
+
+// checkSumWithoutBy 检查 sum 是否丢弃了所有标签
+func checkSumWithoutBy(node parser.Node, _ []parser.Node, _ LintConfig) []Warning {
+	agg, ok := node.(*parser.AggregateExpr)
+	if !ok || agg.Op != parser.SUM || agg.Without || len(agg.Grouping) > 0 {
+		return nil
+	}
+	return []Warning{newWarning(agg, "sum without by drops all labels")}
+}
+
+// checkNaNComparison 检查与 NaN 的比较
+func checkNaNComparison(node parser.Node, _ []parser.Node, _ LintConfig) []Warning {
+	bin, ok := node.(*parser.BinaryExpr)
+	if !ok || !bin.Op.IsComparisonOperator() {
+		return nil
+	}
+	if !isNaN(bin.LHS) && !isNaN(bin.RHS) {
+		return nil
+	}
+	result := "false"
+	if bin.Op == parser.NEQ {
+		result = "true"
+	}
+	return []Warning{newWarning(bin, "comparison %s NaN is always %s, use absent() or x != x instead", bin.Op, result)}
+}
+
+// unwrapParens 去掉表达式外层的括号
+func unwrapParens(expr parser.Expr) parser.Expr {
+	for {
+		switch e := expr.(type) {
+		case *parser.ParenExpr:
+			expr = e.Expr
+		case *parser.StepInvariantExpr:
+			expr = e.Expr
+		default:
+			return expr
+		}
+	}
+}
+
+// isNaN 判断表达式是否为 NaN 字面量
+func isNaN(expr parser.Expr) bool {
+	n, ok := unwrapParens(expr).(*parser.NumberLiteral)
+	return ok && math.IsNaN(n.Val)
+}
+
+// hasBucketSelector 判断表达式中是否有经典直方图的 _bucket 指标
+func hasBucketSelector(expr parser.Expr) bool {
+	found := false
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok && strings.HasSuffix(vs.Name, "_bucket") {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+func hasSuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
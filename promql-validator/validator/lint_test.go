@@ -0,0 +1,163 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ruleIDs 返回警告的规则 ID
+func ruleIDs(warnings []Warning) []string {
+	ids := make([]string, 0, len(warnings))
+	for _, w := range warnings {
+		ids = append(ids, w.RuleID)
+	}
+	return ids
+}
+
+// TestLint_Rules 测试每条 lint 规则
+func TestLint_Rules(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		// rate-on-gauge
+		{name: "rate 作用于计数器", query: `sum by (job) (rate(http_requests_total[5m]))`, expected: []string{}},
+		{name: "rate 作用于 gauge", query: `rate(node_memory_free_bytes[5m])`, expected: []string{RuleRateOnGauge}},
+		{name: "increase 作用于 gauge", query: `increase(process_open_fds[5m])`, expected: []string{RuleRateOnGauge}},
+		{name: "rate 作用于直方图的 count", query: `rate(http_request_duration_seconds_count[5m])`, expected: []string{}},
+		{name: "delta 作用于 gauge", query: `delta(node_memory_free_bytes[5m])`, expected: []string{}},
+
+		// histogram-quantile-without-le
+		{name: "histogram_quantile 保留 le", query: `histogram_quantile(0.9, sum by (le, job) (rate(http_request_duration_seconds_bucket[5m])))`, expected: []string{}},
+		{name: "histogram_quantile by 中没有 le", query: `histogram_quantile(0.9, sum by (job) (rate(http_request_duration_seconds_bucket[5m])))`, expected: []string{RuleHistogramQuantileWithoutLe}},
+		{name: "histogram_quantile without le", query: `histogram_quantile(0.9, sum without (le) (rate(http_request_duration_seconds_bucket[5m])))`, expected: []string{RuleHistogramQuantileWithoutLe}},
+		{name: "histogram_quantile without 其他标签", query: `histogram_quantile(0.9, sum without (instance) (rate(http_request_duration_seconds_bucket[5m])))`, expected: []string{}},
+		{name: "histogram_quantile 没有聚合", query: `histogram_quantile(0.9, rate(http_request_duration_seconds_bucket[5m]))`, expected: []string{}},
+		{name: "原生直方图不需要 le", query: `histogram_quantile(0.9, sum by (job) (rate(http_request_duration_seconds[5m])))`, expected: []string{}},
+
+		// range-shorter-than-scrape-interval
+		{name: "范围窗口小于采集间隔", query: `rate(http_requests_total[10s])`, expected: []string{RuleRangeShorterThanScrape}},
+		{name: "范围窗口等于采集间隔", query: `rate(http_requests_total[15s])`, expected: []string{}},
+		{name: "子查询中的范围窗口", query: `max_over_time(rate(http_requests_total[5s])[5m:1m])`, expected: []string{RuleRangeShorterThanScrape}},
+
+		// unanchored-regex
+		{name: "前缀固定的正则", query: `http_requests_total{path=~"/api/.*"}`, expected: []string{}},
+		{name: "前缀不固定的正则", query: `http_requests_total{path=~".*/users"}`, expected: []string{RuleUnanchoredRegex}},
+		{name: "前缀不固定的反向正则", query: `http_requests_total{instance!~".+:9100"}`, expected: []string{RuleUnanchoredRegex}},
+		{name: "指标名使用前缀不固定的正则", query: `{__name__=~".*_errors_total"}`, expected: []string{RuleUnanchoredRegex}},
+		{name: "低基数标签", query: `http_requests_total{job=~".*api"}`, expected: []string{}},
+		{name: "匹配任意值", query: `http_requests_total{path=~".*"}`, expected: []string{}},
+		{name: "标签存在", query: `http_requests_total{path=~".+"}`, expected: []string{}},
+
+		// sum-without-by
+		{name: "sum 没有 by", query: `sum(http_requests_total)`, expected: []string{RuleSumWithoutBy}},
+		{name: "sum without", query: `sum without (instance) (http_requests_total)`, expected: []string{}},
+		{name: "max 没有 by", query: `max(http_requests_total)`, expected: []string{}},
+
+		// nan-comparison
+		{name: "等于 NaN", query: `http_requests_total == NaN`, expected: []string{RuleNaNComparison}},
+		{name: "NaN 在左侧", query: `(NaN) < http_requests_total`, expected: []string{RuleNaNComparison}},
+		{name: "NaN 参与算术运算", query: `http_requests_total + NaN`, expected: []string{}},
+
+		// 多条规则
+		{name: "多条规则按遍历顺序", query: `sum(rate(node_memory_free_bytes[5s]))`, expected: []string{RuleSumWithoutBy, RuleRateOnGauge, RuleRangeShorterThanScrape}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Validate(tt.query)
+			require.True(t, result.Valid, "查询应该有效")
+			assert.Equal(t, tt.expected, ruleIDs(result.Warnings))
+		})
+	}
+}
+
+// TestLint_Warning 测试警告的位置、严重程度和消息
+func TestLint_Warning(t *testing.T) {
+	result := Validate(`sum(x) + rate(node_memory_free_bytes[5m])`)
+	require.Len(t, result.Warnings, 2)
+
+	sum := result.Warnings[0]
+	assert.Equal(t, RuleSumWithoutBy, sum.RuleID)
+	assert.Equal(t, SeverityInfo, sum.Severity)
+	assert.Equal(t, 0, sum.Pos)
+	assert.Equal(t, 6, sum.End)
+	assert.Equal(t, "sum without by drops all labels [sum-without-by]", sum.String())
+
+	rate := result.Warnings[1]
+	assert.Equal(t, RuleRateOnGauge, rate.RuleID)
+	assert.Equal(t, SeverityWarning, rate.Severity)
+	assert.Equal(t, 9, rate.Pos)
+	assert.Equal(t, 41, rate.End)
+	assert.Equal(t, "position 9: rate() on node_memory_free_bytes, which does not look like a counter [rate-on-gauge]", rate.String())
+}
+
+// TestLint_Config 测试规则开关和配置项
+func TestLint_Config(t *testing.T) {
+	query := `sum(rate(http_requests_total{job=~".*api"}[30s]))`
+
+	t.Run("默认配置", func(t *testing.T) {
+		result := ValidateWithLint(query, DefaultLintConfig())
+		assert.Equal(t, []string{RuleSumWithoutBy}, ruleIDs(result.Warnings))
+	})
+
+	t.Run("禁用规则", func(t *testing.T) {
+		cfg := DefaultLintConfig().WithRule(RuleSumWithoutBy, false)
+		result := ValidateWithLint(query, cfg)
+		assert.Empty(t, result.Warnings)
+		assert.True(t, cfg.WithRule(RuleSumWithoutBy, true).Enabled(RuleSumWithoutBy), "重新启用规则")
+		assert.True(t, DefaultLintConfig().Enabled(RuleSumWithoutBy), "不修改原配置")
+	})
+
+	t.Run("采集间隔", func(t *testing.T) {
+		cfg := DefaultLintConfig()
+		cfg.ScrapeInterval = time.Minute
+		result := ValidateWithLint(query, cfg)
+		assert.Equal(t, []string{RuleSumWithoutBy, RuleRangeShorterThanScrape}, ruleIDs(result.Warnings))
+		assert.Contains(t, result.Warnings[1].Message, "range window 30s is shorter than scrape interval 1m")
+	})
+
+	t.Run("检查所有标签", func(t *testing.T) {
+		cfg := DefaultLintConfig()
+		cfg.HighCardinalityLabels = nil
+		result := ValidateWithLint(query, cfg)
+		assert.Equal(t, []string{RuleSumWithoutBy, RuleUnanchoredRegex}, ruleIDs(result.Warnings))
+	})
+
+	t.Run("无效查询不执行 lint", func(t *testing.T) {
+		result := ValidateWithLint(`sum(`, DefaultLintConfig())
+		assert.False(t, result.Valid)
+		assert.Empty(t, result.Warnings)
+	})
+}
+
+// TestLintRules 测试内置规则的描述
+func TestLintRules(t *testing.T) {
+	rules := LintRules()
+	require.Len(t, rules, 6)
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		assert.NotEmpty(t, rule.Description, rule.ID)
+		assert.NotEmpty(t, rule.Severity, rule.ID)
+		assert.False(t, seen[rule.ID], "规则 ID 不应重复: %s", rule.ID)
+		seen[rule.ID] = true
+	}
+}
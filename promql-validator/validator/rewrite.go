@@ -0,0 +1,213 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// RewriteConfig 查询改写配置
+type RewriteConfig struct {
+	// Matchers 注入到每个选择器（包括范围选择器和子查询中的选择器）的标签匹配，
+	// 选择器中已有同名标签的匹配时覆盖，RejectOverride 为 true 时拒绝查询
+	Matchers []*labels.Matcher
+	// RejectOverride 选择器中已有与注入的匹配不同的同名标签匹配时返回 MatcherConflictError，
+	// 用于多租户网关强制租户标签；与注入的匹配完全相同时不视为冲突
+	RejectOverride bool
+	// RenameMetrics 指标重命名，key 为原指标名，只改写指标名和 __name__ 的等值匹配，不改写正则匹配
+	RenameMetrics map[string]string
+	// Pretty 使用 parser.Prettify 输出多行格式，否则输出单行
+	Pretty bool
+}
+
+// Validate 检查配置，不能注入 __name__ 的匹配，同一个标签只能注入一次，重命名的目标必须是合法的指标名
+func (c RewriteConfig) Validate() error {
+	seen := make(map[string]struct{}, len(c.Matchers))
+	for _, m := range c.Matchers {
+		if m == nil {
+			return errors.New("nil matcher")
+		}
+		if m.Name == model.MetricNameLabel {
+			return fmt.Errorf("cannot inject %s matcher, use RenameMetrics", model.MetricNameLabel)
+		}
+		if !model.LabelName(m.Name).IsValid() {
+			return fmt.Errorf("invalid label name %q", m.Name)
+		}
+		if _, ok := seen[m.Name]; ok {
+			return fmt.Errorf("duplicate matcher for label %q", m.Name)
+		}
+		seen[m.Name] = struct{}{}
+	}
+	for from, to := range c.RenameMetrics {
+		if !model.IsValidMetricName(model.LabelValue(to)) {
+			return fmt.Errorf("invalid metric name %q for %s", to, from)
+		}
+	}
+	return nil
+}
+
+// MatcherConflictError 查询中的标签匹配与强制注入的匹配冲突
+type MatcherConflictError struct {
+	// Pos 冲突的选择器在查询中的位置
+	Pos int
+	// Matcher 查询中的匹配
+	Matcher *labels.Matcher
+	// Enforced 强制注入的匹配
+	Enforced *labels.Matcher
+}
+
+func (e *MatcherConflictError) Error() string {
+	msg := fmt.Sprintf("matcher %s conflicts with enforced matcher %s", e.Matcher, e.Enforced)
+	if e.Pos <= 0 {
+		return msg
+	}
+	return fmt.Sprintf(positionFormat, e.Pos, msg)
+}
+
+// RewriteResult 查询改写结果
+type RewriteResult struct {
+	// Query 改写后的查询
+	Query string
+	// Expr 改写后的表达式
+	Expr parser.Expr
+	// Metrics 改写后查询中的指标名
+	Metrics []string
+	// Overridden 被覆盖的标签匹配，RejectOverride 为 false 时才可能不为空
+	Overridden []*labels.Matcher
+}
+
+// Rewrite 解析查询并按 cfg 改写，解析失败时返回的错误包含 ParseError
+func Rewrite(query string, cfg RewriteConfig) (*RewriteResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	normalizedQuery, parseErr := preprocessQuery(query)
+	if parseErr.Message != "" {
+		return nil, parseErr
+	}
+	expr, parseErrs := parseQuery(normalizedQuery)
+	if parseErrs != nil {
+		errs := make([]error, len(parseErrs))
+		for i, e := range parseErrs {
+			errs[i] = e
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	overridden, err := rewriteExpr(expr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	result := &RewriteResult{Expr: expr, Overridden: overridden}
+	if cfg.Pretty {
+		result.Query = parser.Prettify(expr)
+	} else {
+		result.Query = expr.String()
+	}
+	metadata := newValidationResult()
+	collectMetadata(expr, metadata)
+	result.Metrics = metadata.Metrics
+	return result, nil
+}
+
+// RewriteExpr 按 cfg 原地改写已解析的表达式
+func RewriteExpr(expr parser.Expr, cfg RewriteConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	_, err := rewriteExpr(expr, cfg)
+	return err
+}
+
+// rewriteExpr 改写每个向量选择器，返回被覆盖的标签匹配
+func rewriteExpr(expr parser.Expr, cfg RewriteConfig) ([]*labels.Matcher, error) {
+	var overridden []*labels.Matcher
+	err := inspectSelectors(expr, func(vs *parser.VectorSelector) error {
+		renameMetric(vs, cfg.RenameMetrics)
+		replaced, err := injectMatchers(vs, cfg.Matchers, cfg.RejectOverride)
+		overridden = append(overridden, replaced...)
+		return err
+	})
+	return overridden, err
+}
+
+// renameMetric 按 renames 改写选择器的指标名和 __name__ 的等值匹配
+func renameMetric(vs *parser.VectorSelector, renames map[string]string) {
+	if len(renames) == 0 {
+		return
+	}
+	if to, ok := renames[vs.Name]; ok && vs.Name != "" {
+		vs.Name = to
+	}
+	for i, m := range vs.LabelMatchers {
+		if m.Name != model.MetricNameLabel || m.Type != labels.MatchEqual {
+			continue
+		}
+		if to, ok := renames[m.Value]; ok {
+			vs.LabelMatchers[i] = labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, to)
+		}
+	}
+}
+
+// injectMatchers 向选择器注入标签匹配，返回被覆盖的匹配
+func injectMatchers(vs *parser.VectorSelector, inject []*labels.Matcher, reject bool) ([]*labels.Matcher, error) {
+	if len(inject) == 0 {
+		return nil, nil
+	}
+	enforced := make(map[string]*labels.Matcher, len(inject))
+	for _, m := range inject {
+		enforced[m.Name] = m
+	}
+	var overridden []*labels.Matcher
+	matchers := make([]*labels.Matcher, 0, len(vs.LabelMatchers)+len(inject))
+	for _, m := range vs.LabelMatchers {
+		e, ok := enforced[m.Name]
+		if !ok {
+			matchers = append(matchers, m)
+			continue
+		}
+		if m.Type == e.Type && m.Value == e.Value {
+			continue
+		}
+		if reject {
+			return nil, &MatcherConflictError{Pos: int(vs.PositionRange().Start), Matcher: m, Enforced: e}
+		}
+		overridden = append(overridden, m)
+	}
+	vs.LabelMatchers = append(matchers, inject...)
+	return overridden, nil
+}
+
+// selectorVisitor 对每个向量选择器调用的函数，返回错误时停止遍历
+type selectorVisitor func(vs *parser.VectorSelector) error
+
+func (f selectorVisitor) Visit(node parser.Node, _ []parser.Node) (parser.Visitor, error) {
+	if vs, ok := node.(*parser.VectorSelector); ok {
+		if err := f(vs); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// inspectSelectors 按表达式顺序访问每个向量选择器，范围选择器和子查询中的选择器也会访问
+func inspectSelectors(expr parser.Node, fn func(vs *parser.VectorSelector) error) error {
+	return parser.Walk(selectorVisitor(fn), expr, nil)
+}
@@ -0,0 +1,265 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRewrite 测试标签注入和指标重命名
+func TestRewrite(t *testing.T) {
+	tenant := labels.MustNewMatcher(labels.MatchEqual, "tenant", "a")
+	env := labels.MustNewMatcher(labels.MatchNotEqual, "env", "dev")
+
+	tests := []struct {
+		name       string
+		query      string
+		cfg        RewriteConfig
+		expected   string
+		metrics    []string
+		overridden []string
+	}{
+		{
+			name:     "没有改写",
+			query:    `  sum by (job) (rate(http_requests_total[5m]))  `,
+			expected: `sum by (job) (rate(http_requests_total[5m]))`,
+			metrics:  []string{"http_requests_total"},
+		},
+		{
+			name:     "注入瞬时选择器",
+			query:    `up`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}},
+			expected: `up{tenant="a"}`,
+			metrics:  []string{"up"},
+		},
+		{
+			name:     "注入范围选择器",
+			query:    `rate(http_requests_total{code="500"}[5m])`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}},
+			expected: `rate(http_requests_total{code="500",tenant="a"}[5m])`,
+			metrics:  []string{"http_requests_total"},
+		},
+		{
+			name:     "注入二元表达式两侧",
+			query:    `sum(rate(errors_total[5m])) / sum(rate(requests_total[5m]))`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}},
+			expected: `sum(rate(errors_total{tenant="a"}[5m])) / sum(rate(requests_total{tenant="a"}[5m]))`,
+			metrics:  []string{"errors_total", "requests_total"},
+		},
+		{
+			name:     "注入子查询、offset 和 @",
+			query:    `max_over_time(rate(x[5m] offset 1h)[1h:1m] @ 100)`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}},
+			expected: `max_over_time(rate(x{tenant="a"}[5m] offset 1h)[1h:1m] @ 100.000)`,
+			metrics:  []string{"x"},
+		},
+		{
+			name:     "注入没有指标名的选择器",
+			query:    `count({job="api"})`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}},
+			expected: `count({job="api",tenant="a"})`,
+			metrics:  []string{},
+		},
+		{
+			name:     "注入函数参数中的选择器",
+			query:    `label_replace(up, "host", "$1", "instance", "(.*):.*") or absent(up)`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}},
+			expected: `label_replace(up{tenant="a"}, "host", "$1", "instance", "(.*):.*") or absent(up{tenant="a"})`,
+			metrics:  []string{"up"},
+		},
+		{
+			name:     "注入多个匹配",
+			query:    `up`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant, env}},
+			expected: `up{env!="dev",tenant="a"}`,
+			metrics:  []string{"up"},
+		},
+		{
+			name:     "标量表达式不变",
+			query:    `time() - 1`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}},
+			expected: `time() - 1`,
+			metrics:  []string{},
+		},
+		{
+			name:       "覆盖已有的匹配",
+			query:      `up{tenant="b", job="api"} + up{tenant=~".*"}`,
+			cfg:        RewriteConfig{Matchers: []*labels.Matcher{tenant}},
+			expected:   `up{job="api",tenant="a"} + up{tenant="a"}`,
+			metrics:    []string{"up"},
+			overridden: []string{`tenant="b"`, `tenant=~".*"`},
+		},
+		{
+			name:     "相同的匹配不重复",
+			query:    `up{tenant="a"}`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}, RejectOverride: true},
+			expected: `up{tenant="a"}`,
+			metrics:  []string{"up"},
+		},
+		{
+			name:     "重命名指标",
+			query:    `rate(http_requests_total[5m]) / rate(http_requests_total[1h]) + up`,
+			cfg:      RewriteConfig{RenameMetrics: map[string]string{"http_requests_total": "http_server_requests_total"}},
+			expected: `rate(http_server_requests_total[5m]) / rate(http_server_requests_total[1h]) + up`,
+			metrics:  []string{"http_server_requests_total", "up"},
+		},
+		{
+			name:     "重命名 __name__ 的等值匹配",
+			query:    `{__name__="old_metric", job="a"}`,
+			cfg:      RewriteConfig{RenameMetrics: map[string]string{"old_metric": "new_metric"}},
+			expected: `{__name__="new_metric",job="a"}`,
+			metrics:  []string{},
+		},
+		{
+			name:     "不改写 __name__ 的正则匹配",
+			query:    `{__name__=~"old_metric|other"}`,
+			cfg:      RewriteConfig{RenameMetrics: map[string]string{"old_metric": "new_metric"}},
+			expected: `{__name__=~"old_metric|other"}`,
+			metrics:  []string{},
+		},
+		{
+			name:     "重命名并注入",
+			query:    `old_metric{tenant="a"}`,
+			cfg:      RewriteConfig{Matchers: []*labels.Matcher{tenant}, RenameMetrics: map[string]string{"old_metric": "new_metric"}, RejectOverride: true},
+			expected: `new_metric{tenant="a"}`,
+			metrics:  []string{"new_metric"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Rewrite(tt.query, tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.Query)
+			assert.Equal(t, tt.expected, result.Expr.String())
+			assert.Equal(t, tt.metrics, result.Metrics)
+			var overridden []string
+			for _, m := range result.Overridden {
+				overridden = append(overridden, m.String())
+			}
+			assert.Equal(t, tt.overridden, overridden)
+
+			// 改写结果可以重新解析，再次改写结果不变
+			again, err := Rewrite(result.Query, tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, result.Query, again.Query)
+		})
+	}
+}
+
+// TestRewrite_RejectOverride 测试拒绝覆盖强制注入的匹配
+func TestRewrite_RejectOverride(t *testing.T) {
+	cfg := RewriteConfig{
+		Matchers:       []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "tenant", "a")},
+		RejectOverride: true,
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		pos      int
+		expected string
+	}{
+		{name: "其他租户", query: `up{tenant="b"}`, pos: 0, expected: `matcher tenant="b" conflicts with enforced matcher tenant="a"`},
+		{name: "正则匹配", query: `sum(rate(x{tenant=~"a|b"}[5m]))`, pos: 9, expected: `position 9: matcher tenant=~"a|b" conflicts with enforced matcher tenant="a"`},
+		{name: "不等匹配", query: `up + up{tenant!="a"}`, pos: 5, expected: `position 5: matcher tenant!="a" conflicts with enforced matcher tenant="a"`},
+		{name: "子查询中的冲突", query: `max_over_time(up{tenant=""}[1h:])`, pos: 14, expected: `position 14: matcher tenant="" conflicts with enforced matcher tenant="a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Rewrite(tt.query, cfg)
+			assert.Nil(t, result)
+			var conflict *MatcherConflictError
+			require.ErrorAs(t, err, &conflict)
+			assert.Equal(t, tt.pos, conflict.Pos)
+			assert.Equal(t, "a", conflict.Enforced.Value)
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+// TestRewrite_Errors 测试配置错误和解析错误
+func TestRewrite_Errors(t *testing.T) {
+	tenant := labels.MustNewMatcher(labels.MatchEqual, "tenant", "a")
+
+	tests := []struct {
+		name     string
+		query    string
+		cfg      RewriteConfig
+		expected string
+	}{
+		{name: "注入 __name__", query: `up`, cfg: RewriteConfig{Matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "x")}}, expected: "cannot inject __name__ matcher"},
+		{name: "重复的标签", query: `up`, cfg: RewriteConfig{Matchers: []*labels.Matcher{tenant, tenant}}, expected: `duplicate matcher for label "tenant"`},
+		{name: "空匹配", query: `up`, cfg: RewriteConfig{Matchers: []*labels.Matcher{nil}}, expected: "nil matcher"},
+		{name: "非法标签名", query: `up`, cfg: RewriteConfig{Matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "", "x")}}, expected: `invalid label name ""`},
+		{name: "非法指标名", query: `up`, cfg: RewriteConfig{RenameMetrics: map[string]string{"up": ""}}, expected: `invalid metric name "" for up`},
+		{name: "空查询", query: `  `, expected: "empty query"},
+		{name: "语法错误", query: `sum(up`, expected: "unclosed left parenthesis"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Rewrite(tt.query, tt.cfg)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+
+	t.Run("解析错误包含 ParseError", func(t *testing.T) {
+		_, err := Rewrite(`rate(up)`, RewriteConfig{})
+		var parseErr ParseError
+		require.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, 5, parseErr.Pos)
+	})
+}
+
+// TestRewrite_Pretty 测试使用 Prettify 输出
+func TestRewrite_Pretty(t *testing.T) {
+	cfg := RewriteConfig{
+		Matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "tenant", "a")},
+		Pretty:   true,
+	}
+	result, err := Rewrite(`sum by (job) (rate(http_requests_total{code=~"5..",handler="/api/v1/query"}[5m])) / sum by (job) (rate(http_requests_total[5m]))`, cfg)
+	require.NoError(t, err)
+	expected := `  sum by (job) (rate(http_requests_total{code=~"5..",handler="/api/v1/query",tenant="a"}[5m]))
+/
+  sum by (job) (rate(http_requests_total{tenant="a"}[5m]))`
+	assert.Equal(t, expected, result.Query)
+
+	short, err := Rewrite(`up`, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, `up{tenant="a"}`, short.Query)
+}
+
+// TestRewriteExpr 测试原地改写已解析的表达式
+func TestRewriteExpr(t *testing.T) {
+	expr, err := parser.ParseExpr(`rate(x[5m])`)
+	require.NoError(t, err)
+	require.NoError(t, RewriteExpr(expr, RewriteConfig{Matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "tenant", "a")}}))
+	assert.Equal(t, `rate(x{tenant="a"}[5m])`, expr.String())
+
+	assert.Error(t, RewriteExpr(expr, RewriteConfig{Matchers: []*labels.Matcher{nil}}))
+
+	// 改写后的选择器仍然可以匹配序列
+	vs := expr.(*parser.Call).Args[0].(*parser.MatrixSelector).VectorSelector.(*parser.VectorSelector)
+	series := labels.FromStrings("__name__", "x", "tenant", "a")
+	for _, m := range vs.LabelMatchers {
+		assert.True(t, m.Matches(series.Get(m.Name)), m.String())
+	}
+}
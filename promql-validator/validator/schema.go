@@ -0,0 +1,276 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// 指标目录检查的规则 ID
+const (
+	RuleUnknownMetric = "unknown-metric"
+	RuleUnknownLabel  = "unknown-label"
+	RuleTypeMismatch  = "type-mismatch"
+)
+
+const (
+	// maxSuggestions 每个未知名称最多给出的建议数
+	maxSuggestions = 3
+	// maxSuggestionDistance 建议名称的最大编辑距离
+	maxSuggestionDistance = 3
+)
+
+// instantCounterFunctions 可以直接作用于计数器瞬时向量的函数
+var instantCounterFunctions = map[string]struct{}{
+	"absent":    {},
+	"timestamp": {},
+}
+
+// instantCounterAggregations 可以直接作用于计数器瞬时向量的聚合
+var instantCounterAggregations = map[parser.ItemType]struct{}{
+	parser.COUNT:        {},
+	parser.GROUP:        {},
+	parser.COUNT_VALUES: {},
+}
+
+// counterRangeFunctions 适用于计数器的范围函数
+var counterRangeFunctions = map[string]struct{}{
+	"rate":     {},
+	"irate":    {},
+	"increase": {},
+	"resets":   {},
+}
+
+// ValidateWithSchema 校验查询并执行默认的 lint，再按指标目录检查未知的指标、未知的标签和类型误用，
+// 结果写入 Warnings，未知的指标和标签为 error 级别
+func ValidateWithSchema(query string, catalog *Catalog) *ValidationResult {
+	return ValidateWith(query, DefaultLintConfig(), SchemaCheck(catalog))
+}
+
+// SchemaCheck 返回按指标目录检查的 Check，用于 ValidateWith
+func SchemaCheck(catalog *Catalog) Check {
+	return func(expr parser.Expr) []Warning {
+		return CheckSchema(expr, catalog)
+	}
+}
+
+// CheckSchema 按指标目录检查已解析的表达式，按表达式遍历顺序返回警告
+func CheckSchema(expr parser.Expr, catalog *Catalog) []Warning {
+	warnings := make([]Warning, 0)
+	if catalog == nil {
+		return warnings
+	}
+	labelNames := catalog.LabelNames()
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		schema, known := catalog.Metric(vs.Name)
+		if vs.Name != "" && !known {
+			w := newSchemaWarning(vs, RuleUnknownMetric, SeverityError, suggest(vs.Name, catalog.MetricNames()),
+				"unknown metric %q", vs.Name)
+			warnings = append(warnings, w)
+		}
+		warnings = append(warnings, checkLabels(vs, schema, known, catalog, labelNames)...)
+		if known {
+			if w, ok := checkType(vs, schema, path); ok {
+				warnings = append(warnings, w)
+			}
+		}
+		return nil
+	})
+	return warnings
+}
+
+// checkLabels 检查选择器中的标签是否存在
+// 指标有标签列表时按指标的标签和 Catalog.Labels 检查，否则按目录中所有的标签检查
+func checkLabels(vs *parser.VectorSelector, schema MetricSchema, known bool, catalog *Catalog, labelNames []string) []Warning {
+	allowed := labelNames
+	if known && len(schema.Labels) > 0 {
+		allowed = mergeLabels(schema.Labels, catalog.Labels)
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	var warnings []Warning
+	for _, m := range vs.LabelMatchers {
+		if m.Name == model.MetricNameLabel || containsString(allowed, m.Name) {
+			continue
+		}
+		msg := fmt.Sprintf("unknown label %q", m.Name)
+		if known && len(schema.Labels) > 0 {
+			msg = fmt.Sprintf("unknown label %q for metric %s", m.Name, schema.Name)
+		}
+		warnings = append(warnings, newSchemaWarning(vs, RuleUnknownLabel, SeverityError, suggest(m.Name, allowed), "%s", msg))
+	}
+	return warnings
+}
+
+// checkType 检查计数器是否没有使用 rate()，gauge 是否使用了 rate()
+func checkType(vs *parser.VectorSelector, schema MetricSchema, path []parser.Node) (Warning, bool) {
+	consumer, fn := selectorConsumer(path)
+	switch {
+	case isCounter(schema):
+		switch c := consumer.(type) {
+		case nil:
+			return Warning{}, false
+		case *parser.MatrixSelector, *parser.SubqueryExpr:
+			if fn == nil {
+				return Warning{}, false
+			}
+			if _, ok := counterRangeFunctions[fn.Func.Name]; ok {
+				return Warning{}, false
+			}
+			return newSchemaWarning(vs, RuleTypeMismatch, SeverityWarning, nil,
+				"counter %s used with %s(), use rate() or increase()", schema.Name, fn.Func.Name), true
+		case *parser.Call:
+			if _, ok := instantCounterFunctions[c.Func.Name]; ok {
+				return Warning{}, false
+			}
+		case *parser.AggregateExpr:
+			if _, ok := instantCounterAggregations[c.Op]; ok {
+				return Warning{}, false
+			}
+		}
+		return newSchemaWarning(vs, RuleTypeMismatch, SeverityWarning, nil,
+			"counter %s used without rate() or increase()", schema.Name), true
+	case schema.Type == model.MetricTypeGauge:
+		if _, ok := consumer.(*parser.MatrixSelector); !ok || fn == nil {
+			return Warning{}, false
+		}
+		if _, ok := counterRangeFunctions[fn.Func.Name]; !ok {
+			return Warning{}, false
+		}
+		return newSchemaWarning(vs, RuleTypeMismatch, SeverityWarning, nil,
+			"gauge %s used with %s(), use deriv() or delta()", schema.Name, fn.Func.Name), true
+	}
+	return Warning{}, false
+}
+
+// selectorConsumer 返回直接使用选择器的节点（跳过括号），为范围选择器或子查询时同时返回使用它的函数
+func selectorConsumer(path []parser.Node) (parser.Node, *parser.Call) {
+	i := len(path) - 1
+	next := func() parser.Node {
+		for ; i >= 0; i-- {
+			switch path[i].(type) {
+			case *parser.ParenExpr, *parser.StepInvariantExpr, parser.Expressions:
+				continue
+			}
+			node := path[i]
+			i--
+			return node
+		}
+		return nil
+	}
+	consumer := next()
+	switch consumer.(type) {
+	case *parser.MatrixSelector, *parser.SubqueryExpr:
+		if fn, ok := next().(*parser.Call); ok {
+			return consumer, fn
+		}
+	}
+	return consumer, nil
+}
+
+// isCounter 判断指标是否为计数器，经典直方图和摘要的 _bucket、_sum、_count 序列也是计数器
+func isCounter(schema MetricSchema) bool {
+	switch schema.Type {
+	case model.MetricTypeCounter:
+		return true
+	case model.MetricTypeHistogram:
+		return hasSuffix(schema.Name, []string{"_bucket", "_sum", "_count"})
+	case model.MetricTypeSummary:
+		return hasSuffix(schema.Name, []string{"_sum", "_count"})
+	}
+	return false
+}
+
+// newSchemaWarning 创建指标目录检查的警告，有建议时在消息后追加 did you mean
+func newSchemaWarning(node parser.Node, ruleID string, severity Severity, suggestions []string, format string, args ...any) Warning {
+	w := newWarning(node, format, args...)
+	w.RuleID = ruleID
+	w.Severity = severity
+	if len(suggestions) > 0 {
+		w.Suggestions = suggestions
+		w.Message += fmt.Sprintf(", did you mean %s?", quoteJoin(suggestions))
+	}
+	return w
+}
+
+// suggest 按编辑距离返回与 name 最接近的候选，距离相同时按字母排序
+func suggest(name string, candidates []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	// 短名称只接受较小的编辑距离，避免给出无关的建议
+	limit := min(maxSuggestionDistance, (len(name)+1)/2)
+	var matches []candidate
+	for _, c := range candidates {
+		if d := levenshtein(name, c); d <= limit {
+			matches = append(matches, candidate{name: c, distance: d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+	res := make([]string, 0, len(matches))
+	for _, m := range matches {
+		res = append(res, m.name)
+	}
+	return res
+}
+
+// levenshtein 计算两个字符串的编辑距离
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func quoteJoin(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, " or ")
+}
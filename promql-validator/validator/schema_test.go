@@ -0,0 +1,275 @@
+// Copyright 2025 The Prometheus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCatalogYAML = `
+labels: [job, instance]
+metrics:
+  - name: http_requests_total
+    type: counter
+    labels: [method, code]
+  - name: node_memory_free_bytes
+    type: gauge
+  - name: http_request_duration_seconds_bucket
+    type: histogram
+    labels: [le, handler]
+  - name: up
+    type: gauge
+`
+
+// schemaIssues 返回指标目录检查产生的警告，格式为 规则ID: 消息
+func schemaIssues(warnings []Warning) []string {
+	res := make([]string, 0)
+	for _, w := range warnings {
+		switch w.RuleID {
+		case RuleUnknownMetric, RuleUnknownLabel, RuleTypeMismatch:
+			res = append(res, w.RuleID+": "+w.Message)
+		}
+	}
+	return res
+}
+
+// TestValidateWithSchema 测试按指标目录检查指标、标签和类型
+func TestValidateWithSchema(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(testCatalogYAML))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{name: "指标和标签都存在", query: `sum by (job) (rate(http_requests_total{method="GET", job="api"}[5m]))`, expected: []string{}},
+		{name: "未知指标给出建议", query: `rate(http_request_total[5m])`, expected: []string{`unknown-metric: unknown metric "http_request_total", did you mean "http_requests_total"?`}},
+		{name: "未知指标没有相近的候选", query: `foo`, expected: []string{`unknown-metric: unknown metric "foo"`}},
+		{name: "指标的未知标签", query: `rate(http_requests_total{methd="GET"}[5m])`, expected: []string{`unknown-label: unknown label "methd" for metric http_requests_total, did you mean "method"?`}},
+		{name: "公共标签", query: `up{instance="a:9100"}`, expected: []string{}},
+		{name: "没有指标名时按所有标签检查", query: `{__name__="up", handlr="x"}`, expected: []string{`unknown-label: unknown label "handlr", did you mean "handler"?`}},
+		{name: "计数器没有使用 rate", query: `http_requests_total > 100`, expected: []string{"type-mismatch: counter http_requests_total used without rate() or increase()"}},
+		{name: "计数器使用 delta", query: `delta(http_requests_total[5m])`, expected: []string{"type-mismatch: counter http_requests_total used with delta(), use rate() or increase()"}},
+		{name: "子查询中的计数器", query: `max_over_time(rate(http_requests_total[5m])[1h:1m])`, expected: []string{}},
+		{name: "计数器在括号中", query: `rate((http_requests_total)[5m:1m])`, expected: []string{}},
+		{name: "计数器用于 absent", query: `absent(http_requests_total{job="api"})`, expected: []string{}},
+		{name: "计数器用于 count", query: `count(http_requests_total)`, expected: []string{}},
+		{name: "直方图的 bucket 是计数器", query: `histogram_quantile(0.9, sum by (le) (rate(http_request_duration_seconds_bucket[5m])))`, expected: []string{}},
+		{name: "gauge 使用 rate", query: `rate(node_memory_free_bytes[5m])`, expected: []string{"type-mismatch: gauge node_memory_free_bytes used with rate(), use deriv() or delta()"}},
+		{name: "gauge 使用 deriv", query: `deriv(node_memory_free_bytes[5m])`, expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateWithSchema(tt.query, catalog)
+			require.True(t, result.Valid, "查询应该有效")
+			assert.Equal(t, tt.expected, schemaIssues(result.Warnings))
+		})
+	}
+}
+
+// TestValidateWithSchema_Warning 测试警告的严重程度、位置和建议
+func TestValidateWithSchema_Warning(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(testCatalogYAML))
+	require.NoError(t, err)
+
+	result := ValidateWithSchema(`up + http_request_total{jbo="x"}`, catalog)
+	require.Len(t, result.Warnings, 2)
+
+	metric := result.Warnings[0]
+	assert.Equal(t, RuleUnknownMetric, metric.RuleID)
+	assert.Equal(t, SeverityError, metric.Severity)
+	assert.Equal(t, 5, metric.Pos)
+	assert.Equal(t, []string{"http_requests_total"}, metric.Suggestions)
+
+	label := result.Warnings[1]
+	assert.Equal(t, RuleUnknownLabel, label.RuleID)
+	assert.Equal(t, []string{"job"}, label.Suggestions)
+
+	t.Run("无效查询不检查", func(t *testing.T) {
+		result := ValidateWithSchema(`sum(`, catalog)
+		assert.False(t, result.Valid)
+		assert.Empty(t, result.Warnings)
+	})
+}
+
+// TestSuggest 测试按编辑距离给出建议
+func TestSuggest(t *testing.T) {
+	candidates := []string{"http_requests_total", "http_request_duration_seconds", "node_cpu", "node_cpus", "up"}
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "少一个字符", input: "http_request_total", expected: []string{"http_requests_total"}},
+		{name: "多个候选按距离排序", input: "node_cp", expected: []string{"node_cpu", "node_cpus"}},
+		{name: "短名称不给出距离过大的建议", input: "ip", expected: []string{"up"}},
+		{name: "没有候选", input: "node_cpu_seconds_total", expected: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, suggest(tt.input, candidates))
+		})
+	}
+	assert.Equal(t, 3, levenshtein("kitten", "sitting"))
+	assert.Equal(t, 2, levenshtein("标签", ""))
+}
+
+// TestParseCatalog 测试解析 YAML 和 JSON 格式的指标目录
+func TestParseCatalog(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		catalog, err := ParseCatalog([]byte(`{"labels":["job"],"metrics":[{"name":"up","type":"gauge"},{"name":"up","labels":["instance"]}]}`))
+		require.NoError(t, err)
+		require.Len(t, catalog.Metrics, 1, "同名指标合并")
+		m, ok := catalog.Metric("up")
+		require.True(t, ok)
+		assert.Equal(t, model.MetricTypeGauge, m.Type)
+		assert.Equal(t, []string{"instance"}, m.Labels)
+		assert.Equal(t, []string{"instance", "job"}, catalog.LabelNames())
+	})
+
+	t.Run("未知字段", func(t *testing.T) {
+		_, err := ParseCatalog([]byte(`metricz: []`))
+		assert.ErrorContains(t, err, "parse catalog")
+	})
+
+	t.Run("指标没有名称", func(t *testing.T) {
+		_, err := ParseCatalog([]byte(`metrics: [{type: gauge}]`))
+		assert.ErrorContains(t, err, "metric 0 has no name")
+	})
+
+	t.Run("从文件加载", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "catalog.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(testCatalogYAML), 0o600))
+		catalog, err := LoadCatalog(path)
+		require.NoError(t, err)
+		assert.Len(t, catalog.Metrics, 4)
+	})
+}
+
+// TestCatalogMetricConcurrent 测试并发查询指标目录，配合 -race 检查查询是否只读
+func TestCatalogMetricConcurrent(t *testing.T) {
+	catalogs := map[string]*Catalog{
+		"构造函数创建": NewCatalog(nil, MetricSchema{Name: "up"}, MetricSchema{Name: "http_requests_total"}),
+		"直接创建":   {Metrics: []MetricSchema{{Name: "up"}, {Name: "http_requests_total"}}},
+	}
+	for name, catalog := range catalogs {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, ok := catalog.Metric("up")
+					assert.True(t, ok)
+					_, ok = catalog.Metric("missing")
+					assert.False(t, ok)
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// TestParseCatalogFromAPI 测试从 Prometheus API 的响应构建指标目录
+func TestParseCatalogFromAPI(t *testing.T) {
+	metadata := `{"status":"success","data":{
+		"http_requests":[{"type":"counter","help":"Total requests.","unit":""}],
+		"http_request_duration_seconds":[{"type":"histogram","help":"Latency.","unit":"seconds"}],
+		"rpc_duration_seconds":[{"type":"summary","help":"RPC latency.","unit":""}],
+		"up":[{"type":"gauge","help":"","unit":""}]
+	}}`
+	labels := `{"status":"success","data":["__name__","instance","job"]}`
+
+	catalog, err := ParseCatalogFromAPI([]byte(metadata), []byte(labels))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance", "job"}, catalog.Labels)
+	assert.Equal(t, []string{
+		"http_request_duration_seconds",
+		"http_request_duration_seconds_bucket",
+		"http_request_duration_seconds_count",
+		"http_request_duration_seconds_sum",
+		"http_requests",
+		"http_requests_total",
+		"rpc_duration_seconds",
+		"rpc_duration_seconds_count",
+		"rpc_duration_seconds_sum",
+		"up",
+	}, catalog.MetricNames())
+
+	bucket, _ := catalog.Metric("http_request_duration_seconds_bucket")
+	assert.Equal(t, []string{"le"}, bucket.Labels)
+	summary, _ := catalog.Metric("rpc_duration_seconds")
+	assert.Equal(t, []string{"quantile"}, summary.Labels)
+
+	result := ValidateWithSchema(`rate(http_requests_total{job="api"}[5m]) / rate(rpc_duration_seconds_count{job="api"}[5m])`, catalog)
+	assert.Empty(t, schemaIssues(result.Warnings))
+
+	_, err = ParseCatalogFromAPI([]byte(`{"status":"error","error":"unavailable"}`), nil)
+	assert.ErrorContains(t, err, "unavailable")
+	_, err = ParseCatalogFromAPI([]byte(metadata), []byte(`{`))
+	assert.ErrorContains(t, err, "parse labels response")
+}
+
+// TestParseCatalogFromExposition 测试从采集结果构建指标目录
+func TestParseCatalogFromExposition(t *testing.T) {
+	exposition := `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",code="200"} 10
+http_requests_total{method="POST",code="500",path="/api"} 1
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{handler="/",le="0.1"} 1
+http_request_duration_seconds_bucket{handler="/",le="+Inf"} 2
+http_request_duration_seconds_sum{handler="/"} 0.3
+http_request_duration_seconds_count{handler="/"} 2
+# TYPE process_open_fds gauge
+process_open_fds 12
+`
+	catalog, err := ParseCatalogFromExposition(strings.NewReader(exposition))
+	require.NoError(t, err)
+
+	counter, ok := catalog.Metric("http_requests_total")
+	require.True(t, ok)
+	assert.Equal(t, model.MetricTypeCounter, counter.Type)
+	assert.Equal(t, "Total requests.", counter.Help)
+	assert.Equal(t, []string{"code", "method", "path"}, counter.Labels)
+
+	bucket, ok := catalog.Metric("http_request_duration_seconds_bucket")
+	require.True(t, ok)
+	assert.Equal(t, []string{"handler", "le"}, bucket.Labels)
+	count, ok := catalog.Metric("http_request_duration_seconds_count")
+	require.True(t, ok)
+	assert.Equal(t, []string{"handler"}, count.Labels)
+
+	result := ValidateWithSchema(`rate(http_requests_total{status="500"}[5m])`, catalog)
+	assert.Equal(t, []string{`unknown-label: unknown label "status" for metric http_requests_total`}, schemaIssues(result.Warnings))
+
+	path := filepath.Join(t.TempDir(), "metrics.txt")
+	require.NoError(t, os.WriteFile(path, []byte(exposition), 0o600))
+	_, err = LoadCatalogFromExposition(path)
+	assert.NoError(t, err)
+
+	_, err = ParseCatalogFromExposition(strings.NewReader("# TYPE x counter\nx{ 1\n"))
+	assert.ErrorContains(t, err, "parse exposition")
+}
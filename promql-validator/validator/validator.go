@@ -80,13 +80,26 @@ func newParseErrorWithoutPos(message string) ParseError {
 	}
 }
 
-// Warning 表示非致命的警告信息
+// Warning 表示非致命的警告信息，lint 产生的警告包含规则 ID、严重程度和位置
 type Warning struct {
-	Message string
+	Pos      int
+	End      int
+	RuleID   string
+	Severity Severity
+	Message  string
+	// Suggestions 未知名称的相近候选
+	Suggestions []string
 }
 
 func (w Warning) String() string {
-	return w.Message
+	msg := w.Message
+	if w.RuleID != "" {
+		msg = fmt.Sprintf("%s [%s]", msg, w.RuleID)
+	}
+	if w.Pos <= 0 {
+		return msg
+	}
+	return fmt.Sprintf(positionFormat, w.Pos, msg)
 }
 
 // ValidationResult 表示 PromQL 校验结果
@@ -202,8 +215,21 @@ func (r *ValidationResult) WarningCount() int {
 	return len(r.Warnings)
 }
 
-// Validate 检查 PromQL 查询在语法和语义上是否正确
+// Validate 检查 PromQL 查询在语法和语义上是否正确，并使用默认配置执行 lint
 func Validate(query string) *ValidationResult {
+	return ValidateWithLint(query, DefaultLintConfig())
+}
+
+// ValidateWithLint 检查 PromQL 查询，并按 cfg 执行 lint，lint 的结果写入 Warnings
+func ValidateWithLint(query string, cfg LintConfig) *ValidationResult {
+	return ValidateWith(query, cfg)
+}
+
+// Check 对已解析的表达式执行的额外检查，例如 SchemaCheck、CostCheck
+type Check func(expr parser.Expr) []Warning
+
+// ValidateWith 检查 PromQL 查询，按 cfg 执行 lint，再按顺序执行 checks，所有警告写入 Warnings
+func ValidateWith(query string, cfg LintConfig, checks ...Check) *ValidationResult {
 	result := newValidationResult()
 
 	// 1. 预处理和基础验证
@@ -220,8 +246,17 @@ func Validate(query string) *ValidationResult {
 		return result
 	}
 
-	// 3. 收集元数据并返回
-	return finalizeResult(expr, result)
+	// 3. 收集元数据，执行 lint 和额外检查
+	result = finalizeResult(expr, result)
+	for _, w := range Lint(expr, cfg) {
+		result.addWarning(w)
+	}
+	for _, check := range checks {
+		for _, w := range check(expr) {
+			result.addWarning(w)
+		}
+	}
+	return result
 }
 
 // preprocessQuery 预处理查询字符串